@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"server/pkg/seedtest"
+)
+
+func main() {
+	flags := flag.NewFlagSet("fixtures", flag.ExitOnError)
+	dir := flags.String("o", "pkg/seedtest/testdata/golden", "directory to write the golden files to")
+	seed := flags.Int64("seed", seedtest.DefaultSeed, "seed of the price generator")
+	verbose := flags.Bool("v", false, "show the service log while generating")
+	flags.Parse(os.Args[1:])
+
+	// The service logs every candle it generates
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	fixtures, err := seedtest.NewFixtures(*seed)
+	if err != nil {
+		logger.Fatal("Error generating fixtures:", err)
+	}
+	if err := fixtures.WriteGolden(*dir); err != nil {
+		logger.Fatal("Error writing golden files:", err)
+	}
+	logger.Printf("Wrote golden files for seed %d to %s", *seed, *dir)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"server/internal/config"
+	"server/internal/loadtest"
+	"server/internal/models"
+)
+
+func main() {
+	var opts loadtest.Options
+	var timeFrame string
+	var broadcastInterval time.Duration
+	var transport string
+
+	flags := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	flags.StringVar(&opts.BaseURL, "url", "", "server to test, e.g. http://localhost:8080 (default: start an in-process server)")
+	flags.IntVar(&opts.Clients, "clients", 100, "number of WebSocket clients")
+	flags.IntVar(&opts.Pollers, "pollers", 10, "number of REST clients polling the history")
+	flags.DurationVar(&opts.Duration, "duration", 30*time.Second, "how long to generate load")
+	flags.DurationVar(&opts.PollInterval, "poll-interval", time.Second, "pause between requests of a single poller")
+	flags.BoolVar(&opts.Reconnect, "reconnect", false, "reconnect clients the server disconnects")
+	flags.StringVar(&timeFrame, "timeframe", string(models.TimeFrame1Min), "timeframe to subscribe to and request")
+	flags.DurationVar(&broadcastInterval, "broadcast-interval", time.Second, "broadcast interval of the in-process server")
+	flags.StringVar(&transport, "transport", config.TransportGorilla, "WebSocket transport of the in-process server, gorilla or epoll")
+	flags.Parse(os.Args[1:])
+
+	opts.TimeFrame = models.TimeFrame(timeFrame)
+
+	if opts.BaseURL == "" {
+		cfg := config.Default()
+		cfg.Simulation.BroadcastInterval = broadcastInterval
+		cfg.Server.WebSocket.Transport = transport
+
+		server, err := loadtest.StartServer(cfg)
+		if err != nil {
+			log.Fatal("Error starting in-process server:", err)
+		}
+		defer server.Close()
+		opts.BaseURL = server.URL
+	}
+
+	log.Printf("Running load test against %s: %d clients, %d pollers for %s",
+		opts.BaseURL, opts.Clients, opts.Pollers, opts.Duration)
+
+	report, err := loadtest.Run(opts)
+	if err != nil {
+		log.Fatal("Error running load test:", err)
+	}
+	report.Print(os.Stdout)
+}
@@ -1,81 +1,203 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log"
-	"math/rand"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"server/internal/api"
+	"server/internal/audit"
+	"server/internal/cli"
+	"server/internal/config"
 	"server/internal/service"
+	"server/internal/version"
 
-	"github.com/gorilla/handlers"
-	"github.com/gorilla/mux"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 func main() {
-	// Seed the random number generator
-	rand.Seed(time.Now().UnixNano())
+	commands := append([]cli.Command{{
+		Name:    "serve",
+		Summary: "Run the server, the default without a command",
+		Run:     runServer,
+	}}, cli.DataCommands(serveConfig)...)
+	commands = append(commands, cli.BenchCommand())
+	os.Exit(cli.Run(commands, os.Args[1:]))
+}
 
-	// Create and initialize price service
-	priceService := service.NewPriceService()
+// runServer serves the API until it fails. Flags and the configuration file are the
+// ones of config.Load.
+func runServer(args []string) error {
+	// Load configuration from file, environment and flags
+	cfg, err := config.Load(args)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	return serveConfig(cfg, nil)
+}
+
+// serveConfig serves the API with a loaded configuration until it fails, calling onReady,
+// if not nil, once the price data is ready
+func serveConfig(cfg *config.Config, onReady func(*service.PriceService) error) error {
+	log.Printf("Seedventure server %s", version.Get())
 
-	// Try to load historical data from files
-	if err := priceService.LoadAllTimeFrames(); err != nil {
-		log.Println("Generating new historical data:", err)
+	configStore := config.NewStore(cfg)
 
-		// Generate 1 day of historical data
-		priceService.Initialize(1)
+	// Create and initialize price service
+	priceService := service.NewPriceService(cfg)
+	configStore.OnReload(priceService.ApplyConfig)
 
-		// Save the generated data
-		priceService.SaveAllTimeFrames()
+	router, err := api.NewRouter(configStore, priceService)
+	if err != nil {
+		return err
 	}
+	auditLog := router.AuditLog
+
+	// Configured namespaces and symbols created under /admin/symbols are served under /ns/<name>
+	namespaces, err := api.NewNamespaces(configStore, priceService)
+	if err != nil {
+		return err
+	}
+	if err := router.MountNamespaces(namespaces, configStore); err != nil {
+		return err
+	}
+	handler := namespaces.Handler(router.Handler)
+
+	// Reload configuration on SIGHUP
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			status := http.StatusOK
+			if _, err := configStore.Reload(); err != nil {
+				log.Println("Error reloading configuration:", err)
+				status = http.StatusBadRequest
+			}
 
-	// Set up router
-	r := mux.NewRouter()
+			entry := audit.Entry{
+				Timestamp: time.Now().UnixMilli(),
+				Actor:     "signal",
+				Action:    "SIGHUP config reload",
+				Status:    status,
+			}
+			if err := auditLog.Record(entry); err != nil {
+				log.Println("Error recording audit entry:", err)
+			}
+		}
+	}()
 
-	// Create a handler with the price service
-	priceHandler := api.NewPriceHandler(priceService)
+	// Start server, so clients get 503 instead of connection errors while data loads
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           handler,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
 
-	// Define routes with timeframe support
-	r.HandleFunc("/api/prices/history", priceHandler.HandleHistoricalData).Methods("GET")
-	r.HandleFunc("/api/prices/timeframes", priceHandler.HandleAvailableTimeframes).Methods("GET")
-	r.HandleFunc("/api/prices/live", priceHandler.HandleWebsocket)
-	r.HandleFunc("/api/prices/live/{timeframe}", priceHandler.HandleWebsocketSubscribe)
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on port %d\n", cfg.Server.Port)
+		serverErr <- serve(server, cfg)
+	}()
 
-	// Set up CORS
-	corsMiddleware := handlers.CORS(
-		handlers.AllowedOrigins([]string{"*"}),
-		handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "OPTIONS"}),
-		handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"}),
-	)
+	// Load historical data from files, or generate and save 1 day of it
+	priceService.LoadOrInitialize(1)
 
 	// Start a new candle
 	priceService.StartNewCandle()
 
-	// Update current candle every second, create new one every minute
-	go func() {
-		updateTicker := time.NewTicker(time.Second)
-		candleTicker := time.NewTicker(time.Minute)
-		defer updateTicker.Stop()
-		defer candleTicker.Stop()
-
-		for {
-			select {
-			case <-updateTicker.C:
-				priceService.UpdateCurrentCandle()
-			case <-candleTicker.C:
-				priceService.FinalizeCurrentCandle()
-				priceService.StartNewCandle()
+	// Update current candle every broadcast interval, create new one every minute
+	go priceService.Run()
+
+	priceService.MarkReady()
+	log.Println("Price data ready")
+
+	namespaces.Start()
+
+	if onReady != nil {
+		if err := onReady(priceService); err != nil {
+			return err
+		}
+	}
+
+	if err := <-serverErr; err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+	return nil
+}
+
+// serve starts the server with plain HTTP, static TLS certificates or autocert depending on the configuration
+func serve(server *http.Server, cfg *config.Config) error {
+	tlsConfig := cfg.Server.TLS
+
+	if tlsConfig.Autocert.Enabled {
+		certManager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(tlsConfig.Autocert.Hosts...),
+			Cache:      autocert.DirCache(tlsConfig.Autocert.CacheDir),
+			Email:      tlsConfig.Autocert.Email,
+		}
+		server.TLSConfig = certManager.TLSConfig()
+		if err := requestClientCerts(server.TLSConfig, cfg.Admin.ClientCAFile); err != nil {
+			return err
+		}
+
+		// Answer ACME HTTP-01 challenges and redirect everything else to HTTPS
+		challengeServer := &http.Server{
+			Addr:              fmt.Sprintf(":%d", tlsConfig.Autocert.HTTPPort),
+			Handler:           certManager.HTTPHandler(nil),
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			ReadTimeout:       cfg.Server.ReadTimeout,
+			WriteTimeout:      cfg.Server.WriteTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+		}
+		go func() {
+			if err := challengeServer.ListenAndServe(); err != nil {
+				log.Println("Error serving ACME challenges:", err)
 			}
+		}()
+
+		log.Printf("Serving TLS with automatic certificates for %v", tlsConfig.Autocert.Hosts)
+		return server.ListenAndServeTLS("", "")
+	}
+
+	if tlsConfig.CertFile != "" {
+		server.TLSConfig = &tls.Config{}
+		if err := requestClientCerts(server.TLSConfig, cfg.Admin.ClientCAFile); err != nil {
+			return err
 		}
-	}()
+		log.Printf("Serving TLS with certificate %s", tlsConfig.CertFile)
+		return server.ListenAndServeTLS(tlsConfig.CertFile, tlsConfig.KeyFile)
+	}
+
+	return server.ListenAndServe()
+}
 
-	// Start server
-	port := 8080
-	log.Printf("Server starting on port %d\n", port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), corsMiddleware(r)); err != nil {
-		log.Fatal("Error starting server:", err)
+// requestClientCerts makes TLS connections verify client certificates of the CA in caFile,
+// if not empty. Clients without one can still connect, the admin namespace rejects them.
+func requestClientCerts(tlsConfig *tls.Config, caFile string) error {
+	if caFile == "" {
+		return nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("failed to read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates found in client CA %s", caFile)
 	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	log.Printf("Admin routes require client certificates of %s", caFile)
+	return nil
 }
@@ -0,0 +1,34 @@
+// Command pricemodel-plugin is an example price model plugin. It adds the "trend" model,
+// which follows a trend that flips direction now and then. Build it with
+//
+//	go build -buildmode=plugin -o trend.so ./examples/pricemodel-plugin
+//
+// and load it with simulation.plugins: [trend.so] and simulation.model: trend.
+package main
+
+import (
+	"math/rand"
+
+	"server/pkg/seedventure"
+)
+
+func init() {
+	seedventure.RegisterPriceModel("trend", func() seedventure.PriceModel {
+		return &trend{direction: 1}
+	})
+}
+
+// trend keeps its direction between ticks, so every simulator needs its own instance
+type trend struct {
+	direction float64
+}
+
+func (t *trend) Next(price float64, params seedventure.SimulationParams, rng *rand.Rand) float64 {
+	if rng.Float64() < 0.02 {
+		t.direction = -t.direction
+	}
+	return price + t.direction*rng.Float64()*params.Volatility*0.2 + (rng.Float64()-0.5)*params.Volatility*0.5 + params.Drift
+}
+
+// main is never called, plugins only run their init functions
+func main() {}
@@ -0,0 +1,410 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"server/internal/audit"
+	"server/internal/config"
+	"server/internal/models"
+	"server/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+// AdminHandler handles operational requests under the /admin namespace
+type AdminHandler struct {
+	configStore  *config.Store
+	priceService *service.PriceService
+	auditLog     *audit.Log
+}
+
+// NewAdminHandler creates a new instance of AdminHandler
+func NewAdminHandler(configStore *config.Store, priceService *service.PriceService, auditLog *audit.Log) *AdminHandler {
+	return &AdminHandler{
+		configStore:  configStore,
+		priceService: priceService,
+		auditLog:     auditLog,
+	}
+}
+
+// adminStatus is the response body of admin actions without other output
+type adminStatus struct {
+	Status string `json:"status"`
+}
+
+// writeJSON encodes a value as the JSON response body
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleConfig returns the effective configuration of the running server
+func (h *AdminHandler) HandleConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, h.configStore.Get().Redacted())
+}
+
+// HandleConfigReload re-reads the configuration and applies the settings that can change at runtime
+func (h *AdminHandler) HandleConfigReload(w http.ResponseWriter, r *http.Request) {
+	cfg, err := h.configStore.Reload()
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, r, cfg.Redacted())
+}
+
+// HandleReset discards all price history and generates fresh data
+func (h *AdminHandler) HandleReset(w http.ResponseWriter, r *http.Request) {
+	logRequest(r, "Admin requested data reset")
+	h.priceService.Reset()
+	writeJSON(w, r, adminStatus{Status: "reset"})
+}
+
+// HandlePause stops price generation
+func (h *AdminHandler) HandlePause(w http.ResponseWriter, r *http.Request) {
+	h.priceService.Pause()
+	writeJSON(w, r, adminStatus{Status: "paused"})
+}
+
+// HandleResume continues price generation
+func (h *AdminHandler) HandleResume(w http.ResponseWriter, r *http.Request) {
+	h.priceService.Resume()
+	writeJSON(w, r, adminStatus{Status: "running"})
+}
+
+// HandleSimulation returns the current price generation parameters
+func (h *AdminHandler) HandleSimulation(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, h.priceService.GetSimulationParams())
+}
+
+// HandleSimulationUpdate adjusts volatility, drift, base price or price model at runtime
+func (h *AdminHandler) HandleSimulationUpdate(w http.ResponseWriter, r *http.Request) {
+	var update models.SimulationUpdate
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		httpError(w, r, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params, err := h.priceService.UpdateSimulationParams(update)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logRequest(r, "Admin updated simulation parameters for %s", params.Symbol)
+	writeJSON(w, r, params)
+}
+
+// maintenanceRequest is the body of a maintenance mode change
+type maintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+}
+
+// HandleMaintenance returns the current maintenance status
+func (h *AdminHandler) HandleMaintenance(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, h.priceService.GetStatus())
+}
+
+// HandleMaintenanceUpdate enables or disables maintenance mode
+func (h *AdminHandler) HandleMaintenanceUpdate(w http.ResponseWriter, r *http.Request) {
+	var request maintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		httpError(w, r, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.priceService.SetMaintenance(request.Enabled, request.Message)
+	writeJSON(w, r, h.priceService.GetStatus())
+}
+
+// cashRequest is the body of a one-off deposit or withdrawal
+type cashRequest struct {
+	Amount float64 `json:"amount"` // Deposited, withdrawn if negative
+	Reason string  `json:"reason"`
+}
+
+// HandleCash pays a one-off deposit or withdrawal to every player of the symbol
+func (h *AdminHandler) HandleCash(w http.ResponseWriter, r *http.Request) {
+	var request cashRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+
+	flow, err := h.priceService.PayCash(request.Amount, request.Reason, time.Now())
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, service.ErrInvalidCashFlow) {
+			code = http.StatusBadRequest
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+	logRequest(r, "Admin paid %s of %g: %s", flow.Kind, flow.Amount, request.Reason)
+	writeJSON(w, r, flow)
+}
+
+// HandleConnections lists the connected WebSocket clients
+func (h *AdminHandler) HandleConnections(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, h.priceService.GetConnections())
+}
+
+// HandleLag lists the WebSocket clients falling behind the lag thresholds, longest first
+func (h *AdminHandler) HandleLag(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, h.priceService.GetLagReport())
+}
+
+// HandleSave writes all timeframes to disk
+func (h *AdminHandler) HandleSave(w http.ResponseWriter, r *http.Request) {
+	if err := h.priceService.SaveAllTimeFrames(); err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, r, adminStatus{Status: "saved"})
+}
+
+// reloadDataRequest is the optional body of a data reload
+type reloadDataRequest struct {
+	Dir string `json:"dir"` // Directory to read the dataset from, defaults to the data directory
+}
+
+// HandleReloadData swaps in a new dataset without restarting or disconnecting clients
+func (h *AdminHandler) HandleReloadData(w http.ResponseWriter, r *http.Request) {
+	var request reloadDataRequest
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&request); err != nil && err != io.EOF {
+			httpError(w, r, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	logRequest(r, "Admin requested data reload")
+	reload, err := h.priceService.ReloadData(request.Dir)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, r, reload)
+}
+
+// HandleSnapshots lists the saved simulation snapshots
+func (h *AdminHandler) HandleSnapshots(w http.ResponseWriter, r *http.Request) {
+	snapshots, err := h.priceService.ListSnapshots()
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, r, snapshots)
+}
+
+// HandleSnapshotSave saves the complete simulation state as a new snapshot
+func (h *AdminHandler) HandleSnapshotSave(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := h.priceService.SaveSnapshot()
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, r, snapshot)
+}
+
+// HandleSnapshotRestore replaces the simulation state with a saved snapshot
+func (h *AdminHandler) HandleSnapshotRestore(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	logRequest(r, "Admin requested restore of snapshot %s", name)
+	if err := h.priceService.RestoreSnapshot(name); err != nil {
+		code := http.StatusUnprocessableEntity
+		if errors.Is(err, service.ErrSnapshotNotFound) {
+			code = http.StatusNotFound
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+	writeJSON(w, r, adminStatus{Status: "restored"})
+}
+
+// replayRequest is the optional body of a replay request
+type replayRequest struct {
+	Speed float64 `json:"speed"` // Time compression, defaults to 1
+	Loop  bool    `json:"loop"`  // Start over when the recording ends
+}
+
+// HandleRecordings lists the saved session recordings
+func (h *AdminHandler) HandleRecordings(w http.ResponseWriter, r *http.Request) {
+	recordings, err := h.priceService.ListRecordings()
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, r, recordings)
+}
+
+// defaultUpdatesLimit is the number of logged updates returned without a limit parameter
+const defaultUpdatesLimit = 500
+
+// HandleUpdates returns the logged updates from the offset of the from parameter on, by
+// default the oldest one, as many as the limit parameter, only those of the timeframe
+// parameter if given
+func (h *AdminHandler) HandleUpdates(w http.ResponseWriter, r *http.Request) {
+	first, _, err := h.priceService.LoggedOffsets()
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	from, err := queryInt(r, "from", int(first), 1, math.MaxInt)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultUpdatesLimit, 1, maxListLimit)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	timeFrame, err := parseTimeFrame(r.URL.Query().Get("timeframe"), "")
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	events, next, err := h.priceService.LoggedUpdates(int64(from), timeFrame, limit)
+	switch {
+	case errors.Is(err, service.ErrOffsetDiscarded):
+		writeValidationError(w, r, invalidParameter{name: "from", message: err.Error()})
+	case err != nil:
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, r, models.LoggedUpdates{First: first, Next: next, Events: events})
+	}
+}
+
+// HandleRecordingStatus returns the recording and replay in progress
+func (h *AdminHandler) HandleRecordingStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, h.priceService.RecordingStatus())
+}
+
+// HandleRecordingStart starts recording all broadcasts
+func (h *AdminHandler) HandleRecordingStart(w http.ResponseWriter, r *http.Request) {
+	recording, err := h.priceService.StartRecording()
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, service.ErrRecordingActive) {
+			code = http.StatusConflict
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+	writeJSON(w, r, recording)
+}
+
+// HandleRecordingStop stops the recording in progress
+func (h *AdminHandler) HandleRecordingStop(w http.ResponseWriter, r *http.Request) {
+	recording, err := h.priceService.StopRecording()
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, service.ErrNotRecording) {
+			code = http.StatusConflict
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+	writeJSON(w, r, recording)
+}
+
+// HandleReplayStart re-emits a saved recording to clients instead of live prices
+func (h *AdminHandler) HandleReplayStart(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	request := replayRequest{Speed: 1}
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&request); err != nil && err != io.EOF {
+			httpError(w, r, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	logRequest(r, "Admin requested replay of %s at %gx", name, request.Speed)
+	if err := h.priceService.StartReplay(name, request.Speed, request.Loop); err != nil {
+		code := http.StatusUnprocessableEntity
+		switch {
+		case errors.Is(err, service.ErrRecordingNotFound):
+			code = http.StatusNotFound
+		case errors.Is(err, service.ErrReplayActive):
+			code = http.StatusConflict
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+	writeJSON(w, r, adminStatus{Status: "replaying"})
+}
+
+// HandleReplayStop stops the running replay and returns clients to live prices
+func (h *AdminHandler) HandleReplayStop(w http.ResponseWriter, r *http.Request) {
+	if err := h.priceService.StopReplay(); err != nil {
+		httpError(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, r, adminStatus{Status: "live"})
+}
+
+// HandleRebuild regenerates higher timeframes from the 1-minute history and saves them,
+// only the ones in the optional comma separated timeframes query parameter if given
+func (h *AdminHandler) HandleRebuild(w http.ResponseWriter, r *http.Request) {
+	timeframes, err := parseTimeFrames("timeframes", r.URL.Query().Get("timeframes"))
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	if err := h.priceService.RebuildAggregates(timeframes...); err != nil {
+		writeValidationError(w, r, invalidParameter{name: "timeframes", message: err.Error()})
+		return
+	}
+	writeJSON(w, r, adminStatus{Status: "rebuilt"})
+}
+
+// HandleAudit returns the most recent admin actions, limited by the optional limit query parameter
+func (h *AdminHandler) HandleAudit(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", 100, 1, maxListLimit)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	entries, err := h.auditLog.List(limit)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, entries)
+}
+
+// PprofHandler serves the net/http/pprof endpoints under /admin/debug/pprof
+func PprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// pprof.Index expects paths to start with /debug/pprof/
+	return http.StripPrefix("/admin", mux)
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"server/internal/auth"
+
+	"github.com/gorilla/mux"
+)
+
+// APIKeyHandler issues, rotates and revokes API keys under /admin/api-keys
+type APIKeyHandler struct {
+	keys *auth.KeyStore
+}
+
+// NewAPIKeyHandler creates a new instance of APIKeyHandler
+func NewAPIKeyHandler(keys *auth.KeyStore) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys}
+}
+
+// apiKeyRequest is the body of an API key issuance
+type apiKeyRequest struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope"` // "read", "trade" or "admin"
+}
+
+// HandleAPIKeys lists the issued API keys without their secrets
+func (h *APIKeyHandler) HandleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, h.keys.List())
+}
+
+// HandleAPIKeyCreate issues an API key. The response is the only time the key is shown.
+func (h *APIKeyHandler) HandleAPIKeyCreate(w http.ResponseWriter, r *http.Request) {
+	var request apiKeyRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		httpError(w, r, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Name == "" {
+		httpError(w, r, "name must not be empty", http.StatusUnprocessableEntity)
+		return
+	}
+
+	key, err := h.keys.Create(request.Name, request.Scope)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrInvalidScope) {
+			code = http.StatusUnprocessableEntity
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+
+	logRequest(r, "Admin issued API key %s (%s) with scope %s", key.ID, key.Name, key.Scope)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, r, key)
+}
+
+// HandleAPIKeyRotate replaces the secret of an API key, the old one stops working immediately
+func (h *APIKeyHandler) HandleAPIKeyRotate(w http.ResponseWriter, r *http.Request) {
+	key, err := h.keys.Rotate(mux.Vars(r)["id"])
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrKeyNotFound) {
+			code = http.StatusNotFound
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+
+	logRequest(r, "Admin rotated API key %s (%s)", key.ID, key.Name)
+	writeJSON(w, r, key)
+}
+
+// HandleAPIKeyRevoke deletes an API key
+func (h *APIKeyHandler) HandleAPIKeyRevoke(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := h.keys.Revoke(id); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrKeyNotFound) {
+			code = http.StatusNotFound
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+
+	logRequest(r, "Admin revoked API key %s", id)
+	writeJSON(w, r, adminStatus{Status: "revoked"})
+}
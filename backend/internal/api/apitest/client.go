@@ -0,0 +1,248 @@
+package apitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"server/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// clientBuffer is the number of frames a Client holds until the test reads them
+const clientBuffer = 4096
+
+// Frame is a message received by a Client
+type Frame struct {
+	Type      string           // "new", "update", "delta", "status", "reload" or "error", "history" for the candles of a timeframe
+	TimeFrame models.TimeFrame // Channel of candle frames
+	Candle    models.CandleData
+	Delta     models.DeltaMessage
+	History   []models.CandleData
+	Raw       []byte
+}
+
+// candleState is what a Client last saw of the candles of a timeframe
+type candleState struct {
+	timestamp int64
+	complete  bool
+}
+
+// Client is a WebSocket client for tests of the streaming protocol. It records every
+// frame and checks that the candles of each timeframe follow the contract: a candle
+// starts with "new", gets updates and deltas until an update completes it, and only then
+// the next one starts. The first candle after connecting, subscribing or a reload may be
+// joined with an update.
+type Client struct {
+	tb     testing.TB
+	conn   *websocket.Conn
+	frames chan Frame
+	done   chan struct{}
+
+	lock       sync.Mutex
+	received   []Frame
+	candles    map[models.TimeFrame]*candleState
+	violations []string
+}
+
+// Dial connects a Client to a WebSocket URL such as Server.WebSocketURL
+// returns. The connection is closed when the test ends.
+func Dial(tb testing.TB, url string) *Client {
+	tb.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		tb.Fatalf("failed to connect test client to %s: %v", url, err)
+	}
+
+	c := &Client{
+		tb:      tb,
+		conn:    conn,
+		frames:  make(chan Frame, clientBuffer),
+		done:    make(chan struct{}),
+		candles: make(map[models.TimeFrame]*candleState),
+	}
+	go c.read()
+	tb.Cleanup(c.Close)
+	return c
+}
+
+// Subscribe asks the server to switch the client to another timeframe
+func (c *Client) Subscribe(timeFrame models.TimeFrame) {
+	c.tb.Helper()
+	if err := c.conn.WriteJSON(models.TimeFrameRequest{TimeFrame: timeFrame}); err != nil {
+		c.tb.Fatalf("failed to subscribe test client to %s: %v", timeFrame, err)
+	}
+}
+
+// Send writes a message to the server as JSON
+func (c *Client) Send(message interface{}) {
+	c.tb.Helper()
+	if err := c.conn.WriteJSON(message); err != nil {
+		c.tb.Fatalf("failed to send %T from test client: %v", message, err)
+	}
+}
+
+// Next returns the next frame, failing the test if none arrives within timeout
+func (c *Client) Next(timeout time.Duration) Frame {
+	c.tb.Helper()
+	select {
+	case frame := <-c.frames:
+		return frame
+	case <-c.done:
+		select {
+		case frame := <-c.frames:
+			return frame
+		default:
+		}
+		c.tb.Fatal("test client connection closed while waiting for a frame")
+	case <-time.After(timeout):
+		c.tb.Fatalf("test client got no frame within %s", timeout)
+	}
+	return Frame{}
+}
+
+// NextOf returns the next frame of a type, skipping others, failing the test if none
+// arrives within timeout
+func (c *Client) NextOf(frameType string, timeout time.Duration) Frame {
+	c.tb.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		frame := c.Next(time.Until(deadline))
+		if frame.Type == frameType {
+			return frame
+		}
+	}
+}
+
+// Frames returns every frame received so far, oldest first
+func (c *Client) Frames() []Frame {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]Frame(nil), c.received...)
+}
+
+// AssertOrder fails the test for every frame received so far that broke the order of candles
+func (c *Client) AssertOrder() {
+	c.tb.Helper()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, violation := range c.violations {
+		c.tb.Error(violation)
+	}
+}
+
+// Close closes the connection
+func (c *Client) Close() {
+	c.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(time.Second))
+	c.conn.Close()
+	<-c.done
+}
+
+// read records frames until the connection closes
+func (c *Client) read() {
+	defer close(c.done)
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		frame, err := parseFrame(data)
+
+		c.lock.Lock()
+		if err != nil {
+			c.violations = append(c.violations, fmt.Sprintf("invalid frame %s: %v", data, err))
+		} else {
+			c.checkLocked(frame)
+		}
+		c.received = append(c.received, frame)
+		c.lock.Unlock()
+
+		select {
+		case c.frames <- frame:
+		default:
+			c.lock.Lock()
+			c.violations = append(c.violations, fmt.Sprintf("test client buffer of %d frames is full, frames are not read", clientBuffer))
+			c.lock.Unlock()
+		}
+	}
+}
+
+// parseFrame decodes a message of the server
+func parseFrame(data []byte) (Frame, error) {
+	var header struct {
+		Type      string           `json:"type"`
+		TimeFrame models.TimeFrame `json:"timeFrame"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return Frame{Raw: data}, err
+	}
+	frame := Frame{Type: header.Type, TimeFrame: header.TimeFrame, Raw: data}
+
+	switch header.Type {
+	case "new", "update":
+		var message models.UpdateMessage
+		err := json.Unmarshal(data, &message)
+		frame.Candle = message.Candle
+		return frame, err
+	case "delta":
+		err := json.Unmarshal(data, &frame.Delta)
+		return frame, err
+	case "":
+		var history models.TimeFrameData
+		err := json.Unmarshal(data, &history)
+		frame.Type = "history"
+		frame.History = history.Candles
+		return frame, err
+	}
+	return frame, nil
+}
+
+// checkLocked records a violation if frame breaks the order of candles. Requires c.lock.
+func (c *Client) checkLocked(frame Frame) {
+	fail := func(format string, args ...interface{}) {
+		c.violations = append(c.violations, fmt.Sprintf("frame %d on %s: ", len(c.received), frame.TimeFrame)+fmt.Sprintf(format, args...))
+	}
+
+	state := c.candles[frame.TimeFrame]
+	switch frame.Type {
+	case "history":
+		delete(c.candles, frame.TimeFrame)
+	case "reload":
+		c.candles = make(map[models.TimeFrame]*candleState)
+	case "new":
+		if state != nil && frame.Candle.Timestamp <= state.timestamp {
+			fail("new candle %d isn't newer than candle %d", frame.Candle.Timestamp, state.timestamp)
+		} else if state != nil && !state.complete {
+			fail("new candle %d started before candle %d completed", frame.Candle.Timestamp, state.timestamp)
+		}
+		if frame.Candle.IsComplete {
+			fail("new candle %d is already complete", frame.Candle.Timestamp)
+		}
+		c.candles[frame.TimeFrame] = &candleState{timestamp: frame.Candle.Timestamp, complete: frame.Candle.IsComplete}
+	case "update":
+		switch {
+		case state == nil:
+			c.candles[frame.TimeFrame] = &candleState{timestamp: frame.Candle.Timestamp, complete: frame.Candle.IsComplete}
+		case frame.Candle.Timestamp != state.timestamp:
+			fail("update of candle %d, the current candle is %d", frame.Candle.Timestamp, state.timestamp)
+		case state.complete:
+			fail("update of candle %d after it completed", frame.Candle.Timestamp)
+		default:
+			state.complete = frame.Candle.IsComplete
+		}
+	case "delta":
+		switch {
+		case state == nil:
+			fail("delta of candle %d before a full frame", frame.Delta.Timestamp)
+		case frame.Delta.Timestamp != state.timestamp:
+			fail("delta of candle %d, the current candle is %d", frame.Delta.Timestamp, state.timestamp)
+		case state.complete:
+			fail("delta of candle %d after it completed", frame.Delta.Timestamp)
+		}
+	}
+}
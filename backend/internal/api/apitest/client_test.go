@@ -0,0 +1,48 @@
+package apitest
+
+import (
+	"testing"
+
+	"server/internal/models"
+)
+
+func TestClientChecksCandleOrder(t *testing.T) {
+	candle := func(frameType string, timestamp int64, complete bool) Frame {
+		return Frame{Type: frameType, TimeFrame: models.TimeFrame1Min,
+			Candle: models.CandleData{Timestamp: timestamp, IsComplete: complete}}
+	}
+	delta := func(timestamp int64) Frame {
+		return Frame{Type: "delta", TimeFrame: models.TimeFrame1Min,
+			Delta: models.DeltaMessage{Timestamp: timestamp}}
+	}
+
+	for _, test := range []struct {
+		name       string
+		frames     []Frame
+		violations int
+	}{
+		{"joined with an update", []Frame{candle("update", 1, false), delta(1), candle("update", 1, true), candle("new", 2, false)}, 0},
+		{"started with new", []Frame{candle("new", 1, false), candle("update", 1, true), candle("new", 2, false), delta(2)}, 0},
+		{"history resets the timeframe", []Frame{candle("update", 2, false), {Type: "history", TimeFrame: models.TimeFrame1Min}, candle("update", 1, false)}, 0},
+		{"reload resets every timeframe", []Frame{candle("update", 2, false), {Type: "reload"}, candle("update", 1, false)}, 0},
+		{"new before completion", []Frame{candle("update", 1, false), candle("new", 2, false)}, 1},
+		{"new candle not newer", []Frame{candle("update", 2, true), candle("new", 1, false)}, 1},
+		{"new candle complete", []Frame{candle("new", 1, true)}, 1},
+		{"update of another candle", []Frame{candle("new", 1, false), candle("update", 2, false)}, 1},
+		{"update after completion", []Frame{candle("update", 1, true), candle("update", 1, false)}, 1},
+		{"delta before a full frame", []Frame{delta(1)}, 1},
+		{"delta of another candle", []Frame{candle("new", 1, false), delta(2)}, 1},
+		{"delta after completion", []Frame{candle("update", 1, true), delta(1)}, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Client{candles: make(map[models.TimeFrame]*candleState)}
+			for _, frame := range test.frames {
+				c.checkLocked(frame)
+				c.received = append(c.received, frame)
+			}
+			if len(c.violations) != test.violations {
+				t.Fatalf("got violations %q, want %d", c.violations, test.violations)
+			}
+		})
+	}
+}
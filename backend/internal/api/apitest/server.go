@@ -0,0 +1,117 @@
+// Package apitest starts the Seedventure API in process for tests. Only tests import it, so
+// the testing packages aren't linked into the server.
+package apitest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"server/internal/api"
+	"server/internal/config"
+	"server/internal/service"
+)
+
+// AdminToken is the admin token of servers configured without one
+const AdminToken = "test-admin-token"
+
+// Options configures NewServer
+type Options struct {
+	Config      *config.Config   // Defaults if nil, the data directory is always a temporary one
+	HistoryDays int              // Days of history generated before serving, 1 if 0
+	Run         bool             // Whether prices are generated in the background, otherwise tests move them
+	Now         func() time.Time // Clock of candle timestamps, the wall clock if nil
+}
+
+// Server is an in-process server with the full router, for integration tests
+type Server struct {
+	*httptest.Server
+	Service     *service.PriceService
+	ConfigStore *config.Store
+	AdminToken  string
+}
+
+// NewServer starts a server with every route of the API and a price service seeded
+// with seed 1 unless the configuration sets one, ready with a started candle. The server
+// stops and its temporary data directory is removed when the test ends.
+func NewServer(tb testing.TB, opts Options) *Server {
+	tb.Helper()
+	cfg := config.Default()
+	if opts.Config != nil {
+		copied := *opts.Config
+		cfg = &copied
+	}
+	cfg.Data.Dir = tb.TempDir()
+	cfg.Admin.AuditFile = filepath.Join(cfg.Data.Dir, "audit.log")
+	if cfg.Simulation.Seed == 0 {
+		cfg.Simulation.Seed = 1
+	}
+	if cfg.Admin.Token == "" {
+		cfg.Admin.Token = AdminToken
+	}
+	if err := cfg.Validate(); err != nil {
+		tb.Fatalf("invalid test server configuration: %v", err)
+	}
+
+	configStore := config.NewStore(cfg)
+	priceService := service.NewPriceService(cfg)
+	if opts.Now != nil {
+		priceService.SetClock(opts.Now)
+	}
+	configStore.OnReload(priceService.ApplyConfig)
+	router, err := api.NewRouter(configStore, priceService)
+	if err != nil {
+		tb.Fatalf("failed to set up test server: %v", err)
+	}
+	namespaces, err := api.NewNamespaces(configStore, priceService)
+	if err != nil {
+		tb.Fatalf("failed to set up test server: %v", err)
+	}
+	if err := router.MountNamespaces(namespaces, configStore); err != nil {
+		tb.Fatalf("failed to set up test server: %v", err)
+	}
+
+	// The service can't save, and so stop, without history
+	if opts.HistoryDays == 0 {
+		opts.HistoryDays = 1
+	}
+	priceService.Initialize(opts.HistoryDays)
+	priceService.StartNewCandle()
+	if opts.Run {
+		go priceService.Run()
+	}
+	priceService.MarkReady()
+
+	s := &Server{
+		Server:      httptest.NewServer(namespaces.Handler(router.Handler)),
+		Service:     priceService,
+		ConfigStore: configStore,
+		AdminToken:  cfg.Admin.Token,
+	}
+	tb.Cleanup(func() {
+		s.Close()
+		if err := priceService.Stop(); err != nil {
+			tb.Errorf("failed to stop test server: %v", err)
+		}
+	})
+	return s
+}
+
+// WebSocketURL returns the ws:// URL of a path on the server
+func (s *Server) WebSocketURL(path string) string {
+	return "ws" + strings.TrimPrefix(s.URL, "http") + path
+}
+
+// AdminRequest creates a request to the server authorized with the admin token
+func (s *Server) AdminRequest(tb testing.TB, method, path string) *http.Request {
+	tb.Helper()
+	r, err := http.NewRequest(method, s.URL+path, nil)
+	if err != nil {
+		tb.Fatalf("invalid admin request: %v", err)
+	}
+	r.Header.Set("Authorization", "Bearer "+s.AdminToken)
+	return r
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"server/internal/auth"
+
+	"github.com/gorilla/mux"
+)
+
+// BanHandler manages banned users and IP addresses under /admin/bans
+type BanHandler struct {
+	bans *auth.BanList
+}
+
+// NewBanHandler creates a new instance of BanHandler
+func NewBanHandler(bans *auth.BanList) *BanHandler {
+	return &BanHandler{bans: bans}
+}
+
+// banRequest is the body of a ban
+type banRequest struct {
+	Type     string `json:"type"`     // "user" or "ip"
+	Value    string `json:"value"`    // User ID, IP address or CIDR range
+	Duration string `json:"duration"` // Go duration such as "24h", empty for a permanent ban
+	Reason   string `json:"reason"`
+}
+
+// HandleBans lists the bans in effect
+func (h *BanHandler) HandleBans(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, h.bans.List())
+}
+
+// HandleBanCreate bans a user or IP address. Bans are checked when users log in, on
+// every request with an access token and when WebSocket connections are opened.
+func (h *BanHandler) HandleBanCreate(w http.ResponseWriter, r *http.Request) {
+	var request banRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+
+	var duration time.Duration
+	if request.Duration != "" {
+		parsed, err := time.ParseDuration(request.Duration)
+		if err != nil || parsed <= 0 {
+			httpError(w, r, "duration must be a positive duration such as 24h", http.StatusUnprocessableEntity)
+			return
+		}
+		duration = parsed
+	}
+
+	ban, err := h.bans.Ban(request.Type, request.Value, duration, request.Reason, false)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrInvalidBan) {
+			code = http.StatusUnprocessableEntity
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+
+	logRequest(r, "Admin banned %s %s as %s", ban.Type, ban.Value, ban.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, r, ban)
+}
+
+// HandleBanDelete lifts a ban
+func (h *BanHandler) HandleBanDelete(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := h.bans.Unban(id); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrBanNotFound) {
+			code = http.StatusNotFound
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+
+	logRequest(r, "Admin lifted ban %s", id)
+	writeJSON(w, r, adminStatus{Status: "unbanned"})
+}
@@ -0,0 +1,411 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/config"
+	"server/internal/metrics"
+	"server/internal/models"
+	"server/internal/service"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// The exchange facade serves the price data in the shape of the Binance spot API, so
+// existing trading bots and charting libraries can be pointed at the simulator.
+// Only the market data endpoints and kline streams are implemented.
+
+const (
+	defaultKlineLimit = 500
+	maxKlineLimit     = 1000
+
+	// Error codes of the Binance API
+	binanceBadParameter    = -1100
+	binanceInvalidInterval = -1120
+	binanceInvalidSymbol   = -1121
+	binanceUnknownMethod   = -1014
+	binanceTooManyRequests = -1003
+)
+
+// binanceError is the error body of the Binance API
+type binanceError struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// binanceKlineEvent is a kline stream event
+type binanceKlineEvent struct {
+	EventType string       `json:"e"`
+	EventTime int64        `json:"E"`
+	Symbol    string       `json:"s"`
+	Kline     binanceKline `json:"k"`
+}
+
+// binanceKline is the kline of a stream event
+type binanceKline struct {
+	OpenTime            int64  `json:"t"`
+	CloseTime           int64  `json:"T"`
+	Symbol              string `json:"s"`
+	Interval            string `json:"i"`
+	FirstTradeID        int64  `json:"f"`
+	LastTradeID         int64  `json:"L"`
+	Open                string `json:"o"`
+	Close               string `json:"c"`
+	High                string `json:"h"`
+	Low                 string `json:"l"`
+	Volume              string `json:"v"`
+	Trades              int64  `json:"n"`
+	Closed              bool   `json:"x"`
+	QuoteVolume         string `json:"q"`
+	TakerBuyVolume      string `json:"V"`
+	TakerBuyQuoteVolume string `json:"Q"`
+	Ignore              string `json:"B"`
+}
+
+// binanceCombinedEvent wraps an event sent on a combined stream
+type binanceCombinedEvent struct {
+	Stream string      `json:"stream"`
+	Data   interface{} `json:"data"`
+}
+
+// binanceStreamRequest is a request sent by a stream client
+type binanceStreamRequest struct {
+	Method string          `json:"method"`
+	Params []string        `json:"params"`
+	ID     json.RawMessage `json:"id"`
+}
+
+// binanceStreamResponse answers a stream request
+type binanceStreamResponse struct {
+	Result interface{}     `json:"result"`
+	ID     json.RawMessage `json:"id"`
+}
+
+// BinanceHandler serves the Binance-compatible API. Stream clients are kept in a hub
+// of their own, whose channels are stream names instead of timeframes.
+type BinanceHandler struct {
+	priceService *service.PriceService
+	configStore  *config.Store
+	hub          *service.Hub
+	upgrader     websocket.Upgrader
+}
+
+// NewBinanceHandler creates a new instance of BinanceHandler
+func NewBinanceHandler(priceService *service.PriceService, configStore *config.Store) *BinanceHandler {
+	h := &BinanceHandler{
+		priceService: priceService,
+		configStore:  configStore,
+		hub:          service.NewHub(configStore.Get().Server.WebSocket.Writers),
+	}
+	h.upgrader = websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return originAllowed(h.configStore, r)
+		},
+		WriteBufferPool: writeBufferPool,
+	}
+	priceService.OnUpdate(h.publish)
+	return h
+}
+
+// writeBinanceError writes an error in the format of the Binance API
+func writeBinanceError(w http.ResponseWriter, r *http.Request, code int, msg string) {
+	logRequest(r, "Error: %s", msg)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(binanceError{Code: code, Msg: msg})
+}
+
+// HandlePing answers connectivity checks
+func (h *BinanceHandler) HandlePing(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, struct{}{})
+}
+
+// HandleTime returns the server time in milliseconds
+func (h *BinanceHandler) HandleTime(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, map[string]int64{"serverTime": time.Now().UnixMilli()})
+}
+
+// HandleExchangeInfo describes the simulated symbol
+func (h *BinanceHandler) HandleExchangeInfo(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(h.priceService.GetSimulationParams().Symbol)
+	writeJSON(w, r, map[string]interface{}{
+		"timezone":   "UTC",
+		"serverTime": time.Now().UnixMilli(),
+		"rateLimits": []interface{}{},
+		"symbols": []map[string]interface{}{{
+			"symbol":      symbol,
+			"status":      "TRADING",
+			"baseAsset":   symbol,
+			"quoteAsset":  "USD",
+			"orderTypes":  []string{},
+			"permissions": []string{"SPOT"},
+		}},
+	})
+}
+
+// HandleKlines returns candles as kline arrays. Without startTime the most recent
+// candles are returned, otherwise the first candles from startTime on.
+func (h *BinanceHandler) HandleKlines(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if !h.validSymbol(query.Get("symbol")) {
+		writeBinanceError(w, r, binanceInvalidSymbol, "Invalid symbol.")
+		return
+	}
+	interval, ok := parseInterval(query.Get("interval"))
+	if !ok {
+		writeBinanceError(w, r, binanceInvalidInterval, "Invalid interval.")
+		return
+	}
+
+	limit := defaultKlineLimit
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxKlineLimit {
+			writeBinanceError(w, r, binanceBadParameter, "Illegal characters found in parameter 'limit'; legal range is '1' to '1000'.")
+			return
+		}
+		limit = n
+	}
+
+	from, err := parseTimestamp(r, "startTime", 0)
+	if err != nil {
+		writeBinanceError(w, r, binanceBadParameter, "Illegal characters found in parameter 'startTime'.")
+		return
+	}
+	to, err := parseTimestamp(r, "endTime", time.Now().UnixMilli())
+	if err != nil {
+		writeBinanceError(w, r, binanceBadParameter, "Illegal characters found in parameter 'endTime'.")
+		return
+	}
+	if from > to {
+		writeBinanceError(w, r, binanceBadParameter, "startTime must not be after endTime.")
+		return
+	}
+
+	candles := h.priceService.GetHistoryRange(interval, from, to)
+	if len(candles) > limit {
+		if query.Get("startTime") == "" {
+			candles = candles[len(candles)-limit:]
+		} else {
+			candles = candles[:limit]
+		}
+	}
+
+	duration := interval.GetDuration().Milliseconds()
+	klines := make([][]interface{}, len(candles))
+	for i, c := range candles {
+		klines[i] = []interface{}{
+			c.Timestamp,
+			formatPrice(c.Values[0]),
+			formatPrice(c.Values[1]),
+			formatPrice(c.Values[2]),
+			formatPrice(c.Values[3]),
+			formatPrice(c.Volume),
+			c.Timestamp + duration - 1,
+			formatPrice(c.Volume * c.Values[3]),
+			0,
+			"0",
+			"0",
+			"0",
+		}
+	}
+	writeJSON(w, r, klines)
+}
+
+// HandleStream serves a raw stream such as /ws/seed@kline_1m
+func (h *BinanceHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
+	h.serveStream(w, r, mux.Vars(r)["stream"], false)
+}
+
+// HandleCombinedStream serves /stream?streams=seed@kline_1m, whose events are wrapped
+// with the name of their stream. A connection carries a single stream.
+func (h *BinanceHandler) HandleCombinedStream(w http.ResponseWriter, r *http.Request) {
+	streams := strings.Split(r.URL.Query().Get("streams"), "/")
+	if len(streams) != 1 {
+		httpError(w, r, "only one stream per connection is supported", http.StatusBadRequest)
+		return
+	}
+	h.serveStream(w, r, streams[0], true)
+}
+
+// serveStream upgrades the connection and subscribes it to a kline stream
+func (h *BinanceHandler) serveStream(w http.ResponseWriter, r *http.Request, stream string, combined bool) {
+	stream, ok := parseStream(stream, h.priceService.GetSimulationParams().Symbol)
+	if !ok {
+		httpError(w, r, "invalid stream name", http.StatusBadRequest)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logRequest(r, "WebSocket upgrade failed: %v", err)
+		return
+	}
+
+	// The hijacked connection inherits the HTTP server's deadlines, which
+	// would otherwise close long-lived WebSocket connections
+	conn.NetConn().SetDeadline(time.Time{})
+
+	client := h.hub.Register(conn, streamChannel(stream, combined), false)
+
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				metrics.PanicsRecovered.Inc()
+				logRequest(r, "Panic in stream reader: %v\n%s", rec, debug.Stack())
+			}
+			h.hub.Unregister(client)
+		}()
+
+		for {
+			messageType, p, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType == websocket.TextMessage {
+				h.handleStreamRequest(r, client, p, combined)
+			}
+		}
+	}()
+}
+
+// handleStreamRequest handles the SUBSCRIBE, UNSUBSCRIBE and LIST_SUBSCRIPTIONS
+// methods. Subscribing replaces the stream of the connection.
+func (h *BinanceHandler) handleStreamRequest(r *http.Request, client *service.Client, p []byte, combined bool) {
+	if _, ok := allowMessage(r); !ok {
+		client.Send(binanceError{Code: binanceTooManyRequests, Msg: "Too many requests."})
+		return
+	}
+
+	var request binanceStreamRequest
+	if err := json.Unmarshal(p, &request); err != nil {
+		client.Send(binanceError{Code: binanceBadParameter, Msg: "Invalid JSON."})
+		return
+	}
+
+	current := strings.TrimPrefix(string(client.TimeFrame()), combinedPrefix)
+	switch request.Method {
+	case "SUBSCRIBE":
+		if len(request.Params) != 1 {
+			client.Send(binanceError{Code: binanceBadParameter, Msg: "Only one stream per connection is supported."})
+			return
+		}
+		stream, ok := parseStream(request.Params[0], h.priceService.GetSimulationParams().Symbol)
+		if !ok {
+			client.Send(binanceError{Code: binanceBadParameter, Msg: "Invalid stream name."})
+			return
+		}
+		logRequest(r, "Stream client subscribed to %s", stream)
+		client.Subscribe(streamChannel(stream, combined))
+		client.Send(binanceStreamResponse{ID: request.ID})
+	case "UNSUBSCRIBE":
+		for _, stream := range request.Params {
+			if strings.EqualFold(stream, current) {
+				client.Subscribe("")
+			}
+		}
+		client.Send(binanceStreamResponse{ID: request.ID})
+	case "LIST_SUBSCRIPTIONS":
+		streams := []string{}
+		if current != "" {
+			streams = append(streams, current)
+		}
+		client.Send(binanceStreamResponse{Result: streams, ID: request.ID})
+	default:
+		client.Send(binanceError{Code: binanceUnknownMethod, Msg: "Unknown method."})
+	}
+}
+
+// combinedPrefix marks the hub channels of combined stream clients
+const combinedPrefix = "combined:"
+
+// streamChannel returns the hub channel of a stream
+func streamChannel(stream string, combined bool) models.TimeFrame {
+	if combined {
+		return models.TimeFrame(combinedPrefix + stream)
+	}
+	return models.TimeFrame(stream)
+}
+
+// publish converts a candle update into a kline event and sends it to the clients of its stream
+func (h *BinanceHandler) publish(message models.UpdateMessage) {
+	if h.hub.Count() == 0 {
+		return
+	}
+
+	symbol := strings.ToUpper(h.priceService.GetSimulationParams().Symbol)
+	stream := klineStream(symbol, message.TimeFrame)
+	c := message.Candle
+
+	event := binanceKlineEvent{
+		EventType: "kline",
+		EventTime: time.Now().UnixMilli(),
+		Symbol:    symbol,
+		Kline: binanceKline{
+			OpenTime:            c.Timestamp,
+			CloseTime:           c.Timestamp + message.TimeFrame.GetDuration().Milliseconds() - 1,
+			Symbol:              symbol,
+			Interval:            string(message.TimeFrame),
+			FirstTradeID:        -1,
+			LastTradeID:         -1,
+			Open:                formatPrice(c.Values[0]),
+			Close:               formatPrice(c.Values[3]),
+			High:                formatPrice(c.Values[1]),
+			Low:                 formatPrice(c.Values[2]),
+			Volume:              formatPrice(c.Volume),
+			Closed:              c.IsComplete,
+			QuoteVolume:         formatPrice(c.Volume * c.Values[3]),
+			TakerBuyVolume:      "0",
+			TakerBuyQuoteVolume: "0",
+			Ignore:              "0",
+		},
+	}
+
+	h.hub.Publish(streamChannel(stream, false), event)
+	h.hub.Publish(streamChannel(stream, true), binanceCombinedEvent{Stream: stream, Data: event})
+}
+
+// klineStream returns the name of the kline stream of a symbol and interval
+func klineStream(symbol string, interval models.TimeFrame) string {
+	return strings.ToLower(symbol) + "@kline_" + string(interval)
+}
+
+// parseStream returns the canonical name of a kline stream of the given symbol
+func parseStream(stream, symbol string) (string, bool) {
+	streamSymbol, name, ok := strings.Cut(stream, "@kline_")
+	if !ok || !strings.EqualFold(streamSymbol, symbol) {
+		return "", false
+	}
+	interval, ok := parseInterval(name)
+	if !ok {
+		return "", false
+	}
+	return klineStream(symbol, interval), true
+}
+
+// validSymbol reports whether a symbol names the simulated symbol, ignoring case
+func (h *BinanceHandler) validSymbol(symbol string) bool {
+	return strings.EqualFold(symbol, h.priceService.GetSimulationParams().Symbol)
+}
+
+// parseInterval returns the timeframe of a Binance interval name
+func parseInterval(interval string) (models.TimeFrame, bool) {
+	for _, tf := range models.AllTimeFrames() {
+		if string(tf) == interval {
+			return tf, true
+		}
+	}
+	return "", false
+}
+
+// formatPrice formats a number the way the Binance API does, as a decimal string
+func formatPrice(v float64) string {
+	return strconv.FormatFloat(v, 'f', 8, 64)
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"server/internal/config"
+	"server/internal/metrics"
+	"server/internal/models"
+	"server/internal/service"
+
+	"github.com/gorilla/websocket"
+)
+
+// convertQueueSize is the number of updates buffered until they are converted for streams
+const convertQueueSize = 1024
+
+var convertDropped = metrics.NewCounter("seedventure_convert_dropped_updates_total", "Number of updates not converted for streams because conversion could not keep up")
+
+// ConvertHandler serves the prices of symbols converted into other currencies with the
+// prices of the simulated markets, such as a USD symbol in EUR with a EURUSD pair. Stream
+// clients are kept in a hub of their own, whose channels name the symbol, currency and
+// timeframe.
+type ConvertHandler struct {
+	namespaces  *Namespaces
+	configStore *config.Store
+	hub         *service.Hub
+	upgrader    websocket.Upgrader
+	updates     chan convertUpdate // Updates of listened services waiting to be converted
+
+	lock      sync.Mutex
+	streams   map[models.TimeFrame]*conversionStream // Conversions streamed to clients by hub channel
+	listening map[*service.PriceService]bool         // Services whose updates are converted
+}
+
+// conversionStream is a conversion streamed to clients
+type conversionStream struct {
+	market  service.Market
+	quote   string
+	legs    []service.ConversionLeg
+	tf      models.TimeFrame
+	clients int
+}
+
+// convertUpdate is an update of the candles of a service
+type convertUpdate struct {
+	service *service.PriceService
+	message models.UpdateMessage
+}
+
+// NewConvertHandler creates a new instance of ConvertHandler
+func NewConvertHandler(namespaces *Namespaces, configStore *config.Store) *ConvertHandler {
+	h := &ConvertHandler{
+		namespaces:  namespaces,
+		configStore: configStore,
+		hub:         service.NewHub(configStore.Get().Server.WebSocket.Writers),
+		updates:     make(chan convertUpdate, convertQueueSize),
+		streams:     make(map[models.TimeFrame]*conversionStream),
+		listening:   make(map[*service.PriceService]bool),
+	}
+	h.upgrader = websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return originAllowed(h.configStore, r)
+		},
+		WriteBufferPool: writeBufferPool,
+	}
+	go h.convertUpdates()
+	return h
+}
+
+// resolve finds the market of a symbol, the default simulation's if empty, and the chain of
+// markets converting its prices into a currency
+func (h *ConvertHandler) resolve(symbol, quote string) (service.Market, []service.ConversionLeg, error) {
+	if quote == "" {
+		return service.Market{}, nil, invalidParameter{name: "quote", message: "must name a currency"}
+	}
+	markets := h.namespaces.Markets()
+	market := markets[0]
+	if symbol != "" {
+		found := false
+		for _, m := range markets {
+			if strings.EqualFold(m.Symbol, symbol) {
+				market, found = m, true
+				break
+			}
+		}
+		if !found {
+			return service.Market{}, nil, invalidParameter{name: "symbol", message: fmt.Sprintf("unknown symbol %q", symbol)}
+		}
+	}
+
+	legs, err := service.FindConversion(markets, market.Quote, strings.ToUpper(quote))
+	if err != nil {
+		return service.Market{}, nil, invalidParameter{name: "quote", message: err.Error()}
+	}
+	return market, legs, nil
+}
+
+// history returns the converted history of a timeframe in [from, to]
+func history(market service.Market, quote string, legs []service.ConversionLeg, tf models.TimeFrame, from, to int64) models.ConvertedHistory {
+	via := make([]string, len(legs))
+	for i, leg := range legs {
+		via[i] = leg.Market.Symbol
+	}
+	return models.ConvertedHistory{
+		Symbol:    market.Symbol,
+		Quote:     strings.ToUpper(quote),
+		Via:       via,
+		TimeFrame: tf,
+		Candles:   service.ConvertCandles(market.Service.GetHistoryRange(tf, from, to), tf, legs),
+	}
+}
+
+// HandleConvert returns the history of a symbol with its prices converted into the currency
+// of the quote parameter, with cross rates derived through the other markets if needed
+func (h *ConvertHandler) HandleConvert(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	timeFrame, err := parseTimeFrame(query.Get("timeframe"), models.TimeFrame1Min)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	from, to, err := queryTimeRange(r, "from", "to", math.MinInt64, math.MaxInt64)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	market, legs, err := h.resolve(query.Get("symbol"), query.Get("quote"))
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, history(market, query.Get("quote"), legs, timeFrame, from, to))
+}
+
+// HandleConvertStream streams the candle updates of a symbol converted like HandleConvert,
+// starting with the converted history of the timeframe
+func (h *ConvertHandler) HandleConvertStream(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	timeFrame, err := parseTimeFrame(query.Get("timeframe"), models.TimeFrame1Min)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	market, legs, err := h.resolve(query.Get("symbol"), query.Get("quote"))
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	quote := strings.ToUpper(query.Get("quote"))
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logRequest(r, "WebSocket upgrade failed: %v", err)
+		return
+	}
+
+	// The hijacked connection inherits the HTTP server's deadlines, which
+	// would otherwise close long-lived WebSocket connections
+	conn.NetConn().SetDeadline(time.Time{})
+
+	channel := h.subscribe(market, quote, legs, timeFrame)
+	client := h.hub.Register(conn, channel, false)
+	client.Send(history(market, quote, legs, timeFrame, math.MinInt64, math.MaxInt64))
+
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				metrics.PanicsRecovered.Inc()
+				logRequest(r, "Panic in conversion stream reader: %v\n%s", rec, debug.Stack())
+			}
+			h.hub.Unregister(client)
+			h.unsubscribe(channel)
+		}()
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// subscribe adds a client to the stream of a conversion, listening to the updates of
+// the symbol's service, and returns the stream's hub channel
+func (h *ConvertHandler) subscribe(market service.Market, quote string, legs []service.ConversionLeg, tf models.TimeFrame) models.TimeFrame {
+	channel := conversionChannel(market.Symbol, quote, tf)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	stream := h.streams[channel]
+	if stream == nil {
+		stream = &conversionStream{market: market, quote: quote, legs: legs, tf: tf}
+		h.streams[channel] = stream
+	}
+	stream.clients++
+
+	if !h.listening[market.Service] {
+		h.listening[market.Service] = true
+		priceService := market.Service
+		priceService.OnUpdate(func(message models.UpdateMessage) {
+			select {
+			case h.updates <- convertUpdate{service: priceService, message: message}:
+			default:
+				convertDropped.Inc()
+			}
+		})
+	}
+	return channel
+}
+
+// conversionChannel returns the hub channel of the stream of a conversion
+func conversionChannel(symbol, quote string, tf models.TimeFrame) models.TimeFrame {
+	return models.TimeFrame(symbol + "/" + quote + "@" + string(tf))
+}
+
+// unsubscribe removes a client from the stream of a conversion
+func (h *ConvertHandler) unsubscribe(channel models.TimeFrame) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if stream := h.streams[channel]; stream != nil {
+		if stream.clients--; stream.clients <= 0 {
+			delete(h.streams, channel)
+		}
+	}
+}
+
+// convertUpdates converts the updates of listened services for the streams of their
+// symbol and timeframe. Converting reads the candles of other services, so it runs here
+// rather than in the listeners, which are called by the services' candle owners.
+func (h *ConvertHandler) convertUpdates() {
+	for update := range h.updates {
+		h.lock.Lock()
+		var streams []conversionStream
+		for _, stream := range h.streams {
+			if stream.market.Service == update.service && stream.tf == update.message.TimeFrame {
+				streams = append(streams, *stream)
+			}
+		}
+		h.lock.Unlock()
+
+		for _, stream := range streams {
+			converted := service.ConvertCandles([]models.CandleData{update.message.Candle}, stream.tf, stream.legs)
+			if len(converted) == 0 {
+				continue
+			}
+			h.hub.Publish(conversionChannel(stream.market.Symbol, stream.quote, stream.tf), models.UpdateMessage{Type: update.message.Type, Candle: converted[0], TimeFrame: stream.tf})
+		}
+	}
+}
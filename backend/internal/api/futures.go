@@ -0,0 +1,292 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"server/internal/config"
+	"server/internal/models"
+	"server/internal/service"
+)
+
+// settlementsFile is the file in the data directory holding the settlements of futures contracts
+const settlementsFile = "settlements.json"
+
+// Futures lists the dated futures contracts configured on the symbols of the default
+// simulation and the namespaces. Every contract is served like a namespace named after
+// its symbol. At expiry, the contract is settled at the price of its underlying, its
+// clients are told so and the next contract is listed. Settled contracts are served
+// until the next expiry.
+type Futures struct {
+	namespaces *Namespaces
+	path       string
+
+	lock        sync.RWMutex
+	underlyings []*underlying
+	settlements []models.Settlement
+}
+
+// underlying is a symbol with futures contracts
+type underlying struct {
+	symbol     string
+	service    *service.PriceService
+	definition config.NamespaceConfig // Settings the contracts inherit
+	futures    config.FuturesConfig
+	contracts  []models.FuturesContract // Listed contracts by expiry
+}
+
+// newFutures sets up the futures contracts of the configuration, listed by start
+func newFutures(n *Namespaces) (*Futures, error) {
+	cfg := n.configStore.Get()
+	f := &Futures{
+		namespaces:  n,
+		path:        filepath.Join(cfg.Data.Dir, settlementsFile),
+		settlements: []models.Settlement{},
+	}
+
+	data, err := os.ReadFile(f.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read settlements: %w", err)
+	default:
+		if err := json.Unmarshal(data, &f.settlements); err != nil {
+			return nil, fmt.Errorf("failed to parse settlements %s: %w", f.path, err)
+		}
+	}
+
+	if cfg.Simulation.Futures.Enabled() {
+		f.underlyings = append(f.underlyings, &underlying{
+			symbol:  cfg.Simulation.Symbol,
+			service: n.root,
+			futures: cfg.Simulation.Futures,
+		})
+	}
+	for _, name := range cfg.NamespaceNames() {
+		definition := cfg.Namespaces[name]
+		if !definition.Futures.Enabled() {
+			continue
+		}
+		ns := n.get(name)
+		f.underlyings = append(f.underlyings, &underlying{
+			symbol:     ns.service.GetSimulationParams().Symbol,
+			service:    ns.service,
+			definition: definition,
+			futures:    ns.store.Get().Simulation.Futures,
+		})
+	}
+	return f, nil
+}
+
+// start lists the contracts expiring next and settles them as they expire. The caller
+// holds the changes of the namespaces.
+func (f *Futures) start() {
+	if len(f.underlyings) == 0 {
+		return
+	}
+
+	now := time.Now()
+	f.lock.Lock()
+	for _, u := range f.underlyings {
+		first := now.Truncate(u.futures.Term).Add(u.futures.Term)
+		for i := 0; i < u.futures.Contracts; i++ {
+			f.list(u, first.Add(time.Duration(i)*u.futures.Term))
+		}
+	}
+	f.lock.Unlock()
+
+	go f.run()
+}
+
+// list adds the contract of an underlying expiring at a time. The caller holds lock.
+func (f *Futures) list(u *underlying, expiry time.Time) {
+	symbol := models.ContractSymbol(u.symbol, expiry)
+	contract := models.FuturesContract{
+		Symbol:     symbol,
+		Underlying: u.symbol,
+		Path:       NamespacePrefix + strings.ToLower(symbol),
+		Listed:     expiry.Add(-time.Duration(u.futures.Contracts) * u.futures.Term).UnixMilli(),
+		Expiry:     expiry.UnixMilli(),
+		Premium:    u.futures.Premium,
+	}
+	setup := func(ps *service.PriceService) {
+		ps.SetFuture(u.service, contract)
+	}
+	if err := f.namespaces.addDerivative(symbol, models.SymbolSourceFutures, u.definition, setup); err != nil {
+		log.Printf("Error listing futures contract %s: %v", symbol, err)
+		return
+	}
+	u.contracts = append(u.contracts, contract)
+	log.Printf("Listed futures contract %s under %s, expiring %s", symbol, contract.Path, expiry.UTC().Format(time.RFC3339))
+}
+
+// run settles the contracts as they expire
+func (f *Futures) run() {
+	for {
+		next, ok := f.nextExpiry()
+		if !ok {
+			return
+		}
+		time.Sleep(time.Until(next))
+		f.expire(time.Now())
+	}
+}
+
+// nextExpiry returns the earliest expiry of the contracts that didn't expire yet
+func (f *Futures) nextExpiry() (time.Time, bool) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	var next int64
+	for _, u := range f.underlyings {
+		for _, contract := range u.contracts {
+			if !contract.Expired && (next == 0 || contract.Expiry < next) {
+				next = contract.Expiry
+			}
+		}
+	}
+	return time.UnixMilli(next), next != 0
+}
+
+// expire stops serving the contracts settled before, settles the contracts expired at
+// now and lists their successors
+func (f *Futures) expire(now time.Time) {
+	n := f.namespaces
+	n.changes.Lock()
+	defer n.changes.Unlock()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, u := range f.underlyings {
+		var listed []models.FuturesContract
+		var settled int
+		for _, contract := range u.contracts {
+			if contract.Expired {
+				f.unlist(contract)
+				continue
+			}
+			if contract.Expiry <= now.UnixMilli() {
+				f.settle(u, &contract)
+				settled++
+			}
+			listed = append(listed, contract)
+		}
+		u.contracts = listed
+
+		for ; settled > 0; settled-- {
+			last := time.UnixMilli(u.contracts[len(u.contracts)-1].Expiry)
+			f.list(u, last.Add(u.futures.Term))
+		}
+	}
+}
+
+// settle settles an expired contract at the price of its underlying and tells its clients.
+// The caller holds lock.
+func (f *Futures) settle(u *underlying, contract *models.FuturesContract) {
+	contract.Expired = true
+	price, ok := u.service.LastPrice()
+	if !ok {
+		log.Printf("Cannot settle futures contract %s without a price of %s", contract.Symbol, u.symbol)
+		return
+	}
+
+	settlement := models.Settlement{
+		Symbol:     contract.Symbol,
+		Underlying: contract.Underlying,
+		Expiry:     contract.Expiry,
+		Price:      price,
+	}
+	if ns := f.namespaces.get(strings.ToLower(contract.Symbol)); ns != nil {
+		if err := ns.service.Settle(price); err != nil {
+			log.Printf("Error saving data of futures contract %s: %v", contract.Symbol, err)
+		}
+		ns.service.Hub().PublishAll(models.SettlementMessage{Type: "settlement", Settlement: settlement})
+	}
+
+	f.settlements = append(f.settlements, settlement)
+	if err := f.save(); err != nil {
+		log.Printf("Error saving settlements: %v", err)
+	}
+}
+
+// unlist stops serving a settled contract. The caller holds the changes of the namespaces.
+func (f *Futures) unlist(contract models.FuturesContract) {
+	name := strings.ToLower(contract.Symbol)
+	ns := f.namespaces.get(name)
+	if ns == nil {
+		return
+	}
+	f.namespaces.remove(name)
+	f.namespaces.stop(ns)
+	log.Printf("Unlisted futures contract %s", contract.Symbol)
+}
+
+// Contracts returns the listed contracts, marking the front contract of every underlying
+func (f *Futures) Contracts() []models.FuturesContract {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	contracts := []models.FuturesContract{}
+	for _, u := range f.underlyings {
+		front := false
+		for _, contract := range u.contracts {
+			if !contract.Expired && !front {
+				contract.Front, front = true, true
+			}
+			contracts = append(contracts, contract)
+		}
+	}
+	return contracts
+}
+
+// Settlements returns the settlements of expired contracts, oldest first, only those of
+// an underlying symbol if not empty
+func (f *Futures) Settlements(underlying string) []models.Settlement {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	settlements := []models.Settlement{}
+	for _, settlement := range f.settlements {
+		if underlying == "" || strings.EqualFold(settlement.Underlying, underlying) {
+			settlements = append(settlements, settlement)
+		}
+	}
+	return settlements
+}
+
+// save writes the settlements. The caller holds lock.
+func (f *Futures) save() error {
+	data, err := json.MarshalIndent(f.settlements, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode settlements: %w", err)
+	}
+
+	// Write a temporary file and rename it, so a crash never loses all settlements
+	temp := f.path + ".tmp"
+	if err := os.WriteFile(temp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write settlements: %w", err)
+	}
+	if err := os.Rename(temp, f.path); err != nil {
+		return fmt.Errorf("failed to write settlements: %w", err)
+	}
+	return nil
+}
+
+// HandleContracts lists the listed futures contracts
+func (f *Futures) HandleContracts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, f.Contracts())
+}
+
+// HandleSettlements lists the settlements of expired futures contracts, of the underlying
+// symbol of the symbol parameter if given
+func (f *Futures) HandleSettlements(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, f.Settlements(r.URL.Query().Get("symbol")))
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"server/internal/config"
+	"server/internal/models"
+	"server/internal/service"
+	"server/pkg/seedtest"
+
+	"github.com/gorilla/websocket"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of the wire format in testdata/golden")
+
+const (
+	goldenDir     = "testdata/golden"
+	goldenCandles = 20                     // Candles kept per timeframe, so the golden files stay readable
+	goldenIdle    = 200 * time.Millisecond // Silence after which a client got every frame of a step
+)
+
+// newGoldenService creates a price service with a day of history generated from
+// seedtest.DefaultSeed up to seedtest.Start, whose candles are timestamped by the returned clock
+func newGoldenService(t *testing.T) (*service.PriceService, *config.Store, *seedtest.Clock) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Data.Dir = t.TempDir()
+	cfg.Data.MaxCandles = goldenCandles
+	cfg.Simulation.Seed = seedtest.DefaultSeed
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := seedtest.NewClock(seedtest.Start)
+	ps := service.NewPriceService(cfg)
+	ps.SetClock(clock.Now)
+	ps.Initialize(1)
+	ps.StartNewCandle()
+	ps.MarkReady()
+	t.Cleanup(func() {
+		if err := ps.Stop(); err != nil {
+			t.Errorf("stopping the price service: %v", err)
+		}
+	})
+	return ps, config.NewStore(cfg), clock
+}
+
+// assertGolden fails the test if got differs from the golden file, or rewrites the file
+// with -update
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join(goldenDir, name)
+	if *updateGolden {
+		if err := os.MkdirAll(goldenDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	gotLines, wantLines := strings.Split(string(got), "\n"), strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			t.Fatalf("%s differs from the golden file at line %d (run with -update if intended):\ngot:  %s\nwant: %s", name, i+1, g, w)
+		}
+	}
+}
+
+// TestGoldenHistory compares the history responses of every timeframe with the golden files
+func TestGoldenHistory(t *testing.T) {
+	ps, configStore, _ := newGoldenService(t)
+	handler := NewPriceHandler(ps, configStore)
+
+	get := func(query string) []byte {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		handler.HandleHistoricalData(recorder, httptest.NewRequest(http.MethodGet, "/api/prices/history?"+query, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("history?%s answered %d: %s", query, recorder.Code, recorder.Body)
+		}
+		return recorder.Body.Bytes()
+	}
+
+	for _, tf := range models.AllTimeFrames() {
+		assertGolden(t, "history-"+string(tf)+".json", get("timeframe="+string(tf)))
+	}
+	assertGolden(t, "history-1m-ohlc.json", get("timeframe=1m&schema=ohlc"))
+}
+
+// goldenClient records the raw frames a WebSocket client receives
+type goldenClient struct {
+	name       string
+	frames     chan []byte
+	transcript bytes.Buffer
+}
+
+// dialGolden connects a client, which reads frames until the connection closes
+func dialGolden(t *testing.T, name, url string) *goldenClient {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	client := &goldenClient{name: name, frames: make(chan []byte, 64)}
+	go func() {
+		defer close(client.frames)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			client.frames <- data
+		}
+	}()
+	return client
+}
+
+// drain appends the frames received until the client gets none for goldenIdle, after a
+// line naming the step that caused them
+func (c *goldenClient) drain(t *testing.T, step string) {
+	t.Helper()
+	fmt.Fprintf(&c.transcript, "# %s\n", step)
+	for {
+		select {
+		case data, ok := <-c.frames:
+			if !ok {
+				t.Fatalf("%s client disconnected during %s", c.name, step)
+			}
+			c.transcript.Write(data)
+			c.transcript.WriteByte('\n')
+		case <-time.After(goldenIdle):
+			return
+		}
+	}
+}
+
+// TestGoldenWebSocket compares the frames of WebSocket clients with every combination of
+// options with the golden files, through candle updates, a completed candle and status changes
+func TestGoldenWebSocket(t *testing.T) {
+	ps, configStore, clock := newGoldenService(t)
+	server := httptest.NewServer(http.HandlerFunc(NewPriceHandler(ps, configStore).HandleWebsocket))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	clients := []*goldenClient{
+		dialGolden(t, "default", url),
+		dialGolden(t, "deltas", url+"?deltas=true"),
+		dialGolden(t, "ohlc", url+"?schema=ohlc"),
+	}
+
+	step := func(name string, action func()) {
+		t.Helper()
+		action()
+		for _, client := range clients {
+			client.drain(t, name)
+		}
+	}
+
+	step("connect", func() {})
+	for i := 1; i <= 3; i++ {
+		step(fmt.Sprintf("tick %d", i), func() {
+			clock.Advance(10 * time.Second)
+			ps.UpdateCurrentCandle()
+		})
+	}
+	step("next candle", func() {
+		clock.Set(clock.Now().Truncate(time.Minute).Add(time.Minute))
+		ps.FinalizeCurrentCandle()
+		ps.StartNewCandle()
+	})
+	step("maintenance", func() { ps.SetMaintenance(true, "Upgrading the servers") })
+	step("maintenance over", func() { ps.SetMaintenance(false, "") })
+
+	for _, client := range clients {
+		assertGolden(t, "ws-"+client.name+".txt", client.transcript.Bytes())
+	}
+}
@@ -2,77 +2,246 @@ package api
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
 	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"server/internal/auth"
+	"server/internal/config"
+	"server/internal/metrics"
 	"server/internal/models"
 	"server/internal/service"
+	"server/internal/version"
 
+	"github.com/gobwas/ws"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 )
 
+// defaultTradesLimit is the number of trades returned without a limit parameter
+const defaultTradesLimit = 500
+
+// defaultChatLimit is the number of chat messages returned without a limit parameter
+const defaultChatLimit = 50
+
+// writeBufferPool shares WebSocket write buffers between connections, so idle
+// clients don't each hold on to a buffer between broadcasts
+var writeBufferPool = &sync.Pool{}
+
 // PriceHandler handles HTTP and WebSocket requests related to price data
 type PriceHandler struct {
 	priceService *service.PriceService
+	configStore  *config.Store
 	upgrader     websocket.Upgrader
 }
 
 // NewPriceHandler creates a new instance of PriceHandler
-func NewPriceHandler(priceService *service.PriceService) *PriceHandler {
-	return &PriceHandler{
+func NewPriceHandler(priceService *service.PriceService, configStore *config.Store) *PriceHandler {
+	h := &PriceHandler{
 		priceService: priceService,
-		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // Allow all connections
-			},
-		},
+		configStore:  configStore,
 	}
+	h.upgrader = websocket.Upgrader{
+		CheckOrigin:     h.checkOrigin,
+		WriteBufferPool: writeBufferPool,
+	}
+	return h
+}
+
+// checkOrigin verifies WebSocket upgrades against the allowed origins
+func (h *PriceHandler) checkOrigin(r *http.Request) bool {
+	return originAllowed(h.configStore, r)
+}
+
+// originAllowed verifies WebSocket upgrades against the allowed origins. When the
+// server runs with TLS, only secure origins may open (wss://) connections.
+func originAllowed(configStore *config.Store, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // Non-browser clients don't send an origin
+	}
+
+	cfg := configStore.Get()
+	if cfg.Server.TLS.Enabled() {
+		if r.TLS == nil || !strings.HasPrefix(origin, "https://") {
+			logRequest(r, "Rejected insecure WebSocket origin %s", origin)
+			return false
+		}
+	}
+
+	for _, allowed := range cfg.Server.CORSOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+
+	logRequest(r, "Rejected WebSocket origin %s", origin)
+	return false
 }
 
 // HandleHistoricalData handles requests for historical price data with timeframe support
 func (h *PriceHandler) HandleHistoricalData(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	// Get timeframe from query params, default to 1-minute
-	timeFrameStr := r.URL.Query().Get("timeframe")
-	timeFrame := models.TimeFrame1Min
+	timeFrame, err := parseTimeFrame(r.URL.Query().Get("timeframe"), models.TimeFrame1Min)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	// Optionally limit the history to a range of Unix millisecond timestamps
+	from, to, err := queryTimeRange(r, "from", "to", math.MinInt64, math.MaxInt64)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
 
-	if timeFrameStr != "" {
-		timeFrame = models.TimeFrame(timeFrameStr)
+	// Clients not using the frontend's charting library ask for named fields with ?schema=ohlc
+	schema, err := parseSchema(r.URL.Query().Get("schema"))
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
 	}
 
-	// Get historical data for the requested timeframe
-	history := h.priceService.GetHistoryForTimeFrame(timeFrame)
+	// Write the history for the requested timeframe, flushing as it is streamed
+	flush := func() {
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+	if err := h.priceService.WriteHistory(w, timeFrame, from, to, schema, flush); err != nil {
+		// Part of the response may already be written, so the status can't change anymore
+		logRequest(r, "Error writing history: %v", err)
+	}
+}
 
-	response := models.TimeFrameData{
-		TimeFrame: timeFrame,
-		Candles:   history,
+// HandleGaps reports the periods of a timeframe missing from the stored history
+func (h *PriceHandler) HandleGaps(w http.ResponseWriter, r *http.Request) {
+	timeFrame, err := parseTimeFrame(r.URL.Query().Get("timeframe"), models.TimeFrame1Min)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	from, to, err := queryTimeRange(r, "from", "to", math.MinInt64, math.MaxInt64)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, h.priceService.Gaps(timeFrame, from, to))
+}
+
+// HandleRecentTrades returns the newest trades, up to the limit parameter, oldest first
+func (h *PriceHandler) HandleRecentTrades(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", defaultTradesLimit, 1, service.MaxTrades)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, h.priceService.RecentTrades(limit))
+}
+
+// HandleAggregatedTrades returns the newest trades with consecutive trades at the same price
+// and side compressed into one, up to the limit parameter, oldest first
+func (h *PriceHandler) HandleAggregatedTrades(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", defaultTradesLimit, 1, service.MaxTrades)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
 	}
 
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	writeJSON(w, r, h.priceService.AggregatedTrades(limit))
+}
+
+// HandleCashFlows returns the deposits and withdrawals in the range of the from and to
+// parameters
+func (h *PriceHandler) HandleCashFlows(w http.ResponseWriter, r *http.Request) {
+	from, to, err := queryTimeRange(r, "from", "to", math.MinInt64, math.MaxInt64)
+	if err != nil {
+		writeValidationError(w, r, err)
 		return
 	}
+	writeJSON(w, r, h.priceService.CashFlows(from, to))
+}
+
+// parseTimestamp reads an optional Unix millisecond timestamp from the query string
+func parseTimestamp(r *http.Request, name string, fallback int64) (int64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s timestamp %q, expected Unix milliseconds", name, value)
+	}
+	return timestamp, nil
+}
+
+// HandleReady reports whether price data can be served, for load balancer readiness probes
+func (h *PriceHandler) HandleReady(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	status := http.StatusOK
+	if !h.priceService.IsReady() {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]bool{"ready": status == http.StatusOK})
+}
+
+// HandleVersion returns the build information of the running server
+func (h *PriceHandler) HandleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, version.Get())
+}
+
+// HandleStats returns runtime statistics of the server
+func (h *PriceHandler) HandleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, h.priceService.GetStats())
+}
+
+// HandleClientConfig returns the runtime configuration the frontend needs to configure itself
+func (h *PriceHandler) HandleClientConfig(w http.ResponseWriter, r *http.Request) {
+	cfg := h.configStore.Get()
+
+	features := make(map[string]bool, len(cfg.Features))
+	for name, enabled := range cfg.Features {
+		features[name] = enabled
+	}
+
+	writeJSON(w, r, models.ClientConfig{
+		Namespace:        cfg.NamespaceName(),
+		Symbols:          []string{h.priceService.GetSimulationParams().Symbol},
+		TimeFrames:       models.AllTimeFrames(),
+		DefaultTimeFrame: models.TimeFrame1Min,
+		UpdateIntervalMs: cfg.Simulation.BroadcastInterval.Milliseconds(),
+		CandleIntervalMs: models.TimeFrame1Min.GetDuration().Milliseconds(),
+		Precision:        cfg.Simulation.Precision(),
+		Maintenance:      h.priceService.InMaintenance(),
+		TradingHalted:    h.priceService.TradingHalted(),
+		MarketClosed:     h.priceService.MarketClosed(),
+		Features:         features,
+	})
 }
 
 // HandleAvailableTimeframes returns the list of supported timeframes
 func (h *PriceHandler) HandleAvailableTimeframes(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	timeframes := []models.TimeFrame{
-		models.TimeFrame1Min,
-		models.TimeFrame5Min,
-		models.TimeFrame15Min,
-		models.TimeFrame1Hour,
-		models.TimeFrame4Hour,
-		models.TimeFrame1Day,
-	}
+	timeframes := models.AllTimeFrames()
 
 	if err := json.NewEncoder(w).Encode(timeframes); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
@@ -88,70 +257,302 @@ func (h *PriceHandler) HandleWebsocket(w http.ResponseWriter, r *http.Request) {
 
 // HandleWebsocketSubscribe handles websocket connections with timeframe subscriptions
 func (h *PriceHandler) HandleWebsocketSubscribe(w http.ResponseWriter, r *http.Request) {
-	conn, err := h.upgrader.Upgrade(w, r, nil)
+	// Get timeframe from URL parameters, default to 1-minute
+	timeFrame, err := parseTimeFrame(mux.Vars(r)["timeframe"], models.TimeFrame1Min)
 	if err != nil {
-		log.Println(err)
+		writeValidationError(w, r, err)
 		return
 	}
 
-	// Get timeframe from URL parameters, default to 1-minute
-	vars := mux.Vars(r)
-	timeFrameStr := vars["timeframe"]
-	timeFrame := models.TimeFrame1Min
+	h.serveWebsocket(w, r, timeFrame, false)
+}
 
-	if timeFrameStr != "" {
-		timeFrame = models.TimeFrame(timeFrameStr)
+// HandleSpectate handles unauthenticated, read-only websocket connections of spectators,
+// up to server.websocket.spectators per symbol, optionally on a timeframe
+func (h *PriceHandler) HandleSpectate(w http.ResponseWriter, r *http.Request) {
+	spectators := h.configStore.Get().Server.WebSocket.Spectators
+	if spectators == 0 {
+		httpError(w, r, "spectator mode is disabled", http.StatusNotFound)
+		return
+	}
+	timeFrame, err := parseTimeFrame(mux.Vars(r)["timeframe"], models.TimeFrame1Min)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	if !h.priceService.Hub().ReserveSpectator(spectators) {
+		httpError(w, r, "too many spectators, try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	// The client is a spectator from its registration on, before it can send anything
+	if h.serveWebsocket(w, r, timeFrame, true) == nil {
+		h.priceService.Hub().ReleaseSpectator()
+	}
+}
+
+// serveWebsocket upgrades a connection subscribed to a timeframe and registers it, as a
+// spectator if requested, returning its client or nil if the connection failed
+func (h *PriceHandler) serveWebsocket(w http.ResponseWriter, r *http.Request, timeFrame models.TimeFrame, spectator bool) *service.Client {
+	if _, err := parseSchema(r.URL.Query().Get("schema")); err != nil {
+		writeValidationError(w, r, err)
+		return nil
 	}
 
-	// Register client with the price service
-	h.priceService.RegisterClient(conn)
+	// TLS connections can't be polled and keep using a goroutine per connection
+	if h.priceService.UsesEventLoop() && r.TLS == nil {
+		return h.serveEventLoop(w, r, timeFrame, spectator)
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logRequest(r, "WebSocket upgrade failed: %v", err)
+		return nil
+	}
+
+	// The hijacked connection inherits the HTTP server's deadlines, which
+	// would otherwise close long-lived WebSocket connections
+	conn.NetConn().SetDeadline(time.Time{})
+
+	// Register client with the price service, subscribed to the requested timeframe
+	client := h.priceService.RegisterClient(conn, timeFrame, spectator)
+	h.welcome(r, client, timeFrame)
+
+	// Handle client messages (e.g., change timeframe subscription)
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				metrics.PanicsRecovered.Inc()
+				logRequest(r, "Panic in WebSocket reader: %v\n%s", rec, debug.Stack())
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "internal error"),
+					time.Now().Add(time.Second))
+				h.priceService.UnregisterClient(client)
+			}
+		}()
+
+		for {
+			messageType, p, err := conn.ReadMessage()
+			if err != nil {
+				h.priceService.UnregisterClient(client)
+				break
+			}
+
+			if messageType == websocket.TextMessage {
+				h.handleClientMessage(r, client, p)
+			}
+		}
+	}()
+	return client
+}
+
+// serveEventLoop upgrades a connection with gobwas/ws and hands it to the service's
+// event loop, which reads and writes it without a dedicated goroutine
+func (h *PriceHandler) serveEventLoop(w http.ResponseWriter, r *http.Request, timeFrame models.TimeFrame, spectator bool) *service.Client {
+	if !h.checkOrigin(r) {
+		httpError(w, r, "request origin not allowed", http.StatusForbidden)
+		return nil
+	}
+
+	conn, rw, _, err := ws.UpgradeHTTP(r, w)
+	if err != nil {
+		logRequest(r, "WebSocket upgrade failed: %v", err)
+		return nil
+	}
+
+	// The hijacked connection inherits the HTTP server's deadlines, which
+	// would otherwise close long-lived WebSocket connections
+	conn.SetDeadline(time.Time{})
+
+	client, err := h.priceService.RegisterEventClient(conn, rw.Reader, timeFrame, spectator, func(client *service.Client, p []byte) {
+		h.handleClientMessage(r, client, p)
+	})
+	if err != nil {
+		logRequest(r, "Error registering WebSocket client: %v", err)
+		conn.Close()
+		return nil
+	}
+	h.welcome(r, client, timeFrame)
+	return client
+}
+
+// welcome applies the connection options of a new client and sends it the initial data
+func (h *PriceHandler) welcome(r *http.Request, client *service.Client, timeFrame models.TimeFrame) {
+	// Clients opt into delta frames for intra-candle updates with ?deltas=true
+	if deltas, _ := strconv.ParseBool(r.URL.Query().Get("deltas")); deltas {
+		client.EnableDeltas()
+	}
+	// and into candles with named fields with ?schema=ohlc, validated before the upgrade
+	if schema, _ := parseSchema(r.URL.Query().Get("schema")); schema != models.SchemaXY {
+		client.SetSchema(schema)
+	}
+
+	// Tell clients connecting during maintenance or a holiday why prices don't move, and
+	// during a trading halt not to accept orders
+	if h.priceService.InMaintenance() || h.priceService.MarketClosed() || h.priceService.TradingHalted() {
+		client.Send(h.priceService.GetStatus())
+	}
+
+	// Clients reconnecting with the offset of the next update they expect get the updates
+	// they missed instead, else they have to load the history again
+	if r.URL.Query().Get("from") != "" {
+		from, err := queryInt(r, "from", 0, 1, math.MaxInt)
+		if err == nil {
+			err = h.priceService.ResumeUpdates(client, int64(from))
+		}
+		if err == nil {
+			return
+		}
+		var invalid invalidParameter
+		if !errors.As(err, &invalid) {
+			invalid = invalidParameter{name: "from", message: err.Error()}
+		}
+		client.Send(validationError(invalid))
+	}
 
 	// Send current candle immediately if it exists and matches the requested timeframe
 	if timeFrame == models.TimeFrame1Min {
 		currentCandle := h.priceService.GetCurrentCandle()
 		if currentCandle != nil {
-			data, err := json.Marshal(models.UpdateMessage{
+			client.Send(models.UpdateMessage{
 				Type:      "update",
 				Candle:    *currentCandle,
 				TimeFrame: timeFrame,
 			})
-			if err == nil {
-				conn.WriteMessage(websocket.TextMessage, data)
-			}
 		}
 	}
+}
 
-	// Handle client messages (e.g., change timeframe subscription)
-	go func() {
-		for {
-			messageType, p, err := conn.ReadMessage()
-			if err != nil {
-				h.priceService.UnregisterClient(conn)
-				conn.Close()
-				break
+// handleClientMessage handles a text message sent by a client
+func (h *PriceHandler) handleClientMessage(r *http.Request, client *service.Client, p []byte) {
+	if quotaErr, ok := allowMessage(r); !ok {
+		client.Send(quotaErr)
+		return
+	}
+
+	message, err := decodeClientMessage(p)
+	if err != nil {
+		client.Send(validationError(err))
+		return
+	}
+	switch m := message.(type) {
+	case models.ChatRequest:
+		h.handleChat(r, client, m.Text)
+	case models.AckRequest:
+		// Clients acknowledge the updates they processed, so those falling behind are noticed
+		client.Ack(m.Offset)
+	case models.TimeFrameRequest:
+		h.handleTimeFrameRequest(r, client, m)
+	}
+}
+
+// decodeClientMessage decodes a text message sent by a client into a models.ChatRequest,
+// models.AckRequest or models.TimeFrameRequest, nil if it is none of them. Requests with
+// invalid parameters fail with an invalidParameter.
+func decodeClientMessage(p []byte) (interface{}, error) {
+	var chat models.ChatRequest
+	if err := json.Unmarshal(p, &chat); err == nil && chat.Type == "chat" {
+		return chat, nil
+	}
+
+	var ack models.AckRequest
+	if err := json.Unmarshal(p, &ack); err == nil && ack.Type == "ack" {
+		if ack.Offset < 1 {
+			return nil, invalidParameter{name: "offset", message: fmt.Sprintf("must be a positive offset of the update log, got %d", ack.Offset)}
+		}
+		return ack, nil
+	}
+
+	var request models.TimeFrameRequest
+	if err := json.Unmarshal(p, &request); err == nil && (request.TimeFrame != "" || request.Schema != "") {
+		if request.TimeFrame != "" {
+			if _, err := parseTimeFrame(string(request.TimeFrame), ""); err != nil {
+				return nil, err
 			}
+		}
+		if _, err := parseSchema(request.Schema); err != nil {
+			return nil, err
+		}
+		return request, nil
+	}
+	return nil, nil
+}
 
-			// If client sends a new timeframe request, handle it
-			if messageType == websocket.TextMessage {
-				var request models.TimeFrameRequest
-				if err := json.Unmarshal(p, &request); err == nil {
-					// Client wants to change timeframe
-					log.Printf("Client requested timeframe change to %s", request.TimeFrame)
-
-					// Send the initial data for the new timeframe
-					history := h.priceService.GetHistoryForTimeFrame(request.TimeFrame)
-
-					response := models.TimeFrameData{
-						TimeFrame: request.TimeFrame,
-						Candles:   history,
-					}
-
-					data, err := json.Marshal(response)
-					if err == nil {
-						conn.WriteMessage(websocket.TextMessage, data)
-					}
-				}
+// handleTimeFrameRequest subscribes a client to a new timeframe or candle schema, the
+// current timeframe if the request has none, and sends it the history again
+func (h *PriceHandler) handleTimeFrameRequest(r *http.Request, client *service.Client, request models.TimeFrameRequest) {
+	if request.TimeFrame == "" {
+		request.TimeFrame = client.TimeFrame()
+	}
+	if request.Schema != "" {
+		// The history is sent again below, so the client has all candles in one schema,
+		// validated by decodeClientMessage
+		schema, _ := parseSchema(request.Schema)
+		logRequest(r, "Client switched to candle schema %s", schema)
+		client.SetSchema(schema)
+	}
+
+	// Client wants to change timeframe
+	logRequest(r, "Client requested timeframe change to %s", request.TimeFrame)
+	client.Subscribe(request.TimeFrame)
+
+	// Send the initial data for the new timeframe
+	history := h.priceService.GetHistoryForTimeFrame(request.TimeFrame)
+
+	client.Send(models.TimeFrameData{
+		TimeFrame: request.TimeFrame,
+		Candles:   history,
+	})
+}
+
+// handleChat sends a chat message of a client to the clients of the symbol
+func (h *PriceHandler) handleChat(r *http.Request, client *service.Client, text string) {
+	if client.IsSpectator() {
+		client.Send(validationError(invalidParameter{name: "type", message: "spectators cannot chat"}))
+		return
+	}
+	if quotaErr, ok := allowChat(r); !ok {
+		client.Send(quotaErr)
+		return
+	}
+
+	author, guest := chatAuthor(r, h.configStore)
+	if _, err := h.priceService.PostChat(author, guest, text, time.Now()); err != nil {
+		if errors.Is(err, service.ErrChatDisabled) || errors.Is(err, service.ErrInvalidChatMessage) {
+			client.Send(validationError(invalidParameter{name: "text", message: err.Error()}))
+			return
+		}
+		logRequest(r, "Error saving chat message: %v", err)
+	}
+}
+
+// chatAuthor returns the name chat messages sent over the connection opened by r are
+// signed with: the username of a valid access token, else a guest name derived from what
+// the quotas count the client against, so it doesn't reveal the client's address
+func chatAuthor(r *http.Request, configStore *config.Store) (string, bool) {
+	if cfg := configStore.Get().Auth; cfg.UsersEnabled() {
+		if token := accessToken(r, cfg); token != "" {
+			if claims, err := auth.ParseToken(cfg.JWTSecret, token, time.Now()); err == nil {
+				return claims.Username, false
 			}
 		}
-	}()
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(quotaUser(r, configStore)))
+	return fmt.Sprintf("guest-%04x", hash.Sum32()&0xffff), true
+}
+
+// HandleChatHistory returns the last chat messages of the symbol, as many as the limit
+// parameter, oldest first
+func (h *PriceHandler) HandleChatHistory(w http.ResponseWriter, r *http.Request) {
+	if !h.configStore.Get().Chat.Enabled {
+		httpError(w, r, "chat is disabled", http.StatusNotFound)
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultChatLimit, 1, maxListLimit)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	writeJSON(w, r, h.priceService.ChatHistory(limit))
 }
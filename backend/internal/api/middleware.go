@@ -0,0 +1,675 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/audit"
+	"server/internal/auth"
+	"server/internal/config"
+	"server/internal/idempotency"
+	"server/internal/metrics"
+	"server/internal/models"
+	"server/internal/quota"
+	"server/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+// RequestIDHeader is the header used to read and return request IDs
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	userKey
+	apiKeyKey
+	quotaKey
+)
+
+// RequestIDMiddleware assigns an ID to every request, reusing one supplied by the client
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// LoggingMiddleware logs the method, path, status and duration of every request
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		log.Printf("[%s] %s %s %d %s", RequestID(r), r.Method, requestPath(r), recorder.status, time.Since(start))
+	})
+}
+
+// requestPath returns the path the client requested, including the namespace prefix
+// removed before routing
+func requestPath(r *http.Request) string {
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil && u.Path != "" {
+		return u.Path
+	}
+	return r.URL.Path
+}
+
+// APIKeyHeader carries API keys. WebSocket clients that can't set headers pass
+// their key in the apiKey query parameter instead.
+const APIKeyHeader = "X-API-Key"
+
+// apiKey returns the API key sent with a request, empty if there is none
+func apiKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("apiKey")
+}
+
+// APIKeyMiddleware requires a valid API key with the given scope when auth.requireApiKey
+// is set. Keys sent while it is not set must still be valid.
+func APIKeyMiddleware(configStore *config.Store, keys *auth.KeyStore, scope string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided := apiKey(r)
+			if provided == "" {
+				if configStore.Get().Auth.RequireAPIKey {
+					httpError(w, r, "API key required", http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key, ok := keys.Authenticate(provided)
+			if !ok {
+				httpError(w, r, "invalid API key", http.StatusUnauthorized)
+				return
+			}
+			if !auth.Allows(key.Scope, scope) {
+				httpError(w, r, fmt.Sprintf("API key %s lacks the %s scope", key.ID, scope), http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), apiKeyKey, key)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// AdminNetworkMiddleware restricts the admin namespace to admin.allowedNetworks and, with
+// admin.clientCaFile, to clients presenting a certificate of that CA. It applies on top of
+// the token and API keys, so a leaked token alone doesn't grant access.
+func AdminNetworkMiddleware(configStore *config.Store) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cfg := configStore.Get().Admin
+
+			if len(cfg.AllowedNetworks) > 0 && !inNetworks(r.RemoteAddr, cfg.AllowedNetworks) {
+				httpError(w, r, "admin access not allowed from "+r.RemoteAddr, http.StatusForbidden)
+				return
+			}
+			// The server only accepts certificates of the configured CA, see serve
+			if cfg.ClientCAFile != "" && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+				httpError(w, r, "admin access requires a client certificate", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// inNetworks reports whether the IP of a remote address is in one of the CIDR ranges
+func inNetworks(remoteAddr string, networks []string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if _, ipNet, err := net.ParseCIDR(network); err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminAuthMiddleware rejects requests that carry neither the configured admin bearer
+// token nor an API key with the admin scope. Actions authorized by a key are audited
+// under the key's name.
+func AdminAuthMiddleware(configStore *config.Store, keys *auth.KeyStore) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if provided := apiKey(r); provided != "" {
+				key, ok := keys.Authenticate(provided)
+				if !ok {
+					httpError(w, r, "invalid API key", http.StatusUnauthorized)
+					return
+				}
+				if !auth.Allows(key.Scope, models.ScopeAdmin) {
+					httpError(w, r, fmt.Sprintf("API key %s lacks the %s scope", key.ID, models.ScopeAdmin), http.StatusForbidden)
+					return
+				}
+				r.Header.Set(ActorHeader, "api-key:"+key.Name)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token := configStore.Get().Admin.Token
+			if token == "" {
+				httpError(w, r, "admin token not configured", http.StatusForbidden)
+				return
+			}
+
+			header := r.Header.Get("Authorization")
+			provided := strings.TrimPrefix(header, "Bearer ")
+			if provided == header {
+				httpError(w, r, "admin bearer token required", http.StatusUnauthorized)
+				return
+			}
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				httpError(w, r, "invalid admin token", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UserMiddleware requires an access token issued at /api/auth/login in the Authorization
+// header or a session cookie and passes the user it belongs to on to the handler, see
+// CurrentUser. Banned users are rejected.
+func UserMiddleware(configStore *config.Store, users *auth.UserStore, bans *auth.BanList) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cfg := configStore.Get().Auth
+			token := accessToken(r, cfg)
+			if token == "" {
+				httpError(w, r, "access token required", http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := auth.ParseToken(cfg.JWTSecret, token, time.Now())
+			if err != nil {
+				httpError(w, r, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			// Tokens of deleted users stop working before they expire
+			user, err := users.Get(claims.Subject)
+			if err != nil {
+				httpError(w, r, auth.ErrInvalidToken.Error(), http.StatusUnauthorized)
+				return
+			}
+			if ban, ok := bans.UserBanned(user.ID); ok {
+				writeBanned(w, r, ban)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// CurrentUser returns the user authenticated by UserMiddleware
+func CurrentUser(r *http.Request) (models.User, bool) {
+	user, ok := r.Context().Value(userKey).(models.User)
+	return user, ok
+}
+
+// Names of the quotas, as reported in quota errors
+const (
+	quotaRequests   = "requestsPerMinute"
+	quotaWSMessages = "wsMessagesPerSecond"
+	quotaChat       = "chatMessagesPerMinute"
+)
+
+// violationWindow is the window in which quota violations count towards an automatic ban
+const violationWindow = 10 * time.Minute
+
+// quotaScope is the user a request counts against, passed on to WebSocket readers
+type quotaScope struct {
+	limiter     *quota.Limiter
+	bans        *auth.BanList
+	configStore *config.Store
+	user        string
+}
+
+// QuotaMiddleware rejects banned users and IP addresses, limits the requests of every user
+// to quotas.requestsPerMinute and lets WebSocket connections opened by the request check
+// quotas.wsMessagesPerSecond, see allowMessage. Users exceeding quotas too often are banned
+// for a while. It must run after APIKeyMiddleware to tell API keys apart.
+func QuotaMiddleware(configStore *config.Store, limiter *quota.Limiter, bans *auth.BanList) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope := quotaScope{limiter: limiter, bans: bans, configStore: configStore, user: quotaUser(r, configStore)}
+
+			if ban, ok := bans.IPBanned(r.RemoteAddr); ok {
+				writeBanned(w, r, ban)
+				return
+			}
+			if userID := strings.TrimPrefix(scope.user, "user:"); userID != scope.user {
+				if ban, ok := bans.UserBanned(userID); ok {
+					writeBanned(w, r, ban)
+					return
+				}
+			}
+
+			limit := configStore.Get().Quotas.RequestsPerMinute
+			if ok, retryAfter := limiter.Allow(quotaRequests, scope.user, limit, time.Minute); !ok {
+				logRequest(r, "Quota %s exceeded by %s", quotaRequests, scope.user)
+				scope.violated(r)
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+				w.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(w).Encode(newQuotaError(quotaRequests, limit, retryAfter))
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), quotaKey, scope)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// allowMessage counts a message sent over the WebSocket connection opened by r against
+// quotas.wsMessagesPerSecond. If it exceeds the quota, the error to send back is returned.
+func allowMessage(r *http.Request) (models.QuotaError, bool) {
+	scope, ok := r.Context().Value(quotaKey).(quotaScope)
+	if !ok {
+		return models.QuotaError{}, true
+	}
+	limit := scope.configStore.Get().Quotas.WSMessagesPerSecond
+	if ok, retryAfter := scope.limiter.Allow(quotaWSMessages, scope.user, limit, time.Second); !ok {
+		scope.violated(r)
+		return newQuotaError(quotaWSMessages, limit, retryAfter), false
+	}
+	return models.QuotaError{}, true
+}
+
+// allowChat counts a chat message sent over the WebSocket connection opened by r against
+// quotas.chatMessagesPerMinute. If it exceeds the quota, the error to send back is returned.
+func allowChat(r *http.Request) (models.QuotaError, bool) {
+	scope, ok := r.Context().Value(quotaKey).(quotaScope)
+	if !ok {
+		return models.QuotaError{}, true
+	}
+	limit := scope.configStore.Get().Quotas.ChatMessagesPerMinute
+	if ok, retryAfter := scope.limiter.Allow(quotaChat, scope.user, limit, time.Minute); !ok {
+		scope.violated(r)
+		return newQuotaError(quotaChat, limit, retryAfter), false
+	}
+	return models.QuotaError{}, true
+}
+
+// violated counts a quota violation of the user and bans them for quotas.banDuration once
+// they reach quotas.banAfter violations within violationWindow. Users with an access
+// token are banned by user ID, everybody else by IP address.
+func (s quotaScope) violated(r *http.Request) {
+	cfg := s.configStore.Get().Quotas
+	if cfg.BanDuration == 0 {
+		return
+	}
+	if ok, _ := s.limiter.Allow("violations", s.user, cfg.BanAfter-1, violationWindow); ok && cfg.BanAfter > 1 {
+		return
+	}
+
+	banType, value := models.BanIP, r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		value = host
+	}
+	if userID := strings.TrimPrefix(s.user, "user:"); userID != s.user {
+		banType, value = models.BanUser, userID
+	}
+
+	reason := fmt.Sprintf("exceeded quotas %d times within %s", cfg.BanAfter, violationWindow)
+	if _, err := s.bans.Ban(banType, value, cfg.BanDuration, reason, true); err != nil {
+		logRequest(r, "Error banning %s %s: %v", banType, value, err)
+		return
+	}
+	logRequest(r, "Banned %s %s for %s: %s", banType, value, cfg.BanDuration, reason)
+}
+
+// writeBanned answers 403 with a ban in the structured error format
+func writeBanned(w http.ResponseWriter, r *http.Request, ban models.Ban) {
+	logRequest(r, "Rejected banned %s %s", ban.Type, ban.Value)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(models.BanError{
+		Type:      "error",
+		Error:     "banned",
+		Reason:    ban.Reason,
+		ExpiresAt: ban.ExpiresAt,
+	})
+}
+
+// newQuotaError describes an exceeded quota
+func newQuotaError(name string, limit int, retryAfter time.Duration) models.QuotaError {
+	return models.QuotaError{
+		Type:       "error",
+		Error:      "quota_exceeded",
+		Quota:      name,
+		Limit:      limit,
+		RetryAfter: retryAfter.Milliseconds(),
+	}
+}
+
+// quotaUser identifies who a request counts against: the user of a valid access token,
+// else the API key authenticated by APIKeyMiddleware, else the client's IP address
+func quotaUser(r *http.Request, configStore *config.Store) string {
+	if cfg := configStore.Get().Auth; cfg.UsersEnabled() {
+		if token := accessToken(r, cfg); token != "" {
+			if claims, err := auth.ParseToken(cfg.JWTSecret, token, time.Now()); err == nil {
+				return "user:" + claims.Subject
+			}
+		}
+	}
+	if key, ok := r.Context().Value(apiKeyKey).(models.APIKey); ok {
+		return "key:" + key.ID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// MaxBodyMiddleware limits the size of request bodies to the configured maximum
+func MaxBodyMiddleware(configStore *config.Store) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			maxBytes := configStore.Get().Server.MaxBodyBytes
+			if r.ContentLength > maxBytes {
+				httpError(w, r, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IdempotencyHeader carries a client-chosen key that makes retries of a request safe
+const IdempotencyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength is the longest idempotency key accepted
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyMiddleware answers repeated requests with the same Idempotency-Key header
+// with the response to the first one instead of performing them again. Keys are scoped
+// to the client, see quotaUser. Server errors aren't kept, so such requests can be retried.
+func IdempotencyMiddleware(configStore *config.Store, cache *idempotency.Cache) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				httpError(w, r, fmt.Sprintf("%s must be at most %d characters", IdempotencyHeader, maxIdempotencyKeyLength), http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				httpError(w, r, "failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			scoped := quotaUser(r, configStore) + "|" + key
+			fingerprint := sha256.Sum256([]byte(r.Method + " " + r.URL.Path + "\n" + string(body)))
+			replay, err := cache.Begin(scoped, hex.EncodeToString(fingerprint[:]))
+			switch {
+			case errors.Is(err, idempotency.ErrInProgress):
+				httpError(w, r, err.Error(), http.StatusConflict)
+				return
+			case errors.Is(err, idempotency.ErrMismatch):
+				httpError(w, r, err.Error(), http.StatusUnprocessableEntity)
+				return
+			case replay != nil:
+				logRequest(r, "Replaying response to idempotency key %q", key)
+				for name, values := range replay.Header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(replay.Status)
+				w.Write(replay.Body)
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			completed := false
+			defer func() {
+				if !completed {
+					// The handler panicked or exited its goroutine, whatever it wrote
+					// isn't its response
+					cache.Abort(scoped)
+					if rec := recover(); rec != nil {
+						panic(rec)
+					}
+					return
+				}
+				if recorder.status >= http.StatusInternalServerError {
+					cache.Abort(scoped)
+					return
+				}
+				header := w.Header().Clone()
+				header.Del(RequestIDHeader) // Replays carry the ID of the retry
+				cache.Finish(scoped, idempotency.Response{
+					Status: recorder.status,
+					Header: header,
+					Body:   recorder.body.Bytes(),
+				})
+			}()
+			next.ServeHTTP(recorder, r)
+			completed = true
+		})
+	}
+}
+
+// ActorHeader optionally names the operator performing an admin action
+const ActorHeader = "X-Actor"
+
+// AuditMiddleware records every mutating admin request in the audit log
+func AuditMiddleware(auditLog *audit.Log) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Keep a copy of the body for the audit entry
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				httpError(w, r, "failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			actor := r.Header.Get(ActorHeader)
+			if actor == "" {
+				actor = "admin"
+			}
+
+			entry := audit.Entry{
+				Timestamp:  time.Now().UnixMilli(),
+				Actor:      actor,
+				RemoteAddr: r.RemoteAddr,
+				RequestID:  RequestID(r),
+				Action:     r.Method + " " + r.URL.Path,
+				Status:     recorder.status,
+			}
+			if json.Valid(body) {
+				entry.Payload = body
+			} else if len(body) > 0 {
+				entry.Payload, _ = json.Marshal(string(body))
+			}
+
+			if err := auditLog.Record(entry); err != nil {
+				logRequest(r, "Error recording audit entry: %v", err)
+			}
+		})
+	}
+}
+
+// RecoveryMiddleware turns panics in handlers into 500 responses instead of crashing the server
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				if rec == http.ErrAbortHandler {
+					panic(rec) // Deliberate aborts are handled by net/http
+				}
+				metrics.PanicsRecovered.Inc()
+				logRequest(r, "Panic: %v\n%s", rec, debug.Stack())
+				httpError(w, r, "internal server error", http.StatusInternalServerError)
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ReadinessMiddleware answers 503 and refuses WebSocket upgrades until the price service is ready
+func ReadinessMiddleware(priceService *service.PriceService) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !priceService.IsReady() {
+				w.Header().Set("Retry-After", "1")
+				httpError(w, r, "price data is still loading", http.StatusServiceUnavailable)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// PrimaryOnlyMiddleware answers 409 Conflict on followers, for admin actions that change
+// prices, which only the primary can do
+func PrimaryOnlyMiddleware(priceService *service.PriceService) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if priceService.IsFollower() {
+				httpError(w, r, "this server follows a primary and is read-only, change the primary instead", http.StatusConflict)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequestID returns the ID assigned to a request, or "-" if none was assigned
+func RequestID(r *http.Request) string {
+	if id, ok := r.Context().Value(requestIDKey).(string); ok {
+		return id
+	}
+	return "-"
+}
+
+// logRequest writes a log line prefixed with the request ID
+func logRequest(r *http.Request, format string, args ...interface{}) {
+	log.Printf("[%s] %s", RequestID(r), fmt.Sprintf(format, args...))
+}
+
+// httpError replies with an error message that includes the request ID
+func httpError(w http.ResponseWriter, r *http.Request, message string, code int) {
+	logRequest(r, "Error: %s", message)
+	http.Error(w, fmt.Sprintf("%s (request ID: %s)", message, RequestID(r)), code)
+}
+
+// newRequestID generates a random request ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code before writing it
+func (sr *statusRecorder) WriteHeader(code int) {
+	sr.status = code
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+// Hijack allows WebSocket upgrades through the recorder
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	sr.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Flush forwards flushes to the underlying writer if supported
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// responseRecorder captures the status code and body written by a handler
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader records the status code before writing it
+func (rr *responseRecorder) WriteHeader(code int) {
+	rr.status = code
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the body while writing it
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
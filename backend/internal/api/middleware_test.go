@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"server/internal/config"
+	"server/internal/idempotency"
+)
+
+func TestIdempotencyMiddlewareForgetsPanics(t *testing.T) {
+	calls := 0
+	handler := IdempotencyMiddleware(config.NewStore(config.Default()), idempotency.NewCache(time.Minute))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				panic("handler failed")
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+	serve := func() (recorder *httptest.ResponseRecorder, panicked bool) {
+		recorder = httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/admin/api-keys", nil)
+		request.Header.Set(IdempotencyHeader, "key")
+		defer func() {
+			panicked = recover() != nil
+		}()
+		handler.ServeHTTP(recorder, request)
+		return recorder, false
+	}
+
+	if _, panicked := serve(); !panicked {
+		t.Fatal("the panic of the handler was swallowed")
+	}
+	if recorder, panicked := serve(); panicked || recorder.Code != http.StatusCreated || calls != 2 {
+		t.Fatalf("retry after a panic answered %d after %d calls, want %d from the handler", recorder.Code, calls, http.StatusCreated)
+	}
+	recorder, _ := serve()
+	if recorder.Code != http.StatusCreated || recorder.Header().Get("Idempotent-Replayed") != "true" || calls != 2 {
+		t.Fatalf("second retry answered %d after %d calls, want the replayed %d", recorder.Code, calls, http.StatusCreated)
+	}
+}
+
+func TestIdempotencyMiddlewareForgetsGoexit(t *testing.T) {
+	calls := 0
+	handler := IdempotencyMiddleware(config.NewStore(config.Default()), idempotency.NewCache(time.Minute))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				runtime.Goexit()
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+	// A panic escaping the goroutine fails the whole test binary
+	serve := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/admin/api-keys", nil)
+		request.Header.Set(IdempotencyHeader, "key")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			handler.ServeHTTP(recorder, request)
+		}()
+		<-done
+		return recorder
+	}
+
+	serve()
+	if recorder := serve(); recorder.Code != http.StatusCreated || calls != 2 {
+		t.Fatalf("retry after a Goexit answered %d after %d calls, want %d from the handler", recorder.Code, calls, http.StatusCreated)
+	}
+}
@@ -0,0 +1,552 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"server/internal/config"
+	"server/internal/models"
+	"server/internal/service"
+)
+
+// Errors of creating and retiring symbols
+var (
+	ErrInvalidSymbol    = errors.New("invalid symbol")
+	ErrSymbolExists     = errors.New("symbol exists already")
+	ErrSymbolNotFound   = errors.New("symbol not found")
+	ErrSymbolConfigured = errors.New("symbol is configured, remove it from the configuration file instead")
+	ErrSymbolInUse      = errors.New("symbol is a constituent of an index")
+)
+
+// symbolsFile is the file in the data directory holding the symbols created at runtime
+const symbolsFile = "symbols.json"
+
+// namespace is a simulation served next to the default one
+type namespace struct {
+	name       string
+	store      *config.Store
+	service    *service.PriceService
+	handler    http.Handler       // Routes of the namespace behind its prefix
+	symbol     *storedSymbol      // Definition of a symbol created at runtime, nil if configured
+	index      map[string]float64 // Constituents and their weights if the namespace is an index
+	derivative string             // Source of a contract listed on another symbol, empty otherwise
+}
+
+// storedSymbol is a symbol created at runtime as saved in the symbols file
+type storedSymbol struct {
+	Name      string                 `json:"name"`
+	Config    config.NamespaceConfig `json:"config"`
+	CreatedAt int64                  `json:"createdAt"` // Unix milliseconds
+}
+
+// Namespaces serves the simulations of namespaces under NamespacePrefix and their name,
+// next to the default simulation. Namespaces of the configuration file exist from the
+// start, symbols created under /admin/symbols start and stop while serving and are kept
+// in the data directory, so they come back after a restart.
+type Namespaces struct {
+	configStore *config.Store
+	root        *service.PriceService
+	path        string
+
+	changes    sync.Mutex // Serializes creating and retiring symbols
+	lock       sync.RWMutex
+	namespaces map[string]*namespace
+	started    bool
+	futures    *Futures
+	perpetuals *Perpetuals
+	venues     *Venues
+	halt       models.TradingHalt // Halt of all symbols, applied to symbols added during it, guarded by lock
+}
+
+// NewNamespaces sets up a price service and the routes of every configured namespace and
+// every symbol created at runtime before. The price service of the default simulation
+// only describes it in the list of symbols.
+func NewNamespaces(configStore *config.Store, root *service.PriceService) (*Namespaces, error) {
+	n := &Namespaces{
+		configStore: configStore,
+		root:        root,
+		path:        filepath.Join(configStore.Get().Data.Dir, symbolsFile),
+		namespaces:  make(map[string]*namespace),
+	}
+
+	for _, name := range configStore.Get().NamespaceNames() {
+		store, err := configStore.Namespace(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := n.add(name, store, nil, configStore.Get().Namespaces[name].Index); err != nil {
+			return nil, err
+		}
+	}
+
+	symbols, err := n.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, symbol := range symbols {
+		if _, ok := n.namespaces[symbol.Name]; ok {
+			log.Printf("Skipping symbol %s created at runtime, a namespace of that name is configured", symbol.Name)
+			continue
+		}
+		if err := symbol.Config.ValidateIndex(symbol.Name, n.isIndex); err != nil {
+			log.Printf("Skipping symbol %s created at runtime: %v", symbol.Name, err)
+			continue
+		}
+		store, err := configStore.AddNamespace(symbol.Name, symbol.Config)
+		if err != nil {
+			log.Printf("Skipping symbol %s created at runtime: %v", symbol.Name, err)
+			continue
+		}
+		if _, err := n.add(symbol.Name, store, symbol, symbol.Config.Index); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ns := range n.list() {
+		n.setIndex(ns)
+	}
+
+	n.futures, err = newFutures(n)
+	if err != nil {
+		return nil, err
+	}
+	n.perpetuals, err = newPerpetuals(n)
+	if err != nil {
+		return nil, err
+	}
+	n.venues = newVenues(n)
+	return n, nil
+}
+
+// add sets up the price service and routes of a namespace
+func (n *Namespaces) add(name string, store *config.Store, symbol *storedSymbol, index map[string]float64) (*namespace, error) {
+	priceService := service.NewPriceService(store.Get())
+	store.OnReload(priceService.ApplyConfig)
+
+	router, err := NewRouter(store, priceService)
+	if err != nil {
+		return nil, fmt.Errorf("namespace %s: %w", name, err)
+	}
+
+	prefix := NamespacePrefix + name
+	ns := &namespace{
+		name:    name,
+		store:   store,
+		service: priceService,
+		handler: http.StripPrefix(prefix, router.Handler),
+		symbol:  symbol,
+	}
+	if len(index) > 0 {
+		ns.index = index
+	}
+	n.lock.Lock()
+	n.namespaces[name] = ns
+	halt := n.halt
+	n.lock.Unlock()
+	if halt.Halted {
+		priceService.SetTradingHalt(true, halt.Reason, halt.CancelOpen)
+	}
+	return ns, nil
+}
+
+// setIndex makes a namespace with constituents an index of their price services
+func (n *Namespaces) setIndex(ns *namespace) {
+	if ns.index == nil {
+		return
+	}
+	names := make([]string, 0, len(ns.index))
+	for name := range ns.index {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	constituents := make([]service.IndexConstituent, 0, len(names))
+	for _, name := range names {
+		priceService := n.root
+		if name != config.DefaultNamespace {
+			n.lock.RLock()
+			priceService = n.namespaces[name].service
+			n.lock.RUnlock()
+		}
+		constituents = append(constituents, service.IndexConstituent{Name: name, Service: priceService, Weight: ns.index[name]})
+	}
+	ns.service.SetIndex(constituents)
+}
+
+// isIndex reports whether a namespace exists and is an index, for config.NamespaceConfig.ValidateIndex
+func (n *Namespaces) isIndex(name string) (index, ok bool) {
+	if name == config.DefaultNamespace {
+		return false, true
+	}
+	n.lock.RLock()
+	ns, ok := n.namespaces[name]
+	n.lock.RUnlock()
+	return ok && ns.index != nil, ok
+}
+
+// Start loads or generates the history of every namespace and starts their simulations,
+// indexes after their constituents, and lists the futures and perpetual contracts and the
+// venues. Symbols created afterwards start right away.
+func (n *Namespaces) Start() {
+	n.changes.Lock()
+	defer n.changes.Unlock()
+
+	namespaces := n.list()
+	for _, ns := range namespaces {
+		if ns.index == nil {
+			start(ns)
+		}
+	}
+	for _, ns := range namespaces {
+		if ns.index != nil {
+			start(ns)
+		}
+	}
+	n.started = true
+	n.futures.start()
+	n.perpetuals.start()
+	n.venues.start()
+}
+
+// Futures returns the futures contracts of the symbols
+func (n *Namespaces) Futures() *Futures {
+	return n.futures
+}
+
+// Perpetuals returns the perpetual contracts of the symbols
+func (n *Namespaces) Perpetuals() *Perpetuals {
+	return n.perpetuals
+}
+
+// Venues returns the simulated exchanges quoting the symbols
+func (n *Namespaces) Venues() *Venues {
+	return n.venues
+}
+
+// addDerivative serves a contract on the symbol of a namespace under its lowercase symbol,
+// with the namespace's settings. setup makes the contract's service price it, source is
+// models.SymbolSourceFutures, models.SymbolSourcePerpetual or models.SymbolSourceVenue. The
+// caller holds changes.
+func (n *Namespaces) addDerivative(symbol, source string, definition config.NamespaceConfig, setup func(*service.PriceService)) error {
+	name := strings.ToLower(symbol)
+	definition.Symbol = symbol
+	definition.Base = ""
+	definition.Index = nil
+	definition.Futures = config.FuturesConfig{}
+	definition.Perpetual = config.PerpetualConfig{}
+	definition.Venues = nil
+
+	store, err := n.configStore.AddNamespace(name, definition)
+	if err != nil {
+		return err
+	}
+	ns, err := n.add(name, store, nil, nil)
+	if err != nil {
+		n.configStore.RemoveNamespace(name)
+		return err
+	}
+	ns.derivative = source
+	setup(ns.service)
+	if n.started {
+		start(ns)
+	}
+	return nil
+}
+
+// get returns a namespace by name, nil if there is none
+func (n *Namespaces) get(name string) *namespace {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.namespaces[name]
+}
+
+// lookup returns the namespace and price service of a symbol, given by its name or the name
+// of its namespace, case-insensitively
+func (n *Namespaces) lookup(symbol string) (string, *service.PriceService, bool) {
+	if strings.EqualFold(symbol, config.DefaultNamespace) || strings.EqualFold(symbol, n.root.GetSimulationParams().Symbol) {
+		return config.DefaultNamespace, n.root, true
+	}
+	ns := n.get(strings.ToLower(symbol))
+	if ns == nil {
+		return "", nil, false
+	}
+	return ns.name, ns.service, true
+}
+
+// start loads or generates the history of a namespace and starts its simulation
+func start(ns *namespace) {
+	ns.service.LoadOrInitialize(1)
+	ns.service.StartNewCandle()
+	go ns.service.Run()
+	ns.service.MarkReady()
+	log.Printf("Price data of namespace %s ready under %s%s", ns.name, NamespacePrefix, ns.name)
+}
+
+// Handler serves the routes of namespaces under NamespacePrefix and their name, and
+// every other request with root
+func (n *Namespaces) Handler(root http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rest := strings.TrimPrefix(r.URL.Path, NamespacePrefix); rest != r.URL.Path {
+			name, _, _ := strings.Cut(rest, "/")
+			n.lock.RLock()
+			ns := n.namespaces[name]
+			n.lock.RUnlock()
+			if ns != nil {
+				ns.handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		root.ServeHTTP(w, r)
+	})
+}
+
+// Symbols describes the default simulation followed by the namespaces, sorted by name
+func (n *Namespaces) Symbols() []models.SymbolInfo {
+	symbols := []models.SymbolInfo{describe(n.root, n.configStore.Get(), "", models.SymbolSourceDefault)}
+	for _, ns := range n.list() {
+		symbols = append(symbols, ns.describe())
+	}
+	return symbols
+}
+
+// CreateSymbol creates a namespace named after the lowercase symbol of the definition and
+// starts its simulation, if namespaces started already. Unset settings are the ones of the
+// default simulation, and an unset number of price decimals follows the tick size. An
+// index may only contain symbols that exist already.
+func (n *Namespaces) CreateSymbol(definition config.NamespaceConfig) (models.SymbolInfo, error) {
+	definition.Symbol = strings.ToUpper(strings.TrimSpace(definition.Symbol))
+	if definition.Symbol == "" {
+		return models.SymbolInfo{}, fmt.Errorf("%w: symbol is required", ErrInvalidSymbol)
+	}
+	if definition.TickSize > 0 && definition.PriceDecimals == nil {
+		decimals := tickDecimals(definition.TickSize)
+		definition.PriceDecimals = &decimals
+	}
+	name := strings.ToLower(definition.Symbol)
+	if err := config.ValidateNamespaceName(name); err != nil {
+		return models.SymbolInfo{}, fmt.Errorf("%w: %v", ErrInvalidSymbol, err)
+	}
+
+	n.changes.Lock()
+	defer n.changes.Unlock()
+
+	n.lock.RLock()
+	_, exists := n.namespaces[name]
+	n.lock.RUnlock()
+	if exists || definition.Symbol == n.configStore.Get().Simulation.Symbol {
+		return models.SymbolInfo{}, fmt.Errorf("%w: %s", ErrSymbolExists, definition.Symbol)
+	}
+
+	if err := definition.ValidateIndex(name, n.isIndex); err != nil {
+		return models.SymbolInfo{}, fmt.Errorf("%w: %v", ErrInvalidSymbol, err)
+	}
+
+	store, err := n.configStore.AddNamespace(name, definition)
+	if err != nil {
+		return models.SymbolInfo{}, fmt.Errorf("%w: %v", ErrInvalidSymbol, err)
+	}
+	symbol := &storedSymbol{Name: name, Config: definition, CreatedAt: time.Now().UnixMilli()}
+	ns, err := n.add(name, store, symbol, definition.Index)
+	if err != nil {
+		n.configStore.RemoveNamespace(name)
+		return models.SymbolInfo{}, err
+	}
+	n.setIndex(ns)
+	if err := n.save(); err != nil {
+		n.remove(name)
+		ns.service.Hub().Close()
+		return models.SymbolInfo{}, err
+	}
+
+	if n.started {
+		start(ns)
+	}
+	return ns.describe(), nil
+}
+
+// RetireSymbol stops the simulation of a symbol created at runtime, disconnects its clients
+// and saves its history. Unless purged, the history is continued if the symbol is created again.
+func (n *Namespaces) RetireSymbol(name string, purge bool) error {
+	n.changes.Lock()
+	defer n.changes.Unlock()
+
+	n.lock.RLock()
+	ns := n.namespaces[name]
+	n.lock.RUnlock()
+	switch {
+	case ns == nil:
+		return fmt.Errorf("%w: %s", ErrSymbolNotFound, name)
+	case ns.derivative == models.SymbolSourceFutures:
+		return fmt.Errorf("%w: futures contract %s is retired after its expiry", ErrSymbolInUse, name)
+	case ns.derivative != "":
+		return fmt.Errorf("%w: %s is listed while its underlying symbol is configured", ErrSymbolInUse, name)
+	case ns.symbol == nil:
+		return fmt.Errorf("%w: %s", ErrSymbolConfigured, name)
+	}
+	for _, other := range n.list() {
+		if _, ok := other.index[name]; ok {
+			return fmt.Errorf("%w: %s is in %s", ErrSymbolInUse, name, other.name)
+		}
+	}
+
+	n.remove(name)
+	if err := n.save(); err != nil {
+		return err
+	}
+	n.stop(ns)
+	if purge {
+		if err := os.RemoveAll(ns.store.Get().Data.Dir); err != nil {
+			return fmt.Errorf("failed to delete data of symbol %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// stop stops the simulation of a namespace no longer served, saving its history, and
+// disconnects its clients
+func (n *Namespaces) stop(ns *namespace) {
+	// Before namespaces started, there is no history to save yet
+	if n.started {
+		if err := ns.service.Stop(); err != nil {
+			log.Printf("Error saving data of namespace %s: %v", ns.name, err)
+		}
+	}
+	ns.service.Hub().Close()
+}
+
+// remove stops serving a namespace and reloading its configuration
+func (n *Namespaces) remove(name string) {
+	n.lock.Lock()
+	delete(n.namespaces, name)
+	n.lock.Unlock()
+	n.configStore.RemoveNamespace(name)
+}
+
+// list returns the namespaces sorted by name
+func (n *Namespaces) list() []*namespace {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	namespaces := make([]*namespace, 0, len(n.namespaces))
+	for _, ns := range n.namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].name < namespaces[j].name
+	})
+	return namespaces
+}
+
+// describe returns the description of the namespace's symbol
+func (ns *namespace) describe() models.SymbolInfo {
+	source := models.SymbolSourceConfig
+	switch {
+	case ns.symbol != nil:
+		source = models.SymbolSourceRuntime
+	case ns.derivative != "":
+		source = ns.derivative
+	}
+	info := describe(ns.service, ns.store.Get(), NamespacePrefix+ns.name, source)
+	if ns.symbol != nil {
+		info.CreatedAt = ns.symbol.CreatedAt
+	}
+	info.Index = ns.index
+	return info
+}
+
+// describe returns the description of the symbol of a price service
+func describe(priceService *service.PriceService, cfg *config.Config, path, source string) models.SymbolInfo {
+	params := priceService.GetSimulationParams()
+	base, quote := cfg.Simulation.Market()
+	return models.SymbolInfo{
+		Symbol:     params.Symbol,
+		Base:       base,
+		Quote:      quote,
+		Namespace:  cfg.NamespaceName(),
+		Path:       path,
+		Source:     source,
+		Model:      params.Model,
+		BasePrice:  params.BasePrice,
+		Volatility: params.Volatility,
+		Precision:  cfg.Simulation.Precision(),
+		Clients:    priceService.Hub().Count(),
+	}
+}
+
+// Markets returns the market of the default simulation followed by those of the namespaces
+func (n *Namespaces) Markets() []service.Market {
+	base, quote := n.configStore.Get().Simulation.Market()
+	markets := []service.Market{{Symbol: n.root.GetSimulationParams().Symbol, Base: base, Quote: quote, Service: n.root}}
+	for _, ns := range n.list() {
+		base, quote := ns.store.Get().Simulation.Market()
+		markets = append(markets, service.Market{Symbol: ns.service.GetSimulationParams().Symbol, Base: base, Quote: quote, Service: ns.service})
+	}
+	return markets
+}
+
+// load reads the symbols created at runtime, none if the file doesn't exist
+func (n *Namespaces) load() ([]*storedSymbol, error) {
+	data, err := os.ReadFile(n.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read symbols: %w", err)
+	}
+
+	var symbols []*storedSymbol
+	if err := json.Unmarshal(data, &symbols); err != nil {
+		return nil, fmt.Errorf("failed to parse symbols %s: %w", n.path, err)
+	}
+	return symbols, nil
+}
+
+// save writes the symbols created at runtime, oldest first
+func (n *Namespaces) save() error {
+	symbols := []*storedSymbol{}
+	for _, ns := range n.list() {
+		if ns.symbol != nil {
+			symbols = append(symbols, ns.symbol)
+		}
+	}
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return symbols[i].CreatedAt < symbols[j].CreatedAt
+	})
+
+	data, err := json.MarshalIndent(symbols, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode symbols: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(n.path), 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	// Write a temporary file and rename it, so a crash never loses all symbols
+	temp := n.path + ".tmp"
+	if err := os.WriteFile(temp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write symbols: %w", err)
+	}
+	if err := os.Rename(temp, n.path); err != nil {
+		return fmt.Errorf("failed to write symbols: %w", err)
+	}
+	return nil
+}
+
+// tickDecimals returns the decimal places of a tick size
+func tickDecimals(tickSize float64) int {
+	formatted := strconv.FormatFloat(tickSize, 'f', -1, 64)
+	if i := strings.IndexByte(formatted, '.'); i >= 0 {
+		return len(formatted) - i - 1
+	}
+	return 0
+}
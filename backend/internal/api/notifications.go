@@ -0,0 +1,195 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/events"
+	"server/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultInboxLimit is the number of notifications listed without a limit parameter
+	defaultInboxLimit = 50
+	// alertInterval is how often the prices of symbols with price alerts are checked
+	alertInterval = time.Second
+)
+
+// NotificationHandler serves the inbox of the user of the access token under
+// /api/notifications and sends system messages under /admin/notifications
+type NotificationHandler struct {
+	inbox *auth.InboxStore
+	users *auth.UserStore
+}
+
+// NewNotificationHandler creates a new instance of NotificationHandler
+func NewNotificationHandler(inbox *auth.InboxStore, users *auth.UserStore) *NotificationHandler {
+	return &NotificationHandler{inbox: inbox, users: users}
+}
+
+// systemMessageRequest is the body of a system message
+type systemMessageRequest struct {
+	UserID  string `json:"userId"` // Recipient, empty for all users
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// HandleNotifications lists the user's newest notifications, up to the limit parameter,
+// only unread ones if the unread parameter is true
+func (h *NotificationHandler) HandleNotifications(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+	limit, err := queryInt(r, "limit", defaultInboxLimit, 1, maxListLimit)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	unreadOnly := false
+	if value := r.URL.Query().Get("unread"); value != "" {
+		if unreadOnly, err = strconv.ParseBool(value); err != nil {
+			writeValidationError(w, r, invalidParameter{name: "unread", message: "must be true or false"})
+			return
+		}
+	}
+	writeJSON(w, r, h.inbox.List(user.ID, unreadOnly, limit))
+}
+
+// HandleNotificationRead marks a notification of the user as read
+func (h *NotificationHandler) HandleNotificationRead(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+	notification, err := h.inbox.MarkRead(user.ID, mux.Vars(r)["id"])
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrNotificationNotFound) {
+			code = http.StatusNotFound
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+	writeJSON(w, r, notification)
+}
+
+// HandleNotificationsRead marks all notifications of the user as read
+func (h *NotificationHandler) HandleNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+	if _, err := h.inbox.MarkAllRead(user.ID); err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, r, h.inbox.List(user.ID, false, defaultInboxLimit))
+}
+
+// HandleSystemMessage delivers a system message to the inbox of a user or all users
+func (h *NotificationHandler) HandleSystemMessage(w http.ResponseWriter, r *http.Request) {
+	var request systemMessageRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+	request.Title = strings.TrimSpace(request.Title)
+	if request.Title == "" {
+		httpError(w, r, "title must not be empty", http.StatusUnprocessableEntity)
+		return
+	}
+
+	var recipients []string
+	if request.UserID == "" {
+		for _, user := range h.users.List() {
+			recipients = append(recipients, user.ID)
+		}
+	} else {
+		if _, err := h.users.Get(request.UserID); err != nil {
+			httpError(w, r, err.Error(), http.StatusNotFound)
+			return
+		}
+		recipients = []string{request.UserID}
+	}
+
+	notification, err := h.inbox.Deliver(recipients, models.Notification{
+		Kind:    models.NotificationSystem,
+		Title:   request.Title,
+		Message: request.Message,
+	})
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logRequest(r, "Admin sent system message %q to %d users", request.Title, len(recipients))
+	writeJSON(w, r, notification)
+}
+
+// alertMonitor delivers the price alerts on watchlists to the inboxes of their users, and
+// sends them to their targets, when
+// the price of their symbol crosses their level. Prices are sampled every alertInterval,
+// so a level reached and left between two samples doesn't fire.
+type alertMonitor struct {
+	watchlists *auth.WatchlistStore
+	inbox      *auth.InboxStore
+	notifiers  *events.Notifiers
+	namespaces *Namespaces
+	prices     map[string]float64 // Price of every watched symbol at the last sample
+}
+
+// run checks the price alerts every alertInterval
+func (m *alertMonitor) run() {
+	ticker := time.NewTicker(alertInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.check()
+	}
+}
+
+// check samples the prices of watched symbols and fires the alerts whose level was crossed
+// since the last sample
+func (m *alertMonitor) check() {
+	alerts := m.watchlists.Alerts()
+	prices := make(map[string]float64)
+	for _, bound := range alerts {
+		price, ok := prices[bound.Symbol]
+		if !ok {
+			_, priceService, found := m.namespaces.lookup(bound.Symbol)
+			if !found {
+				continue
+			}
+			if price, ok = priceService.LastPrice(); !ok {
+				continue
+			}
+			prices[bound.Symbol] = price
+		}
+
+		last, ok := m.prices[bound.Symbol]
+		if !ok {
+			continue
+		}
+		alert := bound.Alert
+		switch {
+		case alert.Above > 0 && last < alert.Above && price >= alert.Above:
+			m.fire(bound, fmt.Sprintf("%s above %g", bound.Symbol, alert.Above), price)
+		case alert.Below > 0 && last > alert.Below && price <= alert.Below:
+			m.fire(bound, fmt.Sprintf("%s below %g", bound.Symbol, alert.Below), price)
+		}
+	}
+	m.prices = prices
+}
+
+// fire delivers a price alert to the inbox of its user and sends it to its targets
+func (m *alertMonitor) fire(bound auth.BoundAlert, title string, price float64) {
+	notification := models.Notification{
+		Kind:    models.NotificationAlert,
+		Title:   title,
+		Message: fmt.Sprintf("%s is at %g, alert on watchlist %s", bound.Symbol, price, bound.Watchlist),
+		Symbol:  bound.Symbol,
+	}
+	if _, err := m.inbox.Deliver([]string{bound.UserID}, notification); err != nil {
+		log.Printf("Error delivering price alert %s: %v", title, err)
+	}
+	for _, target := range bound.Alert.Notify {
+		m.notifiers.Send(target, notification)
+	}
+}
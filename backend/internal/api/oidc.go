@@ -0,0 +1,211 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/config"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	oidcStateCookie = "seedventure_oidc_state"
+	oidcLoginTTL    = 10 * time.Minute // Longest a user may take at the identity provider
+	maxPendingLogin = 10000
+)
+
+// pendingLogin is an identity provider login waiting for its callback
+type pendingLogin struct {
+	provider string
+	verifier string
+	expires  time.Time
+}
+
+// oidcProvider describes an identity provider users can log in with
+type oidcProvider struct {
+	Name     string `json:"name"`
+	LoginURL string `json:"loginUrl"`
+}
+
+// HandleOIDCProviders lists the identity providers users can log in with
+func (h *UserHandler) HandleOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	providers := []oidcProvider{}
+	for _, provider := range h.configStore.Get().Auth.OIDC {
+		providers = append(providers, oidcProvider{
+			Name:     provider.Name,
+			LoginURL: "/api/auth/oidc/" + provider.Name + "/login",
+		})
+	}
+	writeJSON(w, r, providers)
+}
+
+// HandleOIDCLogin sends the browser to an identity provider for logging in
+func (h *UserHandler) HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.provider(mux.Vars(r)["provider"])
+	if !ok {
+		httpError(w, r, "identity provider not found", http.StatusNotFound)
+		return
+	}
+	endpoints, err := h.oidc.Endpoints(provider)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadGateway)
+		return
+	}
+	state, verifier, err := auth.NewOIDCState()
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !h.addPending(state, pendingLogin{provider: provider.Name, verifier: verifier, expires: time.Now().Add(oidcLoginTTL)}) {
+		httpError(w, r, "too many logins in progress", http.StatusServiceUnavailable)
+		return
+	}
+
+	// The state cookie ties the callback to this browser, so nobody can log a user
+	// in to an account of their own by sending them a callback URL
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc/",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, h.oidc.AuthCodeURL(provider, endpoints, state, verifier), http.StatusFound)
+}
+
+// HandleOIDCCallback completes a login at an identity provider. The user is created on
+// their first login, then tokens are issued like for a password login: as JSON, or in
+// the fragment of auth.oidcReturnUrl if it is set.
+func (h *UserHandler) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		httpError(w, r, "login was declined: "+reason, http.StatusUnauthorized)
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || cookie.Value != state {
+		httpError(w, r, "login state does not match this browser", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/auth/oidc/", MaxAge: -1})
+
+	pending, ok := h.takePending(state)
+	if !ok || pending.provider != mux.Vars(r)["provider"] {
+		httpError(w, r, "login expired, please try again", http.StatusBadRequest)
+		return
+	}
+	provider, ok := h.provider(pending.provider)
+	if !ok {
+		httpError(w, r, "identity provider not found", http.StatusNotFound)
+		return
+	}
+	endpoints, err := h.oidc.Endpoints(provider)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	identity, err := h.oidc.Exchange(provider, endpoints, query.Get("code"), pending.verifier)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrOIDCFailed) {
+			code = http.StatusBadGateway
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+	user, err := h.users.Provision(provider.Name, identity)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if ban, ok := h.bans.UserBanned(user.ID); ok {
+		writeBanned(w, r, ban)
+		return
+	}
+
+	cfg := h.configStore.Get().Auth
+	refreshToken, err := h.users.IssueRefreshToken(user.ID, cfg.RefreshTokenTTL)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logRequest(r, "User %s (%s) logged in with %s", user.ID, user.Username, provider.Name)
+
+	if cfg.OIDCReturnURL == "" {
+		h.writeTokens(w, r, user, refreshToken)
+		return
+	}
+
+	tokens, err := h.tokens(user, refreshToken)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if cfg.CookieSessions {
+		if err := setSessionCookies(w, r, tokens, cfg); err != nil {
+			httpError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, cfg.OIDCReturnURL, http.StatusFound)
+		return
+	}
+
+	// Fragments aren't sent to servers, so the tokens only reach the page itself
+	fragment := url.Values{}
+	fragment.Set("accessToken", tokens.AccessToken)
+	fragment.Set("refreshToken", tokens.RefreshToken)
+	fragment.Set("tokenType", tokens.TokenType)
+	fragment.Set("expiresIn", strconv.FormatInt(tokens.ExpiresIn, 10))
+	http.Redirect(w, r, cfg.OIDCReturnURL+"#"+fragment.Encode(), http.StatusFound)
+}
+
+// provider returns the configured identity provider with a name
+func (h *UserHandler) provider(name string) (config.OIDCProviderConfig, bool) {
+	for _, provider := range h.configStore.Get().Auth.OIDC {
+		if provider.Name == name {
+			return provider, true
+		}
+	}
+	return config.OIDCProviderConfig{}, false
+}
+
+// addPending remembers a login until its callback, reporting false if too many are in progress
+func (h *UserHandler) addPending(state string, login pendingLogin) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.pending) >= maxPendingLogin {
+		now := time.Now()
+		for s, p := range h.pending {
+			if now.After(p.expires) {
+				delete(h.pending, s)
+			}
+		}
+		if len(h.pending) >= maxPendingLogin {
+			return false
+		}
+	}
+	h.pending[state] = login
+	return true
+}
+
+// takePending removes and returns the login of a state, if it hasn't expired
+func (h *UserHandler) takePending(state string) (pendingLogin, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	login, ok := h.pending[state]
+	delete(h.pending, state)
+	return login, ok && time.Now().Before(login.expires)
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"server/internal/config"
+	"server/internal/models"
+	"server/internal/service"
+)
+
+// fundingFile is the file in the data directory holding the funding history of perpetual contracts
+const fundingFile = "funding.json"
+
+// maxFundingHistory caps the fundings kept, the oldest are discarded
+const maxFundingHistory = 10000
+
+// Perpetuals lists the perpetual contracts configured on the symbols of the default
+// simulation and the namespaces. Every contract is served like a namespace named after the
+// symbol with a -PERP suffix. At every funding time its clients are told the funding rate,
+// the premium of the contract over the symbol averaged since the last funding.
+type Perpetuals struct {
+	namespaces *Namespaces
+	path       string
+
+	lock      sync.RWMutex
+	contracts []*perpetualContract
+	history   []models.FundingRate
+}
+
+// perpetualContract is a perpetual contract on a symbol
+type perpetualContract struct {
+	symbol     string
+	underlying string
+	spot       *service.PriceService
+	service    *service.PriceService  // Nil until listed
+	definition config.NamespaceConfig // Settings the contract inherits
+	settings   config.PerpetualConfig
+}
+
+// newPerpetuals sets up the perpetual contracts of the configuration, listed by start
+func newPerpetuals(n *Namespaces) (*Perpetuals, error) {
+	cfg := n.configStore.Get()
+	p := &Perpetuals{
+		namespaces: n,
+		path:       filepath.Join(cfg.Data.Dir, fundingFile),
+		history:    []models.FundingRate{},
+	}
+
+	data, err := os.ReadFile(p.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read funding history: %w", err)
+	default:
+		if err := json.Unmarshal(data, &p.history); err != nil {
+			return nil, fmt.Errorf("failed to parse funding history %s: %w", p.path, err)
+		}
+	}
+
+	if cfg.Simulation.Perpetual.Enabled {
+		p.contracts = append(p.contracts, &perpetualContract{
+			symbol:     cfg.Simulation.Symbol + "-PERP",
+			underlying: cfg.Simulation.Symbol,
+			spot:       n.root,
+			settings:   cfg.Simulation.Perpetual,
+		})
+	}
+	for _, name := range cfg.NamespaceNames() {
+		ns := n.get(name)
+		simulation := ns.store.Get().Simulation
+		if !simulation.Perpetual.Enabled {
+			continue
+		}
+		p.contracts = append(p.contracts, &perpetualContract{
+			symbol:     simulation.Symbol + "-PERP",
+			underlying: simulation.Symbol,
+			spot:       ns.service,
+			definition: cfg.Namespaces[name],
+			settings:   simulation.Perpetual,
+		})
+	}
+	return p, nil
+}
+
+// start lists the contracts and funds them at their funding times. The caller holds the
+// changes of the namespaces.
+func (p *Perpetuals) start() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, c := range p.contracts {
+		c := c
+		setup := func(ps *service.PriceService) {
+			ps.SetPerpetual(c.spot, c.underlying, c.settings.PremiumVolatility)
+			c.service = ps
+		}
+		if err := p.namespaces.addDerivative(c.symbol, models.SymbolSourcePerpetual, c.definition, setup); err != nil {
+			log.Printf("Error listing perpetual contract %s: %v", c.symbol, err)
+			continue
+		}
+		log.Printf("Listed perpetual contract %s under %s%s, funding every %s", c.symbol, NamespacePrefix, strings.ToLower(c.symbol), c.settings.FundingInterval)
+		go p.run(c)
+	}
+}
+
+// nextFunding returns the first funding time of a contract after a time
+func (c *perpetualContract) nextFunding(after time.Time) time.Time {
+	return after.Truncate(c.settings.FundingInterval).Add(c.settings.FundingInterval)
+}
+
+// rate returns the funding rate of an average premium: the premium capped at the maximum
+// funding rate
+func (c *perpetualContract) rate(premium float64) float64 {
+	rate := math.Max(-c.settings.MaxFundingRate, math.Min(c.settings.MaxFundingRate, premium))
+	return math.Round(rate*1e8) / 1e8
+}
+
+// run funds a contract at its funding times
+func (p *Perpetuals) run(c *perpetualContract) {
+	for {
+		next := c.nextFunding(time.Now())
+		time.Sleep(time.Until(next))
+		p.fund(c, next)
+	}
+}
+
+// fund takes the funding rate of a contract since its last funding, tells its clients and
+// records it
+func (p *Perpetuals) fund(c *perpetualContract, at time.Time) {
+	rate := c.rate(c.service.TakeFunding())
+	mark, ok := c.service.LastPrice()
+	if !ok {
+		log.Printf("Skipping funding of perpetual contract %s without a price", c.symbol)
+		return
+	}
+
+	funding := models.FundingRate{
+		Symbol:     c.symbol,
+		Underlying: c.underlying,
+		Time:       at.UnixMilli(),
+		Rate:       rate,
+		MarkPrice:  mark,
+	}
+	c.service.Hub().PublishAll(models.FundingMessage{Type: "funding", Funding: funding})
+	log.Printf("Funded %s at a rate of %g, mark price %g", c.symbol, rate, mark)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.history = append(p.history, funding)
+	if len(p.history) > maxFundingHistory {
+		p.history = append([]models.FundingRate(nil), p.history[len(p.history)-maxFundingHistory:]...)
+	}
+	if err := p.save(); err != nil {
+		log.Printf("Error saving funding history: %v", err)
+	}
+}
+
+// Contracts returns the listed contracts with their current premium and the funding rate
+// they would pay now
+func (p *Perpetuals) Contracts() []models.PerpetualContract {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	now := time.Now()
+	contracts := []models.PerpetualContract{}
+	for _, c := range p.contracts {
+		if c.service == nil {
+			continue
+		}
+		premium, average := c.service.Premium()
+		contracts = append(contracts, models.PerpetualContract{
+			Symbol:          c.symbol,
+			Underlying:      c.underlying,
+			Path:            NamespacePrefix + strings.ToLower(c.symbol),
+			FundingInterval: c.settings.FundingInterval.Milliseconds(),
+			NextFunding:     c.nextFunding(now).UnixMilli(),
+			Premium:         premium,
+			PredictedRate:   c.rate(average),
+		})
+	}
+	return contracts
+}
+
+// Funding returns the fundings in [from, to], oldest first, only those of a contract or its
+// underlying symbol if not empty
+func (p *Perpetuals) Funding(symbol string, from, to int64) []models.FundingRate {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	history := []models.FundingRate{}
+	for _, funding := range p.history {
+		if funding.Time < from || funding.Time > to {
+			continue
+		}
+		if symbol == "" || strings.EqualFold(funding.Symbol, symbol) || strings.EqualFold(funding.Underlying, symbol) {
+			history = append(history, funding)
+		}
+	}
+	return history
+}
+
+// save writes the funding history. The caller holds lock.
+func (p *Perpetuals) save() error {
+	data, err := json.MarshalIndent(p.history, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode funding history: %w", err)
+	}
+
+	// Write a temporary file and rename it, so a crash never loses the whole history
+	temp := p.path + ".tmp"
+	if err := os.WriteFile(temp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write funding history: %w", err)
+	}
+	if err := os.Rename(temp, p.path); err != nil {
+		return fmt.Errorf("failed to write funding history: %w", err)
+	}
+	return nil
+}
+
+// HandleContracts lists the perpetual contracts
+func (p *Perpetuals) HandleContracts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, p.Contracts())
+}
+
+// HandleFunding returns the funding history in the range of the from and to parameters, of
+// the contract or underlying symbol of the symbol parameter if given
+func (p *Perpetuals) HandleFunding(w http.ResponseWriter, r *http.Request) {
+	from, to, err := queryTimeRange(r, "from", "to", math.MinInt64, math.MaxInt64)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+	writeJSON(w, r, p.Funding(r.URL.Query().Get("symbol"), from, to))
+}
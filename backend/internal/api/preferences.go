@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"server/internal/auth"
+	"server/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// PreferenceHandler keeps the preferences of the user of the access token under /api/preferences
+type PreferenceHandler struct {
+	preferences *auth.PreferenceStore
+	namespaces  *Namespaces
+}
+
+// NewPreferenceHandler creates a new instance of PreferenceHandler
+func NewPreferenceHandler(preferences *auth.PreferenceStore, namespaces *Namespaces) *PreferenceHandler {
+	return &PreferenceHandler{preferences: preferences, namespaces: namespaces}
+}
+
+// HandlePreferences returns the user's preferences
+func (h *PreferenceHandler) HandlePreferences(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+	writeJSON(w, r, h.preferences.Get(user.ID))
+}
+
+// HandlePreferencesUpdate replaces the user's preferences, drawings included
+func (h *PreferenceHandler) HandlePreferencesUpdate(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+	var request models.Preferences
+	if !decodeBody(w, r, &request) {
+		return
+	}
+
+	preferences, err := h.preferences.Set(user.ID, request)
+	if err != nil {
+		writePreferencesError(w, r, err)
+		return
+	}
+	writeJSON(w, r, preferences)
+}
+
+// HandleDrawing returns the user's drawings on a symbol as they were saved
+func (h *PreferenceHandler) HandleDrawing(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+	symbol := strings.ToUpper(mux.Vars(r)["symbol"])
+	drawing, ok := h.preferences.Get(user.ID).Drawings[symbol]
+	if !ok {
+		httpError(w, r, "no drawings on "+symbol, http.StatusNotFound)
+		return
+	}
+	writeJSON(w, r, drawing)
+}
+
+// HandleDrawingUpdate replaces the user's drawings on a symbol with the body, any JSON
+// value the frontend draws from
+func (h *PreferenceHandler) HandleDrawingUpdate(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+	var drawing json.RawMessage
+	if !decodeBody(w, r, &drawing) {
+		return
+	}
+	if string(drawing) == "null" {
+		httpError(w, r, "drawings must not be null, delete them instead", http.StatusUnprocessableEntity)
+		return
+	}
+	_, priceService, ok := h.namespaces.lookup(mux.Vars(r)["symbol"])
+	if !ok {
+		writePreferencesError(w, r, fmt.Errorf("%w: unknown symbol %q", auth.ErrInvalidPreferences, mux.Vars(r)["symbol"]))
+		return
+	}
+
+	preferences, err := h.preferences.SetDrawing(user.ID, priceService.GetSimulationParams().Symbol, drawing)
+	if err != nil {
+		writePreferencesError(w, r, err)
+		return
+	}
+	writeJSON(w, r, preferences)
+}
+
+// HandleDrawingDelete removes the user's drawings on a symbol
+func (h *PreferenceHandler) HandleDrawingDelete(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+	preferences, err := h.preferences.SetDrawing(user.ID, mux.Vars(r)["symbol"], nil)
+	if err != nil {
+		writePreferencesError(w, r, err)
+		return
+	}
+	writeJSON(w, r, preferences)
+}
+
+// writePreferencesError answers with the status of a preferences error
+func writePreferencesError(w http.ResponseWriter, r *http.Request, err error) {
+	code := http.StatusInternalServerError
+	if errors.Is(err, auth.ErrInvalidPreferences) {
+		code = http.StatusUnprocessableEntity
+	}
+	httpError(w, r, err.Error(), code)
+}
@@ -0,0 +1,343 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"server/internal/audit"
+	"server/internal/auth"
+	"server/internal/config"
+	"server/internal/events"
+	"server/internal/idempotency"
+	"server/internal/metrics"
+	"server/internal/models"
+	"server/internal/quota"
+	"server/internal/scripting"
+	"server/internal/service"
+	"server/internal/webui"
+
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+)
+
+// NamespacePrefix starts the paths of the routes of a namespace, followed by its name
+const NamespacePrefix = "/ns/"
+
+// Router is the complete API of a price service
+type Router struct {
+	Handler  http.Handler // Every route, behind CORS
+	AuditLog *audit.Log   // Admin actions, also for those taken outside of the API
+
+	// For routes mounted after the router is set up
+	routes *mux.Router
+	admin  *mux.Router
+	data   func(http.Handler) http.Handler // Middleware of data routes
+	user   func(http.Handler) http.Handler // Middleware of user routes, behind quotas, nil unless user accounts are enabled
+	users  *auth.UserStore                 // Nil unless user accounts are enabled
+	cipher *auth.Cipher                    // Encrypts account data at rest
+}
+
+// NewRouter sets up every route of the API with the stores in the data directory of the
+// configuration. The price service must not be started yet, as some routes listen to
+// its updates.
+func NewRouter(configStore *config.Store, priceService *service.PriceService) (*Router, error) {
+	cfg := configStore.Get()
+
+	// Push candle events to the configured webhooks
+	deadLetters, err := events.NewDeadLetterLog(filepath.Join(cfg.Data.Dir, "dead-letters.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead-letter log: %w", err)
+	}
+	dispatcher := events.NewDispatcher(configStore, deadLetters)
+	priceService.OnUpdate(dispatcher.OnUpdate)
+
+	// Account data holding identities of players is encrypted at rest if a key is configured
+	dataKey, err := cfg.Data.LoadEncryptionKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption key: %w", err)
+	}
+	dataCipher, err := auth.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption key: %w", err)
+	}
+
+	// API keys for clients and automation
+	apiKeys, err := auth.NewKeyStore(filepath.Join(cfg.Data.Dir, "api-keys.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API keys: %w", err)
+	}
+
+	// Set up router with request IDs and request logging
+	r := mux.NewRouter()
+	r.Use(RequestIDMiddleware, LoggingMiddleware, RecoveryMiddleware, MaxBodyMiddleware(configStore), CSRFMiddleware(configStore))
+
+	// Create a handler with the price service
+	priceHandler := NewPriceHandler(priceService, configStore)
+
+	// Data routes answer 503 until history is loaded and the first candle has started
+	ready := ReadinessMiddleware(priceService)
+
+	// Admin actions changing prices answer 409 on followers
+	primaryOnly := PrimaryOnlyMiddleware(priceService)
+
+	// Data routes need an API key with at least read scope if auth.requireApiKey is set
+	read := APIKeyMiddleware(configStore, apiKeys, models.ScopeRead)
+
+	// Data routes count against the quotas of their user and reject banned clients
+	bans, err := auth.NewBanList(filepath.Join(cfg.Data.Dir, "bans.json"), dataCipher)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bans: %w", err)
+	}
+	limited := QuotaMiddleware(configStore, quota.NewLimiter(), bans)
+
+	// Creating routes replay their response to retries with the same Idempotency-Key
+	idempotent := IdempotencyMiddleware(configStore, idempotency.NewCache(24*time.Hour))
+
+	// Define routes with timeframe support
+	r.Handle("/api/prices/history", read(limited(ready(http.HandlerFunc(priceHandler.HandleHistoricalData))))).Methods("GET")
+	r.Handle("/api/prices/gaps", read(limited(ready(http.HandlerFunc(priceHandler.HandleGaps))))).Methods("GET")
+	r.Handle("/api/trades/recent", read(limited(ready(http.HandlerFunc(priceHandler.HandleRecentTrades))))).Methods("GET")
+	r.Handle("/api/trades/aggregated", read(limited(ready(http.HandlerFunc(priceHandler.HandleAggregatedTrades))))).Methods("GET")
+	r.Handle("/api/cash/flows", read(limited(http.HandlerFunc(priceHandler.HandleCashFlows)))).Methods("GET")
+	r.Handle("/api/chat/history", read(limited(http.HandlerFunc(priceHandler.HandleChatHistory)))).Methods("GET")
+	r.Handle("/api/prices/timeframes", read(limited(http.HandlerFunc(priceHandler.HandleAvailableTimeframes)))).Methods("GET")
+	r.Handle("/api/prices/live", read(limited(ready(http.HandlerFunc(priceHandler.HandleWebsocket)))))
+	r.Handle("/api/prices/live/{timeframe}", read(limited(ready(http.HandlerFunc(priceHandler.HandleWebsocketSubscribe)))))
+	r.Handle("/api/prices/spectate", limited(ready(http.HandlerFunc(priceHandler.HandleSpectate))))
+	r.Handle("/api/prices/spectate/{timeframe}", limited(ready(http.HandlerFunc(priceHandler.HandleSpectate))))
+	r.HandleFunc("/api/ready", priceHandler.HandleReady).Methods("GET")
+	r.HandleFunc("/api/version", priceHandler.HandleVersion).Methods("GET")
+	r.Handle("/api/stats", read(limited(http.HandlerFunc(priceHandler.HandleStats)))).Methods("GET")
+	r.Handle("/api/config/client", read(limited(http.HandlerFunc(priceHandler.HandleClientConfig)))).Methods("GET")
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// Binance-compatible market data API
+	binanceHandler := NewBinanceHandler(priceService, configStore)
+	r.HandleFunc("/api/v3/ping", binanceHandler.HandlePing).Methods("GET")
+	r.HandleFunc("/api/v3/time", binanceHandler.HandleTime).Methods("GET")
+	r.Handle("/api/v3/exchangeInfo", read(limited(http.HandlerFunc(binanceHandler.HandleExchangeInfo)))).Methods("GET")
+	r.Handle("/api/v3/klines", read(limited(ready(http.HandlerFunc(binanceHandler.HandleKlines))))).Methods("GET")
+	r.Handle("/ws/{stream}", read(limited(ready(http.HandlerFunc(binanceHandler.HandleStream)))))
+	r.Handle("/stream", read(limited(ready(http.HandlerFunc(binanceHandler.HandleCombinedStream)))))
+
+	// TradingView UDF-compatible datafeed
+	udfHandler := NewUDFHandler(priceService, configStore)
+	r.HandleFunc("/api/udf/time", udfHandler.HandleTime).Methods("GET")
+	r.Handle("/api/udf/config", read(limited(http.HandlerFunc(udfHandler.HandleConfig)))).Methods("GET")
+	r.Handle("/api/udf/symbols", read(limited(http.HandlerFunc(udfHandler.HandleSymbols)))).Methods("GET")
+	r.Handle("/api/udf/search", read(limited(http.HandlerFunc(udfHandler.HandleSearch)))).Methods("GET")
+	r.Handle("/api/udf/history", read(limited(ready(http.HandlerFunc(udfHandler.HandleHistory))))).Methods("GET")
+
+	// Admin routes, all guarded by the admin token and recorded in the audit log
+	auditLog, err := audit.NewLog(cfg.Admin.AuditFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	adminHandler := NewAdminHandler(configStore, priceService, auditLog)
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(AdminNetworkMiddleware(configStore), AdminAuthMiddleware(configStore, apiKeys), AuditMiddleware(auditLog))
+	admin.HandleFunc("/audit", adminHandler.HandleAudit).Methods("GET")
+	admin.HandleFunc("/config", adminHandler.HandleConfig).Methods("GET")
+	admin.HandleFunc("/config/reload", adminHandler.HandleConfigReload).Methods("POST")
+	admin.Handle("/reset", ready(primaryOnly(http.HandlerFunc(adminHandler.HandleReset)))).Methods("POST")
+	admin.HandleFunc("/simulation", adminHandler.HandleSimulation).Methods("GET")
+	admin.Handle("/simulation", primaryOnly(http.HandlerFunc(adminHandler.HandleSimulationUpdate))).Methods("PATCH")
+	admin.Handle("/simulation/pause", primaryOnly(http.HandlerFunc(adminHandler.HandlePause))).Methods("POST")
+	admin.Handle("/simulation/resume", primaryOnly(http.HandlerFunc(adminHandler.HandleResume))).Methods("POST")
+	admin.HandleFunc("/maintenance", adminHandler.HandleMaintenance).Methods("GET")
+	admin.Handle("/maintenance", primaryOnly(http.HandlerFunc(adminHandler.HandleMaintenanceUpdate))).Methods("POST")
+	admin.Handle("/cash", idempotent(http.HandlerFunc(adminHandler.HandleCash))).Methods("POST")
+	admin.HandleFunc("/connections", adminHandler.HandleConnections).Methods("GET")
+	admin.HandleFunc("/lag", adminHandler.HandleLag).Methods("GET")
+	admin.Handle("/save", ready(http.HandlerFunc(adminHandler.HandleSave))).Methods("POST")
+	admin.Handle("/rebuild", ready(http.HandlerFunc(adminHandler.HandleRebuild))).Methods("POST")
+	admin.Handle("/reload-data", ready(primaryOnly(http.HandlerFunc(adminHandler.HandleReloadData)))).Methods("POST")
+	admin.HandleFunc("/snapshots", adminHandler.HandleSnapshots).Methods("GET")
+	admin.Handle("/snapshots", ready(http.HandlerFunc(adminHandler.HandleSnapshotSave))).Methods("POST")
+	admin.Handle("/snapshots/{name}/restore", ready(primaryOnly(http.HandlerFunc(adminHandler.HandleSnapshotRestore)))).Methods("POST")
+	admin.HandleFunc("/recordings", adminHandler.HandleRecordings).Methods("GET")
+	admin.HandleFunc("/updates", adminHandler.HandleUpdates).Methods("GET")
+	admin.HandleFunc("/recording", adminHandler.HandleRecordingStatus).Methods("GET")
+	admin.Handle("/recording/start", ready(http.HandlerFunc(adminHandler.HandleRecordingStart))).Methods("POST")
+	admin.HandleFunc("/recording/stop", adminHandler.HandleRecordingStop).Methods("POST")
+	admin.Handle("/recordings/{name}/replay", ready(primaryOnly(http.HandlerFunc(adminHandler.HandleReplayStart)))).Methods("POST")
+	admin.HandleFunc("/replay/stop", adminHandler.HandleReplayStop).Methods("POST")
+
+	// Failed webhook deliveries
+	webhookHandler := NewWebhookHandler(dispatcher)
+	admin.HandleFunc("/webhooks/dead-letters", webhookHandler.HandleDeadLetters).Methods("GET")
+	admin.HandleFunc("/webhooks/dead-letters/{id}", webhookHandler.HandleDeadLetter).Methods("GET")
+	admin.HandleFunc("/webhooks/dead-letters/{id}", webhookHandler.HandleDeadLetterDelete).Methods("DELETE")
+	admin.HandleFunc("/webhooks/dead-letters/{id}/replay", webhookHandler.HandleDeadLetterReplay).Methods("POST")
+
+	// API keys
+	apiKeyHandler := NewAPIKeyHandler(apiKeys)
+	admin.HandleFunc("/api-keys", apiKeyHandler.HandleAPIKeys).Methods("GET")
+	admin.Handle("/api-keys", idempotent(http.HandlerFunc(apiKeyHandler.HandleAPIKeyCreate))).Methods("POST")
+	admin.HandleFunc("/api-keys/{id}/rotate", apiKeyHandler.HandleAPIKeyRotate).Methods("POST")
+	admin.HandleFunc("/api-keys/{id}", apiKeyHandler.HandleAPIKeyRevoke).Methods("DELETE")
+
+	// Banned users and IP addresses
+	banHandler := NewBanHandler(bans)
+	admin.HandleFunc("/bans", banHandler.HandleBans).Methods("GET")
+	admin.Handle("/bans", idempotent(http.HandlerFunc(banHandler.HandleBanCreate))).Methods("POST")
+	admin.HandleFunc("/bans/{id}", banHandler.HandleBanDelete).Methods("DELETE")
+
+	// User accounts, for the player-facing parts of the API
+	var user func(http.Handler) http.Handler
+	var users *auth.UserStore
+	if cfg.Auth.UsersEnabled() {
+		users, err = auth.NewUserStore(filepath.Join(cfg.Data.Dir, "users.json"), dataCipher)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load users: %w", err)
+		}
+
+		user = UserMiddleware(configStore, users, bans)
+		userHandler := NewUserHandler(users, bans, configStore)
+		r.Handle("/api/auth/register", limited(idempotent(http.HandlerFunc(userHandler.HandleRegister)))).Methods("POST")
+		r.Handle("/api/auth/login", limited(http.HandlerFunc(userHandler.HandleLogin))).Methods("POST")
+		r.Handle("/api/auth/refresh", limited(http.HandlerFunc(userHandler.HandleRefresh))).Methods("POST")
+		r.HandleFunc("/api/auth/logout", userHandler.HandleLogout).Methods("POST")
+		r.HandleFunc("/api/auth/csrf", userHandler.HandleCSRF).Methods("GET")
+		r.Handle("/api/auth/me", user(http.HandlerFunc(userHandler.HandleMe))).Methods("GET")
+		r.HandleFunc("/api/auth/oidc", userHandler.HandleOIDCProviders).Methods("GET")
+		r.HandleFunc("/api/auth/oidc/{provider}/login", userHandler.HandleOIDCLogin).Methods("GET")
+		r.HandleFunc("/api/auth/oidc/{provider}/callback", userHandler.HandleOIDCCallback).Methods("GET")
+		log.Println("User accounts enabled under /api/auth")
+	}
+
+	// Scenario scripts
+	if cfg.Scripting.Enabled {
+		engine, err := scripting.NewEngine(filepath.Join(cfg.Data.Dir, "scripts"), configStore, priceService)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load scripts: %w", err)
+		}
+		priceService.OnUpdate(engine.OnUpdate)
+
+		scriptHandler := NewScriptHandler(engine)
+		admin.HandleFunc("/scripts", scriptHandler.HandleScripts).Methods("GET")
+		admin.HandleFunc("/scripts/{name}", scriptHandler.HandleScript).Methods("GET")
+		admin.HandleFunc("/scripts/{name}", scriptHandler.HandleScriptPut).Methods("PUT")
+		admin.HandleFunc("/scripts/{name}", scriptHandler.HandleScriptDelete).Methods("DELETE")
+		admin.HandleFunc("/scripts/{name}/enable", scriptHandler.HandleScriptEnable).Methods("POST")
+		admin.HandleFunc("/scripts/{name}/disable", scriptHandler.HandleScriptDisable).Methods("POST")
+		log.Println("Scripting enabled under /admin/scripts")
+	}
+
+	// Profiling endpoints
+	if cfg.Admin.Pprof {
+		admin.PathPrefix("/debug/pprof/").Handler(PprofHandler())
+		log.Println("Profiling endpoints enabled under /admin/debug/pprof")
+	}
+
+	// The embedded frontend answers every other page, so one process serves everything
+	if cfg.Server.Frontend {
+		frontend, err := webui.NewHandler()
+		switch {
+		case errors.Is(err, webui.ErrNotBuilt):
+			log.Println("Frontend not embedded in this build, serving the API only")
+		case err != nil:
+			return nil, fmt.Errorf("failed to load frontend: %w", err)
+		default:
+			r.PathPrefix("/").Handler(frontend).Methods("GET", "HEAD")
+			log.Println("Serving the embedded frontend under /")
+		}
+	}
+
+	// Set up CORS
+	corsMiddleware := handlers.CORS(
+		handlers.AllowedOriginValidator(func(origin string) bool {
+			for _, allowed := range configStore.Get().Server.CORSOrigins {
+				if allowed == "*" || allowed == origin {
+					return true
+				}
+			}
+			return false
+		}),
+		handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"}),
+		handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", APIKeyHeader, IdempotencyHeader, CSRFHeader}),
+	)
+
+	data := func(h http.Handler) http.Handler {
+		return read(limited(ready(h)))
+	}
+	var userRoutes func(http.Handler) http.Handler
+	if user != nil {
+		userRoutes = func(h http.Handler) http.Handler {
+			return limited(user(h))
+		}
+	}
+	return &Router{Handler: corsMiddleware(r), AuditLog: auditLog, routes: r, admin: admin, data: data, user: userRoutes, users: users, cipher: dataCipher}, nil
+}
+
+// MountNamespaces adds the routes spanning the namespaces: creating and retiring their
+// symbols, halting their trading, converting prices with the markets of all of them,
+// listing futures and perpetual contracts and venues, and the watchlists, preferences and
+// notifications of users
+func (r *Router) MountNamespaces(namespaces *Namespaces, configStore *config.Store) error {
+	convertHandler := NewConvertHandler(namespaces, configStore)
+	r.routes.Handle("/api/prices/convert", r.data(http.HandlerFunc(convertHandler.HandleConvert))).Methods("GET")
+	r.routes.Handle("/api/prices/convert/live", r.data(http.HandlerFunc(convertHandler.HandleConvertStream)))
+
+	futures := namespaces.Futures()
+	r.routes.Handle("/api/futures", r.data(http.HandlerFunc(futures.HandleContracts))).Methods("GET")
+	r.routes.Handle("/api/futures/settlements", r.data(http.HandlerFunc(futures.HandleSettlements))).Methods("GET")
+
+	perpetuals := namespaces.Perpetuals()
+	r.routes.Handle("/api/perpetuals", r.data(http.HandlerFunc(perpetuals.HandleContracts))).Methods("GET")
+	r.routes.Handle("/api/perpetuals/funding", r.data(http.HandlerFunc(perpetuals.HandleFunding))).Methods("GET")
+
+	r.routes.Handle("/api/venues", r.data(http.HandlerFunc(namespaces.Venues().HandleMarkets))).Methods("GET")
+
+	symbolHandler := NewSymbolHandler(namespaces)
+	r.admin.HandleFunc("/symbols", symbolHandler.HandleSymbols).Methods("GET")
+	r.admin.HandleFunc("/symbols", symbolHandler.HandleSymbolCreate).Methods("POST")
+	r.admin.HandleFunc("/symbols/{name}", symbolHandler.HandleSymbolRetire).Methods("DELETE")
+
+	tradingHandler := NewTradingHandler(namespaces)
+	r.admin.HandleFunc("/trading", tradingHandler.HandleTrading).Methods("GET")
+	r.admin.HandleFunc("/trading/halt", tradingHandler.HandleTradingHalt).Methods("POST")
+	r.admin.HandleFunc("/trading/resume", tradingHandler.HandleTradingResume).Methods("POST")
+
+	if r.user != nil {
+		watchlists, err := auth.NewWatchlistStore(filepath.Join(configStore.Get().Data.Dir, "watchlists.json"), r.cipher)
+		if err != nil {
+			return fmt.Errorf("failed to load watchlists: %w", err)
+		}
+		notifiers := events.NewNotifiers(configStore)
+		watchlistHandler := NewWatchlistHandler(watchlists, namespaces, notifiers)
+		r.routes.Handle("/api/watchlists", r.user(http.HandlerFunc(watchlistHandler.HandleWatchlists))).Methods("GET")
+		r.routes.Handle("/api/watchlists", r.user(http.HandlerFunc(watchlistHandler.HandleWatchlistCreate))).Methods("POST")
+		r.routes.Handle("/api/watchlists/{id}", r.user(http.HandlerFunc(watchlistHandler.HandleWatchlist))).Methods("GET")
+		r.routes.Handle("/api/watchlists/{id}", r.user(http.HandlerFunc(watchlistHandler.HandleWatchlistUpdate))).Methods("PUT")
+		r.routes.Handle("/api/watchlists/{id}", r.user(http.HandlerFunc(watchlistHandler.HandleWatchlistDelete))).Methods("DELETE")
+
+		preferences, err := auth.NewPreferenceStore(filepath.Join(configStore.Get().Data.Dir, "preferences.json"), r.cipher)
+		if err != nil {
+			return fmt.Errorf("failed to load preferences: %w", err)
+		}
+		preferenceHandler := NewPreferenceHandler(preferences, namespaces)
+		r.routes.Handle("/api/preferences", r.user(http.HandlerFunc(preferenceHandler.HandlePreferences))).Methods("GET")
+		r.routes.Handle("/api/preferences", r.user(http.HandlerFunc(preferenceHandler.HandlePreferencesUpdate))).Methods("PUT")
+		r.routes.Handle("/api/preferences/drawings/{symbol}", r.user(http.HandlerFunc(preferenceHandler.HandleDrawing))).Methods("GET")
+		r.routes.Handle("/api/preferences/drawings/{symbol}", r.user(http.HandlerFunc(preferenceHandler.HandleDrawingUpdate))).Methods("PUT")
+		r.routes.Handle("/api/preferences/drawings/{symbol}", r.user(http.HandlerFunc(preferenceHandler.HandleDrawingDelete))).Methods("DELETE")
+
+		inbox, err := auth.NewInboxStore(filepath.Join(configStore.Get().Data.Dir, "notifications.json"), r.cipher)
+		if err != nil {
+			return fmt.Errorf("failed to load notifications: %w", err)
+		}
+		notificationHandler := NewNotificationHandler(inbox, r.users)
+		r.routes.Handle("/api/notifications", r.user(http.HandlerFunc(notificationHandler.HandleNotifications))).Methods("GET")
+		r.routes.Handle("/api/notifications/read", r.user(http.HandlerFunc(notificationHandler.HandleNotificationsRead))).Methods("POST")
+		r.routes.Handle("/api/notifications/{id}/read", r.user(http.HandlerFunc(notificationHandler.HandleNotificationRead))).Methods("POST")
+		r.admin.HandleFunc("/notifications", notificationHandler.HandleSystemMessage).Methods("POST")
+		go (&alertMonitor{watchlists: watchlists, inbox: inbox, notifiers: notifiers, namespaces: namespaces}).run()
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package api_test
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+
+	"server/internal/api"
+	"server/internal/api/apitest"
+	"server/internal/config"
+	"server/internal/models"
+)
+
+func TestRouterServesHistory(t *testing.T) {
+	server := apitest.NewServer(t, apitest.Options{})
+
+	response, err := http.Get(server.URL + "/api/prices/history?timeframe=1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("history answered %d", response.StatusCode)
+	}
+
+	var history models.TimeFrameData
+	if err := json.NewDecoder(response.Body).Decode(&history); err != nil {
+		t.Fatal(err)
+	}
+	if history.TimeFrame != models.TimeFrame1Hour || len(history.Candles) < 24 {
+		t.Fatalf("got %d %s candles, want a day of 1h candles", len(history.Candles), history.TimeFrame)
+	}
+	for _, candle := range history.Candles {
+		if err := candle.CheckOHLC(); err != nil {
+			t.Fatalf("candle at %d: %v", candle.Timestamp, err)
+		}
+	}
+}
+
+func TestRouterGuardsAdminRoutes(t *testing.T) {
+	server := apitest.NewServer(t, apitest.Options{})
+
+	for _, test := range []struct {
+		name          string
+		authorization string // Replaces the header of AdminRequest unless empty
+		want          int
+	}{
+		{"without token", "none", http.StatusUnauthorized},
+		{"without scheme", server.AdminToken, http.StatusUnauthorized},
+		{"with another scheme", "Basic " + server.AdminToken, http.StatusUnauthorized},
+		{"with wrong token", "Bearer wrong", http.StatusUnauthorized},
+		{"with token", "", http.StatusOK},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			request := server.AdminRequest(t, http.MethodGet, "/admin/maintenance")
+			switch test.authorization {
+			case "":
+			case "none":
+				request.Header.Del("Authorization")
+			default:
+				request.Header.Set("Authorization", test.authorization)
+			}
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if response.StatusCode != test.want {
+				t.Fatalf("got %d, want %d", response.StatusCode, test.want)
+			}
+		})
+	}
+}
+
+func TestRouterAppliesCORSOrigins(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.CORSOrigins = []string{"https://allowed.example"}
+	server := apitest.NewServer(t, apitest.Options{Config: cfg})
+
+	for _, path := range []string{"/api/prices/history", "/api/prices/timeframes"} {
+		for origin, want := range map[string]string{
+			"https://allowed.example": "https://allowed.example",
+			"https://other.example":   "",
+		} {
+			request, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request.Header.Set("Origin", origin)
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if got := response.Header.Get("Access-Control-Allow-Origin"); got != want {
+				t.Errorf("%s from %s allowed origin %q, want %q", path, origin, got, want)
+			}
+		}
+	}
+}
+
+func TestRouterPaysCashOncePerIdempotencyKey(t *testing.T) {
+	server := apitest.NewServer(t, apitest.Options{})
+
+	for i := 0; i < 2; i++ {
+		request := server.AdminRequest(t, http.MethodPost, "/admin/cash")
+		request.Body = io.NopCloser(strings.NewReader(`{"amount":100,"reason":"bonus"}`))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(api.IdempotencyHeader, "deposit-1")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			t.Fatalf("deposit %d answered %d", i+1, response.StatusCode)
+		}
+		if replayed := response.Header.Get("Idempotent-Replayed") == "true"; replayed != (i > 0) {
+			t.Fatalf("deposit %d replayed %v", i+1, replayed)
+		}
+	}
+	if flows := server.Service.CashFlows(math.MinInt64, math.MaxInt64); len(flows) != 1 {
+		t.Fatalf("got %d cash flows, want the retried deposit paid once", len(flows))
+	}
+}
+
+func TestRouterLimitsUserRoutes(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = "test-jwt-secret-of-32-characters"
+	cfg.Quotas.RequestsPerMinute = 1
+	server := apitest.NewServer(t, apitest.Options{Config: cfg})
+
+	for _, path := range []string{"/api/watchlists", "/api/preferences", "/api/notifications"} {
+		var codes []int
+		for i := 0; i < 2; i++ {
+			response, err := http.Get(server.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			codes = append(codes, response.StatusCode)
+		}
+		if codes[1] != http.StatusTooManyRequests {
+			t.Errorf("%s answered %v, want the second request over the quota", path, codes)
+		}
+	}
+}
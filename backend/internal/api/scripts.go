@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"server/internal/scripting"
+
+	"github.com/gorilla/mux"
+)
+
+// ScriptHandler manages scenario scripts under /admin/scripts
+type ScriptHandler struct {
+	engine *scripting.Engine
+}
+
+// NewScriptHandler creates a new instance of ScriptHandler
+func NewScriptHandler(engine *scripting.Engine) *ScriptHandler {
+	return &ScriptHandler{engine: engine}
+}
+
+// HandleScripts lists the installed scripts with their run statistics
+func (h *ScriptHandler) HandleScripts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, h.engine.List())
+}
+
+// HandleScript returns an installed script including its source
+func (h *ScriptHandler) HandleScript(w http.ResponseWriter, r *http.Request) {
+	script, err := h.engine.Get(mux.Vars(r)["name"])
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, r, script)
+}
+
+// HandleScriptPut installs or replaces a script. The request body is the Tengo source.
+func (h *ScriptHandler) HandleScriptPut(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	source, err := io.ReadAll(r.Body)
+	if err != nil {
+		httpError(w, r, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logRequest(r, "Admin requested install of script %s", name)
+	script, err := h.engine.Put(name, string(source))
+	if err != nil {
+		code := http.StatusUnprocessableEntity
+		if errors.Is(err, scripting.ErrTooManyScripts) {
+			code = http.StatusConflict
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+	writeJSON(w, r, script)
+}
+
+// HandleScriptDelete removes a script
+func (h *ScriptHandler) HandleScriptDelete(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	logRequest(r, "Admin requested deletion of script %s", name)
+	if err := h.engine.Delete(name); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, scripting.ErrScriptNotFound) {
+			code = http.StatusNotFound
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+	writeJSON(w, r, adminStatus{Status: "deleted"})
+}
+
+// HandleScriptEnable runs a script again, after it was disabled manually or for failing
+func (h *ScriptHandler) HandleScriptEnable(w http.ResponseWriter, r *http.Request) {
+	h.setEnabled(w, r, true)
+}
+
+// HandleScriptDisable stops running a script until it is enabled or the server restarts
+func (h *ScriptHandler) HandleScriptDisable(w http.ResponseWriter, r *http.Request) {
+	h.setEnabled(w, r, false)
+}
+
+// setEnabled enables or disables the script named in the request
+func (h *ScriptHandler) setEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	script, err := h.engine.SetEnabled(mux.Vars(r)["name"], enabled)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, r, script)
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"server/internal/config"
+	"server/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// Cookies of cookie sessions, see auth.cookieSessions
+const (
+	accessCookie  = "seedventure_access"
+	refreshCookie = "seedventure_refresh"
+	csrfCookie    = "seedventure_csrf"
+)
+
+// CSRFHeader must repeat the CSRF cookie on mutating requests authenticated by cookies
+const CSRFHeader = "X-CSRF-Token"
+
+// csrfResponse is the response to GET /api/auth/csrf
+type csrfResponse struct {
+	CSRFToken string `json:"csrfToken"`
+}
+
+// accessToken returns the access token of a request, from the Authorization header or,
+// with cookie sessions, the access cookie
+func accessToken(r *http.Request, cfg config.AuthConfig) string {
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" {
+		return token
+	}
+	if cfg.CookieSessions {
+		if cookie, err := r.Cookie(accessCookie); err == nil {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// setSessionCookies stores tokens in HttpOnly cookies, so scripts injected into the
+// frontend can't read them, along with a CSRF token if the browser has none yet
+func setSessionCookies(w http.ResponseWriter, r *http.Request, tokens models.TokenPair, cfg config.AuthConfig) error {
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessCookie,
+		Value:    tokens.AccessToken,
+		Path:     "/",
+		MaxAge:   int(cfg.AccessTokenTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookie,
+		Value:    tokens.RefreshToken,
+		Path:     "/api/auth/",
+		MaxAge:   int(cfg.RefreshTokenTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	_, err := csrfToken(w, r, cfg)
+	return err
+}
+
+// clearSessionCookies removes the tokens stored by setSessionCookies
+func clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: accessCookie, Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	http.SetCookie(w, &http.Cookie{Name: refreshCookie, Path: "/api/auth/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+}
+
+// csrfToken returns the CSRF token of the browser, issuing one in a cookie readable by
+// the frontend if it has none. The token lives as long as refresh tokens.
+func csrfToken(w http.ResponseWriter, r *http.Request, cfg config.AuthConfig) (string, error) {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(cfg.RefreshTokenTTL.Seconds()),
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token, nil
+}
+
+// HandleCSRF returns the CSRF token of the browser, issuing one if needed. Frontends can
+// also read it from the seedventure_csrf cookie.
+func (h *UserHandler) HandleCSRF(w http.ResponseWriter, r *http.Request) {
+	cfg := h.configStore.Get().Auth
+	if !cfg.CookieSessions {
+		httpError(w, r, "cookie sessions are disabled", http.StatusNotFound)
+		return
+	}
+	token, err := csrfToken(w, r, cfg)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, csrfResponse{CSRFToken: token})
+}
+
+// CSRFMiddleware rejects mutating requests that carry session cookies unless the
+// X-CSRF-Token header repeats the CSRF cookie. Other sites can make browsers send the
+// cookies, but can't read the CSRF cookie to set the header. Requests authenticated by
+// headers aren't affected, as browsers never add those on their own.
+func CSRFMiddleware(configStore *config.Store) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !configStore.Get().Auth.CookieSessions || !hasSessionCookie(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cookie, err := r.Cookie(csrfCookie)
+			header := r.Header.Get(CSRFHeader)
+			if err != nil || header == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 {
+				logRequest(r, "Rejected request without valid CSRF token")
+				httpError(w, r, "missing or invalid "+CSRFHeader+" header", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasSessionCookie reports whether a request carries a token in a cookie
+func hasSessionCookie(r *http.Request) bool {
+	for _, name := range []string{accessCookie, refreshCookie} {
+		if _, err := r.Cookie(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package api_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"server/internal/api/apitest"
+	"server/internal/config"
+	"server/internal/models"
+	"server/pkg/seedtest"
+)
+
+const frameTimeout = 5 * time.Second
+
+func TestStreamKeepsCandleOrder(t *testing.T) {
+	clock := seedtest.NewClock(seedtest.Start)
+	server := apitest.NewServer(t, apitest.Options{Now: clock.Now})
+	full := apitest.Dial(t, server.WebSocketURL("/api/prices/live"))
+	deltas := apitest.Dial(t, server.WebSocketURL("/api/prices/live?deltas=true"))
+	for _, client := range []*apitest.Client{full, deltas} {
+		client.NextOf("update", frameTimeout)
+	}
+
+	for minute := 0; minute < 3; minute++ {
+		for tick := 0; tick < 5; tick++ {
+			clock.Advance(10 * time.Second)
+			server.Service.UpdateCurrentCandle()
+		}
+		clock.Advance(10 * time.Second)
+		server.Service.FinalizeCurrentCandle()
+		server.Service.StartNewCandle()
+
+		for _, client := range []*apitest.Client{full, deltas} {
+			if frame := client.NextOf("new", frameTimeout); frame.Candle.Timestamp != clock.Now().UnixMilli() {
+				t.Fatalf("new candle at %d, want %d", frame.Candle.Timestamp, clock.Now().UnixMilli())
+			}
+		}
+	}
+
+	deltas.Subscribe(models.TimeFrame5Min)
+	if history := deltas.NextOf("history", frameTimeout); history.TimeFrame != models.TimeFrame5Min || len(history.History) == 0 {
+		t.Fatalf("got %d candles of %s after subscribing to 5m", len(history.History), history.TimeFrame)
+	}
+
+	var deltaFrames int
+	for _, frame := range deltas.Frames() {
+		if frame.Type == "delta" {
+			deltaFrames++
+		}
+	}
+	if deltaFrames == 0 {
+		t.Error("the client that opted into deltas got none")
+	}
+	full.AssertOrder()
+	deltas.AssertOrder()
+}
+
+func TestSpectatorsCannotChatRightAway(t *testing.T) {
+	const spectators = 20
+	cfg := config.Default()
+	cfg.Server.WebSocket.Spectators = spectators
+	server := apitest.NewServer(t, apitest.Options{Config: cfg})
+
+	// Each spectator chats as soon as it's connected, before the server could mark it
+	clients := make([]*apitest.Client, spectators)
+	for i := range clients {
+		clients[i] = apitest.Dial(t, server.WebSocketURL("/api/prices/spectate"))
+		clients[i].Send(models.ChatRequest{Type: "chat", Text: "hello"})
+	}
+	for i, client := range clients {
+		frame := client.NextOf("error", frameTimeout)
+		if !strings.Contains(string(frame.Raw), "spectators cannot chat") {
+			t.Fatalf("spectator %d got %s, want its chat rejected", i, frame.Raw)
+		}
+	}
+	for _, frame := range clients[spectators-1].Frames() {
+		if frame.Type == "chat" {
+			t.Fatalf("a spectator's chat was posted: %s", frame.Raw)
+		}
+	}
+}
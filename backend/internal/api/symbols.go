@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"server/internal/config"
+
+	"github.com/gorilla/mux"
+)
+
+// SymbolHandler creates and retires simulated symbols under /admin/symbols
+type SymbolHandler struct {
+	namespaces *Namespaces
+}
+
+// NewSymbolHandler creates a new instance of SymbolHandler
+func NewSymbolHandler(namespaces *Namespaces) *SymbolHandler {
+	return &SymbolHandler{namespaces: namespaces}
+}
+
+// HandleSymbols lists the simulated symbols and where they are served
+func (h *SymbolHandler) HandleSymbols(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, h.namespaces.Symbols())
+}
+
+// HandleSymbolCreate creates a symbol served under /ns/<lowercase symbol> and starts
+// generating its prices, with the history of an earlier symbol of that name if kept
+func (h *SymbolHandler) HandleSymbolCreate(w http.ResponseWriter, r *http.Request) {
+	var definition config.NamespaceConfig
+	if !decodeBody(w, r, &definition) {
+		return
+	}
+
+	symbol, err := h.namespaces.CreateSymbol(definition)
+	if err != nil {
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrInvalidSymbol):
+			code = http.StatusUnprocessableEntity
+		case errors.Is(err, ErrSymbolExists):
+			code = http.StatusConflict
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+
+	logRequest(r, "Admin created symbol %s under %s", symbol.Symbol, symbol.Path)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, r, symbol)
+}
+
+// HandleSymbolRetire stops a symbol created at runtime and disconnects its clients. Its
+// history is kept unless purge is set.
+func (h *SymbolHandler) HandleSymbolRetire(w http.ResponseWriter, r *http.Request) {
+	name := strings.ToLower(mux.Vars(r)["name"])
+	purge, _ := strconv.ParseBool(r.URL.Query().Get("purge"))
+	if err := h.namespaces.RetireSymbol(name, purge); err != nil {
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrSymbolNotFound):
+			code = http.StatusNotFound
+		case errors.Is(err, ErrSymbolConfigured), errors.Is(err, ErrSymbolInUse):
+			code = http.StatusConflict
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+
+	logRequest(r, "Admin retired symbol %s", name)
+	writeJSON(w, r, adminStatus{Status: "retired"})
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"server/internal/config"
+	"server/internal/models"
+	"server/internal/service"
+)
+
+// TradingHalts returns the trading status of every symbol
+func (n *Namespaces) TradingHalts() []models.TradingHalt {
+	halts := []models.TradingHalt{tradingHalt(config.DefaultNamespace, n.root)}
+	for _, ns := range n.list() {
+		halts = append(halts, tradingHalt(ns.name, ns.service))
+	}
+	return halts
+}
+
+// tradingHalt returns the trading status of the symbol of a namespace
+func tradingHalt(name string, priceService *service.PriceService) models.TradingHalt {
+	halt := priceService.TradingHalt()
+	halt.Namespace = name
+	return halt
+}
+
+// SetTradingHalt halts or resumes trading of a symbol, given by its name or the name of its
+// namespace, or of all symbols if empty. A halt of all symbols also halts the symbols added
+// until trading resumes.
+func (n *Namespaces) SetTradingHalt(symbol string, halted bool, reason string, cancelOpen bool) ([]models.TradingHalt, error) {
+	if symbol == "" {
+		n.lock.Lock()
+		n.halt = models.TradingHalt{Halted: halted, Reason: reason, CancelOpen: cancelOpen}
+		n.lock.Unlock()
+
+		n.root.SetTradingHalt(halted, reason, cancelOpen)
+		for _, ns := range n.list() {
+			ns.service.SetTradingHalt(halted, reason, cancelOpen)
+		}
+		return n.TradingHalts(), nil
+	}
+
+	name, priceService, ok := n.lookup(symbol)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+	}
+	priceService.SetTradingHalt(halted, reason, cancelOpen)
+	return []models.TradingHalt{tradingHalt(name, priceService)}, nil
+}
+
+// TradingHandler halts and resumes trading under /admin/trading
+type TradingHandler struct {
+	namespaces *Namespaces
+}
+
+// NewTradingHandler creates a new instance of TradingHandler
+func NewTradingHandler(namespaces *Namespaces) *TradingHandler {
+	return &TradingHandler{namespaces: namespaces}
+}
+
+// tradingRequest is the body of a trading halt or resumption
+type tradingRequest struct {
+	Symbol     string `json:"symbol"` // Symbol or namespace, empty for all symbols
+	Reason     string `json:"reason"`
+	CancelOpen bool   `json:"cancelOpen"` // Tell clients to close open positions at the current price
+}
+
+// HandleTrading lists the trading status of every symbol
+func (h *TradingHandler) HandleTrading(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, h.namespaces.TradingHalts())
+}
+
+// HandleTradingHalt halts trading of a symbol or all symbols: prices keep moving, but
+// clients are told with a trading_halted status not to accept orders
+func (h *TradingHandler) HandleTradingHalt(w http.ResponseWriter, r *http.Request) {
+	h.update(w, r, true)
+}
+
+// HandleTradingResume resumes trading of a symbol or all symbols
+func (h *TradingHandler) HandleTradingResume(w http.ResponseWriter, r *http.Request) {
+	h.update(w, r, false)
+}
+
+// update halts or resumes trading as requested and responds with the changed statuses
+func (h *TradingHandler) update(w http.ResponseWriter, r *http.Request, halted bool) {
+	var request tradingRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+
+	halts, err := h.namespaces.SetTradingHalt(strings.TrimSpace(request.Symbol), halted, request.Reason, request.CancelOpen)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, ErrSymbolNotFound) {
+			code = http.StatusNotFound
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+
+	target := request.Symbol
+	if target == "" {
+		target = "all symbols"
+	}
+	if halted {
+		logRequest(r, "Admin halted trading of %s: %s", target, request.Reason)
+	} else {
+		logRequest(r, "Admin resumed trading of %s", target)
+	}
+	writeJSON(w, r, halts)
+}
@@ -0,0 +1,367 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/config"
+	"server/internal/models"
+	"server/internal/service"
+)
+
+// The UDF facade serves the price data in the shape of the Universal Data Feed of the
+// TradingView charting library, so its UDF datafeed and widgets built on Lightweight Charts
+// can be pointed at /api/udf without a custom adapter. Times are Unix seconds.
+// Marks, quotes and group requests are not implemented.
+
+const (
+	udfExchange = "Seedventure" // Exchange the symbol is listed on, also accepted as a symbol prefix
+	udfType     = "crypto"      // Symbol type, as prices are generated around the clock
+
+	// maxUDFBars caps the bars of a countback request, the datafeed asks for older ones
+	// when it gets fewer
+	maxUDFBars = 10000
+
+	// maxUDFTime keeps Unix seconds within the range of Unix milliseconds
+	maxUDFTime = math.MaxInt64 / 1000
+)
+
+// udfResolutions maps the resolutions of the datafeed to timeframes, shortest first
+var udfResolutions = []struct {
+	resolution string
+	timeFrame  models.TimeFrame
+}{
+	{"1", models.TimeFrame1Min},
+	{"5", models.TimeFrame5Min},
+	{"15", models.TimeFrame15Min},
+	{"60", models.TimeFrame1Hour},
+	{"240", models.TimeFrame4Hour},
+	{"1D", models.TimeFrame1Day},
+}
+
+// udfError is the error body of the UDF
+type udfError struct {
+	S      string `json:"s"` // Always "error"
+	Errmsg string `json:"errmsg"`
+}
+
+// udfConfig describes what the datafeed supports
+type udfConfig struct {
+	SupportedResolutions   []string        `json:"supported_resolutions"`
+	SupportsGroupRequest   bool            `json:"supports_group_request"`
+	SupportsMarks          bool            `json:"supports_marks"`
+	SupportsSearch         bool            `json:"supports_search"`
+	SupportsTimescaleMarks bool            `json:"supports_timescale_marks"`
+	SupportsTime           bool            `json:"supports_time"`
+	Exchanges              []udfFilter     `json:"exchanges"`
+	SymbolsTypes           []udfSymbolType `json:"symbols_types"`
+}
+
+// udfFilter is an exchange symbols are searched on
+type udfFilter struct {
+	Value string `json:"value"`
+	Name  string `json:"name"`
+	Desc  string `json:"desc"`
+}
+
+// udfSymbolType is a type symbols are searched by
+type udfSymbolType struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// udfSymbolInfo describes a symbol to the charting library
+type udfSymbolInfo struct {
+	Name                 string   `json:"name"`
+	Ticker               string   `json:"ticker"`
+	Description          string   `json:"description"`
+	Type                 string   `json:"type"`
+	Session              string   `json:"session"`
+	Exchange             string   `json:"exchange"`
+	ListedExchange       string   `json:"listed_exchange"`
+	Timezone             string   `json:"timezone"`
+	Format               string   `json:"format"`
+	CurrencyCode         string   `json:"currency_code"`
+	PriceScale           int64    `json:"pricescale"`
+	MinMov               int64    `json:"minmov"`
+	HasIntraday          bool     `json:"has_intraday"`
+	HasDaily             bool     `json:"has_daily"`
+	HasWeeklyAndMonthly  bool     `json:"has_weekly_and_monthly"`
+	IntradayMultipliers  []string `json:"intraday_multipliers"`
+	DailyMultipliers     []string `json:"daily_multipliers"`
+	SupportedResolutions []string `json:"supported_resolutions"`
+	VolumePrecision      int      `json:"volume_precision"`
+	DataStatus           string   `json:"data_status"`
+}
+
+// udfSearchResult is a symbol found by a search
+type udfSearchResult struct {
+	Symbol      string `json:"symbol"`
+	FullName    string `json:"full_name"`
+	Description string `json:"description"`
+	Exchange    string `json:"exchange"`
+	Ticker      string `json:"ticker"`
+	Type        string `json:"type"`
+}
+
+// udfHistory holds bars as columns, or only the status and the time of the newest bar
+// before the requested range if it holds none
+type udfHistory struct {
+	S        string    `json:"s"` // "ok" or "no_data"
+	T        []int64   `json:"t,omitempty"`
+	O        []float64 `json:"o,omitempty"`
+	H        []float64 `json:"h,omitempty"`
+	L        []float64 `json:"l,omitempty"`
+	C        []float64 `json:"c,omitempty"`
+	V        []float64 `json:"v,omitempty"`
+	NextTime *int64    `json:"nextTime,omitempty"`
+}
+
+// UDFHandler serves the UDF-compatible API
+type UDFHandler struct {
+	priceService *service.PriceService
+	configStore  *config.Store
+}
+
+// NewUDFHandler creates a new instance of UDFHandler
+func NewUDFHandler(priceService *service.PriceService, configStore *config.Store) *UDFHandler {
+	return &UDFHandler{priceService: priceService, configStore: configStore}
+}
+
+// writeUDFError writes an error in the format of the UDF
+func writeUDFError(w http.ResponseWriter, r *http.Request, code int, msg string) {
+	logRequest(r, "Error: %s", msg)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(udfError{S: "error", Errmsg: msg})
+}
+
+// HandleConfig describes the datafeed
+func (h *UDFHandler) HandleConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, udfConfig{
+		SupportedResolutions: udfResolutionNames(),
+		SupportsSearch:       true,
+		SupportsTime:         true,
+		Exchanges: []udfFilter{
+			{Value: "", Name: "All Exchanges", Desc: ""},
+			{Value: udfExchange, Name: udfExchange, Desc: udfExchange},
+		},
+		SymbolsTypes: []udfSymbolType{
+			{Name: "All types", Value: ""},
+			{Name: "Crypto", Value: udfType},
+		},
+	})
+}
+
+// HandleTime returns the server time in seconds, as plain text
+func (h *UDFHandler) HandleTime(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprint(w, time.Now().Unix())
+}
+
+// HandleSymbols resolves the symbol parameter, with or without the exchange prefix
+func (h *UDFHandler) HandleSymbols(w http.ResponseWriter, r *http.Request) {
+	if !h.validSymbol(r.URL.Query().Get("symbol")) {
+		writeUDFError(w, r, http.StatusNotFound, "unknown_symbol")
+		return
+	}
+	writeJSON(w, r, h.symbolInfo())
+}
+
+// HandleSearch finds the symbol if its name contains the query parameter, ignoring case,
+// and it matches the optional type and exchange filters
+func (h *UDFHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := queryInt(r, "limit", maxListLimit, 1, maxListLimit)
+	if err != nil {
+		writeUDFError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	info := h.symbolInfo()
+	results := []udfSearchResult{}
+	if strings.Contains(strings.ToUpper(info.Ticker), strings.ToUpper(query.Get("query"))) &&
+		(query.Get("type") == "" || query.Get("type") == udfType) &&
+		(query.Get("exchange") == "" || strings.EqualFold(query.Get("exchange"), udfExchange)) {
+		results = append(results, udfSearchResult{
+			Symbol:      info.Ticker,
+			FullName:    info.Name,
+			Description: info.Description,
+			Exchange:    udfExchange,
+			Ticker:      info.Ticker,
+			Type:        udfType,
+		})
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	writeJSON(w, r, results)
+}
+
+// HandleHistory returns the bars of a resolution with times in [from, to), or the newest
+// countback bars before to if countback is set
+func (h *UDFHandler) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if !h.validSymbol(query.Get("symbol")) {
+		writeUDFError(w, r, http.StatusNotFound, "unknown_symbol")
+		return
+	}
+	timeFrame, ok := parseResolution(query.Get("resolution"))
+	if !ok {
+		writeUDFError(w, r, http.StatusBadRequest, fmt.Sprintf("unsupported resolution %q, must be one of %v", query.Get("resolution"), udfResolutionNames()))
+		return
+	}
+	from, err := parseUDFTime(query.Get("from"))
+	if err != nil {
+		writeUDFError(w, r, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	to, err := parseUDFTime(query.Get("to"))
+	if err != nil {
+		writeUDFError(w, r, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+	countback, err := queryInt(r, "countback", 0, 1, math.MaxInt32)
+	if err != nil {
+		writeUDFError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if countback == 0 && from > to {
+		writeUDFError(w, r, http.StatusBadRequest, "invalid from: must not be after to")
+		return
+	}
+
+	var candles []models.CandleData
+	if countback > 0 {
+		if countback > maxUDFBars {
+			countback = maxUDFBars
+		}
+		candles = h.priceService.GetHistoryTail(timeFrame, to*1000-1, countback)
+	} else {
+		candles = h.priceService.GetHistoryRange(timeFrame, from*1000, to*1000-1)
+	}
+
+	if len(candles) == 0 {
+		// Tell the datafeed where older bars are, so it doesn't keep asking for empty ranges
+		history := udfHistory{S: "no_data"}
+		if countback > 0 {
+			from = to
+		}
+		if before := h.priceService.GetHistoryTail(timeFrame, from*1000-1, 1); len(before) > 0 {
+			nextTime := before[0].Timestamp / 1000
+			history.NextTime = &nextTime
+		}
+		writeJSON(w, r, history)
+		return
+	}
+
+	history := udfHistory{
+		S: "ok",
+		T: make([]int64, len(candles)),
+		O: make([]float64, len(candles)),
+		H: make([]float64, len(candles)),
+		L: make([]float64, len(candles)),
+		C: make([]float64, len(candles)),
+		V: make([]float64, len(candles)),
+	}
+	for i, c := range candles {
+		history.T[i] = c.Timestamp / 1000
+		history.O[i] = c.Values[0]
+		history.H[i] = c.Values[1]
+		history.L[i] = c.Values[2]
+		history.C[i] = c.Values[3]
+		history.V[i] = c.Volume
+	}
+	writeJSON(w, r, history)
+}
+
+// symbolInfo describes the simulated symbol
+func (h *UDFHandler) symbolInfo() udfSymbolInfo {
+	simulation := h.configStore.Get().Simulation
+	precision := simulation.Precision()
+	base, quote := simulation.Market()
+	ticker := strings.ToUpper(h.priceService.GetSimulationParams().Symbol)
+
+	var intraday []string
+	for _, resolution := range udfResolutions {
+		if resolution.timeFrame.GetDuration() < 24*time.Hour {
+			intraday = append(intraday, resolution.resolution)
+		}
+	}
+
+	priceScale := math.Pow10(precision.PriceDecimals)
+	return udfSymbolInfo{
+		Name:                 udfExchange + ":" + ticker,
+		Ticker:               ticker,
+		Description:          base + "/" + quote,
+		Type:                 udfType,
+		Session:              "24x7",
+		Exchange:             udfExchange,
+		ListedExchange:       udfExchange,
+		Timezone:             "Etc/UTC",
+		Format:               "price",
+		CurrencyCode:         quote,
+		PriceScale:           int64(priceScale),
+		MinMov:               int64(math.Round(precision.TickSize * priceScale)),
+		HasIntraday:          true,
+		HasDaily:             true,
+		IntradayMultipliers:  intraday,
+		DailyMultipliers:     []string{"1"},
+		SupportedResolutions: udfResolutionNames(),
+		VolumePrecision:      precision.VolumeDecimals,
+		DataStatus:           "streaming",
+	}
+}
+
+// validSymbol reports whether a symbol names the simulated symbol, ignoring case and an
+// optional prefix of the exchange
+func (h *UDFHandler) validSymbol(symbol string) bool {
+	if exchange, name, ok := strings.Cut(symbol, ":"); ok {
+		if !strings.EqualFold(exchange, udfExchange) {
+			return false
+		}
+		symbol = name
+	}
+	return strings.EqualFold(symbol, h.priceService.GetSimulationParams().Symbol)
+}
+
+// udfResolutionNames returns the supported resolutions, shortest first
+func udfResolutionNames() []string {
+	names := make([]string, len(udfResolutions))
+	for i, resolution := range udfResolutions {
+		names[i] = resolution.resolution
+	}
+	return names
+}
+
+// parseResolution returns the timeframe of a resolution, accepting D for 1D
+func parseResolution(resolution string) (models.TimeFrame, bool) {
+	if resolution == "D" {
+		resolution = "1D"
+	}
+	for _, supported := range udfResolutions {
+		if supported.resolution == resolution {
+			return supported.timeFrame, true
+		}
+	}
+	return "", false
+}
+
+// parseUDFTime parses a required time in Unix seconds
+func parseUDFTime(value string) (int64, error) {
+	if value == "" {
+		return 0, errors.New("required")
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < -maxUDFTime || seconds > maxUDFTime {
+		return 0, fmt.Errorf("expected Unix seconds, got %q", value)
+	}
+	return seconds, nil
+}
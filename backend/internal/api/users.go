@@ -0,0 +1,228 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"server/internal/auth"
+	"server/internal/config"
+	"server/internal/models"
+)
+
+// UserHandler handles registration, login and token refreshes of user accounts under
+// /api/auth, with passwords or through identity providers
+type UserHandler struct {
+	users       *auth.UserStore
+	bans        *auth.BanList
+	configStore *config.Store
+	oidc        *auth.OIDCClient
+
+	lock    sync.Mutex
+	pending map[string]pendingLogin // Identity provider logins by state
+}
+
+// NewUserHandler creates a new instance of UserHandler
+func NewUserHandler(users *auth.UserStore, bans *auth.BanList, configStore *config.Store) *UserHandler {
+	return &UserHandler{
+		users:       users,
+		bans:        bans,
+		configStore: configStore,
+		oidc:        auth.NewOIDCClient(),
+		pending:     make(map[string]pendingLogin),
+	}
+}
+
+// credentialsRequest is the body of a registration or login
+type credentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// refreshRequest is the body of a token refresh or logout
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// HandleRegister creates a user account
+func (h *UserHandler) HandleRegister(w http.ResponseWriter, r *http.Request) {
+	if !h.configStore.Get().Auth.Registration {
+		httpError(w, r, "registration is disabled", http.StatusForbidden)
+		return
+	}
+
+	var request credentialsRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+
+	user, err := h.users.Register(request.Username, request.Password)
+	if err != nil {
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, auth.ErrUserExists):
+			code = http.StatusConflict
+		case errors.Is(err, auth.ErrInvalidUsername), errors.Is(err, auth.ErrWeakPassword):
+			code = http.StatusUnprocessableEntity
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+
+	logRequest(r, "Registered user %s (%s)", user.ID, user.Username)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, r, user)
+}
+
+// HandleLogin issues an access and a refresh token for a username and password
+func (h *UserHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	var request credentialsRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+
+	user, err := h.users.Login(request.Username, request.Password)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			code = http.StatusUnauthorized
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+	if ban, ok := h.bans.UserBanned(user.ID); ok {
+		writeBanned(w, r, ban)
+		return
+	}
+
+	cfg := h.configStore.Get().Auth
+	refreshToken, err := h.users.IssueRefreshToken(user.ID, cfg.RefreshTokenTTL)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeTokens(w, r, user, refreshToken)
+}
+
+// HandleRefresh exchanges a refresh token for a new access and refresh token. The
+// refresh token can't be used again.
+func (h *UserHandler) HandleRefresh(w http.ResponseWriter, r *http.Request) {
+	var request refreshRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+
+	if request.RefreshToken == "" {
+		request.RefreshToken = h.refreshCookie(r)
+	}
+
+	user, refreshToken, err := h.users.Refresh(request.RefreshToken, h.configStore.Get().Auth.RefreshTokenTTL)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenExpired) {
+			code = http.StatusUnauthorized
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+	if ban, ok := h.bans.UserBanned(user.ID); ok {
+		h.users.RevokeRefreshToken(refreshToken)
+		writeBanned(w, r, ban)
+		return
+	}
+	h.writeTokens(w, r, user, refreshToken)
+}
+
+// HandleLogout revokes a refresh token and removes session cookies. Access tokens stay
+// valid until they expire.
+func (h *UserHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	var request refreshRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+	if request.RefreshToken == "" {
+		request.RefreshToken = h.refreshCookie(r)
+	}
+
+	if err := h.users.RevokeRefreshToken(request.RefreshToken); err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.configStore.Get().Auth.CookieSessions {
+		clearSessionCookies(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refreshCookie returns the refresh token of a cookie session, empty without one
+func (h *UserHandler) refreshCookie(r *http.Request) string {
+	if !h.configStore.Get().Auth.CookieSessions {
+		return ""
+	}
+	cookie, err := r.Cookie(refreshCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// HandleMe returns the user of the access token
+func (h *UserHandler) HandleMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := CurrentUser(r)
+	if !ok {
+		httpError(w, r, "access token required", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, r, user)
+}
+
+// writeTokens signs an access token for user and writes it with the refresh token, also
+// in cookies with cookie sessions
+func (h *UserHandler) writeTokens(w http.ResponseWriter, r *http.Request, user models.User, refreshToken string) {
+	tokens, err := h.tokens(user, refreshToken)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if cfg := h.configStore.Get().Auth; cfg.CookieSessions {
+		if err := setSessionCookies(w, r, tokens, cfg); err != nil {
+			httpError(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, tokens)
+}
+
+// tokens signs an access token for user and pairs it with the refresh token
+func (h *UserHandler) tokens(user models.User, refreshToken string) (models.TokenPair, error) {
+	cfg := h.configStore.Get().Auth
+	accessToken, err := auth.SignToken(cfg.JWTSecret, auth.NewClaims(user, cfg.AccessTokenTTL))
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	return models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(cfg.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// decodeBody decodes a JSON request body into v, answering 400 if it is invalid
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		httpError(w, r, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if decoder.More() {
+		httpError(w, r, "invalid request body: unexpected data after the JSON value", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"server/internal/models"
+)
+
+// maxListLimit caps the limit query parameter of listing endpoints
+const maxListLimit = 1000
+
+// invalidParameter is a request parameter that failed validation
+type invalidParameter struct {
+	name    string
+	message string
+}
+
+func (e invalidParameter) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.name, e.message)
+}
+
+// queryInt reads an optional integer query parameter, which must be between min and max
+func queryInt(r *http.Request, name string, fallback, min, max int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, invalidParameter{name: name, message: fmt.Sprintf("must be an integer from %d to %d, got %q", min, max, value)}
+	}
+	return n, nil
+}
+
+// queryTimeRange reads the optional Unix millisecond timestamps fromName and toName,
+// which must not be reversed
+func queryTimeRange(r *http.Request, fromName, toName string, fallbackFrom, fallbackTo int64) (int64, int64, error) {
+	from, err := parseTimestamp(r, fromName, fallbackFrom)
+	if err != nil {
+		return 0, 0, invalidParameter{name: fromName, message: err.Error()}
+	}
+	to, err := parseTimestamp(r, toName, fallbackTo)
+	if err != nil {
+		return 0, 0, invalidParameter{name: toName, message: err.Error()}
+	}
+	if from > to {
+		return 0, 0, invalidParameter{name: fromName, message: fmt.Sprintf("must not be after %s", toName)}
+	}
+	return from, to, nil
+}
+
+// parseTimeFrame parses an optional timeframe, which must be supported
+func parseTimeFrame(value string, fallback models.TimeFrame) (models.TimeFrame, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if tf := models.TimeFrame(value); tf.IsValid() {
+		return tf, nil
+	}
+	return "", invalidParameter{name: "timeframe", message: fmt.Sprintf("must be one of %v, got %q", models.AllTimeFrames(), value)}
+}
+
+// parseSchema parses an optional candle schema, SchemaXY if empty
+func parseSchema(value string) (models.CandleSchema, error) {
+	schema, err := models.ParseCandleSchema(value)
+	if err != nil {
+		return "", invalidParameter{name: "schema", message: err.Error()}
+	}
+	return schema, nil
+}
+
+// parseTimeFrames parses an optional comma separated list of supported timeframes
+func parseTimeFrames(name, value string) ([]models.TimeFrame, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var timeframes []models.TimeFrame
+	seen := make(map[models.TimeFrame]bool)
+	for _, part := range strings.Split(value, ",") {
+		tf := models.TimeFrame(strings.TrimSpace(part))
+		if !tf.IsValid() {
+			return nil, invalidParameter{name: name, message: fmt.Sprintf("must be a list of %v, got %q", models.AllTimeFrames(), part)}
+		}
+		if !seen[tf] {
+			seen[tf] = true
+			timeframes = append(timeframes, tf)
+		}
+	}
+	return timeframes, nil
+}
+
+// validationError describes a failed validation in the structured error format
+func validationError(err error) models.ValidationError {
+	var invalid invalidParameter
+	if !errors.As(err, &invalid) {
+		invalid = invalidParameter{message: err.Error()}
+	}
+	return models.ValidationError{
+		Type:      "error",
+		Error:     "invalid_parameter",
+		Parameter: invalid.name,
+		Message:   invalid.message,
+	}
+}
+
+// writeValidationError answers 400 with a failed validation in the structured error format
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	logRequest(r, "Error: %v", err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(validationError(err))
+}
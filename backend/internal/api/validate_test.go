@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"server/internal/models"
+)
+
+func FuzzParseTimeFrames(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"1m",
+		"1m,5m,1h",
+		" 1m , 4h ",
+		"1m,1m,1m",
+		"1m,,5m",
+		"\ufeff1m",
+		"1M",
+		"1m,2m",
+		",",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		timeframes, err := parseTimeFrames("timeframes", value)
+		if err != nil {
+			if _, ok := err.(invalidParameter); !ok {
+				t.Fatalf("parseTimeFrames(%q) failed with %T, want invalidParameter", value, err)
+			}
+			return
+		}
+		if value == "" && timeframes != nil {
+			t.Fatalf("parseTimeFrames(\"\") = %v, want nil", timeframes)
+		}
+		seen := make(map[models.TimeFrame]bool)
+		for _, tf := range timeframes {
+			if !tf.IsValid() {
+				t.Fatalf("parseTimeFrames(%q) returned unsupported timeframe %q", value, tf)
+			}
+			if seen[tf] {
+				t.Fatalf("parseTimeFrames(%q) returned %q twice", value, tf)
+			}
+			seen[tf] = true
+		}
+	})
+}
+
+func FuzzDecodeClientMessage(f *testing.F) {
+	for _, seed := range []string{
+		`{"type":"chat","text":"hello"}`,
+		`{"type":"ack","offset":42}`,
+		`{"type":"ack","offset":0}`,
+		`{"type":"ack","offset":-1}`,
+		`{"type":"ack","offset":"1"}`,
+		`{"timeFrame":"5m"}`,
+		`{"timeFrame":"7m"}`,
+		`{"timeFrame":" 1m "}`,
+		`{"schema":"ohlc"}`,
+		`{"timeFrame":"1h","schema":"xy"}`,
+		`{"schema":"candles"}`,
+		`{"timeFrame":"1m"} {"timeFrame":"1d"}`,
+		`{"type":"ack","offset":1}garbage`,
+		"\ufeff{\"timeFrame\":\"1m\"}",
+		`{"timeFrame":NaN}`,
+		`[]`,
+		`null`,
+		``,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, p []byte) {
+		message, err := decodeClientMessage(p)
+		if err != nil {
+			if _, ok := err.(invalidParameter); !ok {
+				t.Fatalf("decodeClientMessage(%q) failed with %T, want invalidParameter", p, err)
+			}
+			if message != nil {
+				t.Fatalf("decodeClientMessage(%q) returned %#v along with an error", p, message)
+			}
+			return
+		}
+		if message != nil && !json.Valid(p) {
+			t.Fatalf("decodeClientMessage(%q) accepted invalid JSON as %#v", p, message)
+		}
+
+		switch m := message.(type) {
+		case nil:
+		case models.ChatRequest:
+			if m.Type != "chat" {
+				t.Fatalf("decodeClientMessage(%q) returned a chat request of type %q", p, m.Type)
+			}
+		case models.AckRequest:
+			if m.Type != "ack" || m.Offset < 1 {
+				t.Fatalf("decodeClientMessage(%q) returned invalid ack %#v", p, m)
+			}
+		case models.TimeFrameRequest:
+			if m.TimeFrame == "" && m.Schema == "" {
+				t.Fatalf("decodeClientMessage(%q) returned an empty timeframe request", p)
+			}
+			if m.TimeFrame != "" && !m.TimeFrame.IsValid() {
+				t.Fatalf("decodeClientMessage(%q) returned unsupported timeframe %q", p, m.TimeFrame)
+			}
+			if _, err := models.ParseCandleSchema(m.Schema); err != nil {
+				t.Fatalf("decodeClientMessage(%q) returned invalid schema: %v", p, err)
+			}
+		default:
+			t.Fatalf("decodeClientMessage(%q) returned unexpected %T", p, message)
+		}
+	})
+}
+
+func TestParseTimeFramesDropsDuplicates(t *testing.T) {
+	timeframes, err := parseTimeFrames("timeframes", " 1m,5m , 1m,5m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []models.TimeFrame{models.TimeFrame1Min, models.TimeFrame5Min}; !reflect.DeepEqual(timeframes, want) {
+		t.Fatalf("parseTimeFrames = %v, want %v", timeframes, want)
+	}
+}
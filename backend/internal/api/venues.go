@@ -0,0 +1,165 @@
+package api
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+
+	"server/internal/config"
+	"server/internal/models"
+	"server/internal/service"
+)
+
+// Venues lists the simulated exchanges configured on the symbols of the default simulation
+// and the namespaces. Every venue is served like a namespace named after the symbol and the
+// venue, e.g. SEED-ALPHA, its prices diverging from the symbol's and reaching it late. The
+// consolidated feed, e.g. SEED-CONSOLIDATED, averages the prices of the venues.
+type Venues struct {
+	namespaces *Namespaces
+
+	lock    sync.RWMutex
+	markets []*venueMarket
+}
+
+// venueMarket is a symbol quoted on venues
+type venueMarket struct {
+	underlying   string
+	spot         *service.PriceService
+	definition   config.NamespaceConfig // Settings the venues inherit
+	precision    models.Precision
+	venues       []config.VenueConfig
+	feeds        []venueFeed // Listed venues
+	consolidated *venueFeed  // Nil until listed
+}
+
+// venueFeed is a listed venue or consolidated feed
+type venueFeed struct {
+	venue   config.VenueConfig
+	symbol  string
+	service *service.PriceService
+}
+
+// newVenues sets up the venues of the configuration, listed by start
+func newVenues(n *Namespaces) *Venues {
+	cfg := n.configStore.Get()
+	v := &Venues{namespaces: n}
+
+	if len(cfg.Simulation.Venues) > 0 {
+		v.markets = append(v.markets, &venueMarket{
+			underlying: cfg.Simulation.Symbol,
+			spot:       n.root,
+			precision:  cfg.Simulation.Precision(),
+			venues:     cfg.Simulation.Venues,
+		})
+	}
+	for _, name := range cfg.NamespaceNames() {
+		ns := n.get(name)
+		simulation := ns.store.Get().Simulation
+		if len(simulation.Venues) == 0 {
+			continue
+		}
+		v.markets = append(v.markets, &venueMarket{
+			underlying: simulation.Symbol,
+			spot:       ns.service,
+			definition: cfg.Namespaces[name],
+			precision:  simulation.Precision(),
+			venues:     simulation.Venues,
+		})
+	}
+	return v
+}
+
+// start lists the venues of every symbol and then their consolidated feed. The caller holds
+// the changes of the namespaces.
+func (v *Venues) start() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	for _, m := range v.markets {
+		for _, venue := range m.venues {
+			feed := venueFeed{venue: venue, symbol: m.underlying + "-" + strings.ToUpper(venue.Name)}
+			setup := func(ps *service.PriceService) {
+				ps.SetVenue(m.spot, m.underlying, venue.Divergence, venue.Latency)
+				feed.service = ps
+			}
+			if err := v.namespaces.addDerivative(feed.symbol, models.SymbolSourceVenue, m.definition, setup); err != nil {
+				log.Printf("Error listing venue %s: %v", feed.symbol, err)
+				continue
+			}
+			m.feeds = append(m.feeds, feed)
+		}
+		if len(m.feeds) == 0 {
+			continue
+		}
+
+		constituents := make([]service.IndexConstituent, len(m.feeds))
+		for i, feed := range m.feeds {
+			constituents[i] = service.IndexConstituent{Name: feed.symbol, Service: feed.service, Weight: 1 / float64(len(m.feeds))}
+		}
+		consolidated := venueFeed{
+			venue:  config.VenueConfig{Name: config.ConsolidatedVenue},
+			symbol: m.underlying + "-" + strings.ToUpper(config.ConsolidatedVenue),
+		}
+		setup := func(ps *service.PriceService) {
+			ps.SetIndex(constituents)
+			consolidated.service = ps
+		}
+		if err := v.namespaces.addDerivative(consolidated.symbol, models.SymbolSourceVenue, m.definition, setup); err != nil {
+			log.Printf("Error listing consolidated feed %s: %v", consolidated.symbol, err)
+			continue
+		}
+		m.consolidated = &consolidated
+		log.Printf("Listed %s on %d venues with the consolidated feed %s", m.underlying, len(m.feeds), consolidated.symbol)
+	}
+}
+
+// quote returns the venue's current price
+func (f venueFeed) quote() models.VenueQuote {
+	price, _ := f.service.LastPrice()
+	return models.VenueQuote{
+		Venue:   f.venue.Name,
+		Symbol:  f.symbol,
+		Path:    NamespacePrefix + strings.ToLower(f.symbol),
+		Latency: f.venue.Latency.Milliseconds(),
+		Price:   price,
+	}
+}
+
+// Markets returns the symbols quoted on venues with the current prices of the venues, only
+// the one of an underlying symbol if not empty
+func (v *Venues) Markets(underlying string) []models.VenueMarket {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	markets := []models.VenueMarket{}
+	for _, m := range v.markets {
+		if m.consolidated == nil || (underlying != "" && !strings.EqualFold(m.underlying, underlying)) {
+			continue
+		}
+		market := models.VenueMarket{
+			Underlying:   m.underlying,
+			Consolidated: m.consolidated.quote(),
+			Venues:       make([]models.VenueQuote, len(m.feeds)),
+		}
+		high, low := math.Inf(-1), math.Inf(1)
+		for i, feed := range m.feeds {
+			quote := feed.quote()
+			market.Venues[i] = quote
+			if quote.Price > 0 {
+				high, low = math.Max(high, quote.Price), math.Min(low, quote.Price)
+			}
+		}
+		if high >= low {
+			market.Spread = m.precision.Price(high - low)
+		}
+		markets = append(markets, market)
+	}
+	return markets
+}
+
+// HandleMarkets lists the symbols quoted on venues, the one of the symbol parameter if given
+func (v *Venues) HandleMarkets(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, v.Markets(r.URL.Query().Get("symbol")))
+}
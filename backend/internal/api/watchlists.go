@@ -0,0 +1,181 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/config"
+	"server/internal/events"
+	"server/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// summaryWindow is the period the live data of watched symbols covers
+const summaryWindow = 24 * time.Hour
+
+// WatchlistHandler manages the watchlists of the user of the access token under /api/watchlists
+type WatchlistHandler struct {
+	watchlists *auth.WatchlistStore
+	namespaces *Namespaces
+	notifiers  *events.Notifiers
+}
+
+// NewWatchlistHandler creates a new instance of WatchlistHandler
+func NewWatchlistHandler(watchlists *auth.WatchlistStore, namespaces *Namespaces, notifiers *events.Notifiers) *WatchlistHandler {
+	return &WatchlistHandler{watchlists: watchlists, namespaces: namespaces, notifiers: notifiers}
+}
+
+// watchlistRequest is the body of a watchlist creation or replacement
+type watchlistRequest struct {
+	Name    string                  `json:"name"`
+	Symbols []models.WatchlistEntry `json:"symbols"` // In display order, summaries are ignored
+}
+
+// HandleWatchlists lists the user's watchlists with live data of their symbols
+func (h *WatchlistHandler) HandleWatchlists(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+	watchlists := h.watchlists.List(user.ID)
+	for i := range watchlists {
+		h.summarize(&watchlists[i])
+	}
+	writeJSON(w, r, watchlists)
+}
+
+// HandleWatchlist returns a watchlist of the user with live data of its symbols
+func (h *WatchlistHandler) HandleWatchlist(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+	watchlist, err := h.watchlists.Get(user.ID, mux.Vars(r)["id"])
+	if err != nil {
+		writeWatchlistError(w, r, err)
+		return
+	}
+	h.summarize(&watchlist)
+	writeJSON(w, r, watchlist)
+}
+
+// HandleWatchlistCreate creates a watchlist for the user
+func (h *WatchlistHandler) HandleWatchlistCreate(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+	var request watchlistRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+	if err := h.resolveSymbols(request.Symbols); err != nil {
+		writeWatchlistError(w, r, err)
+		return
+	}
+
+	watchlist, err := h.watchlists.Create(user.ID, request.Name, request.Symbols)
+	if err != nil {
+		writeWatchlistError(w, r, err)
+		return
+	}
+	h.summarize(&watchlist)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, r, watchlist)
+}
+
+// HandleWatchlistUpdate replaces the name and symbols of a watchlist of the user
+func (h *WatchlistHandler) HandleWatchlistUpdate(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+	var request watchlistRequest
+	if !decodeBody(w, r, &request) {
+		return
+	}
+	if err := h.resolveSymbols(request.Symbols); err != nil {
+		writeWatchlistError(w, r, err)
+		return
+	}
+
+	watchlist, err := h.watchlists.Update(user.ID, mux.Vars(r)["id"], request.Name, request.Symbols)
+	if err != nil {
+		writeWatchlistError(w, r, err)
+		return
+	}
+	h.summarize(&watchlist)
+	writeJSON(w, r, watchlist)
+}
+
+// HandleWatchlistDelete deletes a watchlist of the user
+func (h *WatchlistHandler) HandleWatchlistDelete(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+	if err := h.watchlists.Delete(user.ID, mux.Vars(r)["id"]); err != nil {
+		writeWatchlistError(w, r, err)
+		return
+	}
+	writeJSON(w, r, adminStatus{Status: "deleted"})
+}
+
+// resolveSymbols replaces the symbols of watchlist entries, also given by the name of their
+// namespace, with the symbols they name, rejecting symbols that don't exist and alerts to
+// targets that can't be notified
+func (h *WatchlistHandler) resolveSymbols(entries []models.WatchlistEntry) error {
+	for i, entry := range entries {
+		_, priceService, ok := h.namespaces.lookup(entry.Symbol)
+		if !ok {
+			return fmt.Errorf("%w: unknown symbol %q", auth.ErrInvalidWatchlist, entry.Symbol)
+		}
+		entries[i].Symbol = priceService.GetSimulationParams().Symbol
+		for _, alert := range entry.Alerts {
+			for _, target := range alert.Notify {
+				if err := h.notifiers.Validate(target); err != nil {
+					return fmt.Errorf("%w: %v", auth.ErrInvalidWatchlist, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// summarize adds the live data of its symbols to a watchlist. Symbols retired since they
+// were added are listed without.
+func (h *WatchlistHandler) summarize(watchlist *models.Watchlist) {
+	now := time.Now()
+	for i, entry := range watchlist.Symbols {
+		name, priceService, ok := h.namespaces.lookup(entry.Symbol)
+		if !ok {
+			continue
+		}
+		price, ok := priceService.LastPrice()
+		if !ok {
+			continue
+		}
+
+		summary := models.SymbolSummary{Price: price, Halted: priceService.TradingHalted()}
+		if name != config.DefaultNamespace {
+			summary.Path = NamespacePrefix + name
+		}
+		candles := priceService.GetHistoryRange(models.TimeFrame1Hour, now.Add(-summaryWindow).UnixMilli(), now.UnixMilli())
+		if len(candles) > 0 {
+			summary.High, summary.Low = math.Inf(-1), math.Inf(1)
+			for _, candle := range candles {
+				summary.High = math.Max(summary.High, candle.Values[1])
+				summary.Low = math.Min(summary.Low, candle.Values[2])
+				summary.Volume += candle.Volume
+			}
+			summary.Volume = math.Round(summary.Volume*1e8) / 1e8
+			if open := candles[0].Values[0]; open != 0 {
+				summary.Change = math.Round((price/open-1)*1e6) / 1e6
+			}
+		}
+		watchlist.Symbols[i].Summary = &summary
+	}
+}
+
+// writeWatchlistError answers with the status of a watchlist error
+func writeWatchlistError(w http.ResponseWriter, r *http.Request, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, auth.ErrWatchlistNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, auth.ErrInvalidWatchlist), errors.Is(err, auth.ErrTooManyWatchlists):
+		code = http.StatusUnprocessableEntity
+	}
+	httpError(w, r, err.Error(), code)
+}
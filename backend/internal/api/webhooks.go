@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"server/internal/events"
+
+	"github.com/gorilla/mux"
+)
+
+// WebhookHandler inspects and replays failed webhook deliveries under /admin/webhooks
+type WebhookHandler struct {
+	dispatcher *events.Dispatcher
+}
+
+// NewWebhookHandler creates a new instance of WebhookHandler
+func NewWebhookHandler(dispatcher *events.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{dispatcher: dispatcher}
+}
+
+// HandleDeadLetters returns the deliveries that failed on every attempt, newest first,
+// optionally only those to the url query parameter and limited by the limit query parameter
+func (h *WebhookHandler) HandleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", 100, 1, maxListLimit)
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, h.dispatcher.DeadLetters().List(r.URL.Query().Get("url"), limit))
+}
+
+// HandleDeadLetter returns a failed delivery including its body
+func (h *WebhookHandler) HandleDeadLetter(w http.ResponseWriter, r *http.Request) {
+	letter, err := h.dispatcher.DeadLetters().Get(mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, r, letter)
+}
+
+// HandleDeadLetterReplay posts a failed delivery to its webhook again
+func (h *WebhookHandler) HandleDeadLetterReplay(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	logRequest(r, "Admin requested replay of dead letter %s", id)
+	if err := h.dispatcher.Replay(id); err != nil {
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, events.ErrDeadLetterNotFound):
+			code = http.StatusNotFound
+		case errors.Is(err, events.ErrWebhookNotConfigured):
+			code = http.StatusConflict
+		case errors.Is(err, events.ErrReplayFailed):
+			code = http.StatusBadGateway
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+	writeJSON(w, r, adminStatus{Status: "delivered"})
+}
+
+// HandleDeadLetterDelete discards a failed delivery
+func (h *WebhookHandler) HandleDeadLetterDelete(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	logRequest(r, "Admin requested deletion of dead letter %s", id)
+	if err := h.dispatcher.DeadLetters().Remove(id); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, events.ErrDeadLetterNotFound) {
+			code = http.StatusNotFound
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+	writeJSON(w, r, adminStatus{Status: "deleted"})
+}
@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Entry describes a single admin action
+type Entry struct {
+	Timestamp  int64           `json:"timestamp"` // Unix milliseconds
+	Actor      string          `json:"actor"`
+	RemoteAddr string          `json:"remoteAddr"`
+	RequestID  string          `json:"requestId,omitempty"`
+	Action     string          `json:"action"` // e.g. "POST /admin/reset"
+	Status     int             `json:"status"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+}
+
+// Log is an append-only audit log stored as JSON lines
+type Log struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewLog creates a new audit log writing to the given file
+func NewLog(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %w", err)
+	}
+
+	return &Log{
+		path: path,
+	}, nil
+}
+
+// Record appends an entry to the log
+func (l *Log) Record(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+
+	// Make sure the entry survives a crash
+	return file.Sync()
+}
+
+// List returns the most recent entries, oldest first. A limit of zero returns all entries.
+func (l *Log) List(limit int) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return []Entry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	entries := make([]Entry, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue // Skip a torn last line
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"server/internal/models"
+)
+
+var (
+	// ErrBanNotFound is returned for IDs without a ban
+	ErrBanNotFound = errors.New("ban not found")
+	// ErrInvalidBan is returned when banning something that is not a user ID, IP address or CIDR range
+	ErrInvalidBan = errors.New("ban type must be user with a user ID or ip with an IP address or CIDR range")
+)
+
+// activeBan is a ban with its IP range parsed
+type activeBan struct {
+	models.Ban
+	network *net.IPNet // For IP bans
+}
+
+// BanList keeps the users and IP addresses banned from the API. Expired bans are
+// dropped when the list is saved, which happens after every change.
+type BanList struct {
+	path   string
+	cipher *Cipher
+
+	lock sync.RWMutex
+	bans map[string]*activeBan // By ID
+}
+
+// NewBanList opens the bans saved at path, starting without bans if there is none.
+// The file is encrypted with c if it isn't nil.
+func NewBanList(path string, c *Cipher) (*BanList, error) {
+	l := &BanList{path: path, cipher: c, bans: make(map[string]*activeBan)}
+
+	data, migrate, err := readSealed(path, c)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bans: %w", err)
+	}
+
+	var bans []models.Ban
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return nil, fmt.Errorf("failed to parse bans %s: %w", path, err)
+	}
+	for _, ban := range bans {
+		active, err := newActiveBan(ban)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ban %s in %s: %w", ban.ID, path, err)
+		}
+		l.bans[ban.ID] = active
+	}
+
+	// Don't leave banned IP addresses in plaintext once encryption is enabled
+	if migrate {
+		if err := l.saveLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Ban bans a user ID or an IP address or CIDR range for duration, or permanently if it is zero
+func (l *BanList) Ban(banType, value string, duration time.Duration, reason string, automatic bool) (models.Ban, error) {
+	now := time.Now()
+	ban := models.Ban{
+		ID:        newID(),
+		Type:      banType,
+		Value:     value,
+		Reason:    reason,
+		Automatic: automatic,
+		CreatedAt: now.UnixMilli(),
+	}
+	if duration > 0 {
+		ban.ExpiresAt = now.Add(duration).UnixMilli()
+	}
+	active, err := newActiveBan(ban)
+	if err != nil {
+		return models.Ban{}, err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.bans[ban.ID] = active
+	if err := l.saveLocked(); err != nil {
+		delete(l.bans, ban.ID)
+		return models.Ban{}, err
+	}
+	return ban, nil
+}
+
+// Unban lifts a ban
+func (l *BanList) Unban(id string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, ok := l.bans[id]; !ok {
+		return ErrBanNotFound
+	}
+	delete(l.bans, id)
+	return l.saveLocked()
+}
+
+// List returns the bans in effect, oldest first
+func (l *BanList) List() []models.Ban {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	now := time.Now().UnixMilli()
+	bans := []models.Ban{}
+	for _, ban := range l.bans {
+		if !ban.expired(now) {
+			bans = append(bans, ban.Ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].CreatedAt < bans[j].CreatedAt
+	})
+	return bans
+}
+
+// UserBanned returns the ban of a user ID, if there is one in effect
+func (l *BanList) UserBanned(userID string) (models.Ban, bool) {
+	return l.find(func(ban *activeBan) bool {
+		return ban.Type == models.BanUser && ban.Value == userID
+	})
+}
+
+// IPBanned returns the ban of the IP address of remoteAddr, if there is one in effect
+func (l *BanList) IPBanned(remoteAddr string) (models.Ban, bool) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return models.Ban{}, false
+	}
+	return l.find(func(ban *activeBan) bool {
+		return ban.Type == models.BanIP && ban.network.Contains(ip)
+	})
+}
+
+// find returns the first ban in effect that matches
+func (l *BanList) find(matches func(*activeBan) bool) (models.Ban, bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	now := time.Now().UnixMilli()
+	for _, ban := range l.bans {
+		if matches(ban) && !ban.expired(now) {
+			return ban.Ban, true
+		}
+	}
+	return models.Ban{}, false
+}
+
+// saveLocked writes the bans in effect to disk. Requires l.lock.
+func (l *BanList) saveLocked() error {
+	now := time.Now().UnixMilli()
+	bans := []models.Ban{}
+	for id, ban := range l.bans {
+		if ban.expired(now) {
+			delete(l.bans, id)
+			continue
+		}
+		bans = append(bans, ban.Ban)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].CreatedAt < bans[j].CreatedAt
+	})
+
+	data, err := json.MarshalIndent(bans, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode bans: %w", err)
+	}
+	if err := writeSealed(l.path, data, l.cipher); err != nil {
+		return fmt.Errorf("failed to write bans: %w", err)
+	}
+	return nil
+}
+
+// expired reports whether a ban has ended at the Unix millisecond time now
+func (b *activeBan) expired(now int64) bool {
+	return b.ExpiresAt != 0 && now >= b.ExpiresAt
+}
+
+// newActiveBan validates a ban and parses its IP range. Single IP addresses become
+// ranges of one address.
+func newActiveBan(ban models.Ban) (*activeBan, error) {
+	switch ban.Type {
+	case models.BanUser:
+		if ban.Value == "" {
+			return nil, ErrInvalidBan
+		}
+		return &activeBan{Ban: ban}, nil
+	case models.BanIP:
+		if _, network, err := net.ParseCIDR(ban.Value); err == nil {
+			return &activeBan{Ban: ban, network: network}, nil
+		}
+		ip := net.ParseIP(ban.Value)
+		if ip == nil {
+			return nil, ErrInvalidBan
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &activeBan{Ban: ban, network: &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}}, nil
+	}
+	return nil, ErrInvalidBan
+}
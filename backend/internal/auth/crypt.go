@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sealedMagic starts every encrypted file, so plaintext files written before encryption
+// was enabled are still read
+var sealedMagic = []byte("SVENC1\n")
+
+// ErrNoEncryptionKey is returned when reading an encrypted file without a key
+var ErrNoEncryptionKey = errors.New("file is encrypted but data.encryptionKey is not set")
+
+// Cipher encrypts the account data saved by the stores of this package with AES-256-GCM.
+// A nil Cipher leaves files in plaintext.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher creates a cipher from a base64 encoded 32 byte key, or returns nil if key is empty
+func NewCipher(key string) (*Cipher, error) {
+	if key == "" {
+		return nil, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes encoded as base64")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// seal encrypts data, or returns it unchanged if c is nil
+func (c *Cipher) seal(data []byte) ([]byte, error) {
+	if c == nil {
+		return data, nil
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := append(append([]byte{}, sealedMagic...), nonce...)
+	return c.aead.Seal(sealed, nonce, data, sealedMagic), nil
+}
+
+// open decrypts data written by seal. Plaintext data is returned unchanged, with sealed
+// false so callers can write it again encrypted.
+func (c *Cipher) open(data []byte) (plain []byte, sealed bool, err error) {
+	if !bytes.HasPrefix(data, sealedMagic) {
+		return data, false, nil
+	}
+	if c == nil {
+		return nil, true, ErrNoEncryptionKey
+	}
+	data = data[len(sealedMagic):]
+	if len(data) < c.aead.NonceSize() {
+		return nil, true, errors.New("encrypted file is truncated")
+	}
+	nonce, ciphertext := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plain, err = c.aead.Open(nil, nonce, ciphertext, sealedMagic)
+	if err != nil {
+		return nil, true, errors.New("failed to decrypt, wrong encryption key or corrupted file")
+	}
+	return plain, true, nil
+}
+
+// readSealed reads a file written by writeSealed. migrate is true if the file is in
+// plaintext but c would encrypt it.
+func readSealed(path string, c *Cipher) (data []byte, migrate bool, err error) {
+	data, err = os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	data, sealed, err := c.open(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", path, err)
+	}
+	return data, c != nil && !sealed, nil
+}
+
+// writeSealed encrypts data with c and writes it to path. A temporary file is written and
+// renamed, so a crash never leaves a partial file.
+func writeSealed(path string, data []byte, c *Cipher) error {
+	data, err := c.seal(data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"server/internal/models"
+)
+
+// maxInboxSize is the number of notifications kept per user, the oldest are discarded
+const maxInboxSize = 500
+
+// ErrNotificationNotFound is returned for IDs without a notification of the user
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// InboxStore keeps the notifications of users
+type InboxStore struct {
+	path   string
+	cipher *Cipher
+
+	lock    sync.Mutex
+	inboxes map[string][]*models.Notification // By user ID, oldest first
+}
+
+// NewInboxStore opens the notifications saved at path, starting without notifications if
+// there is none. The file is encrypted with c if it isn't nil.
+func NewInboxStore(path string, c *Cipher) (*InboxStore, error) {
+	s := &InboxStore{path: path, cipher: c, inboxes: make(map[string][]*models.Notification)}
+
+	data, migrate, err := readSealed(path, c)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notifications: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.inboxes); err != nil {
+		return nil, fmt.Errorf("failed to parse notifications %s: %w", path, err)
+	}
+
+	// Don't leave notifications in plaintext once encryption is enabled
+	if migrate {
+		if err := s.saveLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Deliver adds a notification to the inboxes of users and returns it as delivered
+func (s *InboxStore) Deliver(userIDs []string, notification models.Notification) (models.Notification, error) {
+	notification.ID = newID()
+	notification.CreatedAt = time.Now().UnixMilli()
+	notification.Read = false
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	previous := make(map[string][]*models.Notification, len(userIDs))
+	for _, userID := range userIDs {
+		previous[userID] = s.inboxes[userID]
+		delivered := notification
+		inbox := append(s.inboxes[userID], &delivered)
+		if len(inbox) > maxInboxSize {
+			inbox = append([]*models.Notification(nil), inbox[len(inbox)-maxInboxSize:]...)
+		}
+		s.inboxes[userID] = inbox
+	}
+	if err := s.saveLocked(); err != nil {
+		for userID, inbox := range previous {
+			if inbox == nil {
+				delete(s.inboxes, userID)
+			} else {
+				s.inboxes[userID] = inbox
+			}
+		}
+		return models.Notification{}, err
+	}
+	return notification, nil
+}
+
+// List returns the newest notifications of a user, up to limit, only unread ones if
+// unreadOnly is set
+func (s *InboxStore) List(userID string, unreadOnly bool, limit int) models.Inbox {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	inbox := models.Inbox{Notifications: []models.Notification{}}
+	notifications := s.inboxes[userID]
+	for i := len(notifications) - 1; i >= 0; i-- {
+		notification := notifications[i]
+		if !notification.Read {
+			inbox.Unread++
+		}
+		if len(inbox.Notifications) < limit && (!unreadOnly || !notification.Read) {
+			inbox.Notifications = append(inbox.Notifications, *notification)
+		}
+	}
+	return inbox
+}
+
+// MarkRead marks a notification of a user as read
+func (s *InboxStore) MarkRead(userID, id string) (models.Notification, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, notification := range s.inboxes[userID] {
+		if notification.ID != id {
+			continue
+		}
+		if notification.Read {
+			return *notification, nil
+		}
+		notification.Read = true
+		if err := s.saveLocked(); err != nil {
+			notification.Read = false
+			return models.Notification{}, err
+		}
+		return *notification, nil
+	}
+	return models.Notification{}, ErrNotificationNotFound
+}
+
+// MarkAllRead marks all notifications of a user as read and returns how many were unread
+func (s *InboxStore) MarkAllRead(userID string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var marked []*models.Notification
+	for _, notification := range s.inboxes[userID] {
+		if !notification.Read {
+			notification.Read = true
+			marked = append(marked, notification)
+		}
+	}
+	if len(marked) == 0 {
+		return 0, nil
+	}
+	if err := s.saveLocked(); err != nil {
+		for _, notification := range marked {
+			notification.Read = false
+		}
+		return 0, err
+	}
+	return len(marked), nil
+}
+
+// saveLocked writes all notifications to disk. Requires s.lock.
+func (s *InboxStore) saveLocked() error {
+	data, err := json.MarshalIndent(s.inboxes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode notifications: %w", err)
+	}
+	if err := writeSealed(s.path, data, s.cipher); err != nil {
+		return fmt.Errorf("failed to write notifications: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"server/internal/models"
+)
+
+// tokenIssuer is the iss claim of access tokens
+const tokenIssuer = "seedventure"
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed or not signed with the secret
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned for tokens past their expiry
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// jwtHeader is the only header access tokens are issued and accepted with
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims are the claims of an access token
+type Claims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`  // User ID
+	Username  string `json:"name"` // Username at the time the token was issued
+	IssuedAt  int64  `json:"iat"`  // Unix seconds
+	ExpiresAt int64  `json:"exp"`  // Unix seconds
+}
+
+// NewClaims returns the claims of an access token for user, valid for ttl
+func NewClaims(user models.User, ttl time.Duration) Claims {
+	now := time.Now()
+	return Claims{
+		Issuer:    tokenIssuer,
+		Subject:   user.ID,
+		Username:  user.Username,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+}
+
+// SignToken returns claims as a JWT signed with HMAC-SHA256
+func SignToken(secret string, claims Claims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode claims: %w", err)
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + signature(secret, unsigned), nil
+}
+
+// ParseToken verifies a JWT signed by SignToken and returns its claims. Only HS256
+// tokens are accepted, whatever algorithm their header names.
+func ParseToken(secret, token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidToken
+	}
+	expected := signature(secret, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) || parts[0] != jwtHeader {
+		return Claims{}, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Issuer != tokenIssuer || claims.Subject == "" {
+		return Claims{}, ErrInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return Claims{}, ErrTokenExpired
+	}
+	return claims, nil
+}
+
+// signature returns the base64url HMAC-SHA256 of the header and payload of a JWT
+func signature(secret, unsigned string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"server/internal/models"
+)
+
+// Prefixes of API keys and refresh tokens, so leaked ones are easy to search for
+const (
+	keyPrefix     = "sv_"
+	refreshPrefix = "svr_"
+)
+
+var (
+	// ErrKeyNotFound is returned for IDs without an API key
+	ErrKeyNotFound = errors.New("API key not found")
+	// ErrInvalidScope is returned when issuing a key with an unknown scope
+	ErrInvalidScope = fmt.Errorf("scope must be one of %v", models.Scopes())
+)
+
+// storedKey is an API key as saved, with the SHA-256 hash of its secret
+type storedKey struct {
+	models.APIKey
+	Hash string `json:"hash"`
+}
+
+// KeyStore issues API keys and checks the keys of requests. Only hashes of the
+// keys are kept, a lost key can't be recovered but only rotated.
+type KeyStore struct {
+	path string
+
+	lock   sync.RWMutex
+	keys   map[string]*storedKey // By ID
+	hashes map[string]*storedKey // By hash of the secret
+}
+
+// NewKeyStore opens the API keys saved at path, starting without keys if there is none
+func NewKeyStore(path string) (*KeyStore, error) {
+	s := &KeyStore{
+		path:   path,
+		keys:   make(map[string]*storedKey),
+		hashes: make(map[string]*storedKey),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+
+	var keys []*storedKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys %s: %w", path, err)
+	}
+	for _, key := range keys {
+		s.keys[key.ID] = key
+		s.hashes[key.Hash] = key
+	}
+	return s, nil
+}
+
+// Create issues a new API key
+func (s *KeyStore) Create(name, scope string) (models.IssuedAPIKey, error) {
+	if !validScope(scope) {
+		return models.IssuedAPIKey{}, ErrInvalidScope
+	}
+	secret, err := newSecret(keyPrefix)
+	if err != nil {
+		return models.IssuedAPIKey{}, err
+	}
+
+	key := &storedKey{
+		APIKey: models.APIKey{
+			ID:        newID(),
+			Name:      name,
+			Scope:     scope,
+			Prefix:    secret[:len(keyPrefix)+6],
+			CreatedAt: time.Now().UnixMilli(),
+		},
+		Hash: hash(secret),
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.keys[key.ID] = key
+	s.hashes[key.Hash] = key
+	if err := s.saveLocked(); err != nil {
+		delete(s.keys, key.ID)
+		delete(s.hashes, key.Hash)
+		return models.IssuedAPIKey{}, err
+	}
+	return models.IssuedAPIKey{APIKey: key.APIKey, Key: secret}, nil
+}
+
+// Rotate replaces the secret of an API key, the old secret stops working immediately
+func (s *KeyStore) Rotate(id string) (models.IssuedAPIKey, error) {
+	secret, err := newSecret(keyPrefix)
+	if err != nil {
+		return models.IssuedAPIKey{}, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return models.IssuedAPIKey{}, ErrKeyNotFound
+	}
+	previous := *key
+
+	delete(s.hashes, key.Hash)
+	key.Hash = hash(secret)
+	key.Prefix = secret[:len(keyPrefix)+6]
+	key.RotatedAt = time.Now().UnixMilli()
+	s.hashes[key.Hash] = key
+	if err := s.saveLocked(); err != nil {
+		delete(s.hashes, key.Hash)
+		*key = previous
+		s.hashes[key.Hash] = key
+		return models.IssuedAPIKey{}, err
+	}
+	return models.IssuedAPIKey{APIKey: key.APIKey, Key: secret}, nil
+}
+
+// Revoke deletes an API key
+func (s *KeyStore) Revoke(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	delete(s.keys, id)
+	delete(s.hashes, key.Hash)
+	return s.saveLocked()
+}
+
+// List returns all API keys, oldest first
+func (s *KeyStore) List() []models.APIKey {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	keys := make([]models.APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key.APIKey)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt < keys[j].CreatedAt
+	})
+	return keys
+}
+
+// Authenticate returns the API key with the given secret and records its use
+func (s *KeyStore) Authenticate(secret string) (models.APIKey, bool) {
+	h := hash(secret)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key, ok := s.hashes[h]
+	if !ok {
+		return models.APIKey{}, false
+	}
+	key.LastUsed = time.Now().UnixMilli()
+	return key.APIKey, true
+}
+
+// Allows reports whether a key of scope may do what required needs. Scopes include
+// all less privileged ones.
+func Allows(scope, required string) bool {
+	return scopeRank(scope) >= scopeRank(required) && scopeRank(required) >= 0
+}
+
+// saveLocked writes all keys to disk. Requires s.lock.
+func (s *KeyStore) saveLocked() error {
+	keys := make([]*storedKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt < keys[j].CreatedAt
+	})
+
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode API keys: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create API key directory: %w", err)
+	}
+
+	// Write a temporary file and rename it, so a crash never loses all keys
+	temp := s.path + ".tmp"
+	if err := os.WriteFile(temp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write API keys: %w", err)
+	}
+	if err := os.Rename(temp, s.path); err != nil {
+		return fmt.Errorf("failed to write API keys: %w", err)
+	}
+	return nil
+}
+
+// validScope reports whether scope is a known scope
+func validScope(scope string) bool {
+	return scopeRank(scope) >= 0
+}
+
+// scopeRank returns the privilege level of a scope, -1 for unknown scopes
+func scopeRank(scope string) int {
+	for i, known := range models.Scopes() {
+		if scope == known {
+			return i
+		}
+	}
+	return -1
+}
+
+// hash returns the hex SHA-256 of a secret. API keys are random enough that
+// a fast unsalted hash is safe.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// newSecret generates a new API key or refresh token
+func newSecret(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// newID generates the public ID of a key
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
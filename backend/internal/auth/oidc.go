@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"server/internal/config"
+)
+
+// defaultOIDCScopes are requested from providers without configured scopes
+var defaultOIDCScopes = []string{"openid", "email", "profile"}
+
+// ErrOIDCFailed is returned when a provider rejects a login or answers unexpectedly
+var ErrOIDCFailed = errors.New("identity provider login failed")
+
+// OIDCEndpoints are the endpoints of an identity provider used for logging in
+type OIDCEndpoints struct {
+	AuthURL     string `json:"authorization_endpoint"`
+	TokenURL    string `json:"token_endpoint"`
+	UserInfoURL string `json:"userinfo_endpoint"`
+}
+
+// Identity is a user as known to an identity provider
+type Identity struct {
+	Subject  string // Stable ID of the user at the provider
+	Username string // Suggested username, may be taken or invalid locally
+}
+
+// OIDCClient logs users in with OpenID Connect and OAuth2 providers using the authorization
+// code flow with PKCE. Users are identified through the provider's user info endpoint, so
+// no ID token signatures need to be verified.
+type OIDCClient struct {
+	client *http.Client
+
+	lock       sync.Mutex
+	discovered map[string]OIDCEndpoints // By issuer
+}
+
+// NewOIDCClient creates a client for the identity providers of the configuration
+func NewOIDCClient() *OIDCClient {
+	return &OIDCClient{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		discovered: make(map[string]OIDCEndpoints),
+	}
+}
+
+// Endpoints returns the endpoints of a provider, discovering them on first use if the
+// provider has an issuer
+func (c *OIDCClient) Endpoints(provider config.OIDCProviderConfig) (OIDCEndpoints, error) {
+	if provider.Issuer == "" {
+		return OIDCEndpoints{AuthURL: provider.AuthURL, TokenURL: provider.TokenURL, UserInfoURL: provider.UserInfoURL}, nil
+	}
+
+	c.lock.Lock()
+	endpoints, ok := c.discovered[provider.Issuer]
+	c.lock.Unlock()
+	if ok {
+		return endpoints, nil
+	}
+
+	resp, err := c.client.Get(strings.TrimSuffix(provider.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return OIDCEndpoints{}, fmt.Errorf("failed to discover %s: %w", provider.Issuer, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return OIDCEndpoints{}, fmt.Errorf("failed to discover %s: unexpected status %s", provider.Issuer, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&endpoints); err != nil {
+		return OIDCEndpoints{}, fmt.Errorf("invalid discovery document of %s: %w", provider.Issuer, err)
+	}
+	if endpoints.AuthURL == "" || endpoints.TokenURL == "" || endpoints.UserInfoURL == "" {
+		return OIDCEndpoints{}, fmt.Errorf("discovery document of %s lacks endpoints", provider.Issuer)
+	}
+
+	c.lock.Lock()
+	c.discovered[provider.Issuer] = endpoints
+	c.lock.Unlock()
+	return endpoints, nil
+}
+
+// AuthCodeURL returns the URL users are sent to for logging in. state is returned to the
+// callback unchanged, verifier must be passed to Exchange.
+func (c *OIDCClient) AuthCodeURL(provider config.OIDCProviderConfig, endpoints OIDCEndpoints, state, verifier string) string {
+	scopes := provider.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultOIDCScopes
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientID)
+	query.Set("redirect_uri", provider.RedirectURL)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(endpoints.AuthURL, "?") {
+		separator = "&"
+	}
+	return endpoints.AuthURL + separator + query.Encode()
+}
+
+// Exchange trades the code passed to the callback for the identity of the user
+func (c *OIDCClient) Exchange(provider config.OIDCProviderConfig, endpoints OIDCEndpoints, code, verifier string) (Identity, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.RedirectURL)
+	form.Set("client_id", provider.ClientID)
+	form.Set("client_secret", provider.ClientSecret)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequest(http.MethodPost, endpoints.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json") // GitHub answers form-encoded otherwise
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := c.do(req, &token); err != nil {
+		return Identity{}, fmt.Errorf("%w: token exchange: %v", ErrOIDCFailed, err)
+	}
+	if token.AccessToken == "" {
+		return Identity{}, fmt.Errorf("%w: token exchange: %s", ErrOIDCFailed, token.Error)
+	}
+
+	req, err = http.NewRequest(http.MethodGet, endpoints.UserInfoURL, nil)
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var info map[string]interface{}
+	if err := c.do(req, &info); err != nil {
+		return Identity{}, fmt.Errorf("%w: user info: %v", ErrOIDCFailed, err)
+	}
+	return identity(provider, info)
+}
+
+// do sends a request and decodes the JSON response into v
+func (c *OIDCClient) do(req *http.Request, v interface{}) error {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// identity reads the subject and username from user info. OIDC providers name the subject
+// "sub", OAuth2 providers such as GitHub use a numeric "id".
+func identity(provider config.OIDCProviderConfig, info map[string]interface{}) (Identity, error) {
+	subject := claimString(info, "sub")
+	if subject == "" {
+		subject = claimString(info, "id")
+	}
+	if subject == "" {
+		return Identity{}, fmt.Errorf("%w: user info lacks a subject", ErrOIDCFailed)
+	}
+
+	claims := []string{"preferred_username", "login", "email", "name"}
+	if provider.UsernameClaim != "" {
+		claims = append([]string{provider.UsernameClaim}, claims...)
+	}
+	var username string
+	for _, claim := range claims {
+		if username = claimString(info, claim); username != "" {
+			break
+		}
+	}
+	if at := strings.IndexByte(username, '@'); at > 0 {
+		username = username[:at]
+	}
+	return Identity{Subject: subject, Username: username}, nil
+}
+
+// claimString returns a string or numeric claim as a string, empty if it is missing
+func claimString(info map[string]interface{}, claim string) string {
+	switch v := info[claim].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// NewOIDCState returns a random state and PKCE verifier for a login
+func NewOIDCState() (state, verifier string, err error) {
+	b := make([]byte, 48)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate login state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:16]), base64.RawURLEncoding.EncodeToString(b[16:]), nil
+}
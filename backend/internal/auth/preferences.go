@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"server/internal/models"
+)
+
+const (
+	// maxPreferencesSize is the size of the largest preferences of a user, encoded
+	maxPreferencesSize = 256 << 10
+	// maxDrawingSymbols is the number of symbols a user may keep drawings of
+	maxDrawingSymbols = 200
+)
+
+// ErrInvalidPreferences is returned when saving preferences that are not allowed
+var ErrInvalidPreferences = errors.New("invalid preferences")
+
+// PreferenceStore keeps the preferences of users
+type PreferenceStore struct {
+	path   string
+	cipher *Cipher
+
+	lock        sync.Mutex
+	preferences map[string]models.Preferences // By user ID
+}
+
+// NewPreferenceStore opens the preferences saved at path, starting without preferences if
+// there is none. The file is encrypted with c if it isn't nil.
+func NewPreferenceStore(path string, c *Cipher) (*PreferenceStore, error) {
+	s := &PreferenceStore{path: path, cipher: c, preferences: make(map[string]models.Preferences)}
+
+	data, migrate, err := readSealed(path, c)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read preferences: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.preferences); err != nil {
+		return nil, fmt.Errorf("failed to parse preferences %s: %w", path, err)
+	}
+
+	// Don't leave preferences in plaintext once encryption is enabled
+	if migrate {
+		if err := s.saveLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Get returns the preferences of a user, empty ones if they never saved any
+func (s *PreferenceStore) Get(userID string) models.Preferences {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return copyPreferences(s.preferences[userID])
+}
+
+// Set replaces the preferences of a user. Symbols of drawings are stored in upper case.
+func (s *PreferenceStore) Set(userID string, preferences models.Preferences) (models.Preferences, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	drawings := make(map[string]json.RawMessage, len(preferences.Drawings))
+	for symbol, drawing := range preferences.Drawings {
+		drawings[strings.ToUpper(symbol)] = drawing
+	}
+	preferences.Drawings = drawings
+	return s.saveUserLocked(userID, preferences)
+}
+
+// SetDrawing replaces the drawings of a user on a symbol, or removes them if drawing is nil
+func (s *PreferenceStore) SetDrawing(userID, symbol string, drawing json.RawMessage) (models.Preferences, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	preferences := copyPreferences(s.preferences[userID])
+	if drawing == nil {
+		delete(preferences.Drawings, strings.ToUpper(symbol))
+	} else {
+		preferences.Drawings[strings.ToUpper(symbol)] = drawing
+	}
+	return s.saveUserLocked(userID, preferences)
+}
+
+// saveUserLocked validates and saves the preferences of a user. Requires s.lock.
+func (s *PreferenceStore) saveUserLocked(userID string, preferences models.Preferences) (models.Preferences, error) {
+	if err := validatePreferences(preferences); err != nil {
+		return models.Preferences{}, err
+	}
+
+	preferences.UpdatedAt = time.Now().UnixMilli()
+	previous, existed := s.preferences[userID]
+	s.preferences[userID] = preferences
+	if err := s.saveLocked(); err != nil {
+		if existed {
+			s.preferences[userID] = previous
+		} else {
+			delete(s.preferences, userID)
+		}
+		return models.Preferences{}, err
+	}
+	return copyPreferences(preferences), nil
+}
+
+// saveLocked writes all preferences to disk. Requires s.lock.
+func (s *PreferenceStore) saveLocked() error {
+	data, err := json.MarshalIndent(s.preferences, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode preferences: %w", err)
+	}
+	if err := writeSealed(s.path, data, s.cipher); err != nil {
+		return fmt.Errorf("failed to write preferences: %w", err)
+	}
+	return nil
+}
+
+// validatePreferences rejects unknown timeframes and themes, and preferences too large to keep
+func validatePreferences(preferences models.Preferences) error {
+	if preferences.TimeFrame != "" && !preferences.TimeFrame.IsValid() {
+		return fmt.Errorf("%w: unknown timeframe %q", ErrInvalidPreferences, preferences.TimeFrame)
+	}
+	switch preferences.Theme {
+	case "", models.ThemeLight, models.ThemeDark:
+	default:
+		return fmt.Errorf("%w: theme must be %s or %s, got %q", ErrInvalidPreferences, models.ThemeLight, models.ThemeDark, preferences.Theme)
+	}
+	if len(preferences.Drawings) > maxDrawingSymbols {
+		return fmt.Errorf("%w: drawings of at most %d symbols, got %d", ErrInvalidPreferences, maxDrawingSymbols, len(preferences.Drawings))
+	}
+	for symbol := range preferences.Drawings {
+		if symbol == "" {
+			return fmt.Errorf("%w: drawings need a symbol", ErrInvalidPreferences)
+		}
+	}
+	data, err := json.Marshal(preferences)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPreferences, err)
+	}
+	if len(data) > maxPreferencesSize {
+		return fmt.Errorf("%w: at most %d bytes, got %d", ErrInvalidPreferences, maxPreferencesSize, len(data))
+	}
+	return nil
+}
+
+// copyPreferences returns a copy of preferences that shares no map with them
+func copyPreferences(preferences models.Preferences) models.Preferences {
+	drawings := make(map[string]json.RawMessage, len(preferences.Drawings))
+	for symbol, drawing := range preferences.Drawings {
+		drawings[symbol] = drawing
+	}
+	preferences.Drawings = drawings
+	return preferences
+}
@@ -0,0 +1,353 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"server/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minPasswordLength is the shortest password accepted at registration
+const minPasswordLength = 8
+
+var (
+	// ErrUserExists is returned when registering a username that is taken
+	ErrUserExists = errors.New("username is already taken")
+	// ErrInvalidUsername is returned when registering a username that is not allowed
+	ErrInvalidUsername = errors.New("username must be 3 to 32 letters, digits, '.', '-' or '_'")
+	// ErrWeakPassword is returned when registering a password that is too short
+	ErrWeakPassword = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	// ErrInvalidCredentials is returned when logging in with a wrong username or password
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrUserNotFound is returned for IDs without a user
+	ErrUserNotFound = errors.New("user not found")
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,32}$`)
+
+// dummyHash is compared against when logging in as an unknown user, so the response
+// time doesn't reveal which usernames exist
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("seedventure"), bcrypt.DefaultCost)
+
+// storedUser is a user as saved, with the bcrypt hash of their password or, for users
+// of an identity provider, their ID there
+type storedUser struct {
+	models.User
+	PasswordHash string `json:"passwordHash,omitempty"`
+	Subject      string `json:"subject,omitempty"`
+}
+
+// refreshToken is a refresh token as saved, identified by the hash of its secret
+type refreshToken struct {
+	Hash      string `json:"hash"`
+	UserID    string `json:"userId"`
+	ExpiresAt int64  `json:"expiresAt"` // Unix milliseconds
+}
+
+// usersFile is the saved form of a UserStore
+type usersFile struct {
+	Users         []*storedUser   `json:"users"`
+	RefreshTokens []*refreshToken `json:"refreshTokens"`
+}
+
+// UserStore keeps user accounts and their refresh tokens. Refresh tokens can be used
+// once: every refresh replaces the token, so a stolen one stops working as soon as
+// either party uses it.
+type UserStore struct {
+	path   string
+	cipher *Cipher
+
+	lock      sync.Mutex
+	users     map[string]*storedUser   // By ID
+	usernames map[string]*storedUser   // By lower case username
+	subjects  map[string]*storedUser   // By "<provider>:<subject>"
+	refresh   map[string]*refreshToken // By hash of the secret
+}
+
+// NewUserStore opens the users saved at path, starting without users if there is none.
+// The file is encrypted with c if it isn't nil, as it holds identities of players.
+func NewUserStore(path string, c *Cipher) (*UserStore, error) {
+	s := &UserStore{
+		path:      path,
+		cipher:    c,
+		users:     make(map[string]*storedUser),
+		usernames: make(map[string]*storedUser),
+		subjects:  make(map[string]*storedUser),
+		refresh:   make(map[string]*refreshToken),
+	}
+
+	data, migrate, err := readSealed(path, c)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+
+	var saved usersFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse users %s: %w", path, err)
+	}
+	for _, user := range saved.Users {
+		s.users[user.ID] = user
+		s.usernames[strings.ToLower(user.Username)] = user
+		if user.Provider != "" {
+			s.subjects[user.Provider+":"+user.Subject] = user
+		}
+	}
+	for _, token := range saved.RefreshTokens {
+		s.refresh[token.Hash] = token
+	}
+
+	// Don't leave users in plaintext once encryption is enabled
+	if migrate {
+		if err := s.saveLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Register creates a user. Usernames are case-insensitively unique.
+func (s *UserStore) Register(username, password string) (models.User, error) {
+	if !usernamePattern.MatchString(username) {
+		return models.User{}, ErrInvalidUsername
+	}
+	if len(password) < minPasswordLength {
+		return models.User{}, ErrWeakPassword
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &storedUser{
+		User: models.User{
+			ID:        newID(),
+			Username:  username,
+			CreatedAt: time.Now().UnixMilli(),
+		},
+		PasswordHash: string(hashed),
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	lower := strings.ToLower(username)
+	if _, ok := s.usernames[lower]; ok {
+		return models.User{}, ErrUserExists
+	}
+	s.users[user.ID] = user
+	s.usernames[lower] = user
+	if err := s.saveLocked(); err != nil {
+		delete(s.users, user.ID)
+		delete(s.usernames, lower)
+		return models.User{}, err
+	}
+	return user.User, nil
+}
+
+// Login returns the user with the given username and password
+func (s *UserStore) Login(username, password string) (models.User, error) {
+	s.lock.Lock()
+	user, ok := s.usernames[strings.ToLower(username)]
+	s.lock.Unlock()
+
+	if !ok || user.PasswordHash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return models.User{}, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return models.User{}, ErrInvalidCredentials
+	}
+	return user.User, nil
+}
+
+// Provision returns the user of an identity provider's user, creating it on first login.
+// The suggested username is cleaned up and numbered if it is taken.
+func (s *UserStore) Provision(provider string, identity Identity) (models.User, error) {
+	key := provider + ":" + identity.Subject
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if user, ok := s.subjects[key]; ok {
+		return user.User, nil
+	}
+
+	user := &storedUser{
+		User: models.User{
+			ID:        newID(),
+			Username:  s.freeUsernameLocked(identity.Username),
+			Provider:  provider,
+			CreatedAt: time.Now().UnixMilli(),
+		},
+		Subject: identity.Subject,
+	}
+	lower := strings.ToLower(user.Username)
+	s.users[user.ID] = user
+	s.usernames[lower] = user
+	s.subjects[key] = user
+	if err := s.saveLocked(); err != nil {
+		delete(s.users, user.ID)
+		delete(s.usernames, lower)
+		delete(s.subjects, key)
+		return models.User{}, err
+	}
+	return user.User, nil
+}
+
+// freeUsernameLocked turns a suggested username into a valid one not taken yet. Requires s.lock.
+func (s *UserStore) freeUsernameLocked(suggested string) string {
+	base := strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, suggested)
+	if len(base) > 28 {
+		base = base[:28]
+	}
+	if len(base) < 3 {
+		base = "player"
+	}
+
+	username := base
+	for i := 2; ; i++ {
+		if _, ok := s.usernames[strings.ToLower(username)]; !ok {
+			return username
+		}
+		username = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// Get returns the user with an ID
+func (s *UserStore) Get(id string) (models.User, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return models.User{}, ErrUserNotFound
+	}
+	return user.User, nil
+}
+
+// List returns all users, oldest first
+func (s *UserStore) List() []models.User {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	users := make([]models.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user.User)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt < users[j].CreatedAt
+	})
+	return users
+}
+
+// IssueRefreshToken creates a refresh token for a user, valid for ttl
+func (s *UserStore) IssueRefreshToken(userID string, ttl time.Duration) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.issueLocked(userID, ttl)
+}
+
+// Refresh exchanges a refresh token for the user it belongs to and a new refresh token
+func (s *UserStore) Refresh(secret string, ttl time.Duration) (models.User, string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	token, ok := s.refresh[hash(secret)]
+	if !ok {
+		return models.User{}, "", ErrInvalidToken
+	}
+	delete(s.refresh, token.Hash)
+	if time.Now().UnixMilli() >= token.ExpiresAt {
+		return models.User{}, "", ErrTokenExpired
+	}
+	user, ok := s.users[token.UserID]
+	if !ok {
+		return models.User{}, "", ErrInvalidToken
+	}
+
+	next, err := s.issueLocked(user.ID, ttl)
+	if err != nil {
+		s.refresh[token.Hash] = token
+		return models.User{}, "", err
+	}
+	return user.User, next, nil
+}
+
+// RevokeRefreshToken invalidates a refresh token, as done on logout. Unknown tokens are ignored.
+func (s *UserStore) RevokeRefreshToken(secret string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	h := hash(secret)
+	if _, ok := s.refresh[h]; !ok {
+		return nil
+	}
+	delete(s.refresh, h)
+	return s.saveLocked()
+}
+
+// issueLocked creates and saves a refresh token. Requires s.lock.
+func (s *UserStore) issueLocked(userID string, ttl time.Duration) (string, error) {
+	secret, err := newSecret(refreshPrefix)
+	if err != nil {
+		return "", err
+	}
+	token := &refreshToken{
+		Hash:      hash(secret),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(ttl).UnixMilli(),
+	}
+	s.refresh[token.Hash] = token
+	if err := s.saveLocked(); err != nil {
+		delete(s.refresh, token.Hash)
+		return "", err
+	}
+	return secret, nil
+}
+
+// saveLocked writes all users and unexpired refresh tokens to disk. Requires s.lock.
+func (s *UserStore) saveLocked() error {
+	var saved usersFile
+	for _, user := range s.users {
+		saved.Users = append(saved.Users, user)
+	}
+	sort.Slice(saved.Users, func(i, j int) bool {
+		return saved.Users[i].CreatedAt < saved.Users[j].CreatedAt
+	})
+
+	now := time.Now().UnixMilli()
+	for h, token := range s.refresh {
+		if now >= token.ExpiresAt {
+			delete(s.refresh, h)
+			continue
+		}
+		saved.RefreshTokens = append(saved.RefreshTokens, token)
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode users: %w", err)
+	}
+	if err := writeSealed(s.path, data, s.cipher); err != nil {
+		return fmt.Errorf("failed to write users: %w", err)
+	}
+	return nil
+}
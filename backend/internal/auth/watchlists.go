@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"server/internal/models"
+)
+
+const (
+	// maxWatchlists is the number of watchlists a user may have
+	maxWatchlists = 20
+	// maxWatchlistSymbols is the number of symbols a watchlist may hold
+	maxWatchlistSymbols = 100
+	// maxWatchlistName is the length of the longest watchlist name
+	maxWatchlistName = 64
+	// maxAlertTargets is the number of services a price alert may be sent to
+	maxAlertTargets = 5
+)
+
+var (
+	// ErrWatchlistNotFound is returned for IDs without a watchlist of the user
+	ErrWatchlistNotFound = errors.New("watchlist not found")
+	// ErrInvalidWatchlist is returned when saving a watchlist that is not allowed
+	ErrInvalidWatchlist = errors.New("invalid watchlist")
+	// ErrTooManyWatchlists is returned when creating a watchlist beyond maxWatchlists
+	ErrTooManyWatchlists = fmt.Errorf("a user may have at most %d watchlists", maxWatchlists)
+)
+
+// WatchlistStore keeps the watchlists of users
+type WatchlistStore struct {
+	path   string
+	cipher *Cipher
+
+	lock       sync.Mutex
+	watchlists map[string][]*models.Watchlist // By user ID, in creation order
+}
+
+// NewWatchlistStore opens the watchlists saved at path, starting without watchlists if there
+// is none. The file is encrypted with c if it isn't nil.
+func NewWatchlistStore(path string, c *Cipher) (*WatchlistStore, error) {
+	s := &WatchlistStore{path: path, cipher: c, watchlists: make(map[string][]*models.Watchlist)}
+
+	data, migrate, err := readSealed(path, c)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watchlists: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.watchlists); err != nil {
+		return nil, fmt.Errorf("failed to parse watchlists %s: %w", path, err)
+	}
+
+	// Don't leave watchlists in plaintext once encryption is enabled
+	if migrate {
+		if err := s.saveLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// List returns the watchlists of a user, oldest first
+func (s *WatchlistStore) List(userID string) []models.Watchlist {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	watchlists := []models.Watchlist{}
+	for _, watchlist := range s.watchlists[userID] {
+		watchlists = append(watchlists, copyWatchlist(watchlist))
+	}
+	return watchlists
+}
+
+// Get returns a watchlist of a user
+func (s *WatchlistStore) Get(userID, id string) (models.Watchlist, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, watchlist := s.findLocked(userID, id)
+	if watchlist == nil {
+		return models.Watchlist{}, ErrWatchlistNotFound
+	}
+	return copyWatchlist(watchlist), nil
+}
+
+// Create adds a watchlist for a user. Symbols are stored in upper case, each at most once.
+func (s *WatchlistStore) Create(userID, name string, entries []models.WatchlistEntry) (models.Watchlist, error) {
+	name, entries, err := normalizeWatchlist(name, entries)
+	if err != nil {
+		return models.Watchlist{}, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.watchlists[userID]) >= maxWatchlists {
+		return models.Watchlist{}, ErrTooManyWatchlists
+	}
+	now := time.Now().UnixMilli()
+	watchlist := &models.Watchlist{ID: newID(), Name: name, Symbols: entries, CreatedAt: now, UpdatedAt: now}
+	previous := s.watchlists[userID]
+	s.watchlists[userID] = append(previous, watchlist)
+	if err := s.saveLocked(); err != nil {
+		s.watchlists[userID] = previous
+		return models.Watchlist{}, err
+	}
+	return copyWatchlist(watchlist), nil
+}
+
+// Update replaces the name and symbols of a watchlist of a user
+func (s *WatchlistStore) Update(userID, id, name string, entries []models.WatchlistEntry) (models.Watchlist, error) {
+	name, entries, err := normalizeWatchlist(name, entries)
+	if err != nil {
+		return models.Watchlist{}, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, watchlist := s.findLocked(userID, id)
+	if watchlist == nil {
+		return models.Watchlist{}, ErrWatchlistNotFound
+	}
+	previous := *watchlist
+	watchlist.Name, watchlist.Symbols, watchlist.UpdatedAt = name, entries, time.Now().UnixMilli()
+	if err := s.saveLocked(); err != nil {
+		*watchlist = previous
+		return models.Watchlist{}, err
+	}
+	return copyWatchlist(watchlist), nil
+}
+
+// Delete removes a watchlist of a user
+func (s *WatchlistStore) Delete(userID, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i, watchlist := s.findLocked(userID, id)
+	if watchlist == nil {
+		return ErrWatchlistNotFound
+	}
+	previous := s.watchlists[userID]
+	remaining := append(append([]*models.Watchlist(nil), previous[:i]...), previous[i+1:]...)
+	if len(remaining) == 0 {
+		delete(s.watchlists, userID)
+	} else {
+		s.watchlists[userID] = remaining
+	}
+	if err := s.saveLocked(); err != nil {
+		s.watchlists[userID] = previous
+		return err
+	}
+	return nil
+}
+
+// BoundAlert is a price alert bound to a symbol on a watchlist of a user
+type BoundAlert struct {
+	UserID    string
+	Watchlist string // Name of the watchlist
+	Symbol    string
+	Alert     models.PriceAlert
+}
+
+// Alerts returns the price alerts bound to symbols on the watchlists of all users
+func (s *WatchlistStore) Alerts() []BoundAlert {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var alerts []BoundAlert
+	for userID, watchlists := range s.watchlists {
+		for _, watchlist := range watchlists {
+			for _, entry := range watchlist.Symbols {
+				for _, alert := range entry.Alerts {
+					alert.Notify = append([]models.AlertTarget(nil), alert.Notify...)
+					alerts = append(alerts, BoundAlert{UserID: userID, Watchlist: watchlist.Name, Symbol: entry.Symbol, Alert: alert})
+				}
+			}
+		}
+	}
+	return alerts
+}
+
+// findLocked returns a watchlist of a user and its position, nil if there is none. Requires s.lock.
+func (s *WatchlistStore) findLocked(userID, id string) (int, *models.Watchlist) {
+	for i, watchlist := range s.watchlists[userID] {
+		if watchlist.ID == id {
+			return i, watchlist
+		}
+	}
+	return -1, nil
+}
+
+// saveLocked writes all watchlists to disk. Requires s.lock.
+func (s *WatchlistStore) saveLocked() error {
+	data, err := json.MarshalIndent(s.watchlists, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode watchlists: %w", err)
+	}
+	if err := writeSealed(s.path, data, s.cipher); err != nil {
+		return fmt.Errorf("failed to write watchlists: %w", err)
+	}
+	return nil
+}
+
+// normalizeWatchlist validates the name and symbols of a watchlist and returns them as
+// stored: the name trimmed, the symbols in upper case without live data
+func normalizeWatchlist(name string, entries []models.WatchlistEntry) (string, []models.WatchlistEntry, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxWatchlistName {
+		return "", nil, fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidWatchlist, maxWatchlistName)
+	}
+	if len(entries) > maxWatchlistSymbols {
+		return "", nil, fmt.Errorf("%w: at most %d symbols, got %d", ErrInvalidWatchlist, maxWatchlistSymbols, len(entries))
+	}
+
+	normalized := make([]models.WatchlistEntry, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		symbol := strings.ToUpper(strings.TrimSpace(entry.Symbol))
+		if symbol == "" {
+			return "", nil, fmt.Errorf("%w: symbols must not be empty", ErrInvalidWatchlist)
+		}
+		if seen[symbol] {
+			return "", nil, fmt.Errorf("%w: symbol %s is listed twice", ErrInvalidWatchlist, symbol)
+		}
+		seen[symbol] = true
+		for _, alert := range entry.Alerts {
+			if alert.Above < 0 || alert.Below < 0 || alert.Above == 0 && alert.Below == 0 {
+				return "", nil, fmt.Errorf("%w: alerts of %s need a positive above or below price", ErrInvalidWatchlist, symbol)
+			}
+			if len(alert.Notify) > maxAlertTargets {
+				return "", nil, fmt.Errorf("%w: alerts of %s may notify at most %d targets", ErrInvalidWatchlist, symbol, maxAlertTargets)
+			}
+		}
+		normalized = append(normalized, models.WatchlistEntry{Symbol: symbol, Alerts: copyAlerts(entry.Alerts)})
+	}
+	return name, normalized, nil
+}
+
+// copyWatchlist returns a copy of a watchlist that shares no slices with it
+func copyWatchlist(watchlist *models.Watchlist) models.Watchlist {
+	c := *watchlist
+	c.Symbols = make([]models.WatchlistEntry, len(watchlist.Symbols))
+	for i, entry := range watchlist.Symbols {
+		c.Symbols[i] = models.WatchlistEntry{Symbol: entry.Symbol, Alerts: copyAlerts(entry.Alerts)}
+	}
+	return c
+}
+
+// copyAlerts returns a copy of price alerts that shares no slices with them
+func copyAlerts(alerts []models.PriceAlert) []models.PriceAlert {
+	if alerts == nil {
+		return nil
+	}
+	c := make([]models.PriceAlert, len(alerts))
+	for i, alert := range alerts {
+		c[i] = alert
+		c[i].Notify = append([]models.AlertTarget(nil), alert.Notify...)
+	}
+	return c
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"server/internal/config"
+	"server/internal/loadtest"
+	"server/internal/models"
+)
+
+// BenchCommand drives the live endpoints of a running server with synthetic clients
+func BenchCommand() Command {
+	c := Command{Name: "bench", Summary: "Connect WebSocket clients to a server and report latency, message loss and reconnects"}
+	c.Run = func(args []string) error {
+		var opts loadtest.Options
+		flags := newFlagSet(c)
+		target := flags.String("url", "", "server to benchmark (default http://localhost:PORT)")
+		timeFrame := flags.String("timeframe", string(models.TimeFrame1Min), "timeframe to subscribe to and request")
+		flags.IntVar(&opts.Clients, "clients", 100, "number of WebSocket clients")
+		flags.IntVar(&opts.Pollers, "pollers", 0, "number of REST clients polling the history")
+		flags.DurationVar(&opts.Duration, "duration", 60*time.Second, "how long to generate load")
+		flags.DurationVar(&opts.PollInterval, "poll-interval", time.Second, "pause between requests of a single poller")
+		flags.BoolVar(&opts.Reconnect, "reconnect", true, "reconnect clients the server disconnects")
+		cfg, err := config.LoadFlags(flags, args)
+		if err != nil {
+			return err
+		}
+		opts.TimeFrame = models.TimeFrame(*timeFrame)
+		if !opts.TimeFrame.IsValid() {
+			return fmt.Errorf("unknown timeframe %q", *timeFrame)
+		}
+		if opts.Clients < 1 || opts.Duration <= 0 {
+			flags.Usage()
+			return errUsage
+		}
+
+		opts.BaseURL = *target
+		if opts.BaseURL == "" {
+			opts.BaseURL = fmt.Sprintf("http://localhost:%d", cfg.Server.Port)
+		}
+		log.Printf("Benchmarking %s: %d clients, %d pollers for %s", opts.BaseURL, opts.Clients, opts.Pollers, opts.Duration)
+
+		report, err := loadtest.Run(opts)
+		if err != nil {
+			return err
+		}
+		report.Print(os.Stdout)
+		return nil
+	}
+	return c
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Command is a subcommand of the seedventure binary
+type Command struct {
+	Name    string
+	Usage   string // Arguments after the flags, if any
+	Summary string
+	Run     func(args []string) error
+}
+
+// Run runs the command named by the first argument with the remaining ones and returns
+// the exit code. Without a command name, the first command runs, so flags alone keep
+// starting the server as before there were commands.
+func Run(commands []Command, args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "help", "-h", "-help", "--help":
+			usage(os.Stdout, commands)
+			return 0
+		}
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return run(commands[0], args)
+	}
+	for _, command := range commands {
+		if command.Name == args[0] {
+			return run(command, args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+	usage(os.Stderr, commands)
+	return 2
+}
+
+// run runs a command and turns its error into an exit code
+func run(command Command, args []string) int {
+	err := command.Run(args)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	return 1
+}
+
+// usage lists the commands
+func usage(w io.Writer, commands []Command) {
+	fmt.Fprintln(w, "Usage: seedventure [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, command := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", command.Name, command.Summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Without a command, %s runs. Run seedventure <command> -h for its flags.\n", commands[0].Name)
+}
+
+// errUsage is returned by commands called with invalid arguments after printing their usage
+var errUsage = errors.New("invalid arguments")
+
+// newFlagSet creates the flag set of a command, printing its usage on -h or invalid flags
+func newFlagSet(command Command) *flag.FlagSet {
+	fs := flag.NewFlagSet("seedventure "+command.Name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s\n\n%s\n\nFlags:\n", strings.TrimSpace("seedventure "+command.Name+" [flags] "+command.Usage), command.Summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
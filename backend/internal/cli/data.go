@@ -0,0 +1,638 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/config"
+	"server/internal/models"
+	"server/internal/service"
+	"server/internal/store"
+)
+
+// Formats of imported and exported candles
+const (
+	formatJSON = "json" // Array of candles as in the data files
+	formatCSV  = "csv"  // time,open,high,low,close,volume with time in Unix milliseconds
+)
+
+// csvHeader is the first row of exported CSV files
+var csvHeader = []string{"time", "open", "high", "low", "close", "volume"}
+
+// ServeFunc runs the server with a configuration until it fails, calling ready once the
+// price data is loaded
+type ServeFunc func(cfg *config.Config, ready func(ps *service.PriceService) error) error
+
+// DataCommands returns the commands working on the data directory. A running server
+// doesn't notice their changes until POST /admin/reload-data, and overwrites them with
+// its next save otherwise, so stop it or reload the data afterwards. serve runs the
+// server for replays.
+func DataCommands(serve ServeFunc) []Command {
+	return []Command{
+		generateCommand(),
+		importCommand(),
+		exportCommand(),
+		compactCommand(),
+		verifyCommand(),
+		repairCommand(),
+		rebuildCommand(),
+		replayCommand(serve),
+	}
+}
+
+// generateCommand replaces the history with generated prices. Only the last -max-candles
+// candles of every timeframe are kept, so raise it for long histories.
+func generateCommand() Command {
+	c := Command{Name: "generate", Summary: "Generate a new price history in the data directory"}
+	c.Run = func(args []string) error {
+		flags := newFlagSet(c)
+		days := flags.Int("days", 1, "days of 1-minute history to generate")
+		force := flags.Bool("force", false, "replace an existing history")
+		seed := flags.Int64("seed", 0, "seed of the price generator, the same seed generates the same history (default from the configuration)")
+		model := flags.String("model", "", "price model moving the price (default from the configuration)")
+		cfg, err := config.LoadFlags(flags, args)
+		if err != nil {
+			return err
+		}
+		if *days < 1 {
+			return fmt.Errorf("-days must be positive, got %d", *days)
+		}
+		if *seed != 0 {
+			cfg.Simulation.Seed = *seed
+		}
+		if *model != "" {
+			if _, ok := models.GetPriceModel(*model); !ok {
+				return fmt.Errorf("unknown price model %q", *model)
+			}
+			cfg.Simulation.Model = *model
+		}
+		if _, err := os.Stat(service.HistoryFile(cfg.Data.Dir, models.TimeFrame1Min)); err == nil && !*force {
+			return fmt.Errorf("%s already holds a history, pass -force to replace it", cfg.Data.Dir)
+		}
+
+		ps := service.NewPriceService(cfg)
+		ps.Initialize(*days)
+		return ps.SaveAllTimeFrames()
+	}
+	return c
+}
+
+// importCommand merges candles from a file into the history
+func importCommand() Command {
+	c := Command{Name: "import", Usage: "FILE", Summary: "Import candles from a JSON or CSV file into the data directory"}
+	c.Run = func(args []string) error {
+		flags := newFlagSet(c)
+		timeFrame := flags.String("timeframe", string(models.TimeFrame1Min), "timeframe of the imported candles")
+		format := flags.String("format", "", "json or csv, by default from the file extension")
+		replace := flags.Bool("replace", false, "discard the existing history of the timeframe instead of merging")
+		cfg, err := config.LoadFlags(flags, args)
+		if err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return errUsage
+		}
+		tf := models.TimeFrame(*timeFrame)
+		if !tf.IsValid() {
+			return fmt.Errorf("unknown timeframe %q", *timeFrame)
+		}
+
+		path := flags.Arg(0)
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		imported, err := readCandles(file, fileFormat(path, *format))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		for i := range imported {
+			imported[i].Timestamp = tf.NormalizeTimestamp(imported[i].Timestamp)
+			imported[i].IsComplete = true
+		}
+
+		var existing []models.CandleData
+		if !*replace {
+			existing, err = service.ReadHistoryFile(cfg.Data.Dir, tf)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to read %s history: %w", tf, err)
+			}
+		}
+
+		// Imported candles replace existing ones with the same timestamp
+		candles := store.NewSeriesFrom(append(existing, imported...), cfg.Data.MaxCandles).Candles()
+		if err := service.WriteHistoryFile(cfg.Data.Dir, tf, candles); err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d candles, %s history holds %d\n", len(imported), tf, len(candles))
+
+		// Higher timeframes follow the 1-minute history
+		if tf == models.TimeFrame1Min {
+			if err := rebuildAggregates(cfg, candles, models.AllTimeFrames()[1:]); err != nil {
+				return err
+			}
+			fmt.Println("Rebuilt higher timeframes from the 1-minute history")
+		}
+		return nil
+	}
+	return c
+}
+
+// rebuildCommand regenerates higher timeframes from the 1-minute history
+func rebuildCommand() Command {
+	c := Command{Name: "rebuild", Summary: "Regenerate higher timeframes from the 1-minute history"}
+	c.Run = func(args []string) error {
+		flags := newFlagSet(c)
+		list := flags.String("timeframes", "", "comma separated timeframes to rebuild (default all above 1m)")
+		cfg, err := config.LoadFlags(flags, args)
+		if err != nil {
+			return err
+		}
+
+		timeframes := models.AllTimeFrames()[1:]
+		if *list != "" {
+			timeframes = nil
+			for _, part := range strings.Split(*list, ",") {
+				tf := models.TimeFrame(strings.TrimSpace(part))
+				if !tf.IsValid() {
+					return fmt.Errorf("unknown timeframe %q", part)
+				}
+				if tf == models.TimeFrame1Min {
+					return service.ErrNotAggregate
+				}
+				timeframes = append(timeframes, tf)
+			}
+		}
+
+		minute, err := service.ReadHistoryFile(cfg.Data.Dir, models.TimeFrame1Min)
+		if err != nil {
+			return fmt.Errorf("failed to read 1-minute history: %w", err)
+		}
+		if err := rebuildAggregates(cfg, minute, timeframes); err != nil {
+			return err
+		}
+		fmt.Printf("Rebuilt %v from %d 1-minute candles\n", timeframes, len(minute))
+		return nil
+	}
+	return c
+}
+
+// rebuildAggregates replaces the history of higher timeframes with the aggregated minute candles
+func rebuildAggregates(cfg *config.Config, minute []models.CandleData, timeframes []models.TimeFrame) error {
+	for _, tf := range timeframes {
+		aggregated := store.NewSeriesFrom(service.AggregateHistory(minute, tf), cfg.Data.MaxCandles).Candles()
+		if err := service.WriteHistoryFile(cfg.Data.Dir, tf, aggregated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportCommand writes the history of a timeframe to a file or stdout
+func exportCommand() Command {
+	c := Command{Name: "export", Summary: "Export the history of a timeframe as JSON or CSV"}
+	c.Run = func(args []string) error {
+		flags := newFlagSet(c)
+		timeFrame := flags.String("timeframe", string(models.TimeFrame1Min), "timeframe to export")
+		format := flags.String("format", "", "json or csv, by default from the output file extension or json")
+		output := flags.String("o", "", "file to write, stdout if empty")
+		cfg, err := config.LoadFlags(flags, args)
+		if err != nil {
+			return err
+		}
+		tf := models.TimeFrame(*timeFrame)
+		if !tf.IsValid() {
+			return fmt.Errorf("unknown timeframe %q", *timeFrame)
+		}
+
+		candles, err := service.ReadHistoryFile(cfg.Data.Dir, tf)
+		if err != nil {
+			return fmt.Errorf("failed to read %s history: %w", tf, err)
+		}
+
+		w := os.Stdout
+		if *output != "" {
+			if w, err = os.Create(*output); err != nil {
+				return err
+			}
+			defer w.Close()
+		}
+		buffered := bufio.NewWriter(w)
+		if err := writeCandles(buffered, fileFormat(*output, *format), candles); err != nil {
+			return err
+		}
+		return buffered.Flush()
+	}
+	return c
+}
+
+// compactCommand rewrites the data files in their canonical form
+func compactCommand() Command {
+	c := Command{Name: "compact", Summary: "Sort the data files, drop duplicate and surplus candles and leftover temporary files"}
+	c.Run = func(args []string) error {
+		flags := newFlagSet(c)
+		cfg, err := config.LoadFlags(flags, args)
+		if err != nil {
+			return err
+		}
+
+		for _, tf := range models.AllTimeFrames() {
+			candles, err := service.ReadHistoryFile(cfg.Data.Dir, tf)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read %s history: %w", tf, err)
+			}
+			compacted := store.NewSeriesFrom(candles, cfg.Data.MaxCandles).Candles()
+			if err := service.WriteHistoryFile(cfg.Data.Dir, tf, compacted); err != nil {
+				return err
+			}
+			fmt.Printf("%s: %d candles, %d dropped\n", tf, len(compacted), len(candles)-len(compacted))
+		}
+
+		// Saves interrupted by crashes leave their temporary files behind
+		temps, err := filepath.Glob(filepath.Join(cfg.Data.Dir, "*.tmp"))
+		if err != nil {
+			return err
+		}
+		for _, temp := range temps {
+			if err := os.Remove(temp); err != nil {
+				return err
+			}
+			fmt.Printf("Removed %s\n", temp)
+		}
+		return nil
+	}
+	return c
+}
+
+// verifyCommand checks the data files for inconsistencies
+func verifyCommand() Command {
+	c := Command{Name: "verify", Summary: "Check the data files for unsorted, invalid or inconsistent candles"}
+	c.Run = func(args []string) error {
+		flags := newFlagSet(c)
+		cfg, err := config.LoadFlags(flags, args)
+		if err != nil {
+			return err
+		}
+
+		histories := make(map[models.TimeFrame][]models.CandleData)
+		var problems []string
+		for _, tf := range models.AllTimeFrames() {
+			candles, err := service.ReadHistoryFile(cfg.Data.Dir, tf)
+			if errors.Is(err, os.ErrNotExist) {
+				problems = append(problems, fmt.Sprintf("%s: no data file", tf))
+				continue
+			}
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", tf, err))
+				continue
+			}
+			histories[tf] = candles
+			problems = append(problems, verifyCandles(tf, candles, cfg.Data.MaxCandles)...)
+		}
+		if minute, ok := histories[models.TimeFrame1Min]; ok {
+			for _, tf := range models.AllTimeFrames()[1:] {
+				if candles, ok := histories[tf]; ok {
+					problems = append(problems, verifyAggregates(tf, candles, minute)...)
+				}
+			}
+		}
+
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("found %d problems in %s", len(problems), cfg.Data.Dir)
+		}
+		fmt.Printf("%s is consistent\n", cfg.Data.Dir)
+		return nil
+	}
+	return c
+}
+
+// repairCommand fixes what verify finds and reports the repairs
+func repairCommand() Command {
+	c := Command{Name: "repair", Summary: "Fix invalid and inconsistent candles in the data files and report the repairs"}
+	c.Run = func(args []string) error {
+		flags := newFlagSet(c)
+		dryRun := flags.Bool("dry-run", false, "report the repairs without writing them")
+		cfg, err := config.LoadFlags(flags, args)
+		if err != nil {
+			return err
+		}
+
+		// The 1-minute history is repaired first, the higher timeframes are compared with it
+		histories := make(map[models.TimeFrame][]models.CandleData)
+		var repairs []string
+		for _, tf := range models.AllTimeFrames() {
+			candles, err := service.ReadHistoryFile(cfg.Data.Dir, tf)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read %s history: %w", tf, err)
+			}
+
+			repaired, fixed := repairCandles(tf, candles, cfg.Data.MaxCandles)
+			if minute, ok := histories[models.TimeFrame1Min]; ok && tf != models.TimeFrame1Min {
+				var recomputed []string
+				repaired, recomputed = repairAggregates(tf, repaired, minute, cfg.Data.MaxCandles)
+				fixed = append(fixed, recomputed...)
+			}
+			histories[tf] = repaired
+			repairs = append(repairs, fixed...)
+
+			if len(fixed) == 0 || *dryRun {
+				continue
+			}
+			if err := service.WriteHistoryFile(cfg.Data.Dir, tf, repaired); err != nil {
+				return err
+			}
+		}
+
+		for _, repair := range repairs {
+			fmt.Println(repair)
+		}
+		switch {
+		case len(repairs) == 0:
+			fmt.Printf("%s needs no repairs\n", cfg.Data.Dir)
+		case *dryRun:
+			fmt.Printf("Would make %d repairs in %s\n", len(repairs), cfg.Data.Dir)
+		default:
+			fmt.Printf("Made %d repairs in %s\n", len(repairs), cfg.Data.Dir)
+		}
+		return nil
+	}
+	return c
+}
+
+// replayCommand prints a session recording or the 1-minute history of a data directory as
+// the messages clients receive, or serves them through the API with -serve
+func replayCommand(serve ServeFunc) Command {
+	c := Command{Name: "replay", Usage: "RECORDING|DATA-DIR", Summary: "Replay a session recording or a price history to stdout or through the API"}
+	c.Run = func(args []string) error {
+		flags := newFlagSet(c)
+		speed := flags.Float64("speed", 1, "how many times faster than recorded, 0 prints everything at once")
+		channel := flags.String("channel", "", "only print messages sent on this timeframe, and those sent to everybody")
+		history := flags.Int("history", 100, "1-minute candles of a price history sent as the initial history before replaying the rest")
+		serveAPI := flags.Bool("serve", false, "run the server and replay to its clients instead of printing")
+		loop := flags.Bool("loop", false, "start over at the end, with -serve")
+		cfg, err := config.LoadFlags(flags, args)
+		if err != nil {
+			return err
+		}
+		if flags.NArg() != 1 || *speed < 0 || *history < 0 || *serveAPI && *speed == 0 {
+			flags.Usage()
+			return errUsage
+		}
+
+		// Directories are price histories, bare names are recordings in the data directory
+		// as listed by /admin/recordings
+		path := flags.Arg(0)
+		info, err := os.Stat(path)
+		dataset := err == nil && info.IsDir()
+		if !dataset && !strings.ContainsRune(path, filepath.Separator) {
+			path = filepath.Join(cfg.Data.Dir, "recordings", path)
+		}
+
+		if *serveAPI {
+			if dataset {
+				if path, err = historyRecording(path, *history, filepath.Join(cfg.Data.Dir, "recordings")); err != nil {
+					return err
+				}
+			}
+			return serve(cfg, func(ps *service.PriceService) error {
+				return ps.ReplayFile(path, *speed, *loop)
+			})
+		}
+
+		out := bufio.NewWriter(os.Stdout)
+		defer out.Flush()
+		var previous int64
+		emit := func(event models.RecordedEvent) error {
+			if *channel != "" && event.Channel != "" && string(event.Channel) != *channel {
+				return nil
+			}
+			if *speed > 0 && previous != 0 && event.Time > previous {
+				out.Flush()
+				time.Sleep(time.Duration(float64(time.Duration(event.Time-previous)*time.Millisecond) / *speed))
+			}
+			previous = event.Time
+
+			out.Write(event.Message)
+			return out.WriteByte('\n')
+		}
+
+		if dataset {
+			minute, err := service.ReadHistoryFile(path, models.TimeFrame1Min)
+			if err != nil {
+				return err
+			}
+			return service.HistoryEvents(minute, *history, emit)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), 64<<20)
+		for scanner.Scan() {
+			var event models.RecordedEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				return fmt.Errorf("invalid event: %w", err)
+			}
+			if err := emit(event); err != nil {
+				return err
+			}
+		}
+		return scanner.Err()
+	}
+	return c
+}
+
+// historyRecording writes the 1-minute history of a data directory to a recording in
+// recordings, named after the directory so the server can replay it again, and returns its path
+func historyRecording(dir string, history int, recordings string) (string, error) {
+	minute, err := service.ReadHistoryFile(dir, models.TimeFrame1Min)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	name := strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, filepath.Base(abs))
+	if err := os.MkdirAll(recordings, 0755); err != nil {
+		return "", err
+	}
+	file, err := os.Create(filepath.Join(recordings, "history-"+name+".jsonl"))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	out := bufio.NewWriter(file)
+	err = service.HistoryEvents(minute, history, func(event models.RecordedEvent) error {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		out.Write(line)
+		return out.WriteByte('\n')
+	})
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write recording: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// fileFormat returns the format of a file, explicit if given or from the file extension
+func fileFormat(path, explicit string) string {
+	if explicit != "" {
+		return explicit
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return formatCSV
+	}
+	return formatJSON
+}
+
+// readCandles decodes candles in a format
+func readCandles(r io.Reader, format string) ([]models.CandleData, error) {
+	switch format {
+	case formatJSON:
+		var candles []models.CandleData
+		decoder := json.NewDecoder(r)
+		if err := decoder.Decode(&candles); err != nil {
+			return nil, err
+		}
+		if _, err := decoder.Token(); err != io.EOF {
+			return nil, errors.New("unexpected data after the candles")
+		}
+		for i, candle := range candles {
+			if err := validateCandle(candle); err != nil {
+				return nil, fmt.Errorf("candle %d: %w", i+1, err)
+			}
+		}
+		return candles, nil
+	case formatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		var candles []models.CandleData
+		for line := 1; ; line++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				return candles, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if line == 1 {
+				// Spreadsheets often start files with a byte order mark
+				record[0] = strings.TrimPrefix(record[0], "\ufeff")
+				if strings.TrimSpace(record[0]) == csvHeader[0] {
+					continue
+				}
+			}
+			candle, err := parseCSVCandle(record)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			candles = append(candles, candle)
+		}
+	}
+	return nil, fmt.Errorf("unknown format %q, must be %s or %s", format, formatJSON, formatCSV)
+}
+
+// parseCSVCandle parses a CSV row of time, open, high, low, close and an optional volume.
+// Prices must be finite and the volume must not be negative.
+func parseCSVCandle(record []string) (models.CandleData, error) {
+	if len(record) < 5 || len(record) > 6 {
+		return models.CandleData{}, fmt.Errorf("expected 5 or 6 fields, got %d", len(record))
+	}
+	var candle models.CandleData
+	timestamp, err := strconv.ParseInt(strings.TrimSpace(record[0]), 10, 64)
+	if err != nil {
+		return candle, fmt.Errorf("invalid time %q", record[0])
+	}
+	candle.Timestamp = timestamp
+	for i := 0; i < 4; i++ {
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[i+1]), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return candle, fmt.Errorf("invalid %s %q", csvHeader[i+1], record[i+1])
+		}
+		candle.Values[i] = value
+	}
+	if len(record) == 6 && strings.TrimSpace(record[5]) != "" {
+		volume, err := strconv.ParseFloat(strings.TrimSpace(record[5]), 64)
+		if err != nil || volume < 0 || math.IsNaN(volume) || math.IsInf(volume, 0) {
+			return candle, fmt.Errorf("invalid volume %q", record[5])
+		}
+		candle.Volume = volume
+	}
+	return candle, nil
+}
+
+// validateCandle checks the values of a decoded candle as parseCSVCandle does: finite
+// prices and a finite, non-negative volume
+func validateCandle(candle models.CandleData) error {
+	for i, value := range candle.Values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("invalid %s %v", csvHeader[i+1], value)
+		}
+	}
+	if candle.Volume < 0 || math.IsNaN(candle.Volume) || math.IsInf(candle.Volume, 0) {
+		return fmt.Errorf("invalid volume %v", candle.Volume)
+	}
+	return nil
+}
+
+// writeCandles encodes candles in a format
+func writeCandles(w io.Writer, format string, candles []models.CandleData) error {
+	switch format {
+	case formatJSON:
+		return json.NewEncoder(w).Encode(candles)
+	case formatCSV:
+		writer := csv.NewWriter(w)
+		writer.Write(csvHeader)
+		for _, candle := range candles {
+			writer.Write([]string{
+				strconv.FormatInt(candle.Timestamp, 10),
+				strconv.FormatFloat(candle.Values[0], 'f', -1, 64),
+				strconv.FormatFloat(candle.Values[1], 'f', -1, 64),
+				strconv.FormatFloat(candle.Values[2], 'f', -1, 64),
+				strconv.FormatFloat(candle.Values[3], 'f', -1, 64),
+				strconv.FormatFloat(candle.Volume, 'f', -1, 64),
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return fmt.Errorf("unknown format %q, must be %s or %s", format, formatJSON, formatCSV)
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"server/internal/models"
+)
+
+// checkCandle fails the test if an imported candle has a price that isn't finite or a
+// negative volume
+func checkCandle(t *testing.T, input []byte, candle models.CandleData) {
+	t.Helper()
+	for i, value := range candle.Values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			t.Fatalf("%q imported non-finite %s %v", input, csvHeader[i+1], value)
+		}
+	}
+	if candle.Volume < 0 || math.IsNaN(candle.Volume) || math.IsInf(candle.Volume, 0) {
+		t.Fatalf("%q imported invalid volume %v", input, candle.Volume)
+	}
+}
+
+func FuzzParseCSVCandle(f *testing.F) {
+	for _, seed := range []string{
+		"1700000000000,1,2,0.5,1.5,10",
+		"1700000000000,1,2,0.5,1.5",
+		" 1700000000000 , 1 , 2 , 0.5 , 1.5 , 10 ",
+		"1700000000000,1,2,0.5,1.5,",
+		"1700000000000,NaN,2,0.5,1.5,10",
+		"1700000000000,1,+Inf,0.5,1.5,10",
+		"1700000000000,1,2,-Inf,1.5,10",
+		"1700000000000,1,2,0.5,1.5,-3",
+		"1700000000000,1,2,0.5,1.5,NaN",
+		"\ufeff1700000000000,1,2,0.5,1.5,10",
+		"time,open,high,low,close,volume",
+		"1700000000000,1,2",
+		"1700000000000,1,2,0.5,1.5,10,11",
+		"1e12,1,2,0.5,1.5,10",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, row string) {
+		record, err := csv.NewReader(strings.NewReader(row)).Read()
+		if err != nil {
+			return
+		}
+		candle, err := parseCSVCandle(record)
+		if err != nil {
+			return
+		}
+		checkCandle(t, []byte(row), candle)
+	})
+}
+
+func FuzzReadCandles(f *testing.F) {
+	for _, seed := range []struct {
+		format string
+		input  string
+	}{
+		{formatCSV, "time,open,high,low,close,volume\n1700000000000,1,2,0.5,1.5,10\n"},
+		{formatCSV, "\ufefftime,open,high,low,close,volume\n1700000000000,1,2,0.5,1.5,10\n"},
+		{formatCSV, "\ufeff1700000000000,1,2,0.5,1.5,10\n"},
+		{formatCSV, " time ,open,high,low,close,volume\n 1700000000000 , 1 , 2 , 0.5 , 1.5 , 10 \n"},
+		{formatCSV, "1700000000000,1,2,0.5,1.5\n1700000060000,1.5,2,1,1.2,\n"},
+		{formatCSV, "1700000000000,NaN,2,0.5,1.5,10\n"},
+		{formatCSV, "1700000000000,1,Inf,0.5,1.5,10\n"},
+		{formatCSV, "1700000000000,1,2,0.5,1.5,-1\n"},
+		{formatCSV, "1700000000000,1,2\n"},
+		{formatCSV, "\"1700000000000,1,2,0.5,1.5,10\n"},
+		{formatJSON, `[{"x":1700000000000,"y":[1,2,0.5,1.5],"volume":10}]`},
+		{formatJSON, `[{"x":1700000000000,"y":[1,2,0.5,1.5]}] [{"x":1}]`},
+		{formatJSON, `[{"x":1700000000000,"y":[1,2,0.5,1.5]}]]`},
+		{formatJSON, `[{"x":1700000000000,"y":[1,2,0.5,1.5]}] garbage`},
+		{formatJSON, "[]\n"},
+		{formatJSON, `[{"x":1700000000000,"y":[NaN,2,0.5,1.5]}]`},
+		{formatJSON, "\ufeff[]"},
+		{formatJSON, `[{"x":1700000000000,"y":[1,2,0.5,1.5],"volume":-1}]`},
+		{formatJSON, `[{"x":1700000000000,"y":[1,2,0.5,1.5],"volume":1e308},{"x":1700000060000,"y":[-0,2,0.5,1.5],"volume":-0}]`},
+	} {
+		f.Add(seed.format, []byte(seed.input))
+	}
+
+	f.Fuzz(func(t *testing.T, format string, input []byte) {
+		candles, err := readCandles(bytes.NewReader(input), format)
+		if err != nil {
+			return
+		}
+		switch format {
+		case formatCSV:
+			for _, candle := range candles {
+				checkCandle(t, input, candle)
+			}
+		case formatJSON:
+			// A file holds a single array of candles, anything after it is rejected
+			var decoded []models.CandleData
+			if err := json.Unmarshal(input, &decoded); err != nil {
+				t.Fatalf("readCandles accepted %q, which isn't a single JSON value: %v", input, err)
+			}
+			for _, candle := range candles {
+				checkCandle(t, input, candle)
+			}
+		default:
+			t.Fatalf("readCandles accepted unknown format %q", format)
+		}
+	})
+}
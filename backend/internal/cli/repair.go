@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"fmt"
+	"math"
+
+	"server/internal/models"
+	"server/internal/service"
+	"server/internal/store"
+)
+
+// repairReport counts the repairs of one timeframe
+type repairReport struct {
+	tf      models.TimeFrame
+	repairs []string
+}
+
+// add records n repairs of a kind, ignoring kinds without any
+func (r *repairReport) add(n int, repair string) {
+	if n > 0 {
+		r.repairs = append(r.repairs, fmt.Sprintf("%s: %d %s", r.tf, n, repair))
+	}
+}
+
+// repairCandles fixes what verifyCandles finds: candles with invalid prices are dropped,
+// negative volumes are zeroed, prices outside of low and high widen them, misaligned
+// candles are moved to the start of their period, and the candles are sorted with the
+// last of every timestamp and the most recent maxCandles kept.
+func repairCandles(tf models.TimeFrame, candles []models.CandleData, maxCandles int) ([]models.CandleData, []string) {
+	report := repairReport{tf: tf}
+	var invalid, volumes, widened, realigned, unsorted int
+
+	repaired := make([]models.CandleData, 0, len(candles))
+	for _, candle := range candles {
+		sum := candle.Values[0] + candle.Values[1] + candle.Values[2] + candle.Values[3]
+		if math.IsNaN(sum) || math.IsInf(sum, 0) {
+			invalid++
+			continue
+		}
+		if candle.Volume < 0 || math.IsNaN(candle.Volume) || math.IsInf(candle.Volume, 0) {
+			candle.Volume = 0
+			volumes++
+		}
+
+		if candle.EnforceOHLC() {
+			widened++
+		}
+		if normalized := tf.NormalizeTimestamp(candle.Timestamp); normalized != candle.Timestamp {
+			candle.Timestamp = normalized
+			realigned++
+		}
+		if n := len(repaired); n > 0 && candle.Timestamp < repaired[n-1].Timestamp {
+			unsorted++
+		}
+		repaired = append(repaired, candle)
+	}
+
+	series := store.NewSeriesFrom(repaired, maxCandles)
+	report.add(invalid, "candles with invalid prices dropped")
+	report.add(volumes, "invalid volumes zeroed")
+	report.add(widened, "candles widened to their open and close")
+	report.add(realigned, "candles moved to the start of their period")
+	report.add(unsorted, "candles out of order sorted")
+	duplicates := len(repaired) - series.Len()
+	if len(repaired) > maxCandles {
+		report.add(len(repaired)-maxCandles, "oldest candles beyond data.maxCandles dropped")
+		duplicates = maxCandles - series.Len()
+	}
+	report.add(duplicates, "candles with a repeated timestamp dropped")
+	return series.Candles(), report.repairs
+}
+
+// repairAggregates replaces the candles of a higher timeframe in the periods the 1-minute
+// history covers completely with the ones it gives, the same periods verifyAggregates
+// compares. Candles of older periods are kept as they are.
+func repairAggregates(tf models.TimeFrame, candles, minute []models.CandleData, maxCandles int) ([]models.CandleData, []string) {
+	if len(minute) == 0 {
+		return candles, nil
+	}
+	report := repairReport{tf: tf}
+	first := minute[0].Timestamp
+	end := minute[len(minute)-1].Timestamp + models.TimeFrame1Min.GetDuration().Milliseconds()
+	period := tf.GetDuration().Milliseconds()
+	covered := func(timestamp int64) bool {
+		return timestamp >= first && timestamp+period <= end
+	}
+
+	expected := make(map[int64]models.CandleData)
+	for _, candle := range service.AggregateHistory(minute, tf) {
+		if covered(candle.Timestamp) {
+			expected[candle.Timestamp] = candle
+		}
+	}
+
+	var dropped, recomputed int
+	repaired := make([]models.CandleData, 0, len(candles)+len(expected))
+	for _, candle := range candles {
+		if !covered(candle.Timestamp) {
+			repaired = append(repaired, candle)
+			continue
+		}
+		want, ok := expected[candle.Timestamp]
+		if !ok {
+			dropped++
+			continue
+		}
+		for i := range candle.Values {
+			if math.Abs(candle.Values[i]-want.Values[i]) > 1e-6 {
+				recomputed++
+				break
+			}
+		}
+		delete(expected, candle.Timestamp)
+		repaired = append(repaired, want)
+	}
+	for _, candle := range expected {
+		repaired = append(repaired, candle)
+	}
+
+	report.add(dropped, "candles without 1-minute candles dropped")
+	report.add(recomputed, "candles recomputed from the 1-minute history")
+	report.add(len(expected), "missing candles added from the 1-minute history")
+	return store.NewSeriesFrom(repaired, maxCandles).Candles(), report.repairs
+}
@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"testing"
+
+	"server/internal/config"
+	"server/internal/service"
+)
+
+func TestReplayServerReloadsConfig(t *testing.T) {
+	served := false
+	serve := func(cfg *config.Config, ready func(ps *service.PriceService) error) error {
+		served = true
+		reloaded, err := config.NewStore(cfg).Reload()
+		if err != nil {
+			t.Fatalf("reloading the configuration of replay -serve: %v", err)
+		}
+		if reloaded.Data.MaxCandles != 500 {
+			t.Fatalf("reload lost -max-candles, got %d", reloaded.Data.MaxCandles)
+		}
+		return nil
+	}
+
+	args := []string{"-serve", "-loop", "-speed", "2", "-data-dir", t.TempDir(), "-max-candles", "500", "session.jsonl"}
+	if err := replayCommand(serve).Run(args); err != nil {
+		t.Fatal(err)
+	}
+	if !served {
+		t.Fatal("replay -serve didn't start the server")
+	}
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"server/internal/models"
+	"server/internal/service"
+)
+
+// maxProblemsPerCheck limits the problems reported by one check, so a broken file
+// doesn't print one line per candle
+const maxProblemsPerCheck = 10
+
+// problemList collects the problems of one check, up to maxProblemsPerCheck
+type problemList struct {
+	prefix   string
+	problems []string
+	omitted  int
+}
+
+// add records a problem
+func (l *problemList) add(format string, args ...interface{}) {
+	if len(l.problems) == maxProblemsPerCheck {
+		l.omitted++
+		return
+	}
+	l.problems = append(l.problems, l.prefix+fmt.Sprintf(format, args...))
+}
+
+// list returns the recorded problems
+func (l *problemList) list() []string {
+	if l.omitted > 0 {
+		return append(l.problems, fmt.Sprintf("%s%d more problems omitted", l.prefix, l.omitted))
+	}
+	return l.problems
+}
+
+// verifyCandles checks that the candles of a timeframe are sorted, unique, aligned to the
+// timeframe and have consistent prices
+func verifyCandles(tf models.TimeFrame, candles []models.CandleData, maxCandles int) []string {
+	problems := problemList{prefix: string(tf) + ": "}
+	if len(candles) > maxCandles {
+		problems.add("%d candles exceed data.maxCandles of %d, compact drops the oldest", len(candles), maxCandles)
+	}
+
+	for i, candle := range candles {
+		at := time.UnixMilli(candle.Timestamp).UTC().Format(time.RFC3339)
+		if i > 0 && candle.Timestamp < candles[i-1].Timestamp {
+			problems.add("candle %d at %s is older than the one before it", i, at)
+		}
+		if i > 0 && candle.Timestamp == candles[i-1].Timestamp {
+			problems.add("candle %d at %s repeats a timestamp", i, at)
+		}
+		if tf.NormalizeTimestamp(candle.Timestamp) != candle.Timestamp {
+			problems.add("candle %d at %s doesn't start a %s period", i, at, tf)
+		}
+
+		open, high, low, close := candle.Values[0], candle.Values[1], candle.Values[2], candle.Values[3]
+		if err := candle.CheckOHLC(); err != nil && !math.IsNaN(open+high+low+close) {
+			problems.add("candle %d at %s has %v", i, at, err)
+		}
+		if candle.Volume < 0 || math.IsNaN(open+high+low+close+candle.Volume) || math.IsInf(open+high+low+close+candle.Volume, 0) {
+			problems.add("candle %d at %s has a negative volume or invalid values", i, at)
+		}
+	}
+	return problems.list()
+}
+
+// verifyAggregates checks that the candles of a higher timeframe match the 1-minute
+// history. Only periods the 1-minute history covers completely are compared, older ones
+// have been dropped from it.
+func verifyAggregates(tf models.TimeFrame, candles, minute []models.CandleData) []string {
+	problems := problemList{prefix: string(tf) + ": "}
+	if len(minute) == 0 {
+		return nil
+	}
+	first := minute[0].Timestamp
+	end := minute[len(minute)-1].Timestamp + models.TimeFrame1Min.GetDuration().Milliseconds()
+	period := tf.GetDuration().Milliseconds()
+
+	expected := make(map[int64]models.CandleData)
+	for _, candle := range service.AggregateHistory(minute, tf) {
+		expected[candle.Timestamp] = candle
+	}
+
+	for _, candle := range candles {
+		if candle.Timestamp < first || candle.Timestamp+period > end {
+			continue
+		}
+		at := time.UnixMilli(candle.Timestamp).UTC().Format(time.RFC3339)
+		want, ok := expected[candle.Timestamp]
+		if !ok {
+			problems.add("candle at %s has no 1-minute candles", at)
+			continue
+		}
+		for i := range candle.Values {
+			if math.Abs(candle.Values[i]-want.Values[i]) > 1e-6 {
+				problems.add("candle at %s is %v, the 1-minute history gives %v", at, candle.Values, want.Values)
+				break
+			}
+		}
+	}
+	return problems.list()
+}
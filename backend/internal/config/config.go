@@ -0,0 +1,1234 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variable names recognised by the server
+const (
+	EnvConfigFile  = "SEEDVENTURE_CONFIG"
+	EnvPort        = "SEEDVENTURE_PORT"
+	EnvDataDir     = "SEEDVENTURE_DATA_DIR"
+	EnvBasePrice   = "SEEDVENTURE_BASE_PRICE"
+	EnvVolatility  = "SEEDVENTURE_VOLATILITY"
+	EnvMaxCandles  = "SEEDVENTURE_MAX_CANDLES"
+	EnvSave        = "SEEDVENTURE_SAVE_INTERVAL"
+	EnvBroadcast   = "SEEDVENTURE_BROADCAST_INTERVAL"
+	EnvCORS        = "SEEDVENTURE_CORS_ORIGINS"
+	EnvAdminToken  = "SEEDVENTURE_ADMIN_TOKEN"
+	EnvJWTSecret   = "SEEDVENTURE_JWT_SECRET"
+	EnvDataKey     = "SEEDVENTURE_DATA_KEY"
+	EnvPprof       = "SEEDVENTURE_PPROF"
+	EnvTLSCert     = "SEEDVENTURE_TLS_CERT"
+	EnvTLSKey      = "SEEDVENTURE_TLS_KEY"
+	EnvWSTransport = "SEEDVENTURE_WS_TRANSPORT"
+	EnvIngestURL   = "SEEDVENTURE_INGEST_URL"
+	EnvFollow      = "SEEDVENTURE_FOLLOW"
+)
+
+// maxFuturesContracts caps the number of futures contracts listed at a time on a symbol
+const maxFuturesContracts = 12
+
+// Limits of the chat, messages beyond them would bloat every client's traffic
+const (
+	maxChatLength  = 2000
+	maxChatHistory = 1000
+)
+
+// ClientQueueSize is the number of payloads queued for a WebSocket client, which is
+// dropped once its queue is full
+const ClientQueueSize = 256
+
+// ConsolidatedVenue is the suffix of the feed consolidating the venues of a symbol
+const ConsolidatedVenue = "consolidated"
+
+// venueName matches valid venue names
+var venueName = regexp.MustCompile(`^[a-z0-9]{1,16}$`)
+
+// WebSocket transports
+const (
+	TransportGorilla = "gorilla" // A reader and a writer goroutine per connection
+	TransportEpoll   = "epoll"   // A shared event loop, Linux only
+)
+
+// Config holds all runtime settings for the server
+type Config struct {
+	Server     ServerConfig     `yaml:"server" json:"server"`
+	Data       DataConfig       `yaml:"data" json:"data"`
+	Simulation SimulationConfig `yaml:"simulation" json:"simulation"`
+	Ingest     IngestConfig     `yaml:"ingest" json:"ingest"`
+	Follow     FollowConfig     `yaml:"follow" json:"follow"`
+	Scripting  ScriptingConfig  `yaml:"scripting" json:"scripting"`
+	Events     EventsConfig     `yaml:"events" json:"events"`
+	Auth       AuthConfig       `yaml:"auth" json:"auth"`
+	Quotas     QuotasConfig     `yaml:"quotas" json:"quotas"`
+	Admin      AdminConfig      `yaml:"admin" json:"admin"`
+	Cash       CashConfig       `yaml:"cash" json:"cash"`
+	Chat       ChatConfig       `yaml:"chat" json:"chat"`
+	Chaos      ChaosConfig      `yaml:"chaos" json:"chaos"`
+
+	// Features are flags passed to the frontend through /api/config/client
+	Features map[string]bool `yaml:"features" json:"features"`
+
+	// Namespaces are further simulations served by the same process, each with its own
+	// data directory and clients, under /ns/<name>
+	Namespaces map[string]NamespaceConfig `yaml:"namespaces" json:"namespaces,omitempty"`
+
+	// File is the path the configuration was loaded from, if any
+	File string `yaml:"-" json:"file,omitempty"`
+
+	args      []string // Configuration flags set on the command line, parsed again on reload
+	namespace string   // Name of the namespace the configuration was derived for, empty for the default
+}
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	Port        int      `yaml:"port" json:"port"`
+	CORSOrigins []string `yaml:"corsOrigins" json:"corsOrigins"` // Allowed CORS origins, "*" allows any
+
+	ReadTimeout       time.Duration `yaml:"readTimeout" json:"readTimeout"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" json:"readHeaderTimeout"` // Guards against slowloris clients
+	WriteTimeout      time.Duration `yaml:"writeTimeout" json:"writeTimeout"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout" json:"idleTimeout"`
+	MaxHeaderBytes    int           `yaml:"maxHeaderBytes" json:"maxHeaderBytes"`
+	MaxBodyBytes      int64         `yaml:"maxBodyBytes" json:"maxBodyBytes"` // Limit for request bodies
+	Frontend          bool          `yaml:"frontend" json:"frontend"`         // Serve the frontend embedded in the binary under /, if it has one
+
+	TLS       TLSConfig       `yaml:"tls" json:"tls"`
+	WebSocket WebSocketConfig `yaml:"websocket" json:"websocket"`
+}
+
+// WebSocketConfig holds settings for live price connections
+type WebSocketConfig struct {
+	Transport string `yaml:"transport" json:"transport"` // "gorilla" or "epoll", read at startup
+	Workers   int    `yaml:"workers" json:"workers"`     // Goroutines reading epoll connections
+	Writers   int    `yaml:"writers" json:"writers"`     // Goroutines writing to all connections
+
+	// Spectators is the number of unauthenticated, read-only connections per symbol under
+	// /api/prices/spectate, which need no API key, 0 disables spectator mode
+	Spectators int `yaml:"spectators" json:"spectators"`
+
+	Lag LagConfig `yaml:"lag" json:"lag"`
+}
+
+// LagConfig holds the thresholds from which a WebSocket client falls behind, which raises
+// an alert and lists it under /admin/lag
+type LagConfig struct {
+	QueueDepth int           `yaml:"queueDepth" json:"queueDepth"` // Payloads waiting to be written to the client, 0 disables
+	AckLag     int64         `yaml:"ackLag" json:"ackLag"`         // Offsets of the update log the client's acknowledgements trail the updates written to it, 0 disables
+	EvictAfter time.Duration `yaml:"evictAfter" json:"evictAfter"` // Time a client may fall behind before it is disconnected, 0 never
+}
+
+// TLSConfig holds settings for serving HTTPS and WSS directly
+type TLSConfig struct {
+	CertFile string         `yaml:"certFile" json:"certFile,omitempty"`
+	KeyFile  string         `yaml:"keyFile" json:"keyFile,omitempty"`
+	Autocert AutocertConfig `yaml:"autocert" json:"autocert"`
+}
+
+// AutocertConfig holds settings for obtaining certificates from Let's Encrypt
+type AutocertConfig struct {
+	Enabled  bool     `yaml:"enabled" json:"enabled"`
+	Hosts    []string `yaml:"hosts" json:"hosts,omitempty"`
+	Email    string   `yaml:"email" json:"email,omitempty"`
+	CacheDir string   `yaml:"cacheDir" json:"cacheDir"`
+	HTTPPort int      `yaml:"httpPort" json:"httpPort"` // Port serving ACME challenges and HTTPS redirects
+}
+
+// Enabled reports whether the server should listen with TLS
+func (t TLSConfig) Enabled() bool {
+	return t.Autocert.Enabled || t.CertFile != ""
+}
+
+// DataConfig holds storage settings
+type DataConfig struct {
+	Dir          string          `yaml:"dir" json:"dir"`
+	MaxCandles   int             `yaml:"maxCandles" json:"maxCandles"`     // Maximum number of candles to keep per timeframe
+	SaveInterval time.Duration   `yaml:"saveInterval" json:"saveInterval"` // How often changed timeframes are written to disk
+	UpdateLog    UpdateLogConfig `yaml:"updateLog" json:"updateLog"`
+	// Base64 encoded 32 byte AES key encrypting users and bans at rest, empty for plaintext
+	EncryptionKey     string `yaml:"encryptionKey" json:"encryptionKey,omitempty"`
+	EncryptionKeyFile string `yaml:"encryptionKeyFile" json:"encryptionKeyFile,omitempty"` // File holding the key instead, such as a secret mounted from a KMS
+}
+
+// UpdateLogConfig holds the log of every candle update sent to clients, split into segment
+// files in the data directory
+type UpdateLogConfig struct {
+	Enabled     bool  `yaml:"enabled" json:"enabled"`
+	SegmentSize int64 `yaml:"segmentSize" json:"segmentSize"` // Bytes after which a new segment is started
+	Segments    int   `yaml:"segments" json:"segments"`       // Segments kept, the oldest are deleted
+}
+
+// LoadEncryptionKey returns the key encrypting account data, reading it from the key file
+// if one is set
+func (d DataConfig) LoadEncryptionKey() (string, error) {
+	if d.EncryptionKeyFile == "" {
+		return d.EncryptionKey, nil
+	}
+	key, err := os.ReadFile(d.EncryptionKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read data.encryptionKeyFile: %w", err)
+	}
+	return strings.TrimSpace(string(key)), nil
+}
+
+// SimulationConfig holds price generation settings
+type SimulationConfig struct {
+	Symbol            string          `yaml:"symbol" json:"symbol"`
+	Base              string          `yaml:"base" json:"base"`   // Asset the symbol prices, the symbol itself if empty
+	Quote             string          `yaml:"quote" json:"quote"` // Currency prices are quoted in
+	Model             string          `yaml:"model" json:"model"` // Name of the price model
+	BasePrice         float64         `yaml:"basePrice" json:"basePrice"`
+	Volatility        float64         `yaml:"volatility" json:"volatility"`
+	Drift             float64         `yaml:"drift" json:"drift"`                         // Average price change per tick
+	BroadcastInterval time.Duration   `yaml:"broadcastInterval" json:"broadcastInterval"` // How often the current candle is updated
+	Seed              int64           `yaml:"seed" json:"seed"`                           // Seed of the price generator, 0 picks a random one at startup
+	PriceDecimals     int             `yaml:"priceDecimals" json:"priceDecimals"`         // Decimal places of prices
+	TickSize          float64         `yaml:"tickSize" json:"tickSize"`                   // Smallest price change, a multiple of 10^-priceDecimals
+	VolumeDecimals    int             `yaml:"volumeDecimals" json:"volumeDecimals"`       // Decimal places of volumes
+	Seasonality       []float64       `yaml:"seasonality" json:"seasonality"`             // Multipliers of the volatility and volume of the 24 hours of a day in UTC, empty for none
+	Holidays          HolidaysConfig  `yaml:"holidays" json:"holidays"`                   // Days without trading
+	Volume            VolumeConfig    `yaml:"volume" json:"volume"`
+	Futures           FuturesConfig   `yaml:"futures" json:"futures"`
+	Perpetual         PerpetualConfig `yaml:"perpetual" json:"perpetual"`
+	Venues            []VenueConfig   `yaml:"venues" json:"venues"`   // Simulated exchanges quoting the symbol, none or at least 2
+	Plugins           []string        `yaml:"plugins" json:"plugins"` // Go plugins registering additional price models
+}
+
+// Precision returns the decimal precision of the prices and volumes of the symbol
+func (s SimulationConfig) Precision() models.Precision {
+	return models.Precision{PriceDecimals: s.PriceDecimals, TickSize: s.TickSize, VolumeDecimals: s.VolumeDecimals}
+}
+
+// VolumeParams returns the parameters of the volume model, following the intraday seasonality
+// of the simulation
+func (s SimulationConfig) VolumeParams() models.VolumeParams {
+	params := s.Volume.Params()
+	params.Intraday = s.Seasonality
+	return params
+}
+
+// Market returns the asset the symbol prices and the currency it is quoted in, uppercase
+func (s SimulationConfig) Market() (base, quote string) {
+	base = s.Base
+	if base == "" {
+		base = s.Symbol
+	}
+	return strings.ToUpper(base), strings.ToUpper(s.Quote)
+}
+
+// VolumeConfig holds settings of the volume traded with generated prices
+type VolumeConfig struct {
+	Base              float64   `yaml:"base" json:"base"`                           // Average volume per minute
+	PriceSensitivity  float64   `yaml:"priceSensitivity" json:"priceSensitivity"`   // From 0 to 1, how much volume grows with the size of a price move
+	RegimeSensitivity float64   `yaml:"regimeSensitivity" json:"regimeSensitivity"` // From 0 to 1, how much volume grows in volatile periods
+	Seasonality       []float64 `yaml:"seasonality" json:"seasonality"`             // Multipliers of the 24 hours of a day in UTC on top of simulation.seasonality, empty for none
+}
+
+// Params returns the parameters of the volume model
+func (v VolumeConfig) Params() models.VolumeParams {
+	return models.VolumeParams{
+		Base:              v.Base,
+		PriceSensitivity:  v.PriceSensitivity,
+		RegimeSensitivity: v.RegimeSensitivity,
+		Seasonality:       v.Seasonality,
+	}
+}
+
+// FuturesConfig lists dated futures contracts on the symbol, each served as a symbol of its own
+type FuturesConfig struct {
+	Contracts int           `yaml:"contracts" json:"contracts"` // Number of contracts listed at a time, 0 for none
+	Term      time.Duration `yaml:"term" json:"term"`           // Time between expiries, contracts expire at its multiples since the Unix epoch
+	Premium   float64       `yaml:"premium" json:"premium"`     // Basis over spot of a newly listed contract, relative, converging to 0 at expiry
+}
+
+// Enabled reports whether futures contracts are listed
+func (f FuturesConfig) Enabled() bool {
+	return f.Contracts > 0
+}
+
+// Validate reports why the futures settings are unusable, if they are
+func (f FuturesConfig) Validate() error {
+	if !f.Enabled() {
+		return nil
+	}
+	if f.Contracts > maxFuturesContracts {
+		return fmt.Errorf("contracts must be at most %d, got %d", maxFuturesContracts, f.Contracts)
+	}
+	if f.Term < time.Minute || f.Term%time.Minute != 0 {
+		return fmt.Errorf("term must be a whole number of minutes, got %s", f.Term)
+	}
+	if !(f.Premium > -1) || math.IsInf(f.Premium, 0) {
+		return fmt.Errorf("premium must be a number above -1, got %g", f.Premium)
+	}
+	return nil
+}
+
+// HolidaysConfig lists the days, in UTC, the symbol doesn't trade, so no candles are generated
+type HolidaysConfig struct {
+	Calendars []string `yaml:"calendars" json:"calendars"` // Presets of standard markets, see models.HolidayCalendarNames
+	Dates     []string `yaml:"dates" json:"dates"`         // Further holidays such as 2026-12-24
+	File      string   `yaml:"file" json:"file"`           // JSON list of further holidays
+}
+
+// Calendar returns the calendar of the holidays, reading the file if set
+func (h HolidaysConfig) Calendar() (*models.HolidayCalendar, error) {
+	dates := h.Dates
+	if h.File != "" {
+		data, err := os.ReadFile(h.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read holidays: %w", err)
+		}
+		var listed []string
+		if err := json.Unmarshal(data, &listed); err != nil {
+			return nil, fmt.Errorf("failed to parse holidays %s, must be a JSON list of dates: %w", h.File, err)
+		}
+		dates = append(append([]string(nil), dates...), listed...)
+	}
+	return models.NewHolidayCalendar(h.Calendars, dates)
+}
+
+// PerpetualConfig lists a perpetual contract on the symbol, served as a symbol of its own,
+// whose holders pay each other a funding rate following its premium over the symbol
+type PerpetualConfig struct {
+	Enabled           bool          `yaml:"enabled" json:"enabled"`
+	FundingInterval   time.Duration `yaml:"fundingInterval" json:"fundingInterval"`     // Time between fundings, at its multiples since the Unix epoch
+	PremiumVolatility float64       `yaml:"premiumVolatility" json:"premiumVolatility"` // Standard deviation of a move of the premium per broadcast interval
+	MaxFundingRate    float64       `yaml:"maxFundingRate" json:"maxFundingRate"`       // Largest funding rate paid at a funding, either way
+}
+
+// Validate reports why the perpetual settings are unusable, if they are
+func (p PerpetualConfig) Validate() error {
+	if !p.Enabled {
+		return nil
+	}
+	if p.FundingInterval < time.Minute || p.FundingInterval%time.Minute != 0 {
+		return fmt.Errorf("fundingInterval must be a whole number of minutes, got %s", p.FundingInterval)
+	}
+	if !(p.PremiumVolatility >= 0) || p.PremiumVolatility >= 0.1 {
+		return fmt.Errorf("premiumVolatility must be from 0 to below 0.1, got %g", p.PremiumVolatility)
+	}
+	if !(p.MaxFundingRate > 0) || p.MaxFundingRate >= 1 {
+		return fmt.Errorf("maxFundingRate must be above 0 and below 1, got %g", p.MaxFundingRate)
+	}
+	return nil
+}
+
+// VenueConfig is a simulated exchange quoting the symbol, served as a symbol of its own, whose
+// prices diverge from the symbol's and reach it late
+type VenueConfig struct {
+	Name       string        `yaml:"name" json:"name"`             // Lowercase letters and digits, suffixed to the symbol
+	Divergence float64       `yaml:"divergence" json:"divergence"` // Standard deviation of a move of the premium over the symbol per broadcast interval
+	Latency    time.Duration `yaml:"latency" json:"latency"`       // Delay of the symbol's prices, rounded up to broadcast intervals
+}
+
+// validateVenues reports why the venues of the symbol are unusable, if they are
+func validateVenues(venues []VenueConfig) error {
+	if len(venues) == 1 {
+		return fmt.Errorf("must be none or at least 2, got 1")
+	}
+	names := make(map[string]bool)
+	for _, venue := range venues {
+		switch {
+		case !venueName.MatchString(venue.Name):
+			return fmt.Errorf("names must be up to 16 lowercase letters and digits, got %q", venue.Name)
+		case venue.Name == ConsolidatedVenue:
+			return fmt.Errorf("%q names the consolidated feed", ConsolidatedVenue)
+		case names[venue.Name]:
+			return fmt.Errorf("duplicate venue %q", venue.Name)
+		case !(venue.Divergence >= 0) || venue.Divergence >= 0.1:
+			return fmt.Errorf("divergence of venue %s must be from 0 to below 0.1, got %g", venue.Name, venue.Divergence)
+		case venue.Latency < 0 || venue.Latency > time.Minute:
+			return fmt.Errorf("latency of venue %s must be from 0 to 1m, got %s", venue.Name, venue.Latency)
+		}
+		names[venue.Name] = true
+	}
+	return nil
+}
+
+// IngestConfig holds settings for building candles from the trades of a real exchange
+// instead of generating prices
+type IngestConfig struct {
+	URL            string        `yaml:"url" json:"url"`                       // Binance trade stream, e.g. wss://stream.binance.com:9443/ws/btcusdt@trade, empty generates prices
+	ReconnectDelay time.Duration `yaml:"reconnectDelay" json:"reconnectDelay"` // Pause before reconnecting a lost feed
+}
+
+// Enabled reports whether prices come from an exchange feed
+func (i IngestConfig) Enabled() bool {
+	return i.URL != ""
+}
+
+// FollowConfig holds settings for mirroring the candles of another Seedventure server
+// instead of generating prices
+type FollowConfig struct {
+	Primary        string        `yaml:"primary" json:"primary"`               // Base URL of the primary, e.g. http://primary:8080, empty generates prices
+	APIKey         string        `yaml:"apiKey" json:"apiKey,omitempty"`       // Key with the read scope, if the primary requires one
+	ReconnectDelay time.Duration `yaml:"reconnectDelay" json:"reconnectDelay"` // Pause before reconnecting to a lost primary
+}
+
+// Enabled reports whether the server follows a primary
+func (f FollowConfig) Enabled() bool {
+	return f.Primary != ""
+}
+
+// ScriptingConfig holds settings for scenario scripts managed through the admin API
+type ScriptingConfig struct {
+	Enabled        bool          `yaml:"enabled" json:"enabled"`
+	Timeout        time.Duration `yaml:"timeout" json:"timeout"`               // Longest a single run may take
+	MaxAllocs      int64         `yaml:"maxAllocs" json:"maxAllocs"`           // Objects a single run may allocate
+	MaxScripts     int           `yaml:"maxScripts" json:"maxScripts"`         // Scripts that can be installed
+	MaxSourceBytes int           `yaml:"maxSourceBytes" json:"maxSourceBytes"` // Size limit of a script
+}
+
+// Webhook payload formats
+const (
+	FormatJSON              = "json"               // The update message clients receive
+	FormatCloudEvents       = "cloudevents"        // A CloudEvents 1.0 event in structured mode
+	FormatCloudEventsBinary = "cloudevents-binary" // A CloudEvents 1.0 event in binary mode, attributes in ce-* headers
+)
+
+// EventsConfig holds settings for pushing candle events to other services
+type EventsConfig struct {
+	Source          string          `yaml:"source" json:"source"`                   // CloudEvents source attribute, defaults to /seedventure/<symbol>
+	Timeout         time.Duration   `yaml:"timeout" json:"timeout"`                 // Longest a webhook delivery attempt may take
+	MaxAttempts     int             `yaml:"maxAttempts" json:"maxAttempts"`         // Attempts before a delivery goes to the dead-letter log
+	RetryBackoff    time.Duration   `yaml:"retryBackoff" json:"retryBackoff"`       // Pause after the first failed attempt, doubled after every further one
+	MaxRetryBackoff time.Duration   `yaml:"maxRetryBackoff" json:"maxRetryBackoff"` // Longest pause between attempts
+	DeadLetterLimit int             `yaml:"deadLetterLimit" json:"deadLetterLimit"` // Failed deliveries kept, the oldest are discarded
+	Webhooks        []WebhookConfig `yaml:"webhooks" json:"webhooks"`
+	Notifiers       NotifiersConfig `yaml:"notifiers" json:"notifiers"`
+}
+
+// NotifiersConfig holds the services price alerts on watchlists can also be sent to
+type NotifiersConfig struct {
+	TelegramBotToken string `yaml:"telegramBotToken" json:"telegramBotToken,omitempty"` // Bot messaging the chats of players, empty disables Telegram
+	Discord          bool   `yaml:"discord" json:"discord"`                             // Players may send alerts to Discord webhooks
+}
+
+// WebhookConfig holds an endpoint events are posted to
+type WebhookConfig struct {
+	URL        string             `yaml:"url" json:"url"`
+	Secret     string             `yaml:"secret" json:"secret,omitempty"`         // Key of the HMAC-SHA256 signature of every delivery, empty sends them unsigned
+	Format     string             `yaml:"format" json:"format"`                   // "json", "cloudevents" or "cloudevents-binary"
+	Types      []string           `yaml:"types" json:"types,omitempty"`           // Event types to deliver, empty for all
+	TimeFrames []models.TimeFrame `yaml:"timeFrames" json:"timeFrames,omitempty"` // Timeframes to deliver, empty for all
+}
+
+// AuthConfig holds settings for authenticating clients
+type AuthConfig struct {
+	RequireAPIKey bool `yaml:"requireApiKey" json:"requireApiKey"` // Market data needs a key with the read scope, see /admin/api-keys
+
+	// User accounts under /api/auth, enabled by a JWT secret
+	JWTSecret       string        `yaml:"jwtSecret" json:"jwtSecret,omitempty"`   // HMAC-SHA256 key of access tokens, empty disables user accounts
+	AccessTokenTTL  time.Duration `yaml:"accessTokenTtl" json:"accessTokenTtl"`   // Lifetime of access tokens
+	RefreshTokenTTL time.Duration `yaml:"refreshTokenTtl" json:"refreshTokenTtl"` // Lifetime of refresh tokens, renewed with every refresh
+	Registration    bool          `yaml:"registration" json:"registration"`       // Anyone may register an account
+	CookieSessions  bool          `yaml:"cookieSessions" json:"cookieSessions"`   // Also keep tokens in HttpOnly cookies, guarded by CSRF tokens
+
+	OIDCReturnURL string               `yaml:"oidcReturnUrl" json:"oidcReturnUrl"` // Page receiving the tokens of OIDC logins in its fragment, empty answers with JSON
+	OIDC          []OIDCProviderConfig `yaml:"oidc" json:"oidc,omitempty"`         // Identity providers players can log in with
+}
+
+// OIDCProviderConfig holds an OpenID Connect or OAuth2 identity provider. Providers
+// supporting discovery only need an issuer, others such as GitHub need their endpoints.
+type OIDCProviderConfig struct {
+	Name          string   `yaml:"name" json:"name"`                   // Path segment of /api/auth/oidc/<name>/login
+	Issuer        string   `yaml:"issuer" json:"issuer,omitempty"`     // Discovers the endpoints from <issuer>/.well-known/openid-configuration
+	AuthURL       string   `yaml:"authUrl" json:"authUrl,omitempty"`   // Authorization endpoint, if not discovered
+	TokenURL      string   `yaml:"tokenUrl" json:"tokenUrl,omitempty"` // Token endpoint, if not discovered
+	UserInfoURL   string   `yaml:"userInfoUrl" json:"userInfoUrl,omitempty"`
+	ClientID      string   `yaml:"clientId" json:"clientId"`
+	ClientSecret  string   `yaml:"clientSecret" json:"clientSecret,omitempty"`
+	RedirectURL   string   `yaml:"redirectUrl" json:"redirectUrl"`     // Callback registered with the provider, <public URL>/api/auth/oidc/<name>/callback
+	Scopes        []string `yaml:"scopes" json:"scopes,omitempty"`     // Defaults to openid, email and profile
+	UsernameClaim string   `yaml:"usernameClaim" json:"usernameClaim"` // User info field suggesting the username, defaults to preferred_username
+}
+
+// UsersEnabled reports whether user accounts are enabled
+func (a AuthConfig) UsersEnabled() bool {
+	return a.JWTSecret != ""
+}
+
+// CashConfig holds the cash flows of the players of a round, announced to clients, which
+// hold the players' cash
+type CashConfig struct {
+	Deposit         float64       `yaml:"deposit" json:"deposit"`                 // Paid to every player at every deposit time, withdrawn if negative
+	DepositInterval time.Duration `yaml:"depositInterval" json:"depositInterval"` // Time between deposits, at its multiples since the Unix epoch, 0 for none
+	InterestRate    float64       `yaml:"interestRate" json:"interestRate"`       // Interest on idle cash at every 1-minute candle close, relative, 0 for none
+}
+
+// ChatConfig holds the chat of the clients connected to a symbol, a room per namespace
+type ChatConfig struct {
+	Enabled      bool     `yaml:"enabled" json:"enabled"`
+	MaxLength    int      `yaml:"maxLength" json:"maxLength"`       // Characters of a message
+	History      int      `yaml:"history" json:"history"`           // Messages kept per room for /api/chat/history, 0 for none
+	Filters      []string `yaml:"filters" json:"filters"`           // Chat filters every message passes in order, see models.RegisterChatFilter
+	BlockedWords []string `yaml:"blockedWords" json:"blockedWords"` // Words the built-in filters mask or reject, case-insensitively
+}
+
+// ChaosConfig holds faults injected into the broadcasts to WebSocket clients, so their
+// reconnection and resume logic can be tested. Each probability applies to every frame
+// sent to every client on its own.
+type ChaosConfig struct {
+	Enabled               bool          `yaml:"enabled" json:"enabled"`
+	DelayProbability      float64       `yaml:"delayProbability" json:"delayProbability"`           // Chance a client's next frames are held back
+	MaxDelay              time.Duration `yaml:"maxDelay" json:"maxDelay"`                           // Longest they are held back, the delay is uniformly distributed up to it
+	DropProbability       float64       `yaml:"dropProbability" json:"dropProbability"`             // Chance a frame is silently not sent
+	DisconnectProbability float64       `yaml:"disconnectProbability" json:"disconnectProbability"` // Chance the connection is closed instead of sending a frame
+}
+
+// QuotasConfig holds limits of what a single user may do, to keep public instances
+// healthy. Users are told apart by access token, API key or IP address, in this order.
+type QuotasConfig struct {
+	RequestsPerMinute     int           `yaml:"requestsPerMinute" json:"requestsPerMinute"`         // Market data requests and WebSocket connections, 0 for unlimited
+	WSMessagesPerSecond   int           `yaml:"wsMessagesPerSecond" json:"wsMessagesPerSecond"`     // Messages sent by WebSocket clients, 0 for unlimited
+	ChatMessagesPerMinute int           `yaml:"chatMessagesPerMinute" json:"chatMessagesPerMinute"` // Chat messages sent by WebSocket clients, 0 for unlimited
+	BanAfter              int           `yaml:"banAfter" json:"banAfter"`                           // Quota violations within 10 minutes that lead to an automatic ban
+	BanDuration           time.Duration `yaml:"banDuration" json:"banDuration"`                     // Length of automatic bans, 0 disables them
+}
+
+// AdminConfig holds settings for the /admin namespace
+type AdminConfig struct {
+	Token string `yaml:"token" json:"token,omitempty"` // Bearer token required for guarded admin routes
+	Pprof bool   `yaml:"pprof" json:"pprof"`           // Mount net/http/pprof under /admin/debug/pprof
+
+	AuditFile string `yaml:"auditFile" json:"auditFile"` // Append-only log of admin actions, defaults to audit.log in the data directory
+
+	// Network policy checked before the token, for defense in depth
+	AllowedNetworks []string `yaml:"allowedNetworks" json:"allowedNetworks,omitempty"` // CIDR ranges admin requests may come from, empty for all
+	ClientCAFile    string   `yaml:"clientCaFile" json:"clientCaFile,omitempty"`       // CA whose client certificates admin requests must present, requires TLS
+}
+
+// Default returns the configuration used when nothing else is specified
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:        8080,
+			CORSOrigins: []string{"*"},
+
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      15 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			MaxHeaderBytes:    1 << 16,
+			MaxBodyBytes:      1 << 20,
+			Frontend:          true,
+
+			TLS: TLSConfig{
+				Autocert: AutocertConfig{
+					CacheDir: "certs",
+					HTTPPort: 80,
+				},
+			},
+			WebSocket: WebSocketConfig{
+				Transport: TransportGorilla,
+				Workers:   4,
+				Writers:   16,
+				Lag: LagConfig{
+					QueueDepth: 64,
+					AckLag:     100,
+					EvictAfter: 30 * time.Second,
+				},
+			},
+		},
+		Data: DataConfig{
+			Dir:          "data",
+			MaxCandles:   100,
+			SaveInterval: time.Minute,
+			UpdateLog: UpdateLogConfig{
+				SegmentSize: 16 << 20,
+				Segments:    8,
+			},
+		},
+		Simulation: SimulationConfig{
+			Symbol:            "SEED",
+			Quote:             "USD",
+			Model:             models.PriceModelRandomWalk,
+			BasePrice:         1.0,
+			Volatility:        10.0,
+			BroadcastInterval: time.Second,
+			PriceDecimals:     models.DefaultPrecision.PriceDecimals,
+			TickSize:          models.DefaultPrecision.TickSize,
+			VolumeDecimals:    models.DefaultPrecision.VolumeDecimals,
+			Seasonality:       append([]float64(nil), models.DefaultSeasonality...),
+			Volume: VolumeConfig{
+				Base:              models.DefaultVolumeParams.Base,
+				PriceSensitivity:  models.DefaultVolumeParams.PriceSensitivity,
+				RegimeSensitivity: models.DefaultVolumeParams.RegimeSensitivity,
+			},
+			Futures: FuturesConfig{
+				Term:    24 * time.Hour,
+				Premium: 0.01,
+			},
+			Perpetual: PerpetualConfig{
+				FundingInterval:   8 * time.Hour,
+				PremiumVolatility: 0.0002,
+				MaxFundingRate:    0.0075,
+			},
+		},
+		Ingest: IngestConfig{
+			ReconnectDelay: 5 * time.Second,
+		},
+		Follow: FollowConfig{
+			ReconnectDelay: 5 * time.Second,
+		},
+		Scripting: ScriptingConfig{
+			Timeout:        50 * time.Millisecond,
+			MaxAllocs:      100000,
+			MaxScripts:     16,
+			MaxSourceBytes: 64 << 10,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+			Registration:    true,
+		},
+		Quotas: QuotasConfig{
+			ChatMessagesPerMinute: 10,
+			BanAfter:              10,
+		},
+		Chat: ChatConfig{
+			MaxLength: 280,
+			History:   100,
+			Filters:   []string{models.ChatFilterMask},
+		},
+		Events: EventsConfig{
+			Timeout:         5 * time.Second,
+			MaxAttempts:     5,
+			RetryBackoff:    time.Second,
+			MaxRetryBackoff: time.Minute,
+			DeadLetterLimit: 1000,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, an optional YAML file,
+// environment variables and command line flags, in increasing order of precedence
+func Load(args []string) (*Config, error) {
+	return LoadFlags(flag.NewFlagSet("server", flag.ContinueOnError), args)
+}
+
+// LoadFlags is Load with a flag set that may define flags of its own, such as those of
+// a command, which are parsed along with the configuration flags
+func LoadFlags(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := Default()
+
+	// Flags defined by the caller, which aren't configuration and can't be parsed on reload
+	commandFlags := make(map[string]bool)
+	fs.VisitAll(func(f *flag.Flag) {
+		commandFlags[f.Name] = true
+	})
+
+	configFile := fs.String("config", "", "path to a YAML configuration file")
+	port := fs.Int("port", cfg.Server.Port, "HTTP port to listen on")
+	dataDir := fs.String("data-dir", cfg.Data.Dir, "directory to store data files")
+	maxCandles := fs.Int("max-candles", cfg.Data.MaxCandles, "maximum number of candles to keep per timeframe")
+	basePrice := fs.Float64("base-price", cfg.Simulation.BasePrice, "starting price for generated history")
+	volatility := fs.Float64("volatility", cfg.Simulation.Volatility, "price volatility of the simulation")
+	broadcastInterval := fs.Duration("broadcast-interval", cfg.Simulation.BroadcastInterval, "how often the current candle is updated")
+	tlsCert := fs.String("tls-cert", cfg.Server.TLS.CertFile, "path to the TLS certificate")
+	tlsKey := fs.String("tls-key", cfg.Server.TLS.KeyFile, "path to the TLS private key")
+	pprofEnabled := fs.Bool("pprof", cfg.Admin.Pprof, "expose profiling endpoints under /admin/debug/pprof")
+	corsOrigins := fs.String("cors-origins", strings.Join(cfg.Server.CORSOrigins, ","), "comma separated list of allowed CORS origins")
+	namespace := fs.String("namespace", DefaultNamespace, "namespace whose data and settings to use")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// Collect the flags that were explicitly set so they override everything else, and
+	// keep the configuration flags among them for reloads
+	setFlags := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+		if !commandFlags[f.Name] {
+			cfg.args = append(cfg.args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+
+	// The config file can come from a flag or the environment
+	path := os.Getenv(EnvConfigFile)
+	if setFlags["config"] {
+		path = *configFile
+	}
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	// Apply flags last
+	if setFlags["port"] {
+		cfg.Server.Port = *port
+	}
+	if setFlags["data-dir"] {
+		cfg.Data.Dir = *dataDir
+	}
+	if setFlags["max-candles"] {
+		cfg.Data.MaxCandles = *maxCandles
+	}
+	if setFlags["base-price"] {
+		cfg.Simulation.BasePrice = *basePrice
+	}
+	if setFlags["volatility"] {
+		cfg.Simulation.Volatility = *volatility
+	}
+	if setFlags["broadcast-interval"] {
+		cfg.Simulation.BroadcastInterval = *broadcastInterval
+	}
+	if setFlags["cors-origins"] {
+		cfg.Server.CORSOrigins = splitList(*corsOrigins)
+	}
+	if setFlags["tls-cert"] {
+		cfg.Server.TLS.CertFile = *tlsCert
+	}
+	if setFlags["tls-key"] {
+		cfg.Server.TLS.KeyFile = *tlsKey
+	}
+	if setFlags["pprof"] {
+		cfg.Admin.Pprof = *pprofEnabled
+	}
+
+	if cfg.Admin.AuditFile == "" {
+		cfg.Admin.AuditFile = filepath.Join(cfg.Data.Dir, "audit.log")
+	}
+
+	// Plugins must be loaded before validation, which checks the selected price model
+	if err := loadPlugins(cfg.Simulation.Plugins); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	for _, name := range cfg.NamespaceNames() {
+		if _, err := cfg.Namespace(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg.Namespace(*namespace)
+}
+
+// loadPlugins loads the price model plugins, skipping ones loaded before
+func loadPlugins(paths []string) error {
+	for _, path := range paths {
+		added, err := models.LoadPriceModelPlugin(path)
+		if err != nil {
+			return err
+		}
+		if len(added) > 0 {
+			log.Printf("Loaded price models %v from %s", added, path)
+		}
+	}
+	return nil
+}
+
+// loadFile merges the settings of a YAML file into the configuration
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	c.File = path
+	return nil
+}
+
+// loadEnv merges settings from environment variables into the configuration
+func (c *Config) loadEnv() error {
+	if v, ok := os.LookupEnv(EnvPort); ok {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvPort, err)
+		}
+		c.Server.Port = port
+	}
+	if v, ok := os.LookupEnv(EnvDataDir); ok {
+		c.Data.Dir = v
+	}
+	if v, ok := os.LookupEnv(EnvMaxCandles); ok {
+		maxCandles, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvMaxCandles, err)
+		}
+		c.Data.MaxCandles = maxCandles
+	}
+	if v, ok := os.LookupEnv(EnvSave); ok {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvSave, err)
+		}
+		c.Data.SaveInterval = interval
+	}
+	if v, ok := os.LookupEnv(EnvBasePrice); ok {
+		basePrice, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvBasePrice, err)
+		}
+		c.Simulation.BasePrice = basePrice
+	}
+	if v, ok := os.LookupEnv(EnvVolatility); ok {
+		volatility, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvVolatility, err)
+		}
+		c.Simulation.Volatility = volatility
+	}
+	if v, ok := os.LookupEnv(EnvBroadcast); ok {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvBroadcast, err)
+		}
+		c.Simulation.BroadcastInterval = interval
+	}
+	if v, ok := os.LookupEnv(EnvCORS); ok {
+		c.Server.CORSOrigins = splitList(v)
+	}
+	if v, ok := os.LookupEnv(EnvTLSCert); ok {
+		c.Server.TLS.CertFile = v
+	}
+	if v, ok := os.LookupEnv(EnvTLSKey); ok {
+		c.Server.TLS.KeyFile = v
+	}
+	if v, ok := os.LookupEnv(EnvWSTransport); ok {
+		c.Server.WebSocket.Transport = v
+	}
+	if v, ok := os.LookupEnv(EnvIngestURL); ok {
+		c.Ingest.URL = v
+	}
+	if v, ok := os.LookupEnv(EnvFollow); ok {
+		c.Follow.Primary = v
+	}
+	if v, ok := os.LookupEnv(EnvAdminToken); ok {
+		c.Admin.Token = v
+	}
+	if v, ok := os.LookupEnv(EnvJWTSecret); ok {
+		c.Auth.JWTSecret = v
+	}
+	if v, ok := os.LookupEnv(EnvDataKey); ok {
+		c.Data.EncryptionKey = v
+	}
+	if v, ok := os.LookupEnv(EnvPprof); ok {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvPprof, err)
+		}
+		c.Admin.Pprof = enabled
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration with secrets masked, suitable for display
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	if redacted.Admin.Token != "" {
+		redacted.Admin.Token = "********"
+	}
+	if redacted.Auth.JWTSecret != "" {
+		redacted.Auth.JWTSecret = "********"
+	}
+	if redacted.Data.EncryptionKey != "" {
+		redacted.Data.EncryptionKey = "********"
+	}
+	redacted.Auth.OIDC = make([]OIDCProviderConfig, len(c.Auth.OIDC))
+	for i, provider := range c.Auth.OIDC {
+		if provider.ClientSecret != "" {
+			provider.ClientSecret = "********"
+		}
+		redacted.Auth.OIDC[i] = provider
+	}
+	if redacted.Follow.APIKey != "" {
+		redacted.Follow.APIKey = "********"
+	}
+	redacted.Events.Webhooks = make([]WebhookConfig, len(c.Events.Webhooks))
+	for i, webhook := range c.Events.Webhooks {
+		if webhook.Secret != "" {
+			webhook.Secret = "********"
+		}
+		redacted.Events.Webhooks[i] = webhook
+	}
+	if redacted.Events.Notifiers.TelegramBotToken != "" {
+		redacted.Events.Notifiers.TelegramBotToken = "********"
+	}
+	return &redacted
+}
+
+// validate checks a webhook, naming it prefix in the problems found
+func (w WebhookConfig) validate(prefix string) []string {
+	var problems []string
+	if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("%s.url must be an http:// or https:// URL, got %q", prefix, w.URL))
+	}
+	switch w.Format {
+	case FormatJSON, FormatCloudEvents, FormatCloudEventsBinary:
+	default:
+		problems = append(problems, fmt.Sprintf("%s.format must be %q, %q or %q, got %q", prefix, FormatJSON, FormatCloudEvents, FormatCloudEventsBinary, w.Format))
+	}
+	for _, t := range w.Types {
+		if !models.IsEventType(t) {
+			problems = append(problems, fmt.Sprintf("%s.types must only contain %v, got %q", prefix, models.EventTypes(), t))
+		}
+	}
+	for _, tf := range w.TimeFrames {
+		if !tf.IsValid() {
+			problems = append(problems, fmt.Sprintf("%s.timeFrames must only contain %v, got %q", prefix, models.AllTimeFrames(), tf))
+		}
+	}
+	return problems
+}
+
+// validate returns the problems of an identity provider, prefix names it in messages
+func (p OIDCProviderConfig) validate(prefix string) []string {
+	var problems []string
+	if !oidcNamePattern.MatchString(p.Name) {
+		problems = append(problems, fmt.Sprintf("%s.name must be lower case letters, digits and '-', got %q", prefix, p.Name))
+	}
+	if p.Issuer != "" {
+		if !isHTTPURL(p.Issuer) {
+			problems = append(problems, fmt.Sprintf("%s.issuer must be an http:// or https:// URL, got %q", prefix, p.Issuer))
+		}
+	} else if !isHTTPURL(p.AuthURL) || !isHTTPURL(p.TokenURL) || !isHTTPURL(p.UserInfoURL) {
+		problems = append(problems, fmt.Sprintf("%s needs an issuer or authUrl, tokenUrl and userInfoUrl", prefix))
+	}
+	if p.ClientID == "" {
+		problems = append(problems, fmt.Sprintf("%s.clientId must not be empty", prefix))
+	}
+	if !isHTTPURL(p.RedirectURL) {
+		problems = append(problems, fmt.Sprintf("%s.redirectUrl must be an http:// or https:// URL, got %q", prefix, p.RedirectURL))
+	}
+	return problems
+}
+
+// validate returns the problems of the chaos settings
+func (c ChaosConfig) validate() []string {
+	var problems []string
+	for _, p := range []struct {
+		name  string
+		value float64
+	}{
+		{"delayProbability", c.DelayProbability},
+		{"dropProbability", c.DropProbability},
+		{"disconnectProbability", c.DisconnectProbability},
+	} {
+		if !(p.value >= 0 && p.value <= 1) {
+			problems = append(problems, fmt.Sprintf("chaos.%s must be between 0 and 1, got %g", p.name, p.value))
+		}
+	}
+	if c.MaxDelay < 0 || (c.DelayProbability > 0 && c.MaxDelay == 0) {
+		problems = append(problems, fmt.Sprintf("chaos.maxDelay must be positive if delayProbability is set, got %s", c.MaxDelay))
+	}
+	return problems
+}
+
+var oidcNamePattern = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+
+// isHTTPURL reports whether v is an absolute http:// or https:// URL
+func isHTTPURL(v string) bool {
+	u, err := url.Parse(v)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// splitList splits a comma separated list, dropping empty entries
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Validate checks that all settings are within sensible bounds
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("server.port must be between 1 and 65535, got %d", c.Server.Port))
+	}
+	if c.Data.Dir == "" {
+		problems = append(problems, "data.dir must not be empty")
+	}
+	if c.Data.MaxCandles < 1 {
+		problems = append(problems, fmt.Sprintf("data.maxCandles must be positive, got %d", c.Data.MaxCandles))
+	}
+	if c.Data.SaveInterval < time.Second {
+		problems = append(problems, fmt.Sprintf("data.saveInterval must be at least 1s, got %s", c.Data.SaveInterval))
+	}
+	if c.Data.UpdateLog.SegmentSize < 1<<10 {
+		problems = append(problems, fmt.Sprintf("data.updateLog.segmentSize must be at least 1024 bytes, got %d", c.Data.UpdateLog.SegmentSize))
+	}
+	if c.Data.UpdateLog.Segments < 1 {
+		problems = append(problems, fmt.Sprintf("data.updateLog.segments must be positive, got %d", c.Data.UpdateLog.Segments))
+	}
+	if c.Data.EncryptionKey != "" && c.Data.EncryptionKeyFile != "" {
+		problems = append(problems, "data.encryptionKey and data.encryptionKeyFile must not both be set")
+	}
+	if c.Data.EncryptionKey != "" {
+		if key, err := base64.StdEncoding.DecodeString(c.Data.EncryptionKey); err != nil || len(key) != 32 {
+			problems = append(problems, "data.encryptionKey must be 32 bytes encoded as base64")
+		}
+	}
+	if c.Simulation.Symbol == "" {
+		problems = append(problems, "simulation.symbol must not be empty")
+	}
+	if base, quote := c.Simulation.Market(); quote == "" {
+		problems = append(problems, "simulation.quote must not be empty")
+	} else if base == quote {
+		problems = append(problems, fmt.Sprintf("simulation.quote must differ from the base asset %s", base))
+	}
+	if _, ok := models.GetPriceModel(c.Simulation.Model); !ok {
+		problems = append(problems, fmt.Sprintf("simulation.model must be one of %v, got %q", models.PriceModelNames(), c.Simulation.Model))
+	}
+	if c.Simulation.BasePrice <= 0 {
+		problems = append(problems, fmt.Sprintf("simulation.basePrice must be positive, got %g", c.Simulation.BasePrice))
+	}
+	if c.Simulation.Volatility < 0 {
+		problems = append(problems, fmt.Sprintf("simulation.volatility must not be negative, got %g", c.Simulation.Volatility))
+	}
+	if err := c.Simulation.Precision().Validate(); err != nil {
+		problems = append(problems, fmt.Sprintf("simulation precision: %v", err))
+	}
+	if err := c.Simulation.Futures.Validate(); err != nil {
+		problems = append(problems, fmt.Sprintf("simulation.futures: %v", err))
+	}
+	if _, err := c.Simulation.Holidays.Calendar(); err != nil {
+		problems = append(problems, fmt.Sprintf("simulation.holidays: %v", err))
+	}
+	if err := c.Simulation.Perpetual.Validate(); err != nil {
+		problems = append(problems, fmt.Sprintf("simulation.perpetual: %v", err))
+	}
+	if err := validateVenues(c.Simulation.Venues); err != nil {
+		problems = append(problems, fmt.Sprintf("simulation.venues: %v", err))
+	}
+	if err := models.Seasonality(c.Simulation.Seasonality).Validate(); err != nil {
+		problems = append(problems, fmt.Sprintf("simulation.%v", err))
+	}
+	if err := c.Simulation.Volume.Params().Validate(); err != nil {
+		problems = append(problems, fmt.Sprintf("simulation.volume: %v", err))
+	}
+	if c.Simulation.BroadcastInterval < 100*time.Millisecond {
+		problems = append(problems, fmt.Sprintf("simulation.broadcastInterval must be at least 100ms, got %s", c.Simulation.BroadcastInterval))
+	}
+	if len(c.Server.CORSOrigins) == 0 {
+		problems = append(problems, "server.corsOrigins must not be empty")
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.ReadHeaderTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 {
+		problems = append(problems, "server timeouts must be positive")
+	}
+	if c.Server.ReadHeaderTimeout > c.Server.ReadTimeout {
+		problems = append(problems, "server.readHeaderTimeout must not exceed server.readTimeout")
+	}
+	if c.Server.MaxHeaderBytes < 1024 {
+		problems = append(problems, fmt.Sprintf("server.maxHeaderBytes must be at least 1024, got %d", c.Server.MaxHeaderBytes))
+	}
+	if c.Server.MaxBodyBytes < 1 {
+		problems = append(problems, fmt.Sprintf("server.maxBodyBytes must be positive, got %d", c.Server.MaxBodyBytes))
+	}
+
+	ws := c.Server.WebSocket
+	if ws.Transport != TransportGorilla && ws.Transport != TransportEpoll {
+		problems = append(problems, fmt.Sprintf("server.websocket.transport must be %q or %q, got %q", TransportGorilla, TransportEpoll, ws.Transport))
+	}
+	if ws.Workers < 1 {
+		problems = append(problems, fmt.Sprintf("server.websocket.workers must be positive, got %d", ws.Workers))
+	}
+	if ws.Writers < 1 {
+		problems = append(problems, fmt.Sprintf("server.websocket.writers must be positive, got %d", ws.Writers))
+	}
+	if ws.Spectators < 0 {
+		problems = append(problems, fmt.Sprintf("server.websocket.spectators must not be negative, got %d", ws.Spectators))
+	}
+	if ws.Lag.QueueDepth < 0 || ws.Lag.QueueDepth >= ClientQueueSize {
+		problems = append(problems, fmt.Sprintf("server.websocket.lag.queueDepth must be between 0 and %d, got %d", ClientQueueSize-1, ws.Lag.QueueDepth))
+	}
+	if ws.Lag.AckLag < 0 {
+		problems = append(problems, fmt.Sprintf("server.websocket.lag.ackLag must not be negative, got %d", ws.Lag.AckLag))
+	}
+	if ws.Lag.EvictAfter < 0 {
+		problems = append(problems, fmt.Sprintf("server.websocket.lag.evictAfter must not be negative, got %s", ws.Lag.EvictAfter))
+	}
+
+	if c.Ingest.Enabled() && !strings.HasPrefix(c.Ingest.URL, "ws://") && !strings.HasPrefix(c.Ingest.URL, "wss://") {
+		problems = append(problems, fmt.Sprintf("ingest.url must be a ws:// or wss:// URL, got %q", c.Ingest.URL))
+	}
+	if c.Ingest.ReconnectDelay < 100*time.Millisecond {
+		problems = append(problems, fmt.Sprintf("ingest.reconnectDelay must be at least 100ms, got %s", c.Ingest.ReconnectDelay))
+	}
+	if c.Follow.Enabled() {
+		if u, err := url.Parse(c.Follow.Primary); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("follow.primary must be an http:// or https:// URL, got %q", c.Follow.Primary))
+		}
+		if c.Ingest.Enabled() {
+			problems = append(problems, "follow.primary cannot be combined with ingest.url")
+		}
+	}
+	if c.Follow.ReconnectDelay < 100*time.Millisecond {
+		problems = append(problems, fmt.Sprintf("follow.reconnectDelay must be at least 100ms, got %s", c.Follow.ReconnectDelay))
+	}
+
+	scripting := c.Scripting
+	if scripting.Timeout < time.Millisecond || scripting.Timeout > 10*time.Second {
+		problems = append(problems, fmt.Sprintf("scripting.timeout must be between 1ms and 10s, got %s", scripting.Timeout))
+	}
+	if scripting.MaxAllocs < 1 {
+		problems = append(problems, fmt.Sprintf("scripting.maxAllocs must be positive, got %d", scripting.MaxAllocs))
+	}
+	if scripting.MaxScripts < 1 {
+		problems = append(problems, fmt.Sprintf("scripting.maxScripts must be positive, got %d", scripting.MaxScripts))
+	}
+	if scripting.MaxSourceBytes < 1 {
+		problems = append(problems, fmt.Sprintf("scripting.maxSourceBytes must be positive, got %d", scripting.MaxSourceBytes))
+	}
+
+	if c.Events.Timeout <= 0 {
+		problems = append(problems, fmt.Sprintf("events.timeout must be positive, got %s", c.Events.Timeout))
+	}
+	if c.Events.MaxAttempts < 1 {
+		problems = append(problems, fmt.Sprintf("events.maxAttempts must be positive, got %d", c.Events.MaxAttempts))
+	}
+	if c.Events.RetryBackoff <= 0 || c.Events.MaxRetryBackoff < c.Events.RetryBackoff {
+		problems = append(problems, fmt.Sprintf("events.retryBackoff must be positive and at most events.maxRetryBackoff, got %s and %s", c.Events.RetryBackoff, c.Events.MaxRetryBackoff))
+	}
+	if c.Events.DeadLetterLimit < 1 {
+		problems = append(problems, fmt.Sprintf("events.deadLetterLimit must be positive, got %d", c.Events.DeadLetterLimit))
+	}
+	for i, webhook := range c.Events.Webhooks {
+		problems = append(problems, webhook.validate(fmt.Sprintf("events.webhooks[%d]", i))...)
+	}
+
+	if c.Auth.UsersEnabled() && len(c.Auth.JWTSecret) < 32 {
+		problems = append(problems, fmt.Sprintf("auth.jwtSecret must be at least 32 characters, got %d", len(c.Auth.JWTSecret)))
+	}
+	if c.Auth.AccessTokenTTL < time.Minute || c.Auth.AccessTokenTTL > 24*time.Hour {
+		problems = append(problems, fmt.Sprintf("auth.accessTokenTtl must be between 1m and 24h, got %s", c.Auth.AccessTokenTTL))
+	}
+	if c.Auth.RefreshTokenTTL < c.Auth.AccessTokenTTL {
+		problems = append(problems, fmt.Sprintf("auth.refreshTokenTtl must be at least auth.accessTokenTtl, got %s", c.Auth.RefreshTokenTTL))
+	}
+	if len(c.Auth.OIDC) > 0 && !c.Auth.UsersEnabled() {
+		problems = append(problems, "auth.oidc requires auth.jwtSecret")
+	}
+	if c.Auth.OIDCReturnURL != "" && !isHTTPURL(c.Auth.OIDCReturnURL) {
+		problems = append(problems, fmt.Sprintf("auth.oidcReturnUrl must be an http:// or https:// URL, got %q", c.Auth.OIDCReturnURL))
+	}
+	names := make(map[string]bool)
+	for i, provider := range c.Auth.OIDC {
+		problems = append(problems, provider.validate(fmt.Sprintf("auth.oidc[%d]", i))...)
+		if names[provider.Name] {
+			problems = append(problems, fmt.Sprintf("auth.oidc[%d].name %q is used twice", i, provider.Name))
+		}
+		names[provider.Name] = true
+	}
+
+	for _, network := range c.Admin.AllowedNetworks {
+		if _, _, err := net.ParseCIDR(network); err != nil {
+			problems = append(problems, fmt.Sprintf("admin.allowedNetworks must only contain CIDR ranges such as 10.0.0.0/8, got %q", network))
+		}
+	}
+	if c.Admin.ClientCAFile != "" && c.Server.TLS.CertFile == "" && !c.Server.TLS.Autocert.Enabled {
+		problems = append(problems, "admin.clientCaFile requires server.tls")
+	}
+
+	if c.Quotas.RequestsPerMinute < 0 {
+		problems = append(problems, fmt.Sprintf("quotas.requestsPerMinute must not be negative, got %d", c.Quotas.RequestsPerMinute))
+	}
+	if c.Quotas.BanAfter < 1 {
+		problems = append(problems, fmt.Sprintf("quotas.banAfter must be positive, got %d", c.Quotas.BanAfter))
+	}
+	if c.Quotas.BanDuration < 0 {
+		problems = append(problems, fmt.Sprintf("quotas.banDuration must not be negative, got %s", c.Quotas.BanDuration))
+	}
+	if c.Quotas.WSMessagesPerSecond < 0 {
+		problems = append(problems, fmt.Sprintf("quotas.wsMessagesPerSecond must not be negative, got %d", c.Quotas.WSMessagesPerSecond))
+	}
+
+	if c.Cash.DepositInterval < 0 || c.Cash.DepositInterval%time.Minute != 0 {
+		problems = append(problems, fmt.Sprintf("cash.depositInterval must be a whole number of minutes, got %s", c.Cash.DepositInterval))
+	}
+	if math.IsNaN(c.Cash.Deposit) || math.IsInf(c.Cash.Deposit, 0) {
+		problems = append(problems, fmt.Sprintf("cash.deposit must be a number, got %g", c.Cash.Deposit))
+	}
+	if !(c.Cash.InterestRate > -1 && c.Cash.InterestRate < 1) {
+		problems = append(problems, fmt.Sprintf("cash.interestRate must be above -1 and below 1, got %g", c.Cash.InterestRate))
+	}
+
+	if c.Quotas.ChatMessagesPerMinute < 0 {
+		problems = append(problems, fmt.Sprintf("quotas.chatMessagesPerMinute must not be negative, got %d", c.Quotas.ChatMessagesPerMinute))
+	}
+	if c.Chat.MaxLength < 1 || c.Chat.MaxLength > maxChatLength {
+		problems = append(problems, fmt.Sprintf("chat.maxLength must be between 1 and %d, got %d", maxChatLength, c.Chat.MaxLength))
+	}
+	if c.Chat.History < 0 || c.Chat.History > maxChatHistory {
+		problems = append(problems, fmt.Sprintf("chat.history must be between 0 and %d, got %d", maxChatHistory, c.Chat.History))
+	}
+	for _, name := range c.Chat.Filters {
+		if _, ok := models.GetChatFilter(name); !ok {
+			problems = append(problems, fmt.Sprintf("chat.filters must only contain %v, got %q", models.ChatFilterNames(), name))
+		}
+	}
+	for _, word := range c.Chat.BlockedWords {
+		if strings.TrimSpace(word) == "" {
+			problems = append(problems, "chat.blockedWords must not contain empty words")
+			break
+		}
+	}
+
+	problems = append(problems, c.Chaos.validate()...)
+	problems = append(problems, c.validateNamespaces()...)
+
+	tls := c.Server.TLS
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		problems = append(problems, "server.tls.certFile and server.tls.keyFile must be set together")
+	}
+	if tls.Autocert.Enabled {
+		if tls.CertFile != "" {
+			problems = append(problems, "server.tls.autocert cannot be combined with certFile/keyFile")
+		}
+		if len(tls.Autocert.Hosts) == 0 {
+			problems = append(problems, "server.tls.autocert.hosts must not be empty")
+		}
+		if tls.Autocert.CacheDir == "" {
+			problems = append(problems, "server.tls.autocert.cacheDir must not be empty")
+		}
+		if tls.Autocert.HTTPPort < 1 || tls.Autocert.HTTPPort > 65535 || tls.Autocert.HTTPPort == c.Server.Port {
+			problems = append(problems, fmt.Sprintf("server.tls.autocert.httpPort must be a free port between 1 and 65535, got %d", tls.Autocert.HTTPPort))
+		}
+	}
+	if c.Admin.Pprof && c.Admin.Token == "" {
+		problems = append(problems, "admin.pprof requires admin.token to be set")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
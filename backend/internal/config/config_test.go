@@ -0,0 +1,18 @@
+package config
+
+import "testing"
+
+func TestValidateLagQueueDepth(t *testing.T) {
+	for depth, valid := range map[int]bool{
+		-1:                  false,
+		0:                   true,
+		ClientQueueSize - 1: true,
+		ClientQueueSize:     false,
+	} {
+		cfg := Default()
+		cfg.Server.WebSocket.Lag.QueueDepth = depth
+		if err := cfg.Validate(); (err == nil) != valid {
+			t.Errorf("queue depth %d: got %v, want valid %v", depth, err, valid)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// DefaultNamespace names the simulation served at the root, with the data directory itself
+const DefaultNamespace = "default"
+
+// namespacesDir is the subdirectory of the data directory holding the data of namespaces
+const namespacesDir = "namespaces"
+
+// namespaceName matches valid namespace names, which become path segments and directories
+var namespaceName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// NamespaceConfig holds the settings of a simulation served next to the default one.
+// Unset settings are the ones of the default simulation.
+type NamespaceConfig struct {
+	Symbol     string  `yaml:"symbol" json:"symbol,omitempty"`
+	Base       string  `yaml:"base" json:"base,omitempty"`   // Asset the symbol prices, the symbol itself if empty
+	Quote      string  `yaml:"quote" json:"quote,omitempty"` // Currency prices are quoted in
+	Model      string  `yaml:"model" json:"model,omitempty"`
+	BasePrice  float64 `yaml:"basePrice" json:"basePrice,omitempty"`
+	Volatility float64 `yaml:"volatility" json:"volatility,omitempty"`
+	Seed       int64   `yaml:"seed" json:"seed,omitempty"`
+
+	// Precision of the symbol, decimals are pointers as 0 is a valid number of places
+	PriceDecimals  *int    `yaml:"priceDecimals" json:"priceDecimals,omitempty"`
+	TickSize       float64 `yaml:"tickSize" json:"tickSize,omitempty"`
+	VolumeDecimals *int    `yaml:"volumeDecimals" json:"volumeDecimals,omitempty"`
+
+	// Constituents of an index by namespace name, "default" for the simulation at the root,
+	// and weight. An index computes its prices from theirs instead of generating them.
+	Index map[string]float64 `yaml:"index" json:"index,omitempty"`
+
+	// Dated futures contracts on the symbol, only listed for configured namespaces. The
+	// term defaults to the one of simulation, contracts and premium don't.
+	Futures FuturesConfig `yaml:"futures" json:"-"`
+
+	// Perpetual contract on the symbol, only listed for configured namespaces. Settings left
+	// out are the ones of simulation.
+	Perpetual PerpetualConfig `yaml:"perpetual" json:"-"`
+
+	// Simulated exchanges quoting the symbol, only listed for configured namespaces
+	Venues []VenueConfig `yaml:"venues" json:"-"`
+}
+
+// ValidateIndex reports why the constituents of the index of a namespace are unusable, if
+// they are. isIndex reports whether a namespace exists and is an index itself.
+func (ns NamespaceConfig) ValidateIndex(name string, isIndex func(constituent string) (index, ok bool)) error {
+	for constituent, weight := range ns.Index {
+		index, ok := isIndex(constituent)
+		switch {
+		case constituent == name:
+			return fmt.Errorf("index %s must not contain itself", name)
+		case !ok:
+			return fmt.Errorf("constituent %q of index %s is not a namespace", constituent, name)
+		case index:
+			return fmt.Errorf("constituent %s of index %s must not be an index itself", constituent, name)
+		case !(weight > 0) || math.IsInf(weight, 0):
+			return fmt.Errorf("weight of constituent %s of index %s must be a positive number, got %g", constituent, name, weight)
+		}
+	}
+	return nil
+}
+
+// NamespaceDir returns the data directory of a namespace
+func (d DataConfig) NamespaceDir(name string) string {
+	if name == DefaultNamespace {
+		return d.Dir
+	}
+	return filepath.Join(d.Dir, namespacesDir, name)
+}
+
+// NamespaceNames returns the names of the configured namespaces, sorted
+func (c *Config) NamespaceNames() []string {
+	names := make([]string, 0, len(c.Namespaces))
+	for name := range c.Namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Namespace returns the configuration of a namespace: this one with the namespace's data
+// directory, audit log and simulation settings. Namespaces always generate their prices,
+// and don't have namespaces of their own.
+func (c *Config) Namespace(name string) (*Config, error) {
+	if name == DefaultNamespace {
+		return c, nil
+	}
+	ns, ok := c.Namespaces[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown namespace %q, configured are %v", name, c.NamespaceNames())
+	}
+	return c.NamespaceWith(name, ns)
+}
+
+// NamespaceWith returns the configuration of a namespace with the given settings, which
+// doesn't have to be configured, such as a symbol created at runtime
+func (c *Config) NamespaceWith(name string, ns NamespaceConfig) (*Config, error) {
+	if err := ValidateNamespaceName(name); err != nil {
+		return nil, err
+	}
+
+	cfg := *c
+	cfg.Data.Dir = c.Data.NamespaceDir(name)
+	cfg.Admin.AuditFile = filepath.Join(cfg.Data.Dir, "audit.log")
+	cfg.Ingest.URL = ""
+	cfg.Follow.Primary = ""
+	cfg.Namespaces = nil
+	cfg.namespace = name
+
+	if ns.Symbol != "" {
+		cfg.Simulation.Symbol = ns.Symbol
+		cfg.Simulation.Base = ns.Base
+	}
+	if ns.Base != "" {
+		cfg.Simulation.Base = ns.Base
+	}
+	if ns.Quote != "" {
+		cfg.Simulation.Quote = ns.Quote
+	}
+	cfg.Simulation.Futures = ns.Futures
+	if ns.Futures.Term == 0 {
+		cfg.Simulation.Futures.Term = c.Simulation.Futures.Term
+	}
+	cfg.Simulation.Perpetual.Enabled = ns.Perpetual.Enabled
+	if ns.Perpetual.FundingInterval != 0 {
+		cfg.Simulation.Perpetual.FundingInterval = ns.Perpetual.FundingInterval
+	}
+	if ns.Perpetual.PremiumVolatility != 0 {
+		cfg.Simulation.Perpetual.PremiumVolatility = ns.Perpetual.PremiumVolatility
+	}
+	if ns.Perpetual.MaxFundingRate != 0 {
+		cfg.Simulation.Perpetual.MaxFundingRate = ns.Perpetual.MaxFundingRate
+	}
+	cfg.Simulation.Venues = ns.Venues
+	if ns.Model != "" {
+		cfg.Simulation.Model = ns.Model
+	}
+	if ns.BasePrice != 0 {
+		cfg.Simulation.BasePrice = ns.BasePrice
+	}
+	if ns.Volatility != 0 {
+		cfg.Simulation.Volatility = ns.Volatility
+	}
+	if ns.Seed != 0 {
+		cfg.Simulation.Seed = ns.Seed
+	}
+	if ns.PriceDecimals != nil {
+		cfg.Simulation.PriceDecimals = *ns.PriceDecimals
+	}
+	if ns.TickSize != 0 {
+		cfg.Simulation.TickSize = ns.TickSize
+	}
+	if ns.VolumeDecimals != nil {
+		cfg.Simulation.VolumeDecimals = *ns.VolumeDecimals
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("namespace %s: %w", name, err)
+	}
+	return &cfg, nil
+}
+
+// NamespaceName returns the name of the namespace of the configuration
+func (c *Config) NamespaceName() string {
+	if c.namespace == "" {
+		return DefaultNamespace
+	}
+	return c.namespace
+}
+
+// ValidateNamespaceName reports why a name can't name a namespace, if it can't
+func ValidateNamespaceName(name string) error {
+	switch {
+	case name == DefaultNamespace:
+		return fmt.Errorf("namespaces must not be named %q, it is the simulation at the root", DefaultNamespace)
+	case !namespaceName.MatchString(name):
+		return fmt.Errorf("namespaces must be named with up to 63 lowercase letters, digits and dashes, got %q", name)
+	}
+	return nil
+}
+
+// isIndex reports whether a namespace is configured and is an index
+func (c *Config) isIndex(name string) (index, ok bool) {
+	if name == DefaultNamespace {
+		return false, true
+	}
+	ns, ok := c.Namespaces[name]
+	return len(ns.Index) > 0, ok
+}
+
+// validateNamespaces checks the names and indexes of the namespaces
+func (c *Config) validateNamespaces() []string {
+	var problems []string
+	for _, name := range c.NamespaceNames() {
+		if err := ValidateNamespaceName(name); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if err := c.Namespaces[name].ValidateIndex(name, c.isIndex); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+)
+
+// Store holds the active configuration and re-reads it on demand
+type Store struct {
+	reloading  sync.Mutex // Serializes reloads
+	mu         sync.RWMutex
+	cfg        *Config
+	listeners  []func(*Config)
+	namespaces []*Store         // Stores of namespaces, reloaded along with this one
+	definition *NamespaceConfig // Settings of a namespace added at runtime, nil if configured
+}
+
+// NewStore creates a new Store holding the given configuration
+func NewStore(cfg *Config) *Store {
+	return &Store{
+		cfg: cfg,
+	}
+}
+
+// Get returns the active configuration. The returned value must not be modified.
+func (s *Store) Get() *Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg
+}
+
+// OnReload registers a function that is called with the new configuration after every reload
+func (s *Store) OnReload(fn func(*Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// Namespace returns a store of the configuration of a namespace, which reloads whenever
+// this one does
+func (s *Store) Namespace(name string) (*Store, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cfg, err := s.cfg.Namespace(name)
+	if err != nil {
+		return nil, err
+	}
+	ns := NewStore(cfg)
+	s.namespaces = append(s.namespaces, ns)
+	return ns, nil
+}
+
+// AddNamespace returns a store of the configuration of a namespace that isn't configured,
+// with the given settings, which reloads whenever this one does
+func (s *Store) AddNamespace(name string, definition NamespaceConfig) (*Store, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.cfg.Namespaces[name]; ok {
+		return nil, fmt.Errorf("namespace %s is configured already", name)
+	}
+	for _, ns := range s.namespaces {
+		if ns.Get().NamespaceName() == name {
+			return nil, fmt.Errorf("namespace %s exists already", name)
+		}
+	}
+	cfg, err := s.cfg.NamespaceWith(name, definition)
+	if err != nil {
+		return nil, err
+	}
+	ns := NewStore(cfg)
+	ns.definition = &definition
+	s.namespaces = append(s.namespaces, ns)
+	return ns, nil
+}
+
+// RemoveNamespace stops reloading the store of a namespace added with AddNamespace
+func (s *Store) RemoveNamespace(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, ns := range s.namespaces {
+		if ns.definition != nil && ns.Get().NamespaceName() == name {
+			s.namespaces = append(s.namespaces[:i], s.namespaces[i+1:]...)
+			return
+		}
+	}
+}
+
+// Reload re-reads the configuration file, environment and flags and applies the
+// settings that are safe to change at runtime. Settings that require a restart
+// keep their current values.
+func (s *Store) Reload() (*Config, error) {
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+
+	s.mu.RLock()
+	args := s.cfg.args
+	s.mu.RUnlock()
+
+	next, err := Load(args)
+	if err != nil {
+		return nil, err
+	}
+	next = s.apply(next)
+
+	s.mu.RLock()
+	namespaces := make([]*Store, len(s.namespaces))
+	copy(namespaces, s.namespaces)
+	s.mu.RUnlock()
+
+	running := make(map[string]bool)
+	for _, ns := range namespaces {
+		name := ns.Get().NamespaceName()
+		running[name] = true
+		var cfg *Config
+		if ns.definition != nil {
+			cfg, err = next.NamespaceWith(name, *ns.definition)
+		} else {
+			cfg, err = next.Namespace(name)
+		}
+		if err != nil {
+			log.Printf("Keeping the configuration of namespace %s until restart: %v", name, err)
+			continue
+		}
+		ns.apply(cfg)
+	}
+	for _, name := range next.NamespaceNames() {
+		if !running[name] {
+			log.Printf("Ignoring new namespace %s until restart", name)
+		}
+	}
+
+	log.Printf("Configuration reloaded")
+	return next, nil
+}
+
+// apply replaces the configuration with a newly loaded one, keeping the settings that
+// cannot change at runtime, notifies the listeners and returns the applied configuration
+func (s *Store) apply(next *Config) *Config {
+	s.mu.Lock()
+	current := s.cfg
+
+	// Keep settings that cannot be changed without a restart
+	if next.Server.Port != current.Server.Port {
+		log.Printf("Ignoring change of server.port to %d until restart", next.Server.Port)
+		next.Server.Port = current.Server.Port
+	}
+	if next.Server.ReadTimeout != current.Server.ReadTimeout || next.Server.ReadHeaderTimeout != current.Server.ReadHeaderTimeout ||
+		next.Server.WriteTimeout != current.Server.WriteTimeout || next.Server.IdleTimeout != current.Server.IdleTimeout ||
+		next.Server.MaxHeaderBytes != current.Server.MaxHeaderBytes {
+		log.Printf("Ignoring change of the server timeouts and maxHeaderBytes until restart")
+		next.Server.ReadTimeout = current.Server.ReadTimeout
+		next.Server.ReadHeaderTimeout = current.Server.ReadHeaderTimeout
+		next.Server.WriteTimeout = current.Server.WriteTimeout
+		next.Server.IdleTimeout = current.Server.IdleTimeout
+		next.Server.MaxHeaderBytes = current.Server.MaxHeaderBytes
+	}
+	if !reflect.DeepEqual(next.Server.TLS, current.Server.TLS) {
+		log.Printf("Ignoring change of server.tls until restart")
+		next.Server.TLS = current.Server.TLS
+	}
+	if next.Data.Dir != current.Data.Dir {
+		log.Printf("Ignoring change of data.dir to %q until restart", next.Data.Dir)
+		next.Data.Dir = current.Data.Dir
+	}
+	if next.Data.EncryptionKey != current.Data.EncryptionKey || next.Data.EncryptionKeyFile != current.Data.EncryptionKeyFile {
+		log.Printf("Ignoring change of data.encryptionKey until restart")
+		next.Data.EncryptionKey = current.Data.EncryptionKey
+		next.Data.EncryptionKeyFile = current.Data.EncryptionKeyFile
+	}
+	if next.Server.WebSocket != current.Server.WebSocket {
+		log.Printf("Ignoring change of server.websocket until restart")
+		next.Server.WebSocket = current.Server.WebSocket
+	}
+	if next.Ingest != current.Ingest {
+		log.Printf("Ignoring change of ingest until restart")
+		next.Ingest = current.Ingest
+	}
+	if next.Follow != current.Follow {
+		log.Printf("Ignoring change of follow until restart")
+		next.Follow = current.Follow
+	}
+	if next.Scripting.Enabled != current.Scripting.Enabled {
+		log.Printf("Ignoring change of scripting.enabled until restart")
+		next.Scripting.Enabled = current.Scripting.Enabled
+	}
+	if next.Auth.UsersEnabled() != current.Auth.UsersEnabled() {
+		log.Printf("Ignoring change of auth.jwtSecret until restart")
+		next.Auth.JWTSecret = current.Auth.JWTSecret
+	}
+	if next.Admin.ClientCAFile != current.Admin.ClientCAFile {
+		log.Printf("Ignoring change of admin.clientCaFile until restart")
+		next.Admin.ClientCAFile = current.Admin.ClientCAFile
+	}
+	if next.Simulation.Symbol != current.Simulation.Symbol {
+		log.Printf("Ignoring change of simulation.symbol to %q until restart", next.Simulation.Symbol)
+		next.Simulation.Symbol = current.Simulation.Symbol
+	}
+	if next.Simulation.Futures != current.Simulation.Futures {
+		log.Printf("Ignoring change of simulation.futures until restart")
+		next.Simulation.Futures = current.Simulation.Futures
+	}
+	if next.Simulation.Perpetual != current.Simulation.Perpetual {
+		log.Printf("Ignoring change of simulation.perpetual until restart")
+		next.Simulation.Perpetual = current.Simulation.Perpetual
+	}
+	if !reflect.DeepEqual(next.Simulation.Venues, current.Simulation.Venues) {
+		log.Printf("Ignoring change of simulation.venues until restart")
+		next.Simulation.Venues = current.Simulation.Venues
+	}
+	if next.Simulation.Precision() != current.Simulation.Precision() {
+		log.Printf("Ignoring change of the simulation precision until restart")
+		next.Simulation.PriceDecimals = current.Simulation.PriceDecimals
+		next.Simulation.TickSize = current.Simulation.TickSize
+		next.Simulation.VolumeDecimals = current.Simulation.VolumeDecimals
+	}
+
+	s.cfg = next
+	listeners := make([]func(*Config), len(s.listeners))
+	copy(listeners, s.listeners)
+	s.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(next)
+	}
+	return next
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+func TestApplyKeepsRestartOnlySettings(t *testing.T) {
+	current := Default()
+	store := NewStore(current)
+
+	next := Default()
+	next.Server.ReadTimeout = current.Server.ReadTimeout + time.Second
+	next.Server.ReadHeaderTimeout = current.Server.ReadHeaderTimeout + time.Second
+	next.Server.WriteTimeout = current.Server.WriteTimeout + time.Second
+	next.Server.IdleTimeout = current.Server.IdleTimeout + time.Second
+	next.Server.MaxHeaderBytes = current.Server.MaxHeaderBytes + 1
+	next.Server.TLS.CertFile = "cert.pem"
+	next.Server.TLS.KeyFile = "key.pem"
+	next.Server.TLS.Autocert.Hosts = []string{"example.com"}
+	next.Server.CORSOrigins = []string{"https://example.com"}
+
+	applied := store.apply(next)
+	if applied != store.Get() {
+		t.Fatal("apply didn't return the active configuration")
+	}
+	if applied.Server.ReadTimeout != current.Server.ReadTimeout || applied.Server.ReadHeaderTimeout != current.Server.ReadHeaderTimeout ||
+		applied.Server.WriteTimeout != current.Server.WriteTimeout || applied.Server.IdleTimeout != current.Server.IdleTimeout ||
+		applied.Server.MaxHeaderBytes != current.Server.MaxHeaderBytes {
+		t.Errorf("server timeouts changed on reload to %+v", applied.Server)
+	}
+	if applied.Server.TLS.CertFile != "" || applied.Server.TLS.KeyFile != "" || len(applied.Server.TLS.Autocert.Hosts) != 0 {
+		t.Errorf("server.tls changed on reload to %+v", applied.Server.TLS)
+	}
+	if len(applied.Server.CORSOrigins) != 1 || applied.Server.CORSOrigins[0] != "https://example.com" {
+		t.Errorf("server.corsOrigins = %v, want the reloaded origins", applied.Server.CORSOrigins)
+	}
+}
+
+func TestReloadWithCommandFlags(t *testing.T) {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	serve := fs.Bool("serve", false, "serve the replay")
+	cfg, err := LoadFlags(fs, []string{"-serve", "-data-dir", t.TempDir(), "-max-candles", "500"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !*serve {
+		t.Fatal("the command flag wasn't parsed")
+	}
+
+	reloaded, err := NewStore(cfg).Reload()
+	if err != nil {
+		t.Fatalf("reloading a configuration loaded with command flags: %v", err)
+	}
+	if reloaded.Data.MaxCandles != 500 || reloaded.Data.Dir != cfg.Data.Dir {
+		t.Fatalf("reload lost the configuration flags: max candles %d, data dir %q", reloaded.Data.MaxCandles, reloaded.Data.Dir)
+	}
+}
@@ -0,0 +1,86 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"server/internal/models"
+)
+
+// Content types of CloudEvents requests
+const (
+	contentTypeJSON        = "application/json"
+	contentTypeCloudEvents = "application/cloudevents+json; charset=UTF-8"
+)
+
+// NewCloudEvent wraps a candle update in a CloudEvent. Its subject is the timeframe,
+// its data a models.CandleEvent.
+func NewCloudEvent(source, symbol string, message models.UpdateMessage, at time.Time) (models.CloudEvent, error) {
+	data, err := json.Marshal(models.CandleEvent{
+		Symbol:    symbol,
+		TimeFrame: message.TimeFrame,
+		Candle:    message.Candle,
+	})
+	if err != nil {
+		return models.CloudEvent{}, fmt.Errorf("failed to encode event data: %w", err)
+	}
+
+	return models.CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              newEventID(),
+		Source:          source,
+		Type:            message.EventType(),
+		Subject:         string(message.TimeFrame),
+		Time:            at.UTC().Format(time.RFC3339Nano),
+		DataContentType: contentTypeJSON,
+		Data:            data,
+	}, nil
+}
+
+// DefaultSource returns the CloudEvents source of a symbol's events when none is configured
+func DefaultSource(symbol string) string {
+	return "/seedventure/" + symbol
+}
+
+// structuredRequest returns the body and headers of an event in structured mode,
+// where the whole event is the JSON body
+func structuredRequest(event models.CloudEvent) ([]byte, http.Header, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", contentTypeCloudEvents)
+	return body, header, nil
+}
+
+// binaryRequest returns the body and headers of an event in binary mode, where the
+// body is the event data and the attributes are ce-* headers
+func binaryRequest(event models.CloudEvent) ([]byte, http.Header) {
+	header := http.Header{}
+	header.Set("Content-Type", event.DataContentType)
+	header.Set("ce-specversion", event.SpecVersion)
+	header.Set("ce-id", event.ID)
+	header.Set("ce-source", event.Source)
+	header.Set("ce-type", event.Type)
+	if event.Subject != "" {
+		header.Set("ce-subject", event.Subject)
+	}
+	if event.Time != "" {
+		header.Set("ce-time", event.Time)
+	}
+	return event.Data, header
+}
+
+// newEventID generates a random event ID, unique per source
+func newEventID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
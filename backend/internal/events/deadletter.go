@@ -0,0 +1,134 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"server/internal/models"
+)
+
+// ErrDeadLetterNotFound is returned for IDs without a dead letter
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetterLog keeps the deliveries that failed on every attempt, so they can be
+// inspected and replayed. It is saved to a JSON file after every change.
+type DeadLetterLog struct {
+	path string
+
+	lock    sync.Mutex
+	letters []models.DeadLetter // Oldest first
+}
+
+// NewDeadLetterLog opens the dead-letter log saved at path, starting empty if there is none
+func NewDeadLetterLog(path string) (*DeadLetterLog, error) {
+	l := &DeadLetterLog{path: path, letters: []models.DeadLetter{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead-letter log: %w", err)
+	}
+	if err := json.Unmarshal(data, &l.letters); err != nil {
+		return nil, fmt.Errorf("failed to parse dead-letter log %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Add appends a failed delivery, discarding the oldest ones beyond limit
+func (l *DeadLetterLog) Add(letter models.DeadLetter, limit int) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.letters = append(l.letters, letter)
+	if len(l.letters) > limit {
+		l.letters = append([]models.DeadLetter(nil), l.letters[len(l.letters)-limit:]...)
+	}
+	return l.saveLocked()
+}
+
+// List returns the failed deliveries to url, or to any URL if it is empty, newest first.
+// A limit of zero returns all of them.
+func (l *DeadLetterLog) List(url string, limit int) []models.DeadLetter {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	letters := []models.DeadLetter{}
+	for i := len(l.letters) - 1; i >= 0; i-- {
+		if url != "" && l.letters[i].URL != url {
+			continue
+		}
+		letters = append(letters, l.letters[i])
+		if limit > 0 && len(letters) == limit {
+			break
+		}
+	}
+	return letters
+}
+
+// Get returns a failed delivery
+func (l *DeadLetterLog) Get(id string) (models.DeadLetter, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for _, letter := range l.letters {
+		if letter.ID == id {
+			return letter, nil
+		}
+	}
+	return models.DeadLetter{}, ErrDeadLetterNotFound
+}
+
+// Update replaces a failed delivery with the same ID
+func (l *DeadLetterLog) Update(letter models.DeadLetter) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for i := range l.letters {
+		if l.letters[i].ID == letter.ID {
+			l.letters[i] = letter
+			return l.saveLocked()
+		}
+	}
+	return ErrDeadLetterNotFound
+}
+
+// Remove deletes a failed delivery
+func (l *DeadLetterLog) Remove(id string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for i := range l.letters {
+		if l.letters[i].ID == id {
+			l.letters = append(l.letters[:i], l.letters[i+1:]...)
+			return l.saveLocked()
+		}
+	}
+	return ErrDeadLetterNotFound
+}
+
+// saveLocked replaces the saved log with the current one. Requires l.lock.
+func (l *DeadLetterLog) saveLocked() error {
+	data, err := json.Marshal(l.letters)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead-letter log: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create dead-letter directory: %w", err)
+	}
+
+	// Write a temporary file and rename it, so a crash never leaves a torn log
+	temp := l.path + ".tmp"
+	if err := os.WriteFile(temp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write dead-letter log: %w", err)
+	}
+	if err := os.Rename(temp, l.path); err != nil {
+		return fmt.Errorf("failed to write dead-letter log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"server/internal/config"
+	"server/internal/metrics"
+	"server/internal/models"
+)
+
+// Names of the built-in notifiers
+const (
+	NotifierTelegram = "telegram"
+	NotifierDiscord  = "discord"
+)
+
+var (
+	notificationsSent   = metrics.NewCounter("seedventure_notifier_deliveries_total", "Number of notifications sent to services outside the app")
+	notificationsFailed = metrics.NewCounter("seedventure_notifier_failures_total", "Number of notifications that could not be sent to services outside the app")
+)
+
+// ErrInvalidTarget is returned for alert targets that cannot be notified
+var ErrInvalidTarget = errors.New("invalid alert target")
+
+// Notifier sends notifications to a service outside the app
+type Notifier interface {
+	// Validate checks a target before alerts are bound to it
+	Validate(cfg config.NotifiersConfig, target string) error
+	// Send delivers a notification to a target
+	Send(ctx context.Context, client *http.Client, cfg config.NotifiersConfig, target string, notification models.Notification) error
+}
+
+var (
+	notifiersLock sync.RWMutex
+	notifiers     = make(map[string]Notifier)
+)
+
+func init() {
+	RegisterNotifier(NotifierTelegram, telegram{})
+	RegisterNotifier(NotifierDiscord, discord{})
+}
+
+// RegisterNotifier makes a notifier available under name, to be selected by alert
+// targets. It panics if the name is empty or already taken, or notifier is nil.
+func RegisterNotifier(name string, notifier Notifier) {
+	notifiersLock.Lock()
+	defer notifiersLock.Unlock()
+
+	if name == "" {
+		panic("events: RegisterNotifier with empty name")
+	}
+	if notifier == nil {
+		panic("events: RegisterNotifier with nil notifier for " + name)
+	}
+	if _, ok := notifiers[name]; ok {
+		panic("events: RegisterNotifier called twice for " + name)
+	}
+	notifiers[name] = notifier
+}
+
+// NotifierNames returns the names of all registered notifiers, sorted
+func NotifierNames() []string {
+	notifiersLock.RLock()
+	defer notifiersLock.RUnlock()
+
+	names := make([]string, 0, len(notifiers))
+	for name := range notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getNotifier returns the notifier registered under name
+func getNotifier(name string) (Notifier, bool) {
+	notifiersLock.RLock()
+	defer notifiersLock.RUnlock()
+	notifier, ok := notifiers[name]
+	return notifier, ok
+}
+
+// Notifiers sends notifications to alert targets with the notifiers of the configuration,
+// which is looked up for every notification so reloaded settings apply immediately
+type Notifiers struct {
+	configStore *config.Store
+	client      *http.Client
+}
+
+// NewNotifiers creates a sender of notifications to alert targets
+func NewNotifiers(configStore *config.Store) *Notifiers {
+	return &Notifiers{configStore: configStore, client: &http.Client{}}
+}
+
+// Validate checks that a target can be notified
+func (n *Notifiers) Validate(target models.AlertTarget) error {
+	notifier, ok := getNotifier(target.Notifier)
+	if !ok {
+		return fmt.Errorf("%w: notifier must be one of %s, got %q", ErrInvalidTarget, strings.Join(NotifierNames(), ", "), target.Notifier)
+	}
+	if err := notifier.Validate(n.configStore.Get().Events.Notifiers, target.Target); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidTarget, target.Notifier, err)
+	}
+	return nil
+}
+
+// Send delivers a notification to a target in the background, giving up after the
+// timeout of webhook deliveries. Failures are logged, not retried.
+func (n *Notifiers) Send(target models.AlertTarget, notification models.Notification) {
+	cfg := n.configStore.Get().Events
+	notifier, ok := getNotifier(target.Notifier)
+	if !ok {
+		notificationsFailed.Inc()
+		log.Printf("Error sending notification %q: unknown notifier %s", notification.Title, target.Notifier)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+		defer cancel()
+		if err := notifier.Send(ctx, n.client, cfg.Notifiers, target.Target, notification); err != nil {
+			notificationsFailed.Inc()
+			log.Printf("Error sending notification %q to %s: %v", notification.Title, target.Notifier, err)
+			return
+		}
+		notificationsSent.Inc()
+	}()
+}
+
+// postJSON posts a JSON body, failing unless the response is a success
+func postJSON(ctx context.Context, client *http.Client, endpoint string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Leave out the URL, which holds the secret of Telegram bots and Discord webhooks
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notificationText is the plain text of a notification sent to chats
+func notificationText(notification models.Notification) string {
+	if notification.Message == "" {
+		return notification.Title
+	}
+	return notification.Title + "\n" + notification.Message
+}
+
+// telegramAPI is the Bot API of Telegram
+const telegramAPI = "https://api.telegram.org"
+
+// telegramChat matches numeric chat IDs and public channel usernames
+var telegramChat = regexp.MustCompile(`^(-?[0-9]{1,20}|@[A-Za-z][A-Za-z0-9_]{4,31})$`)
+
+// telegram sends notifications with the configured bot to a chat, given by its ID
+type telegram struct{}
+
+func (telegram) Validate(cfg config.NotifiersConfig, target string) error {
+	if cfg.TelegramBotToken == "" {
+		return errors.New("not enabled on this server")
+	}
+	if !telegramChat.MatchString(target) {
+		return errors.New("target must be a chat ID or @channel")
+	}
+	return nil
+}
+
+func (telegram) Send(ctx context.Context, client *http.Client, cfg config.NotifiersConfig, target string, notification models.Notification) error {
+	if cfg.TelegramBotToken == "" {
+		return errors.New("not enabled on this server")
+	}
+	body := map[string]string{"chat_id": target, "text": notificationText(notification)}
+	return postJSON(ctx, client, telegramAPI+"/bot"+cfg.TelegramBotToken+"/sendMessage", body)
+}
+
+// discordHosts are the hosts of Discord webhooks, other URLs are rejected so players can't
+// make the server post to arbitrary addresses
+var discordHosts = map[string]bool{
+	"discord.com":        true,
+	"discordapp.com":     true,
+	"ptb.discord.com":    true,
+	"canary.discord.com": true,
+}
+
+// discord sends notifications to a Discord webhook, given by its URL
+type discord struct{}
+
+func (discord) Validate(cfg config.NotifiersConfig, target string) error {
+	if !cfg.Discord {
+		return errors.New("not enabled on this server")
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "https" || !discordHosts[u.Host] || !strings.HasPrefix(u.Path, "/api/webhooks/") {
+		return errors.New("target must be a Discord webhook URL, https://discord.com/api/webhooks/...")
+	}
+	return nil
+}
+
+func (d discord) Send(ctx context.Context, client *http.Client, cfg config.NotifiersConfig, target string, notification models.Notification) error {
+	if err := d.Validate(cfg, target); err != nil {
+		return err
+	}
+	return postJSON(ctx, client, target, map[string]string{"content": notificationText(notification)})
+}
@@ -0,0 +1,350 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"server/internal/config"
+	"server/internal/metrics"
+	"server/internal/models"
+	"server/internal/version"
+)
+
+// webhookQueueSize is the number of deliveries waiting per endpoint, further ones are dropped
+const webhookQueueSize = 1024
+
+var (
+	webhooksDelivered = metrics.NewCounter("seedventure_webhook_deliveries_total", "Number of events delivered to webhooks")
+	webhooksFailed    = metrics.NewCounter("seedventure_webhook_failures_total", "Number of webhook deliveries that failed")
+	webhooksDropped   = metrics.NewCounter("seedventure_webhook_dropped_total", "Number of events dropped because a webhook could not keep up")
+	webhookRetries    = metrics.NewCounter("seedventure_webhook_retries_total", "Number of webhook delivery attempts that were retried")
+)
+
+// Headers added to every delivery
+const (
+	DeliveryHeader  = "X-Seedventure-Delivery"  // ID of the delivery, the same for all its attempts
+	SignatureHeader = "X-Seedventure-Signature" // See Sign
+)
+
+var (
+	// ErrWebhookNotConfigured is returned when replaying to a URL no longer configured
+	ErrWebhookNotConfigured = errors.New("webhook is no longer configured")
+	// ErrReplayFailed is returned when a replayed delivery fails again
+	ErrReplayFailed = errors.New("replay failed")
+)
+
+// delivery is an event waiting to be posted to a webhook
+type delivery struct {
+	webhook config.WebhookConfig
+	message models.UpdateMessage
+	at      time.Time
+}
+
+// endpoint delivers the events of one webhook URL in order
+type endpoint struct {
+	url   string
+	queue chan delivery
+}
+
+// Dispatcher posts candle events to the webhooks of the configuration. Every webhook
+// URL has a goroutine of its own, so a slow endpoint doesn't delay the others.
+type Dispatcher struct {
+	configStore *config.Store
+	deadLetters *DeadLetterLog
+	client      *http.Client
+
+	lock      sync.Mutex
+	endpoints map[string]*endpoint
+}
+
+// NewDispatcher creates a dispatcher for the webhooks of the configuration, which
+// are looked up for every event so reloaded webhooks apply immediately
+func NewDispatcher(configStore *config.Store, deadLetters *DeadLetterLog) *Dispatcher {
+	return &Dispatcher{
+		configStore: configStore,
+		deadLetters: deadLetters,
+		client:      &http.Client{},
+		endpoints:   make(map[string]*endpoint),
+	}
+}
+
+// OnUpdate queues a candle update for the webhooks subscribed to it. It never blocks,
+// events are dropped if a webhook can't keep up.
+func (d *Dispatcher) OnUpdate(message models.UpdateMessage) {
+	webhooks := d.configStore.Get().Events.Webhooks
+	if len(webhooks) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, webhook := range webhooks {
+		if !subscribed(webhook, message) {
+			continue
+		}
+		select {
+		case d.endpoint(webhook.URL).queue <- delivery{webhook: webhook, message: message, at: now}:
+		default:
+			webhooksDropped.Inc()
+		}
+	}
+}
+
+// subscribed reports whether a webhook wants an update
+func subscribed(webhook config.WebhookConfig, message models.UpdateMessage) bool {
+	if len(webhook.TimeFrames) > 0 && !containsTimeFrame(webhook.TimeFrames, message.TimeFrame) {
+		return false
+	}
+	if len(webhook.Types) > 0 && !containsString(webhook.Types, message.EventType()) {
+		return false
+	}
+	return true
+}
+
+// endpoint returns the endpoint of a URL, starting its goroutine on first use
+func (d *Dispatcher) endpoint(url string) *endpoint {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	e, ok := d.endpoints[url]
+	if !ok {
+		e = &endpoint{url: url, queue: make(chan delivery, webhookQueueSize)}
+		d.endpoints[url] = e
+		go d.deliver(e)
+	}
+	return e
+}
+
+// deliver posts the queued events of an endpoint one after another. Failed attempts are
+// retried with exponential backoff, deliveries failing on every attempt are dead-lettered.
+func (d *Dispatcher) deliver(e *endpoint) {
+	for item := range e.queue {
+		cfg := d.configStore.Get()
+		body, header, err := encode(cfg, item)
+		if err != nil {
+			webhooksFailed.Inc()
+			log.Printf("Error encoding %s for webhook %s: %v", item.message.EventType(), e.url, err)
+			continue
+		}
+
+		letter := models.DeadLetter{
+			ID:           newEventID(),
+			URL:          e.url,
+			EventType:    item.message.EventType(),
+			Body:         body,
+			FirstAttempt: time.Now().UnixMilli(),
+		}
+		for attempt := 1; ; attempt++ {
+			err = d.send(item.webhook, letter.ID, header, body)
+			if err == nil || !retryable(err) || attempt >= cfg.Events.MaxAttempts {
+				letter.Attempts = attempt
+				break
+			}
+			webhookRetries.Inc()
+			time.Sleep(backoff(cfg.Events, attempt))
+			cfg = d.configStore.Get()
+		}
+
+		if err == nil {
+			webhooksDelivered.Inc()
+			continue
+		}
+		webhooksFailed.Inc()
+		log.Printf("Error delivering %s to webhook %s after %d attempts: %v", letter.EventType, e.url, letter.Attempts, err)
+
+		letter.Headers = flattenHeader(header)
+		letter.Error = err.Error()
+		letter.LastAttempt = time.Now().UnixMilli()
+		if err := d.deadLetters.Add(letter, cfg.Events.DeadLetterLimit); err != nil {
+			log.Printf("Error saving dead letter %s: %v", letter.ID, err)
+		}
+	}
+}
+
+// send makes one attempt to post a delivery to a webhook, signed with the webhook's secret
+func (d *Dispatcher) send(webhook config.WebhookConfig, id string, header http.Header, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d.configStore.Get().Events.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = header.Clone()
+	req.Header.Set("User-Agent", "Seedventure/"+version.Version)
+	req.Header.Set(DeliveryHeader, id)
+	if webhook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(webhook.Secret, time.Now().Unix(), body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return statusError{code: resp.StatusCode, status: resp.Status}
+	}
+	return nil
+}
+
+// Replay posts a dead-lettered delivery again, once, with the current secret of its
+// webhook. It is removed from the dead-letter log if it succeeds.
+func (d *Dispatcher) Replay(id string) error {
+	letter, err := d.deadLetters.Get(id)
+	if err != nil {
+		return err
+	}
+	webhook, ok := d.webhook(letter.URL)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrWebhookNotConfigured, letter.URL)
+	}
+
+	header := http.Header{}
+	for name, value := range letter.Headers {
+		header.Set(name, value)
+	}
+	if err := d.send(webhook, letter.ID, header, letter.Body); err != nil {
+		letter.Attempts++
+		letter.Error = err.Error()
+		letter.LastAttempt = time.Now().UnixMilli()
+		if err := d.deadLetters.Update(letter); err != nil {
+			log.Printf("Error saving dead letter %s: %v", letter.ID, err)
+		}
+		return fmt.Errorf("%w: %v", ErrReplayFailed, err)
+	}
+
+	webhooksDelivered.Inc()
+	log.Printf("Replayed dead letter %s to webhook %s", letter.ID, letter.URL)
+	return d.deadLetters.Remove(letter.ID)
+}
+
+// DeadLetters returns the dead-letter log of the dispatcher
+func (d *Dispatcher) DeadLetters() *DeadLetterLog {
+	return d.deadLetters
+}
+
+// webhook returns the configured webhook with a URL
+func (d *Dispatcher) webhook(url string) (config.WebhookConfig, bool) {
+	for _, webhook := range d.configStore.Get().Events.Webhooks {
+		if webhook.URL == url {
+			return webhook, true
+		}
+	}
+	return config.WebhookConfig{}, false
+}
+
+// Sign returns the signature header of a delivery: the Unix time it was signed at and
+// the hex HMAC-SHA256 of "<time>.<body>", e.g. "t=1700000000,v1=5257a869...". Receivers
+// recompute the HMAC with the shared secret and reject old timestamps to prevent replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// statusError is a webhook response with a status other than 2xx
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e statusError) Error() string {
+	return "unexpected status " + e.status
+}
+
+// retryable reports whether a failed attempt may succeed when repeated. Client errors
+// other than timeouts and rate limiting won't.
+func retryable(err error) bool {
+	var status statusError
+	if !errors.As(err, &status) {
+		return true
+	}
+	return status.code == http.StatusRequestTimeout || status.code == http.StatusTooManyRequests || status.code >= 500
+}
+
+// backoff returns the pause after a failed attempt, doubling with every attempt up to
+// the configured maximum. Up to half of it is random, so endpoints coming back up
+// don't get all retries at once.
+func backoff(cfg config.EventsConfig, attempt int) time.Duration {
+	wait := cfg.RetryBackoff
+	for i := 1; i < attempt && wait < cfg.MaxRetryBackoff; i++ {
+		wait *= 2
+	}
+	if wait > cfg.MaxRetryBackoff {
+		wait = cfg.MaxRetryBackoff
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// flattenHeader returns the first value of every header
+func flattenHeader(header http.Header) map[string]string {
+	flat := make(map[string]string, len(header))
+	for name := range header {
+		flat[name] = header.Get(name)
+	}
+	return flat
+}
+
+// encode returns the body and headers of a delivery in the format of its webhook
+func encode(cfg *config.Config, item delivery) ([]byte, http.Header, error) {
+	if item.webhook.Format == config.FormatJSON {
+		body, err := models.Marshal(item.message)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to encode update: %w", err)
+		}
+		header := http.Header{}
+		header.Set("Content-Type", contentTypeJSON)
+		return body, header, nil
+	}
+
+	source := cfg.Events.Source
+	if source == "" {
+		source = DefaultSource(cfg.Simulation.Symbol)
+	}
+	event, err := NewCloudEvent(source, cfg.Simulation.Symbol, item.message, item.at)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if item.webhook.Format == config.FormatCloudEventsBinary {
+		body, header := binaryRequest(event)
+		return body, header, nil
+	}
+	return structuredRequest(event)
+}
+
+// containsTimeFrame reports whether timeFrames contains tf
+func containsTimeFrame(timeFrames []models.TimeFrame, tf models.TimeFrame) bool {
+	for _, candidate := range timeFrames {
+		if candidate == tf {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString reports whether values contains v
+func containsString(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,243 @@
+package follow
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"server/internal/metrics"
+	"server/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	pingInterval = 30 * time.Second // Primaries don't ping, so followers do to notice dead connections
+	readTimeout  = 2 * pingInterval
+	writeWait    = 10 * time.Second
+)
+
+var (
+	primaryUpdates    = metrics.NewCounter("seedventure_follow_updates_total", "Number of candle updates received from the primary")
+	primarySyncs      = metrics.NewCounter("seedventure_follow_syncs_total", "Number of times the history was copied from the primary")
+	primaryReconnects = metrics.NewCounter("seedventure_follow_reconnects_total", "Number of times the connection to the primary was re-established")
+)
+
+// Handler receives the data of the primary. Its methods are called from a single goroutine.
+type Handler interface {
+	// Sync replaces the history of all timeframes with the primary's. The 1-minute
+	// history ends with the primary's current candle, if it has one.
+	Sync(history map[models.TimeFrame][]models.CandleData)
+	// Update applies a 1-minute candle update of the primary
+	Update(message models.UpdateMessage)
+}
+
+// Primary mirrors another Seedventure server: it copies the history over HTTP and then
+// follows the live 1-minute stream, copying the history again whenever the primary
+// reloads its data or the connection is re-established
+type Primary struct {
+	url            string
+	apiKey         string
+	reconnectDelay time.Duration
+	client         *http.Client
+	connected      atomic.Bool
+	stop           chan struct{}
+}
+
+// NewPrimary creates a follower of the server at the base URL primaryURL. apiKey is
+// sent with every request if not empty.
+func NewPrimary(primaryURL, apiKey string, reconnectDelay time.Duration) *Primary {
+	p := &Primary{
+		url:            strings.TrimSuffix(primaryURL, "/"),
+		apiKey:         apiKey,
+		reconnectDelay: reconnectDelay,
+		client:         &http.Client{Timeout: time.Minute},
+		stop:           make(chan struct{}),
+	}
+	metrics.NewGaugeFunc("seedventure_follow_connected", "Whether the primary is connected", func() float64 {
+		if p.connected.Load() {
+			return 1
+		}
+		return 0
+	})
+	return p
+}
+
+// Connected reports whether the live stream of the primary is connected
+func (p *Primary) Connected() bool {
+	return p.connected.Load()
+}
+
+// Run passes the primary's data to handler until Close is called
+func (p *Primary) Run(handler Handler) {
+	for {
+		err := p.consume(handler)
+		p.connected.Store(false)
+
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		log.Printf("Lost primary %s, reconnecting in %s: %v", p.url, p.reconnectDelay, err)
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(p.reconnectDelay):
+		}
+		primaryReconnects.Inc()
+	}
+}
+
+// Close stops following the primary
+func (p *Primary) Close() {
+	close(p.stop)
+}
+
+// consume follows the primary over one connection until it fails
+func (p *Primary) consume(handler Handler) error {
+	streamURL, err := p.streamURL()
+	if err != nil {
+		return err
+	}
+
+	// Connect before copying the history, so no update between the two is missed.
+	// Updates already contained in the history are skipped by the handler.
+	conn, _, err := websocket.DefaultDialer.Dial(streamURL, p.header())
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+
+	// Unblock the read below when following stops, and keep the connection alive
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				conn.Close()
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+			}
+		}
+	}()
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(readTimeout))
+	})
+
+	if err := p.sync(handler); err != nil {
+		return err
+	}
+	p.connected.Store(true)
+	log.Printf("Following primary %s", p.url)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		var message struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(data, &message); err != nil {
+			return fmt.Errorf("invalid message from primary: %w", err)
+		}
+
+		switch message.Type {
+		case "new", "update":
+			var update models.UpdateMessage
+			if err := json.Unmarshal(data, &update); err != nil {
+				return fmt.Errorf("invalid update from primary: %w", err)
+			}
+			if update.TimeFrame == models.TimeFrame1Min {
+				primaryUpdates.Inc()
+				handler.Update(update)
+			}
+		case "reload":
+			// The primary swapped its dataset, which is copied as a whole
+			if err := p.sync(handler); err != nil {
+				return err
+			}
+		}
+		// Histories and status messages carry nothing the follower needs
+	}
+}
+
+// sync copies the history of every timeframe from the primary
+func (p *Primary) sync(handler Handler) error {
+	history := make(map[models.TimeFrame][]models.CandleData)
+	for _, tf := range models.AllTimeFrames() {
+		candles, err := p.history(tf)
+		if err != nil {
+			return fmt.Errorf("failed to copy %s history: %w", tf, err)
+		}
+		history[tf] = candles
+	}
+
+	handler.Sync(history)
+	primarySyncs.Inc()
+	return nil
+}
+
+// history fetches the history of a timeframe from the primary
+func (p *Primary) history(tf models.TimeFrame) ([]models.CandleData, error) {
+	req, err := http.NewRequest(http.MethodGet, p.url+"/api/prices/history?timeframe="+url.QueryEscape(string(tf)), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = p.header()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var data models.TimeFrameData
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("invalid history: %w", err)
+	}
+	return data.Candles, nil
+}
+
+// header returns the headers of requests to the primary
+func (p *Primary) header() http.Header {
+	header := http.Header{}
+	if p.apiKey != "" {
+		header.Set("X-API-Key", p.apiKey)
+	}
+	return header
+}
+
+// streamURL returns the WebSocket URL of the primary's 1-minute stream
+func (p *Primary) streamURL() (string, error) {
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/prices/live/" + string(models.TimeFrame1Min)
+	return u.String(), nil
+}
@@ -0,0 +1,114 @@
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"server/internal/metrics"
+)
+
+// pruneInterval is how often expired responses are dropped
+const pruneInterval = time.Minute
+
+var (
+	// ErrInProgress is returned for a key whose first request hasn't been answered yet
+	ErrInProgress = errors.New("a request with this idempotency key is in progress")
+	// ErrMismatch is returned when a key is reused for a different request
+	ErrMismatch = errors.New("idempotency key was used for a different request")
+)
+
+var replays = metrics.NewCounter("seedventure_idempotent_replays_total", "Number of responses replayed for repeated idempotency keys")
+
+// Response is a response kept for replaying
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// entry is the state of one idempotency key
+type entry struct {
+	fingerprint string // Identifies the request, so a reused key is noticed
+	done        bool
+	response    Response
+	expires     time.Time
+}
+
+// Cache remembers the responses to requests with idempotency keys for ttl, so retries
+// of a request get the original response instead of performing it again
+type Cache struct {
+	ttl time.Duration
+
+	lock      sync.Mutex
+	entries   map[string]*entry // By key, scoped to the client by the caller
+	lastPrune time.Time
+}
+
+// NewCache creates an empty cache keeping responses for ttl
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:       ttl,
+		entries:   make(map[string]*entry),
+		lastPrune: time.Now(),
+	}
+}
+
+// Begin starts a request with key. It returns the original response if the request was
+// answered before, or nil if the caller must perform it and call Finish or Abort.
+func (c *Cache) Begin(key, fingerprint string) (*Response, error) {
+	now := time.Now()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if now.Sub(c.lastPrune) >= pruneInterval {
+		c.pruneLocked(now)
+	}
+
+	e, ok := c.entries[key]
+	if !ok || now.After(e.expires) {
+		c.entries[key] = &entry{fingerprint: fingerprint, expires: now.Add(c.ttl)}
+		return nil, nil
+	}
+	if e.fingerprint != fingerprint {
+		return nil, ErrMismatch
+	}
+	if !e.done {
+		return nil, ErrInProgress
+	}
+	replays.Inc()
+	response := e.response
+	return &response, nil
+}
+
+// Finish stores the response to the request started with key
+func (c *Cache) Finish(key string, response Response) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.done = true
+		e.response = response
+		e.expires = time.Now().Add(c.ttl)
+	}
+}
+
+// Abort forgets the request started with key, so it can be tried again
+func (c *Cache) Abort(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.entries, key)
+}
+
+// pruneLocked drops expired responses. Requires c.lock.
+func (c *Cache) pruneLocked(now time.Time) {
+	for key, e := range c.entries {
+		if e.done && now.After(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+	c.lastPrune = now
+}
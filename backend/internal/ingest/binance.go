@@ -0,0 +1,179 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"server/internal/metrics"
+
+	"github.com/gorilla/websocket"
+)
+
+// readTimeout closes feeds that stopped sending. Binance pings every 3 minutes
+// and busy symbols trade far more often.
+const readTimeout = 5 * time.Minute
+
+var (
+	tradesReceived  = metrics.NewCounter("seedventure_ingest_trades_total", "Number of trades received from the exchange feed")
+	feedReconnects  = metrics.NewCounter("seedventure_ingest_reconnects_total", "Number of times the exchange feed was reconnected")
+	feedParseErrors = metrics.NewCounter("seedventure_ingest_parse_errors_total", "Number of feed messages that could not be parsed")
+)
+
+// Trade is a single trade of the ingested symbol
+type Trade struct {
+	Price    float64
+	Quantity float64
+	Time     int64 // Trade time in milliseconds
+}
+
+// binanceTrade is a message of a Binance trade or aggTrade stream. Keys only differing
+// in case need a field each, encoding/json would match them case-insensitively otherwise.
+type binanceTrade struct {
+	EventType string `json:"e"`
+	EventTime int64  `json:"E"`
+	TradeID   int64  `json:"t"`
+	Price     string `json:"p"`
+	Quantity  string `json:"q"`
+	TradeTime int64  `json:"T"`
+	Maker     bool   `json:"m"`
+	Ignore    bool   `json:"M"`
+}
+
+// Feed consumes a Binance trade stream, reconnecting whenever the connection is lost
+type Feed struct {
+	url            string
+	reconnectDelay time.Duration
+	connected      atomic.Bool
+	stop           chan struct{}
+}
+
+// NewFeed creates a feed reading the trade stream at url
+func NewFeed(url string, reconnectDelay time.Duration) *Feed {
+	f := &Feed{
+		url:            url,
+		reconnectDelay: reconnectDelay,
+		stop:           make(chan struct{}),
+	}
+	metrics.NewGaugeFunc("seedventure_ingest_connected", "Whether the exchange feed is connected", func() float64 {
+		if f.connected.Load() {
+			return 1
+		}
+		return 0
+	})
+	return f
+}
+
+// Connected reports whether the feed is currently connected
+func (f *Feed) Connected() bool {
+	return f.connected.Load()
+}
+
+// Run calls handle with every trade until Close is called. handle is called from a single goroutine.
+func (f *Feed) Run(handle func(Trade)) {
+	for {
+		err := f.consume(handle)
+		f.connected.Store(false)
+
+		select {
+		case <-f.stop:
+			return
+		default:
+		}
+
+		log.Printf("Exchange feed disconnected, reconnecting in %s: %v", f.reconnectDelay, err)
+		select {
+		case <-f.stop:
+			return
+		case <-time.After(f.reconnectDelay):
+		}
+		feedReconnects.Inc()
+	}
+}
+
+// Close stops the feed
+func (f *Feed) Close() {
+	close(f.stop)
+}
+
+// consume reads trades from one connection until it fails
+func (f *Feed) consume(handle func(Trade)) error {
+	conn, _, err := websocket.DefaultDialer.Dial(f.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+
+	// Unblock the read below when the feed is closed
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-f.stop:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	// Answering pings is done by gorilla's default handler, which
+	// runs during ReadMessage and must extend the deadline as well
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	f.connected.Store(true)
+	log.Printf("Connected to exchange feed %s", f.url)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		_, p, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		trade, err := parseTrade(p)
+		if err != nil {
+			feedParseErrors.Inc()
+			log.Printf("Error parsing exchange feed message: %v", err)
+			continue
+		}
+		tradesReceived.Inc()
+		handle(trade)
+	}
+}
+
+// parseTrade decodes a trade or aggTrade event. Events of combined streams are
+// wrapped in {"stream": ..., "data": ...}.
+func parseTrade(p []byte) (Trade, error) {
+	var wrapper struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(p, &wrapper); err != nil {
+		return Trade{}, err
+	}
+	if wrapper.Data != nil {
+		p = wrapper.Data
+	}
+
+	var msg binanceTrade
+	if err := json.Unmarshal(p, &msg); err != nil {
+		return Trade{}, err
+	}
+	if msg.EventType != "trade" && msg.EventType != "aggTrade" {
+		return Trade{}, fmt.Errorf("unexpected event type %q", msg.EventType)
+	}
+
+	price, err := strconv.ParseFloat(msg.Price, 64)
+	if err != nil || price <= 0 {
+		return Trade{}, fmt.Errorf("invalid price %q", msg.Price)
+	}
+	quantity, err := strconv.ParseFloat(msg.Quantity, 64)
+	if err != nil || quantity < 0 {
+		return Trade{}, fmt.Errorf("invalid quantity %q", msg.Quantity)
+	}
+	return Trade{Price: price, Quantity: quantity, Time: msg.TradeTime}, nil
+}
@@ -0,0 +1,123 @@
+package loadtest
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Candle broadcasts start with their type, unlike the history a client gets on connecting
+var (
+	newPrefix    = []byte(`{"type":"new"`)
+	updatePrefix = []byte(`{"type":"update"`)
+)
+
+// clientStats is what one synthetic client observed of the candle broadcasts
+type clientStats struct {
+	interrupted atomic.Bool // Set once the client lost its connection or failed to connect
+
+	lock      sync.Mutex
+	connected time.Time   // When the current connection was established
+	last      string      // Last broadcast received, the same update can be sent twice in a row
+	seen      []time.Time // When the broadcasts received were first seen by any client
+}
+
+// connect starts tracking a new connection of a client
+func (stats *clientStats) connect(connected time.Time) {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	stats.connected = connected
+	stats.last = ""
+	stats.seen = stats.seen[:0]
+}
+
+// deliveries tracks when every candle broadcast first reached a client. Delivery latency
+// is measured from then, as messages carry no server time; it shows how evenly the server
+// fans out rather than the network latency.
+type deliveries struct {
+	latency *samples
+
+	lock      sync.Mutex
+	firstSeen map[string]time.Time
+	closed    time.Time // When the clients were told to stop
+}
+
+// newDeliveries creates an empty delivery tracker
+func newDeliveries() *deliveries {
+	return &deliveries{latency: newSamples(), firstSeen: make(map[string]time.Time)}
+}
+
+// received records a message a client received on the connection established at connected
+func (d *deliveries) received(data []byte, connected time.Time, stats *clientStats) {
+	if !bytes.HasPrefix(data, newPrefix) && !bytes.HasPrefix(data, updatePrefix) {
+		return
+	}
+	now := time.Now()
+	key := string(data)
+
+	d.lock.Lock()
+	first, ok := d.firstSeen[key]
+	if !ok && d.closed.IsZero() {
+		first = now
+		d.firstSeen[key] = now
+	}
+	d.lock.Unlock()
+	if first.IsZero() {
+		return
+	}
+	d.latency.add(now.Sub(first))
+
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	if key != stats.last && !first.Before(connected) {
+		stats.seen = append(stats.seen, first)
+	}
+	stats.last = key
+}
+
+// close stops tracking new broadcasts
+func (d *deliveries) close() {
+	d.lock.Lock()
+	d.closed = time.Now()
+	d.lock.Unlock()
+}
+
+// broadcasts returns the number of distinct candle broadcasts received
+func (d *deliveries) broadcasts() int64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return int64(len(d.firstSeen))
+}
+
+// lost counts the broadcasts clients that stayed connected throughout missed, and how
+// many they should have received. Clients are expected to receive every broadcast first
+// seen while they were connected, except for the last lossGrace that may still have been
+// in flight.
+func (d *deliveries) lost(clients []*clientStats) (lost, expected int64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	until := d.closed.Add(-lossGrace)
+
+	for _, stats := range clients {
+		if stats.interrupted.Load() {
+			continue
+		}
+		stats.lock.Lock()
+		if !stats.connected.IsZero() {
+			for _, first := range d.firstSeen {
+				if !first.Before(stats.connected) && !first.After(until) {
+					expected++
+					lost++
+				}
+			}
+			for _, first := range stats.seen {
+				if !first.After(until) {
+					lost--
+				}
+			}
+		}
+		stats.lock.Unlock()
+	}
+	return lost, expected
+}
@@ -0,0 +1,223 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"server/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// Options configures a load test run
+type Options struct {
+	BaseURL      string           // Server to test, e.g. http://localhost:8080
+	Clients      int              // Number of WebSocket clients
+	Pollers      int              // Number of REST clients polling the history
+	Duration     time.Duration    // How long to generate load
+	PollInterval time.Duration    // Pause between requests of a single poller
+	TimeFrame    models.TimeFrame // Timeframe clients subscribe to and pollers request
+	Reconnect    bool             // Whether clients reconnect when the server closes their connection
+}
+
+// lossGrace is how long before the end of a test broadcasts still have to reach every
+// client to count as lost, as the last ones may be in flight when the clients stop
+const lossGrace = time.Second
+
+// Run generates load against the server and reports what the clients observed
+func Run(opts Options) (*Report, error) {
+	wsURL, err := websocketURL(opts.BaseURL, opts.TimeFrame)
+	if err != nil {
+		return nil, err
+	}
+	historyURL := strings.TrimSuffix(opts.BaseURL, "/") + "/api/prices/history?timeframe=" + url.QueryEscape(string(opts.TimeFrame))
+
+	var (
+		wg       sync.WaitGroup
+		stop     = make(chan struct{})
+		counters counters
+		connects = newSamples()
+		requests = newSamples()
+		delivery = newDeliveries()
+		clients  = make([]*clientStats, opts.Clients)
+	)
+
+	for i := range clients {
+		clients[i] = &clientStats{}
+		wg.Add(1)
+		go func(stats *clientStats) {
+			defer wg.Done()
+			runClient(wsURL, opts.Reconnect, stop, &counters, connects, delivery, stats)
+		}(clients[i])
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	for i := 0; i < opts.Pollers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runPoller(client, historyURL, opts.PollInterval, stop, &counters, requests)
+		}()
+	}
+
+	start := time.Now()
+	time.Sleep(opts.Duration)
+	delivery.close()
+	close(stop)
+	wg.Wait()
+	elapsed := time.Since(start)
+	lost, expected := delivery.lost(clients)
+
+	return &Report{
+		Duration:       elapsed,
+		Clients:        opts.Clients,
+		ConnectErrors:  counters.connectErrors.Load(),
+		Dropped:        counters.dropped.Load(),
+		Messages:       counters.messages.Load(),
+		MessageBytes:   counters.messageBytes.Load(),
+		Reconnects:     counters.reconnects.Load(),
+		ConnectLatency: connects.percentiles(),
+		Broadcasts:     delivery.broadcasts(),
+		Lost:           lost,
+		Expected:       expected,
+		Latency:        delivery.latency.percentiles(),
+		Pollers:        opts.Pollers,
+		Requests:       counters.requests.Load(),
+		RequestErrors:  counters.requestErrors.Load(),
+		RequestLatency: requests.percentiles(),
+	}, nil
+}
+
+// counters are shared by all synthetic clients
+type counters struct {
+	connectErrors atomic.Int64
+	dropped       atomic.Int64 // Connections closed before the test ended
+	reconnects    atomic.Int64
+	messages      atomic.Int64
+	messageBytes  atomic.Int64
+	requests      atomic.Int64
+	requestErrors atomic.Int64
+}
+
+// runClient holds a WebSocket connection open and counts the messages it receives until
+// stop is closed, reconnecting if the server closes it and reconnect is set
+func runClient(wsURL string, reconnect bool, stop <-chan struct{}, c *counters, connects *samples, delivery *deliveries, stats *clientStats) {
+	for connected := false; ; {
+		retry, ok := connectClient(wsURL, stop, c, connects, delivery, stats)
+		if ok && connected {
+			c.reconnects.Add(1)
+		}
+		connected = connected || ok
+		if !retry || !reconnect {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// connectClient holds one WebSocket connection open until stop is closed. It reports
+// whether it failed to connect or the server closed the connection first, and whether
+// it connected at all.
+func connectClient(wsURL string, stop <-chan struct{}, c *counters, connects *samples, delivery *deliveries, stats *clientStats) (bool, bool) {
+	start := time.Now()
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		c.connectErrors.Add(1)
+		stats.interrupted.Store(true)
+		return true, false
+	}
+	connects.add(time.Since(start))
+	connected := time.Now()
+	stats.connect(connected)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.messages.Add(1)
+			c.messageBytes.Add(int64(len(data)))
+			delivery.received(data, connected, stats)
+		}
+	}()
+
+	select {
+	case <-stop:
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+			time.Now().Add(time.Second))
+		conn.Close()
+		<-closed
+		return false, true
+	case <-closed:
+		c.dropped.Add(1)
+		stats.interrupted.Store(true)
+		conn.Close()
+		return true, true
+	}
+}
+
+// runPoller requests the history repeatedly until stop is closed
+func runPoller(client *http.Client, historyURL string, interval time.Duration, stop <-chan struct{}, c *counters, requests *samples) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		start := time.Now()
+		resp, err := client.Get(historyURL)
+		if err == nil {
+			_, err = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if err == nil && resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("unexpected status %s", resp.Status)
+			}
+		}
+		c.requests.Add(1)
+		if err != nil {
+			c.requestErrors.Add(1)
+		} else {
+			requests.add(time.Since(start))
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// websocketURL derives the live price endpoint from the server's base URL
+func websocketURL(baseURL string, timeFrame models.TimeFrame) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL %q: %w", baseURL, err)
+	}
+
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("invalid server URL %q: scheme must be http or https", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/prices/live/" + string(timeFrame)
+	return u.String(), nil
+}
@@ -0,0 +1,121 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Percentiles summarizes a latency distribution
+type Percentiles struct {
+	Count int
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// Report describes what the synthetic clients observed during a load test
+type Report struct {
+	Duration time.Duration
+
+	Clients        int
+	ConnectErrors  int64
+	Dropped        int64 // Connections the server closed before the test ended
+	Reconnects     int64 // Connections established again after being dropped
+	Messages       int64
+	MessageBytes   int64
+	ConnectLatency Percentiles
+	Broadcasts     int64       // Distinct candle broadcasts received
+	Lost           int64       // Broadcasts missed by clients that stayed connected
+	Expected       int64       // Broadcasts clients that stayed connected should have received
+	Latency        Percentiles // Delivery of broadcasts after the first client received them
+
+	Pollers        int
+	Requests       int64
+	RequestErrors  int64
+	RequestLatency Percentiles
+}
+
+// Print writes the report in a human readable form
+func (r *Report) Print(w io.Writer) {
+	seconds := r.Duration.Seconds()
+
+	fmt.Fprintf(w, "Duration:            %s\n", r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "\nWebSocket clients:   %d\n", r.Clients)
+	fmt.Fprintf(w, "  connect errors:    %d\n", r.ConnectErrors)
+	fmt.Fprintf(w, "  dropped:           %d (%.1f%%)\n", r.Dropped, percent(r.Dropped, int64(r.ConnectLatency.Count)))
+	fmt.Fprintf(w, "  reconnects:        %d\n", r.Reconnects)
+	fmt.Fprintf(w, "  messages:          %d (%.0f/s, %.1f KiB/s)\n", r.Messages, float64(r.Messages)/seconds, float64(r.MessageBytes)/1024/seconds)
+	fmt.Fprintf(w, "  connect latency:   %s\n", r.ConnectLatency)
+	fmt.Fprintf(w, "  broadcasts:        %d\n", r.Broadcasts)
+	fmt.Fprintf(w, "  lost:              %d (%.2f%%)\n", r.Lost, percent(r.Lost, r.Expected))
+	fmt.Fprintf(w, "  delivery latency:  %s\n", r.Latency)
+	fmt.Fprintf(w, "\nREST pollers:        %d\n", r.Pollers)
+	fmt.Fprintf(w, "  requests:          %d (%.0f/s)\n", r.Requests, float64(r.Requests)/seconds)
+	fmt.Fprintf(w, "  errors:            %d (%.1f%%)\n", r.RequestErrors, percent(r.RequestErrors, r.Requests))
+	fmt.Fprintf(w, "  latency:           %s\n", r.RequestLatency)
+}
+
+// String formats the percentiles on a single line
+func (p Percentiles) String() string {
+	if p.Count == 0 {
+		return "no samples"
+	}
+	return fmt.Sprintf("p50 %s, p90 %s, p99 %s, max %s",
+		p.P50.Round(time.Microsecond), p.P90.Round(time.Microsecond),
+		p.P99.Round(time.Microsecond), p.Max.Round(time.Microsecond))
+}
+
+// percent returns part as a percentage of total
+func percent(part, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
+
+// samples collects latencies from concurrent clients
+type samples struct {
+	mu        sync.Mutex
+	durations []time.Duration
+}
+
+// newSamples creates an empty sample set
+func newSamples() *samples {
+	return &samples{}
+}
+
+// add records a single latency
+func (s *samples) add(d time.Duration) {
+	s.mu.Lock()
+	s.durations = append(s.durations, d)
+	s.mu.Unlock()
+}
+
+// percentiles summarizes the recorded latencies
+func (s *samples) percentiles() Percentiles {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.durations) == 0 {
+		return Percentiles{}
+	}
+
+	sorted := make([]time.Duration, len(s.durations))
+	copy(sorted, s.durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	at := func(q float64) time.Duration {
+		return sorted[int(q*float64(len(sorted)-1))]
+	}
+	return Percentiles{
+		Count: len(sorted),
+		P50:   at(0.50),
+		P90:   at(0.90),
+		P99:   at(0.99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
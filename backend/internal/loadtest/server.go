@@ -0,0 +1,52 @@
+package loadtest
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+
+	"server/internal/api"
+	"server/internal/config"
+	"server/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+// Server is an in-process price server with the public data routes
+type Server struct {
+	*httptest.Server
+	dataDir string
+}
+
+// StartServer starts an in-process price server with generated history, using a temporary data directory
+func StartServer(cfg *config.Config) (*Server, error) {
+	dataDir, err := os.MkdirTemp("", "seedventure-loadtest-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	cfg.Data.Dir = dataDir
+
+	priceService := service.NewPriceService(cfg)
+	priceService.Initialize(1)
+	priceService.StartNewCandle()
+	go priceService.Run()
+	priceService.MarkReady()
+
+	priceHandler := api.NewPriceHandler(priceService, config.NewStore(cfg))
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/prices/history", priceHandler.HandleHistoricalData).Methods("GET")
+	r.HandleFunc("/api/prices/live", priceHandler.HandleWebsocket)
+	r.HandleFunc("/api/prices/live/{timeframe}", priceHandler.HandleWebsocketSubscribe)
+
+	return &Server{
+		Server:  httptest.NewServer(r),
+		dataDir: dataDir,
+	}, nil
+}
+
+// Close stops the server and removes its data directory
+func (s *Server) Close() {
+	s.Server.Close()
+	os.RemoveAll(s.dataDir)
+}
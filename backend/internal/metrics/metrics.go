@@ -0,0 +1,208 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	name  string
+	help  string
+	value atomic.Int64
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	name string
+	help string
+	bits atomic.Uint64
+}
+
+// FuncMetric is a gauge or counter whose value is computed when metrics are collected,
+// optionally with one sample per value of a label
+type FuncMetric struct {
+	name    string
+	help    string
+	kind    string // "gauge" or "counter"
+	label   string
+	collect func() map[string]float64
+}
+
+// metric is implemented by everything that can be exported
+type metric interface {
+	metricName() string
+	write(w io.Writer)
+}
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]metric)
+)
+
+// Shared metrics used across packages
+var (
+	PanicsRecovered = NewCounter("seedventure_panics_recovered_total", "Number of panics recovered in handlers, WebSocket goroutines and simulation loops")
+)
+
+// NewCounter creates and registers a new counter
+func NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	register(c)
+	return c
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add increments the counter by n
+func (c *Counter) Add(n int64) {
+	c.value.Add(n)
+}
+
+// Value returns the current value of the counter
+func (c *Counter) Value() int64 {
+	return c.value.Load()
+}
+
+func (c *Counter) metricName() string { return c.name }
+
+func (c *Counter) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.Value())
+}
+
+// NewGauge creates and registers a new gauge
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	register(g)
+	return g
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Value returns the current value of the gauge
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+func (g *Gauge) metricName() string { return g.name }
+
+func (g *Gauge) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", g.name, g.help, g.name, g.name, g.Value())
+}
+
+// NewGaugeFunc creates and registers a gauge computed by fn on every collection
+func NewGaugeFunc(name, help string, fn func() float64) *FuncMetric {
+	return newFuncMetric(name, help, "gauge", "", func() map[string]float64 {
+		return map[string]float64{"": fn()}
+	})
+}
+
+// NewCounterFunc creates and registers a counter computed by fn on every collection
+func NewCounterFunc(name, help string, fn func() float64) *FuncMetric {
+	return newFuncMetric(name, help, "counter", "", func() map[string]float64 {
+		return map[string]float64{"": fn()}
+	})
+}
+
+// NewLabeledGaugeFunc creates and registers a gauge with one sample per label value, computed by fn on every collection
+func NewLabeledGaugeFunc(name, help, label string, fn func() map[string]float64) *FuncMetric {
+	return newFuncMetric(name, help, "gauge", label, fn)
+}
+
+// newFuncMetric creates and registers a computed metric
+func newFuncMetric(name, help, kind, label string, fn func() map[string]float64) *FuncMetric {
+	m := &FuncMetric{name: name, help: help, kind: kind, label: label, collect: fn}
+	register(m)
+	return m
+}
+
+// samples returns the computed values keyed by their sample name, including the label
+func (m *FuncMetric) samples() map[string]float64 {
+	values := m.collect()
+	samples := make(map[string]float64, len(values))
+	for labelValue, v := range values {
+		if m.label == "" {
+			samples[m.name] = v
+		} else {
+			samples[fmt.Sprintf("%s{%s=%q}", m.name, m.label, labelValue)] = v
+		}
+	}
+	return samples
+}
+
+func (m *FuncMetric) metricName() string { return m.name }
+
+func (m *FuncMetric) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+
+	samples := m.samples()
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s %g\n", name, samples[name])
+	}
+}
+
+// register adds a metric to the registry, replacing one with the same name
+func register(m metric) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry[m.metricName()] = m
+}
+
+// sortedMetrics returns all registered metrics ordered by name
+func sortedMetrics() []metric {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	all := make([]metric, 0, len(registry))
+	for _, m := range registry {
+		all = append(all, m)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].metricName() < all[j].metricName()
+	})
+	return all
+}
+
+// Snapshot returns the current value of every registered metric
+func Snapshot() map[string]float64 {
+	snapshot := make(map[string]float64)
+	for _, m := range sortedMetrics() {
+		switch v := m.(type) {
+		case *Counter:
+			snapshot[v.name] = float64(v.Value())
+		case *Gauge:
+			snapshot[v.name] = v.Value()
+		case *FuncMetric:
+			for name, value := range v.samples() {
+				snapshot[name] = value
+			}
+		}
+	}
+	return snapshot
+}
+
+// Handler serves all metrics in the Prometheus text exposition format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, m := range sortedMetrics() {
+			m.write(w)
+		}
+	})
+}
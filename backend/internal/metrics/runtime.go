@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Go runtime memory and garbage collector metrics
+var (
+	_ = NewGaugeFunc("seedventure_go_heap_alloc_bytes", "Bytes of allocated heap objects", func() float64 {
+		return float64(ReadMemStats().HeapAlloc)
+	})
+	_ = NewGaugeFunc("seedventure_go_heap_objects", "Number of allocated heap objects", func() float64 {
+		return float64(ReadMemStats().HeapObjects)
+	})
+	_ = NewGaugeFunc("seedventure_go_sys_bytes", "Bytes of memory obtained from the operating system", func() float64 {
+		return float64(ReadMemStats().Sys)
+	})
+	_ = NewCounterFunc("seedventure_go_gc_cycles_total", "Number of completed garbage collection cycles", func() float64 {
+		return float64(ReadMemStats().NumGC)
+	})
+	_ = NewCounterFunc("seedventure_go_gc_pause_seconds_total", "Total time the garbage collector stopped the world", func() float64 {
+		return time.Duration(ReadMemStats().PauseTotalNs).Seconds()
+	})
+	_ = NewGaugeFunc("seedventure_go_goroutines", "Number of goroutines", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+)
+
+// memStatsMaxAge is how long memory statistics are reused, reading them briefly stops the world
+const memStatsMaxAge = time.Second
+
+var (
+	memStatsLock sync.Mutex
+	memStats     runtime.MemStats
+	memStatsRead time.Time
+)
+
+// ReadMemStats returns the Go runtime memory statistics, at most memStatsMaxAge old
+func ReadMemStats() runtime.MemStats {
+	memStatsLock.Lock()
+	defer memStatsLock.Unlock()
+
+	if time.Since(memStatsRead) > memStatsMaxAge {
+		runtime.ReadMemStats(&memStats)
+		memStatsRead = time.Now()
+	}
+	return memStats
+}
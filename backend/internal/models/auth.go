@@ -0,0 +1,64 @@
+package models
+
+// API key scopes. Every scope includes the ones before it.
+const (
+	ScopeRead  = "read"  // Market data over REST and WebSocket
+	ScopeTrade = "trade" // Placing orders, for the trading endpoints
+	ScopeAdmin = "admin" // The admin API
+)
+
+// Scopes returns all API key scopes, least privileged first
+func Scopes() []string {
+	return []string{ScopeRead, ScopeTrade, ScopeAdmin}
+}
+
+// APIKey describes an API key without its secret
+type APIKey struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Scope     string `json:"scope"`
+	Prefix    string `json:"prefix"`    // First characters of the key, to tell keys apart
+	CreatedAt int64  `json:"createdAt"` // Unix milliseconds
+	RotatedAt int64  `json:"rotatedAt,omitempty"`
+	LastUsed  int64  `json:"lastUsed,omitempty"`
+}
+
+// IssuedAPIKey is an API key as returned when it is created or rotated, the only
+// time its secret is shown
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// User is a player account, without its password
+type User struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	Provider  string `json:"provider,omitempty"` // Identity provider the user logs in with, empty for passwords
+	CreatedAt int64  `json:"createdAt"`          // Unix milliseconds
+}
+
+// TokenPair is returned when a user logs in or refreshes their tokens
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`  // JWT sent as "Authorization: Bearer <token>"
+	RefreshToken string `json:"refreshToken"` // Exchanged for a new pair at /api/auth/refresh, once
+	TokenType    string `json:"tokenType"`    // Always "Bearer"
+	ExpiresIn    int64  `json:"expiresIn"`    // Seconds until the access token expires
+}
+
+// Ban types
+const (
+	BanUser = "user" // Value is a user ID
+	BanIP   = "ip"   // Value is an IP address or CIDR range
+)
+
+// Ban keeps a user or IP address from using the API
+type Ban struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`  // "user" or "ip"
+	Value     string `json:"value"` // User ID, IP address or CIDR range
+	Reason    string `json:"reason,omitempty"`
+	Automatic bool   `json:"automatic,omitempty"` // Imposed for repeatedly exceeding quotas
+	CreatedAt int64  `json:"createdAt"`           // Unix milliseconds
+	ExpiresAt int64  `json:"expiresAt,omitempty"` // Unix milliseconds, zero for permanent bans
+}
@@ -0,0 +1,24 @@
+package models
+
+// Kinds of cash flows
+const (
+	CashDeposit    = "deposit"
+	CashWithdrawal = "withdrawal"
+	CashInterest   = "interest"
+)
+
+// CashFlow is cash paid to or taken from every player of a round. Players hold their cash
+// in their clients, which apply the flow.
+type CashFlow struct {
+	Kind   string  `json:"kind"`             // CashDeposit, CashWithdrawal or CashInterest
+	Amount float64 `json:"amount,omitempty"` // Deposited or withdrawn, positive
+	Rate   float64 `json:"rate,omitempty"`   // Interest on idle cash, relative
+	Reason string  `json:"reason,omitempty"`
+	Time   int64   `json:"time"` // Unix milliseconds
+}
+
+// CashMessage tells the clients of a symbol about a cash flow
+type CashMessage struct {
+	Type string   `json:"type"` // Always "cash"
+	Flow CashFlow `json:"flow"`
+}
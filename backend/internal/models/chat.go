@@ -0,0 +1,143 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Names of the built-in chat filters
+const (
+	ChatFilterMask   = "mask"   // Replaces blocked words with asterisks
+	ChatFilterReject = "reject" // Rejects messages containing blocked words
+)
+
+// ErrChatRejected is returned by chat filters refusing a message
+var ErrChatRejected = errors.New("message rejected")
+
+// ChatFilter checks the text of a chat message before it's sent, such as a profanity
+// filter. It returns the text to send, possibly changed, or an error wrapping
+// ErrChatRejected to refuse the message. blockedWords is chat.blockedWords.
+type ChatFilter func(text string, blockedWords []string) (string, error)
+
+var (
+	chatFiltersLock sync.RWMutex
+	chatFilters     = make(map[string]ChatFilter)
+)
+
+func init() {
+	RegisterChatFilter(ChatFilterMask, func(text string, blockedWords []string) (string, error) {
+		masked, _ := replaceWords(text, blockedWords, func(word string) string {
+			return strings.Repeat("*", utf8.RuneCountInString(word))
+		})
+		return masked, nil
+	})
+	RegisterChatFilter(ChatFilterReject, func(text string, blockedWords []string) (string, error) {
+		if _, found := replaceWords(text, blockedWords, func(word string) string { return word }); found {
+			return "", ErrChatRejected
+		}
+		return text, nil
+	})
+}
+
+// RegisterChatFilter makes a chat filter available under name, to be selected with
+// chat.filters. It panics if the name is empty or already taken, or filter is nil.
+func RegisterChatFilter(name string, filter ChatFilter) {
+	chatFiltersLock.Lock()
+	defer chatFiltersLock.Unlock()
+
+	if name == "" {
+		panic("models: RegisterChatFilter with empty name")
+	}
+	if filter == nil {
+		panic("models: RegisterChatFilter with nil filter for " + name)
+	}
+	if _, ok := chatFilters[name]; ok {
+		panic("models: RegisterChatFilter called twice for " + name)
+	}
+	chatFilters[name] = filter
+}
+
+// GetChatFilter returns the chat filter registered under name
+func GetChatFilter(name string) (ChatFilter, bool) {
+	chatFiltersLock.RLock()
+	defer chatFiltersLock.RUnlock()
+	filter, ok := chatFilters[name]
+	return filter, ok
+}
+
+// ChatFilterNames returns the names of all registered chat filters, sorted
+func ChatFilterNames() []string {
+	chatFiltersLock.RLock()
+	defer chatFiltersLock.RUnlock()
+
+	names := make([]string, 0, len(chatFilters))
+	for name := range chatFilters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// replaceWords replaces the words of text that are blocked, compared case-insensitively,
+// and reports whether there were any. Words are runs of letters and digits.
+func replaceWords(text string, blocked []string, replace func(word string) string) (string, bool) {
+	if len(blocked) == 0 {
+		return text, false
+	}
+
+	var b strings.Builder
+	found := false
+	start := -1
+	end := func(i int) {
+		word := text[start:i]
+		for _, w := range blocked {
+			if strings.EqualFold(word, w) {
+				word, found = replace(word), true
+				break
+			}
+		}
+		b.WriteString(word)
+		start = -1
+	}
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			end(i)
+		}
+		if !inWord {
+			b.WriteRune(r)
+		}
+	}
+	if start >= 0 {
+		end(len(text))
+	}
+	return b.String(), found
+}
+
+// ChatEntry is a chat message of a room, the clients of a symbol
+type ChatEntry struct {
+	ID     int64  `json:"id"` // Increasing within the room
+	Author string `json:"author"`
+	Guest  bool   `json:"guest,omitempty"` // Author is a name derived from the address of a client without an account
+	Text   string `json:"text"`
+	Time   int64  `json:"time"` // Unix milliseconds
+}
+
+// ChatRequest is a chat message sent by a client over its WebSocket connection
+type ChatRequest struct {
+	Type string `json:"type"` // Always "chat"
+	Text string `json:"text"`
+}
+
+// ChatMessage tells the clients of a symbol about a chat message
+type ChatMessage struct {
+	Type    string    `json:"type"` // Always "chat"
+	Message ChatEntry `json:"message"`
+}
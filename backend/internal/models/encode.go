@@ -0,0 +1,329 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// The messages below are sent to every client on every tick, so they encode
+// themselves by appending to a byte slice instead of going through
+// encoding/json's reflection. The output is identical to json.Marshal.
+
+// JSONAppender is implemented by types that can append their JSON encoding to a buffer
+type JSONAppender interface {
+	AppendJSON(dst []byte) ([]byte, error)
+}
+
+const (
+	initialBufferSize = 1024
+	maxPooledBuffer   = 1 << 20 // Larger buffers are left to the garbage collector
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, initialBufferSize)
+		return &buf
+	},
+}
+
+// Marshal encodes v using a pooled buffer and returns a copy sized to fit
+func Marshal(v JSONAppender) ([]byte, error) {
+	bufPtr := bufferPool.Get().(*[]byte)
+	defer putBuffer(bufPtr)
+
+	buf, err := v.AppendJSON((*bufPtr)[:0])
+	*bufPtr = buf
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, len(buf))
+	copy(data, buf)
+	return data, nil
+}
+
+// WriteJSON encodes v followed by a newline to w using a pooled buffer, like json.Encoder does
+func WriteJSON(w io.Writer, v JSONAppender) error {
+	bufPtr := bufferPool.Get().(*[]byte)
+	defer putBuffer(bufPtr)
+
+	buf, err := v.AppendJSON((*bufPtr)[:0])
+	*bufPtr = buf
+	if err != nil {
+		return err
+	}
+
+	*bufPtr = append(buf, '\n')
+	_, err = w.Write(*bufPtr)
+	return err
+}
+
+// putBuffer returns a buffer to the pool unless it grew too large
+func putBuffer(bufPtr *[]byte) {
+	if cap(*bufPtr) > maxPooledBuffer {
+		return
+	}
+	bufferPool.Put(bufPtr)
+}
+
+// AppendJSON appends the JSON encoding of the candle to dst
+func (c CandleData) AppendJSON(dst []byte) ([]byte, error) {
+	var err error
+
+	dst = append(dst, `{"x":`...)
+	dst = strconv.AppendInt(dst, c.Timestamp, 10)
+	dst = append(dst, `,"y":[`...)
+	for i, v := range c.Values {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		if dst, err = appendFloat(dst, v); err != nil {
+			return dst, err
+		}
+	}
+	dst = append(dst, ']')
+	if c.IsComplete {
+		dst = append(dst, `,"isComplete":true`...)
+	}
+	if c.Volume != 0 {
+		dst = append(dst, `,"volume":`...)
+		if dst, err = appendFloat(dst, c.Volume); err != nil {
+			return dst, err
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+// AppendJSON appends the JSON encoding of the update to dst
+func (m UpdateMessage) AppendJSON(dst []byte) ([]byte, error) {
+	var err error
+
+	dst = append(dst, `{"type":`...)
+	dst = appendString(dst, m.Type)
+	dst = append(dst, `,"candle":`...)
+	if dst, err = m.Candle.AppendJSON(dst); err != nil {
+		return dst, err
+	}
+	if m.TimeFrame != "" {
+		dst = append(dst, `,"timeFrame":`...)
+		dst = appendString(dst, string(m.TimeFrame))
+	}
+	if m.Offset != 0 {
+		dst = append(dst, `,"offset":`...)
+		dst = strconv.AppendInt(dst, m.Offset, 10)
+	}
+	return append(dst, '}'), nil
+}
+
+// AppendJSON appends the JSON encoding of the delta to dst
+func (m DeltaMessage) AppendJSON(dst []byte) ([]byte, error) {
+	var err error
+
+	dst = append(dst, `{"type":`...)
+	dst = appendString(dst, m.Type)
+	dst = append(dst, `,"timeFrame":`...)
+	dst = appendString(dst, string(m.TimeFrame))
+	dst = append(dst, `,"x":`...)
+	dst = strconv.AppendInt(dst, m.Timestamp, 10)
+	dst = append(dst, `,"c":`...)
+	if dst, err = appendFloat(dst, m.Close); err != nil {
+		return dst, err
+	}
+	if m.High != nil {
+		dst = append(dst, `,"h":`...)
+		if dst, err = appendFloat(dst, *m.High); err != nil {
+			return dst, err
+		}
+	}
+	if m.Low != nil {
+		dst = append(dst, `,"l":`...)
+		if dst, err = appendFloat(dst, *m.Low); err != nil {
+			return dst, err
+		}
+	}
+	if m.VolumeDelta != 0 {
+		dst = append(dst, `,"dv":`...)
+		if dst, err = appendFloat(dst, m.VolumeDelta); err != nil {
+			return dst, err
+		}
+	}
+	if m.Offset != 0 {
+		dst = append(dst, `,"offset":`...)
+		dst = strconv.AppendInt(dst, m.Offset, 10)
+	}
+	return append(dst, '}'), nil
+}
+
+// AppendJSON appends the JSON encoding of the history to dst
+func (d TimeFrameData) AppendJSON(dst []byte) ([]byte, error) {
+	var err error
+
+	dst = append(dst, `{"timeFrame":`...)
+	dst = appendString(dst, string(d.TimeFrame))
+	dst = append(dst, `,"candles":`...)
+	if d.Candles == nil {
+		return append(dst, `null}`...), nil
+	}
+	dst = append(dst, '[')
+	if dst, err = AppendCandles(dst, d.Candles); err != nil {
+		return dst, err
+	}
+	return append(dst, "]}"...), nil
+}
+
+// AppendCandles appends the JSON encodings of the candles separated by commas, without the enclosing brackets
+func AppendCandles(dst []byte, candles []CandleData) ([]byte, error) {
+	var err error
+	for i, candle := range candles {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		if dst, err = candle.AppendJSON(dst); err != nil {
+			return dst, err
+		}
+	}
+	return dst, nil
+}
+
+// AppendHistoryPrefix appends the start of a TimeFrameData encoding, up to the opening bracket
+// of the candles. Together with AppendCandles and AppendHistorySuffix it allows encoding a
+// history piece by piece.
+func AppendHistoryPrefix(dst []byte, timeFrame TimeFrame) []byte {
+	dst = append(dst, `{"timeFrame":`...)
+	dst = appendString(dst, string(timeFrame))
+	return append(dst, `,"candles":[`...)
+}
+
+// AppendHistorySuffix appends the end of a TimeFrameData encoding and a newline, like json.Encoder writes
+func AppendHistorySuffix(dst []byte) []byte {
+	return append(dst, "]}\n"...)
+}
+
+// WriteHistoryJSON writes a TimeFrameData response followed by a newline, with candles already
+// encoded by AppendCandles and extra candles appended after them. The output is identical to
+// WriteJSON with all candles in a TimeFrameData, but the encoded candles can be reused between responses.
+func WriteHistoryJSON(w io.Writer, timeFrame TimeFrame, encoded []byte, extra ...CandleData) error {
+	bufPtr := bufferPool.Get().(*[]byte)
+	defer putBuffer(bufPtr)
+
+	buf := AppendHistoryPrefix((*bufPtr)[:0], timeFrame)
+	prefixLen := len(buf)
+
+	var err error
+	for i, candle := range extra {
+		if i > 0 || len(encoded) > 0 {
+			buf = append(buf, ',')
+		}
+		if buf, err = candle.AppendJSON(buf); err != nil {
+			break
+		}
+	}
+	buf = AppendHistorySuffix(buf)
+	*bufPtr = buf
+	if err != nil {
+		return err
+	}
+
+	// The encoded candles are written between the prefix and the rest without being copied
+	if _, err := w.Write(buf[:prefixLen]); err != nil {
+		return err
+	}
+	if _, err := w.Write(encoded); err != nil {
+		return err
+	}
+	_, err = w.Write(buf[prefixLen:])
+	return err
+}
+
+// AppendJSON appends the JSON encoding of the status to dst
+func (m StatusMessage) AppendJSON(dst []byte) ([]byte, error) {
+	dst = append(dst, `{"type":`...)
+	dst = appendString(dst, m.Type)
+	dst = append(dst, `,"status":`...)
+	dst = appendString(dst, m.Status)
+	if m.Message != "" {
+		dst = append(dst, `,"message":`...)
+		dst = appendString(dst, m.Message)
+	}
+	if m.CancelOpen {
+		dst = append(dst, `,"cancelOpen":true`...)
+	}
+	return append(dst, '}'), nil
+}
+
+// appendFloat formats a float the way encoding/json does
+func appendFloat(dst []byte, f float64) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return dst, fmt.Errorf("unsupported value: %s", strconv.FormatFloat(f, 'g', -1, 64))
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, 64)
+	if format == 'e' {
+		// Clean up e-09 to e-9
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst, nil
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendString appends a quoted JSON string, escaping it the way encoding/json does
+func appendString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				dst = append(dst, '\\', b)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
@@ -0,0 +1,26 @@
+package models
+
+// QuotaError is the body of requests and WebSocket messages rejected by a quota
+type QuotaError struct {
+	Type       string `json:"type"`       // Always "error"
+	Error      string `json:"error"`      // Always "quota_exceeded"
+	Quota      string `json:"quota"`      // The exceeded quota, e.g. "requestsPerMinute"
+	Limit      int    `json:"limit"`      // Uses allowed per window
+	RetryAfter int64  `json:"retryAfter"` // Milliseconds until the quota allows more
+}
+
+// ValidationError is the body of requests and WebSocket messages rejected because of an invalid parameter
+type ValidationError struct {
+	Type      string `json:"type"`      // Always "error"
+	Error     string `json:"error"`     // Always "invalid_parameter"
+	Parameter string `json:"parameter"` // Name of the invalid parameter, e.g. "limit"
+	Message   string `json:"message"`
+}
+
+// BanError is the body of requests rejected because the user or their IP address is banned
+type BanError struct {
+	Type      string `json:"type"`  // Always "error"
+	Error     string `json:"error"` // Always "banned"
+	Reason    string `json:"reason,omitempty"`
+	ExpiresAt int64  `json:"expiresAt,omitempty"` // Unix milliseconds, zero for permanent bans
+}
@@ -0,0 +1,69 @@
+package models
+
+import "encoding/json"
+
+// Types of the events pushed to webhooks
+const (
+	EventCandleOpened  = "seedventure.candle.opened"  // A candle of a timeframe started
+	EventCandleUpdated = "seedventure.candle.updated" // The candle in progress changed
+	EventCandleClosed  = "seedventure.candle.closed"  // A candle was completed
+)
+
+// EventTypes returns all event types
+func EventTypes() []string {
+	return []string{EventCandleOpened, EventCandleUpdated, EventCandleClosed}
+}
+
+// IsEventType reports whether t is a known event type
+func IsEventType(t string) bool {
+	for _, known := range EventTypes() {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// EventType returns the type of the event an update is pushed as
+func (m UpdateMessage) EventType() string {
+	switch {
+	case m.Type == "new":
+		return EventCandleOpened
+	case m.Candle.IsComplete:
+		return EventCandleClosed
+	default:
+		return EventCandleUpdated
+	}
+}
+
+// CandleEvent is the data of candle events
+type CandleEvent struct {
+	Symbol    string     `json:"symbol"`
+	TimeFrame TimeFrame  `json:"timeFrame"`
+	Candle    CandleData `json:"candle"`
+}
+
+// CloudEvent is an event in the JSON format of CloudEvents 1.0
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"` // RFC 3339
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// DeadLetter is a webhook delivery that failed on every attempt
+type DeadLetter struct {
+	ID           string            `json:"id"`
+	URL          string            `json:"url"`
+	EventType    string            `json:"eventType"`
+	Headers      map[string]string `json:"headers"` // Headers of the delivery except its signature
+	Body         json.RawMessage   `json:"body"`
+	Attempts     int               `json:"attempts"`
+	Error        string            `json:"error"`        // Error of the last attempt
+	FirstAttempt int64             `json:"firstAttempt"` // Unix milliseconds
+	LastAttempt  int64             `json:"lastAttempt"`  // Unix milliseconds
+}
@@ -0,0 +1,78 @@
+package models
+
+import "time"
+
+// FuturesContract is a dated futures contract on a symbol, served as a symbol of its own
+type FuturesContract struct {
+	Symbol     string  `json:"symbol"`
+	Underlying string  `json:"underlying"` // Symbol of the spot market
+	Path       string  `json:"path"`       // Prefix of the contract's routes
+	Listed     int64   `json:"listed"`     // Unix milliseconds
+	Expiry     int64   `json:"expiry"`     // Unix milliseconds
+	Premium    float64 `json:"premium"`    // Basis over spot when listed, relative
+	Front      bool    `json:"front"`      // Nearest contract that didn't expire yet
+	Expired    bool    `json:"expired"`    // Settled, served until the next expiry
+}
+
+// ContractSymbol returns the symbol of the contract on a symbol expiring at a time
+func ContractSymbol(underlying string, expiry time.Time) string {
+	return underlying + "-" + expiry.UTC().Format("200601021504")
+}
+
+// Basis returns the price of the contract relative to spot at a time: 1 plus the premium
+// when listed, converging linearly to 1 at expiry
+func (c FuturesContract) Basis(at int64) float64 {
+	if at >= c.Expiry || c.Expiry <= c.Listed {
+		return 1
+	}
+	remaining := float64(c.Expiry-at) / float64(c.Expiry-c.Listed)
+	if remaining > 1 {
+		remaining = 1
+	}
+	return 1 + c.Premium*remaining
+}
+
+// Settlement is the final price of an expired futures contract
+type Settlement struct {
+	Symbol     string  `json:"symbol"`
+	Underlying string  `json:"underlying"`
+	Expiry     int64   `json:"expiry"` // Unix milliseconds
+	Price      float64 `json:"price"`  // Price of the underlying at expiry
+}
+
+// SettlementMessage tells the clients of a futures contract that it expired. Open positions
+// in the contract close at the settlement price.
+type SettlementMessage struct {
+	Type       string     `json:"type"` // Always "settlement"
+	Settlement Settlement `json:"settlement"`
+}
+
+// PerpetualContract is a futures contract on a symbol that never expires, served as a symbol
+// of its own. Its holders pay each other the funding rate at every funding time instead.
+type PerpetualContract struct {
+	Symbol          string  `json:"symbol"`
+	Underlying      string  `json:"underlying"`      // Symbol of the spot market
+	Path            string  `json:"path"`            // Prefix of the contract's routes
+	FundingInterval int64   `json:"fundingInterval"` // Milliseconds between fundings
+	NextFunding     int64   `json:"nextFunding"`     // Unix milliseconds
+	Premium         float64 `json:"premium"`         // Current premium over spot, relative
+	PredictedRate   float64 `json:"predictedRate"`   // Funding rate if the next funding was now
+}
+
+// FundingRate is the rate paid at a funding of a perpetual contract: holders of long positions
+// pay holders of short positions the rate times the value of their position, or the other way
+// round if the rate is negative
+type FundingRate struct {
+	Symbol     string  `json:"symbol"`
+	Underlying string  `json:"underlying"`
+	Time       int64   `json:"time"`      // Unix milliseconds
+	Rate       float64 `json:"rate"`      // Average premium since the last funding, capped
+	MarkPrice  float64 `json:"markPrice"` // Price of the contract positions are valued at
+}
+
+// FundingMessage tells the clients of a perpetual contract about a funding. Open positions in
+// the contract pay or receive the rate times their value at the mark price.
+type FundingMessage struct {
+	Type    string      `json:"type"` // Always "funding"
+	Funding FundingRate `json:"funding"`
+}
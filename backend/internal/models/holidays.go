@@ -0,0 +1,170 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Holiday calendar presets of standard markets
+const (
+	HolidaysNYSE   = "nyse"   // New York Stock Exchange
+	HolidaysTARGET = "target" // Euro area TARGET2 payment system
+)
+
+// DateLayout is the layout of holiday dates
+const DateLayout = "2006-01-02"
+
+// holidayPresets compute the holidays of a year of the markets with a preset
+var holidayPresets = map[string]func(year int) []time.Time{
+	HolidaysNYSE:   nyseHolidays,
+	HolidaysTARGET: targetHolidays,
+}
+
+// HolidayCalendarNames returns the names of the holiday calendar presets, sorted
+func HolidayCalendarNames() []string {
+	names := make([]string, 0, len(holidayPresets))
+	for name := range holidayPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HolidayCalendar tells the days, in UTC, a market doesn't trade. The zero value and nil
+// have no holidays. It is safe for concurrent use.
+type HolidayCalendar struct {
+	presets []func(year int) []time.Time
+	dates   map[time.Time]bool // Midnight UTC of the listed holidays
+
+	lock  sync.Mutex
+	years map[int]map[time.Time]bool // Holidays of the presets by year, computed when first needed
+}
+
+// NewHolidayCalendar returns the calendar of the holidays of the named presets and the
+// listed dates, formatted as DateLayout
+func NewHolidayCalendar(presets []string, dates []string) (*HolidayCalendar, error) {
+	c := &HolidayCalendar{dates: make(map[time.Time]bool, len(dates)), years: make(map[int]map[time.Time]bool)}
+	for _, name := range presets {
+		preset, ok := holidayPresets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown holiday calendar %q, must be one of %v", name, HolidayCalendarNames())
+		}
+		c.presets = append(c.presets, preset)
+	}
+	for _, date := range dates {
+		day, err := time.Parse(DateLayout, date)
+		if err != nil {
+			return nil, fmt.Errorf("holiday %q must be a date such as 2026-12-25", date)
+		}
+		c.dates[day] = true
+	}
+	return c, nil
+}
+
+// Closed reports whether the market doesn't trade on the day of a time, in UTC
+func (c *HolidayCalendar) Closed(at time.Time) bool {
+	if c == nil {
+		return false
+	}
+	at = at.UTC()
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+	if c.dates[day] {
+		return true
+	}
+	if len(c.presets) == 0 {
+		return false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	holidays, ok := c.years[day.Year()]
+	if !ok {
+		holidays = make(map[time.Time]bool)
+		for _, preset := range c.presets {
+			for _, holiday := range preset(day.Year()) {
+				holidays[holiday] = true
+			}
+		}
+		c.years[day.Year()] = holidays
+	}
+	return holidays[day]
+}
+
+// date returns midnight UTC of a day
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// easter returns Easter Sunday of a year in the Gregorian calendar
+func easter(year int) time.Time {
+	a, b, c := year%19, year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return date(year, time.Month(month), day)
+}
+
+// nthWeekday returns the nth weekday of a month, counting from its end if n is negative
+func nthWeekday(year int, month time.Month, weekday time.Weekday, n int) time.Time {
+	if n < 0 {
+		last := date(year, month+1, 0)
+		return last.AddDate(0, 0, -((int(last.Weekday())-int(weekday)+7)%7 + 7*(-n-1)))
+	}
+	first := date(year, month, 1)
+	return first.AddDate(0, 0, (int(weekday)-int(first.Weekday())+7)%7+7*(n-1))
+}
+
+// observed moves a holiday on a Saturday to the Friday before and one on a Sunday to the
+// Monday after
+func observed(day time.Time) time.Time {
+	switch day.Weekday() {
+	case time.Saturday:
+		return day.AddDate(0, 0, -1)
+	case time.Sunday:
+		return day.AddDate(0, 0, 1)
+	}
+	return day
+}
+
+// nyseHolidays returns the full-day closures of the New York Stock Exchange in a year
+func nyseHolidays(year int) []time.Time {
+	holidays := []time.Time{
+		nthWeekday(year, time.January, time.Monday, 3),    // Martin Luther King Jr. Day
+		nthWeekday(year, time.February, time.Monday, 3),   // Washington's Birthday
+		easter(year).AddDate(0, 0, -2),                    // Good Friday
+		nthWeekday(year, time.May, time.Monday, -1),       // Memorial Day
+		observed(date(year, time.July, 4)),                // Independence Day
+		nthWeekday(year, time.September, time.Monday, 1),  // Labor Day
+		nthWeekday(year, time.November, time.Thursday, 4), // Thanksgiving Day
+		observed(date(year, time.December, 25)),           // Christmas Day
+	}
+	// New Year's Day on a Saturday isn't observed, as the Friday before ends a year
+	if newYear := date(year, time.January, 1); newYear.Weekday() != time.Saturday {
+		holidays = append(holidays, observed(newYear))
+	}
+	if year >= 2022 {
+		holidays = append(holidays, observed(date(year, time.June, 19))) // Juneteenth
+	}
+	return holidays
+}
+
+// targetHolidays returns the closing days of the TARGET2 payment system in a year, on which
+// euro markets don't settle
+func targetHolidays(year int) []time.Time {
+	return []time.Time{
+		date(year, time.January, 1),
+		easter(year).AddDate(0, 0, -2), // Good Friday
+		easter(year).AddDate(0, 0, 1),  // Easter Monday
+		date(year, time.May, 1),        // Labour Day
+		date(year, time.December, 25),
+		date(year, time.December, 26),
+	}
+}
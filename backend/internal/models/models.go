@@ -1,7 +1,12 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
 	"time"
+
+	"server/internal/version"
 )
 
 // TimeFrame represents a specific time interval for candles
@@ -17,6 +22,28 @@ const (
 	TimeFrame1Day  TimeFrame = "1d"
 )
 
+// AllTimeFrames returns every supported timeframe, shortest first
+func AllTimeFrames() []TimeFrame {
+	return []TimeFrame{
+		TimeFrame1Min,
+		TimeFrame5Min,
+		TimeFrame15Min,
+		TimeFrame1Hour,
+		TimeFrame4Hour,
+		TimeFrame1Day,
+	}
+}
+
+// IsValid reports whether tf is a supported timeframe
+func (tf TimeFrame) IsValid() bool {
+	for _, supported := range AllTimeFrames() {
+		if tf == supported {
+			return true
+		}
+	}
+	return false
+}
+
 // CandleData represents OHLC data for a specific time
 type CandleData struct {
 	Timestamp  int64      `json:"x"`
@@ -25,16 +52,210 @@ type CandleData struct {
 	Volume     float64    `json:"volume,omitempty"`     // Optional volume data
 }
 
+// CheckOHLC reports why the prices of the candle are inconsistent, if they are. Consistent
+// prices satisfy low ≤ min(open, close) ≤ max(open, close) ≤ high.
+func (c CandleData) CheckOHLC() error {
+	open, high, low, close := c.Values[0], c.Values[1], c.Values[2], c.Values[3]
+	if low <= math.Min(open, close) && math.Max(open, close) <= high {
+		return nil
+	}
+	return fmt.Errorf("open %g and close %g are outside of low %g and high %g", open, close, low, high)
+}
+
+// EnforceOHLC widens the high and low of the candle to its open and close, reporting
+// whether it had to
+func (c *CandleData) EnforceOHLC() bool {
+	open, high, low, close := c.Values[0], c.Values[1], c.Values[2], c.Values[3]
+	c.Values[1] = math.Max(high, math.Max(open, close))
+	c.Values[2] = math.Min(low, math.Min(open, close))
+	return c.Values[1] != high || c.Values[2] != low
+}
+
+// Gap is a run of consecutive periods without a stored candle
+type Gap struct {
+	From    int64 `json:"from"`    // Timestamp of the first missing period
+	To      int64 `json:"to"`      // Timestamp of the last missing period
+	Missing int   `json:"missing"` // Number of missing periods
+}
+
+// GapReport lists the periods of a timeframe missing from the stored history
+type GapReport struct {
+	TimeFrame TimeFrame `json:"timeFrame"`
+	From      int64     `json:"from"`    // First period checked, the oldest stored candle unless limited
+	To        int64     `json:"to"`      // Last period checked, the one before the candle in progress unless limited
+	Candles   int       `json:"candles"` // Stored candles in the checked periods
+	Missing   int       `json:"missing"` // Periods without a candle, summed over the gaps
+	Gaps      []Gap     `json:"gaps"`    // Oldest first
+}
+
 // UpdateMessage represents a message sent to the client
 type UpdateMessage struct {
 	Type      string     `json:"type"` // "new" or "update"
 	Candle    CandleData `json:"candle"`
 	TimeFrame TimeFrame  `json:"timeFrame,omitempty"` // The timeframe of the candle
+	Offset    int64      `json:"offset,omitempty"`    // Position in the update log, if enabled, to resume from after reconnecting
+}
+
+// DeltaMessage carries only the fields of the current candle that changed since
+// the previous frame of its channel. High and low are omitted when they didn't move.
+type DeltaMessage struct {
+	Type        string    `json:"type"` // Always "delta"
+	TimeFrame   TimeFrame `json:"timeFrame"`
+	Timestamp   int64     `json:"x"`                // Candle the delta applies to
+	Close       float64   `json:"c"`                // New close
+	High        *float64  `json:"h,omitempty"`      // New high
+	Low         *float64  `json:"l,omitempty"`      // New low
+	VolumeDelta float64   `json:"dv,omitempty"`     // Volume added since the previous frame
+	Offset      int64     `json:"offset,omitempty"` // Offset of the full update in the update log, if enabled
+}
+
+// NewDeltaMessage describes the change from prev to next, two frames of the same candle
+func NewDeltaMessage(timeFrame TimeFrame, prev, next CandleData) DeltaMessage {
+	delta := DeltaMessage{
+		Type:        "delta",
+		TimeFrame:   timeFrame,
+		Timestamp:   next.Timestamp,
+		Close:       next.Values[3],
+		VolumeDelta: math.Round((next.Volume-prev.Volume)*1e8) / 1e8, // Strip floating point noise
+	}
+	if next.Values[1] != prev.Values[1] {
+		high := next.Values[1]
+		delta.High = &high
+	}
+	if next.Values[2] != prev.Values[2] {
+		low := next.Values[2]
+		delta.Low = &low
+	}
+	return delta
+}
+
+// ClientConfig is the non-sensitive runtime configuration the frontend configures itself from
+type ClientConfig struct {
+	Namespace        string          `json:"namespace"` // Simulation the client is connected to
+	Symbols          []string        `json:"symbols"`
+	TimeFrames       []TimeFrame     `json:"timeFrames"`
+	DefaultTimeFrame TimeFrame       `json:"defaultTimeFrame"`
+	UpdateIntervalMs int64           `json:"updateIntervalMs"` // How often the current candle is updated
+	CandleIntervalMs int64           `json:"candleIntervalMs"` // Duration of the base candle
+	Precision        Precision       `json:"precision"`        // Decimal places to display prices and volumes with
+	Maintenance      bool            `json:"maintenance"`
+	TradingHalted    bool            `json:"tradingHalted"` // Orders must not be accepted, see StatusTradingHalted
+	MarketClosed     bool            `json:"marketClosed"`  // Holiday without prices or orders, see StatusClosed
+	Features         map[string]bool `json:"features"`
+}
+
+// Server statuses announced to clients
+const (
+	StatusRunning       = "running"
+	StatusMaintenance   = "maintenance"
+	StatusTradingHalted = "trading_halted" // Prices move, but clients must not accept orders
+	StatusClosed        = "closed"         // Holiday without prices or orders
+)
+
+// StatusMessage announces a change of the server status to clients
+type StatusMessage struct {
+	Type       string `json:"type"` // Always "status"
+	Status     string `json:"status"`
+	Message    string `json:"message,omitempty"`
+	CancelOpen bool   `json:"cancelOpen,omitempty"` // Trading halted and open positions are to be closed at the current price
+}
+
+// TradingHalt is the trading status of a symbol
+type TradingHalt struct {
+	Symbol     string `json:"symbol"`
+	Namespace  string `json:"namespace"`
+	Halted     bool   `json:"halted"`
+	Reason     string `json:"reason,omitempty"`
+	CancelOpen bool   `json:"cancelOpen,omitempty"` // Open positions were to be closed when trading halted
+	Since      int64  `json:"since,omitempty"`      // Unix milliseconds the halt started
+}
+
+// ReloadMessage tells clients that the history was replaced. The new history of the
+// subscribed timeframe follows, and delta frames restart with a full update.
+type ReloadMessage struct {
+	Type        string `json:"type"` // Always "reload"
+	DataVersion uint64 `json:"dataVersion"`
+}
+
+// DataReload describes a dataset swapped in by a reload
+type DataReload struct {
+	DataVersion uint64            `json:"dataVersion"`
+	Dir         string            `json:"dir"`        // Directory the dataset was read from
+	Candles     map[TimeFrame]int `json:"candles"`    // Number of loaded candles per timeframe
+	Aggregated  []TimeFrame       `json:"aggregated"` // Timeframes without a data file, built from the 1-minute candles
+}
+
+// SimulationSnapshot is the complete state of the simulator. Restoring it continues
+// the simulation exactly where the snapshot was taken, including the random sequence.
+type SimulationSnapshot struct {
+	Format        int                        `json:"format"`    // Version of the snapshot layout
+	CreatedAt     int64                      `json:"createdAt"` // Unix milliseconds
+	Params        SimulationParams           `json:"params"`
+	RandomState   uint64                     `json:"randomState"`   // State of the price generator's random source
+	VolumeState   VolumeState                `json:"volumeState"`   // Averages of the volume model, zero in older snapshots
+	CurrentCandle *CandleData                `json:"currentCandle"` // Candle in progress, nil if there was none
+	Candles       map[TimeFrame][]CandleData `json:"candles"`
+}
+
+// SnapshotInfo describes a snapshot saved in the data directory
+type SnapshotInfo struct {
+	Name      string `json:"name"`
+	CreatedAt int64  `json:"createdAt"` // Unix milliseconds
+	Size      int64  `json:"size"`      // File size in bytes
+}
+
+// RecordedEvent is a broadcast written to a session recording, one per line
+type RecordedEvent struct {
+	Offset  int64           `json:"offset,omitempty"`  // Position in the update log, for events logged there
+	Time    int64           `json:"t"`                 // Unix milliseconds
+	Channel TimeFrame       `json:"channel,omitempty"` // Timeframe the broadcast was sent on, empty if it went to all clients
+	Message json.RawMessage `json:"message"`
+}
+
+// LoggedUpdates is a page of the update log
+type LoggedUpdates struct {
+	First  int64           `json:"first"` // Offset of the oldest update the log holds
+	Next   int64           `json:"next"`  // Offset of the next update to be logged
+	Events []RecordedEvent `json:"events"`
+}
+
+// RecordingInfo describes a session recording saved in the data directory
+type RecordingInfo struct {
+	Name      string `json:"name"`
+	CreatedAt int64  `json:"createdAt"` // Unix milliseconds
+	Size      int64  `json:"size"`      // File size in bytes
+}
+
+// RecordingStatus describes the recording and replay in progress
+type RecordingStatus struct {
+	Recording string  `json:"recording,omitempty"` // Recording being written
+	Events    int64   `json:"events"`              // Events written to it so far
+	Replaying string  `json:"replaying,omitempty"` // Recording being replayed
+	Speed     float64 `json:"speed,omitempty"`     // Time compression of the replay
+	Loop      bool    `json:"loop,omitempty"`
+}
+
+// ScriptInfo describes a scenario script and how its runs went
+type ScriptInfo struct {
+	Name       string  `json:"name"`
+	Enabled    bool    `json:"enabled"`
+	Runs       int64   `json:"runs"`
+	Errors     int64   `json:"errors"`
+	LastError  string  `json:"lastError,omitempty"`
+	AvgRunTime float64 `json:"avgRunTime"`       // Average duration of a run in milliseconds
+	Source     string  `json:"source,omitempty"` // Only included when a single script is requested
 }
 
 // TimeFrameRequest represents a request for historical data
 type TimeFrameRequest struct {
 	TimeFrame TimeFrame `json:"timeFrame"`
+	Schema    string    `json:"schema,omitempty"` // Switches the candle schema, see CandleSchema
+}
+
+// AckRequest acknowledges the updates a client processed, up to an offset of the update log
+type AckRequest struct {
+	Type   string `json:"type"` // Always "ack"
+	Offset int64  `json:"offset"`
 }
 
 // TimeFrameData represents all historical data for a specific timeframe
@@ -43,6 +264,120 @@ type TimeFrameData struct {
 	Candles   []CandleData `json:"candles"`
 }
 
+// ConnectionInfo describes a connected WebSocket client
+type ConnectionInfo struct {
+	RemoteAddr  string    `json:"remoteAddr"`
+	ConnectedAt int64     `json:"connectedAt"` // Unix milliseconds
+	TimeFrame   TimeFrame `json:"timeFrame"`   // Subscribed timeframe
+	QueueDepth  int       `json:"queueDepth"`  // Payloads waiting to be written
+	Deltas      bool      `json:"deltas"`      // Receives delta frames for intra-candle updates
+	Transport   string    `json:"transport"`   // WebSocket implementation serving the connection, "gorilla" or "epoll"
+	Spectator   bool      `json:"spectator"`   // Unauthenticated, read-only connection
+
+	SentOffset   int64 `json:"sentOffset,omitempty"`   // Offset of the last update written to the client
+	AckedOffset  int64 `json:"ackedOffset,omitempty"`  // Last offset the client acknowledged
+	LaggingSince int64 `json:"laggingSince,omitempty"` // Unix milliseconds since the client falls behind the lag thresholds
+}
+
+// LagReport lists the WebSocket clients falling behind the lag thresholds
+type LagReport struct {
+	QueueDepth  int              `json:"queueDepth"`  // Queued payloads from which a client lags, 0 if disabled
+	AckLag      int64            `json:"ackLag"`      // Offsets acknowledgements may trail from which a client lags, 0 if disabled
+	EvictAfter  int64            `json:"evictAfter"`  // Milliseconds a client may lag before it is disconnected, 0 for never
+	Connections int              `json:"connections"` // Connected clients
+	Lagging     []ConnectionInfo `json:"lagging"`     // Clients falling behind, longest first
+}
+
+// Sources of simulated symbols
+const (
+	SymbolSourceDefault   = "default"   // The simulation served at the root
+	SymbolSourceConfig    = "config"    // A namespace of the configuration file
+	SymbolSourceRuntime   = "runtime"   // Created under /admin/symbols
+	SymbolSourceFutures   = "futures"   // A futures contract listed on another symbol
+	SymbolSourcePerpetual = "perpetual" // A perpetual contract listed on another symbol
+	SymbolSourceVenue     = "venue"     // A simulated exchange quoting another symbol, or their consolidated feed
+)
+
+// SymbolInfo describes a simulated symbol and where its API is served
+type SymbolInfo struct {
+	Symbol     string             `json:"symbol"`
+	Base       string             `json:"base"`  // Asset the symbol prices
+	Quote      string             `json:"quote"` // Currency the prices are in
+	Namespace  string             `json:"namespace"`
+	Path       string             `json:"path"`   // Prefix of the symbol's routes, empty at the root
+	Source     string             `json:"source"` // "default", "config", "runtime", "futures", "perpetual" or "venue"
+	Model      string             `json:"model"`
+	BasePrice  float64            `json:"basePrice"`
+	Volatility float64            `json:"volatility"`
+	Precision  Precision          `json:"precision"`
+	Clients    int                `json:"clients"`
+	CreatedAt  int64              `json:"createdAt,omitempty"` // Unix milliseconds, for symbols created at runtime
+	Index      map[string]float64 `json:"index,omitempty"`     // Weights of the constituents by namespace, for indexes
+}
+
+// ConvertedHistory is the history of a symbol with its prices converted into another currency
+type ConvertedHistory struct {
+	Symbol    string       `json:"symbol"`
+	Quote     string       `json:"quote"` // Currency of the converted prices
+	Via       []string     `json:"via"`   // Symbols of the markets converting the prices, in order
+	TimeFrame TimeFrame    `json:"timeFrame"`
+	Candles   []CandleData `json:"candles"`
+}
+
+// Stats describes the runtime state of the server
+type Stats struct {
+	Version       version.Info             `json:"version"`
+	UptimeSeconds int64                    `json:"uptimeSeconds"`
+	Ready         bool                     `json:"ready"`
+	Paused        bool                     `json:"paused"`
+	Maintenance   bool                     `json:"maintenance"`
+	Clients       int                      `json:"clients"`
+	Candles       map[TimeFrame]int        `json:"candles"`     // Number of stored candles per timeframe
+	LastSaved     map[TimeFrame]int64      `json:"lastSaved"`   // Unix milliseconds of the last save per saved timeframe
+	DataVersion   uint64                   `json:"dataVersion"` // Incremented whenever a new dataset replaces the history
+	Store         map[TimeFrame]StoreStats `json:"store"`
+	Memory        MemoryStats              `json:"memory"`
+	Simulation    *LoopHealth              `json:"simulation,omitempty"` // Health of the loop moving the prices of the symbol, none before it started and for followers
+}
+
+// States of a simulation loop
+const (
+	LoopRunning    = "running"
+	LoopRestarting = "restarting" // Waiting out the backoff after a panic
+	LoopStopped    = "stopped"
+)
+
+// LoopHealth describes the supervised simulation loop of a symbol
+type LoopHealth struct {
+	State       string `json:"state"`
+	Restarts    int    `json:"restarts"`              // Times the loop was restarted after a panic
+	LastPanic   string `json:"lastPanic,omitempty"`   // Value of the last panic
+	LastPanicAt int64  `json:"lastPanicAt,omitempty"` // Unix milliseconds of the last panic
+	RestartAt   int64  `json:"restartAt,omitempty"`   // Unix milliseconds the loop restarts at, while restarting
+}
+
+// StoreStats describes the candle storage of one timeframe
+type StoreStats struct {
+	Candles     int     `json:"candles"`     // Number of stored candles
+	Capacity    int     `json:"capacity"`    // Maximum number of candles before the oldest are dropped
+	Bytes       int     `json:"bytes"`       // Memory retained by the candle buffer
+	Utilization float64 `json:"utilization"` // Candles relative to capacity, between 0 and 1
+	CacheBytes  int     `json:"cacheBytes"`  // Memory retained by the serialized history cache
+}
+
+// MemoryStats describes the memory use and garbage collection of the process
+type MemoryStats struct {
+	HeapAlloc     uint64  `json:"heapAlloc"`     // Bytes of allocated heap objects
+	HeapInuse     uint64  `json:"heapInuse"`     // Bytes in in-use heap spans
+	HeapObjects   uint64  `json:"heapObjects"`   // Number of allocated heap objects
+	Sys           uint64  `json:"sys"`           // Bytes obtained from the operating system
+	NumGC         uint32  `json:"numGC"`         // Completed garbage collection cycles
+	PauseTotalNs  uint64  `json:"pauseTotalNs"`  // Total stop-the-world pause time
+	LastGC        int64   `json:"lastGC"`        // Unix milliseconds of the last collection, 0 if none
+	GCCPUFraction float64 `json:"gcCPUFraction"` // Fraction of CPU time used by the collector since start
+	Goroutines    int     `json:"goroutines"`
+}
+
 // GetDuration returns the duration of a timeframe
 func (tf TimeFrame) GetDuration() time.Duration {
 	switch tf {
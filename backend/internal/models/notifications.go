@@ -0,0 +1,25 @@
+package models
+
+// Kinds of notifications
+const (
+	NotificationAlert  = "alert"  // A price alert on a watchlist fired
+	NotificationSystem = "system" // A message of the operators
+)
+
+// Notification is a message in the inbox of a user, kept until it is read and beyond, so
+// users who were offline see what they missed
+type Notification struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"` // NotificationAlert or NotificationSystem
+	Title     string `json:"title"`
+	Message   string `json:"message,omitempty"`
+	Symbol    string `json:"symbol,omitempty"` // Symbol the notification is about, if any
+	CreatedAt int64  `json:"createdAt"`        // Unix milliseconds
+	Read      bool   `json:"read"`
+}
+
+// Inbox is a page of the notifications of a user, newest first
+type Inbox struct {
+	Notifications []Notification `json:"notifications"`
+	Unread        int            `json:"unread"` // Unread notifications in the whole inbox
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// LoadPriceModelPlugin opens a Go plugin whose init functions register price models with
+// RegisterPriceModel, and returns the names of the models it added. Loading a plugin again
+// adds nothing. Plugins must be built with the same Go version and module versions as the
+// server, see examples/pricemodel-plugin.
+func LoadPriceModelPlugin(path string) ([]string, error) {
+	before := make(map[string]bool)
+	for _, name := range PriceModelNames() {
+		before[name] = true
+	}
+
+	if _, err := plugin.Open(path); err != nil {
+		return nil, fmt.Errorf("failed to load price model plugin %s: %w", path, err)
+	}
+
+	added := []string{}
+	for _, name := range PriceModelNames() {
+		if !before[name] {
+			added = append(added, name)
+		}
+	}
+	return added, nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// MaxDecimals is the most decimal places of prices and volumes, as on Binance
+const MaxDecimals = 8
+
+// pow10 holds the powers of ten up to 10^MaxDecimals
+var pow10 = [MaxDecimals + 1]float64{1, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8}
+
+// Fixed is a fixed-point decimal, an integer number of units of 10^-decimals. Sums of
+// Fixed values are exact, unlike sums of float64 that drift to values like 99.99999999.
+type Fixed int64
+
+// ToFixed converts v to a fixed-point decimal with the given places, rounding half away from zero
+func ToFixed(v float64, decimals int) Fixed {
+	return Fixed(math.Round(v * pow10[decimals]))
+}
+
+// Float returns the float64 closest to the fixed-point decimal with the given places
+func (f Fixed) Float(decimals int) float64 {
+	return float64(f) / pow10[decimals]
+}
+
+// AddAmounts adds two prices or volumes of at most MaxDecimals places without floating
+// point drift
+func AddAmounts(a, b float64) float64 {
+	return (ToFixed(a, MaxDecimals) + ToFixed(b, MaxDecimals)).Float(MaxDecimals)
+}
+
+// Precision is the decimal precision of the prices and volumes of a symbol
+type Precision struct {
+	PriceDecimals  int     `json:"priceDecimals"`
+	TickSize       float64 `json:"tickSize"` // Smallest price change, a multiple of 10^-PriceDecimals
+	VolumeDecimals int     `json:"volumeDecimals"`
+}
+
+// DefaultPrecision quotes prices and volumes in cents
+var DefaultPrecision = Precision{PriceDecimals: 2, TickSize: 0.01, VolumeDecimals: 2}
+
+// Validate reports why the precision is unusable, if it is
+func (p Precision) Validate() error {
+	if p.PriceDecimals < 0 || p.PriceDecimals > MaxDecimals {
+		return fmt.Errorf("price decimals must be between 0 and %d, got %d", MaxDecimals, p.PriceDecimals)
+	}
+	if p.VolumeDecimals < 0 || p.VolumeDecimals > MaxDecimals {
+		return fmt.Errorf("volume decimals must be between 0 and %d, got %d", MaxDecimals, p.VolumeDecimals)
+	}
+	units := p.TickSize * pow10[p.PriceDecimals]
+	if p.TickSize <= 0 || math.Abs(units-math.Round(units)) > 1e-9 {
+		return fmt.Errorf("tick size must be a positive multiple of %g, got %g", 1/pow10[p.PriceDecimals], p.TickSize)
+	}
+	return nil
+}
+
+// tickUnits returns the tick size in units of the price decimals
+func (p Precision) tickUnits() Fixed {
+	return ToFixed(p.TickSize, p.PriceDecimals)
+}
+
+// Price rounds a price to the nearest tick, but not below one tick
+func (p Precision) Price(v float64) float64 {
+	tick := p.tickUnits()
+	ticks := Fixed(math.Round(float64(ToFixed(v, p.PriceDecimals)) / float64(tick)))
+	if ticks < 1 {
+		ticks = 1
+	}
+	return (ticks * tick).Float(p.PriceDecimals)
+}
+
+// Volume rounds a volume to the volume decimals
+func (p Precision) Volume(v float64) float64 {
+	return ToFixed(v, p.VolumeDecimals).Float(p.VolumeDecimals)
+}
+
+// AddVolume adds two volumes, rounding both to the volume decimals first
+func (p Precision) AddVolume(a, b float64) float64 {
+	return (ToFixed(a, p.VolumeDecimals) + ToFixed(b, p.VolumeDecimals)).Float(p.VolumeDecimals)
+}
@@ -0,0 +1,18 @@
+package models
+
+import "encoding/json"
+
+// Themes of the frontend
+const (
+	ThemeLight = "light"
+	ThemeDark  = "dark"
+)
+
+// Preferences are the settings of a user, kept on the server so they follow the user
+// across devices
+type Preferences struct {
+	TimeFrame TimeFrame                  `json:"timeframe,omitempty"` // Chart timeframe shown first, empty for the default
+	Theme     string                     `json:"theme,omitempty"`     // ThemeLight or ThemeDark, empty to follow the system
+	Drawings  map[string]json.RawMessage `json:"drawings,omitempty"`  // Chart drawings and annotations by symbol, stored as sent
+	UpdatedAt int64                      `json:"updatedAt,omitempty"` // Unix milliseconds, 0 if never saved
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SimulationParams describes how prices of a symbol are generated
+type SimulationParams struct {
+	Symbol     string  `json:"symbol"`
+	Model      string  `json:"model"`
+	BasePrice  float64 `json:"basePrice"`
+	Volatility float64 `json:"volatility"`
+	Drift      float64 `json:"drift"` // Average price change per tick
+
+	Seasonality Seasonality `json:"seasonality,omitempty"` // Intraday curve of the volatility, see At
+}
+
+// At returns the parameters in effect at a time: the volatility follows the intraday
+// seasonality, so price models only see the volatility of the moment
+func (p SimulationParams) At(at time.Time) SimulationParams {
+	p.Volatility *= p.Seasonality.At(at)
+	return p
+}
+
+// SimulationUpdate is a partial update of SimulationParams, nil fields are left unchanged
+type SimulationUpdate struct {
+	Symbol     string   `json:"symbol,omitempty"` // Optional, must match the simulated symbol
+	Model      *string  `json:"model,omitempty"`
+	BasePrice  *float64 `json:"basePrice,omitempty"`
+	Volatility *float64 `json:"volatility,omitempty"`
+	Drift      *float64 `json:"drift,omitempty"`
+}
+
+// PriceModel generates the next price of a symbol from the previous one. All randomness
+// must come from rng, so a simulation can be continued from a saved random state.
+type PriceModel interface {
+	Next(price float64, params SimulationParams, rng *rand.Rand) float64
+}
+
+// PriceModelFunc adapts a function to the PriceModel interface
+type PriceModelFunc func(price float64, params SimulationParams, rng *rand.Rand) float64
+
+// Next calls f(price, params, rng)
+func (f PriceModelFunc) Next(price float64, params SimulationParams, rng *rand.Rand) float64 {
+	return f(price, params, rng)
+}
+
+// Built-in price models
+const (
+	PriceModelRandomWalk    = "random"
+	PriceModelMeanReverting = "meanrevert"
+)
+
+// PriceModelFactory creates a price model. Every simulator gets its own instance, so
+// models may keep state between calls of Next.
+type PriceModelFactory func() PriceModel
+
+var (
+	priceModelsLock sync.RWMutex
+	priceModels     = make(map[string]PriceModelFactory)
+)
+
+func init() {
+	// Random walk with a random step size, the original behaviour of the simulator
+	RegisterPriceModel(PriceModelRandomWalk, stateless(func(price float64, params SimulationParams, rng *rand.Rand) float64 {
+		volatility := rng.Float64() * params.Volatility
+		return price + (rng.Float64()-0.5)*volatility + params.Drift
+	}))
+
+	// Random walk that is pulled back towards the base price
+	RegisterPriceModel(PriceModelMeanReverting, stateless(func(price float64, params SimulationParams, rng *rand.Rand) float64 {
+		reversion := (params.BasePrice - price) * 0.05
+		return price + reversion + (rng.Float64()-0.5)*params.Volatility + params.Drift
+	}))
+}
+
+// stateless returns a factory sharing a single model without state
+func stateless(f PriceModelFunc) PriceModelFactory {
+	return func() PriceModel { return f }
+}
+
+// RegisterPriceModel makes a price model available under name, to be selected with
+// simulation.model. It panics if the name is empty or already taken, or factory is nil.
+func RegisterPriceModel(name string, factory PriceModelFactory) {
+	priceModelsLock.Lock()
+	defer priceModelsLock.Unlock()
+
+	if name == "" {
+		panic("models: RegisterPriceModel with empty name")
+	}
+	if factory == nil {
+		panic("models: RegisterPriceModel with nil factory for " + name)
+	}
+	if _, ok := priceModels[name]; ok {
+		panic("models: RegisterPriceModel called twice for " + name)
+	}
+	priceModels[name] = factory
+}
+
+// GetPriceModel returns a new instance of the price model registered under name
+func GetPriceModel(name string) (PriceModel, bool) {
+	priceModelsLock.RLock()
+	factory, ok := priceModels[name]
+	priceModelsLock.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+	return factory(), true
+}
+
+// PriceModelNames returns the names of all available price models
+func PriceModelNames() []string {
+	priceModelsLock.RLock()
+	defer priceModelsLock.RUnlock()
+
+	names := make([]string, 0, len(priceModels))
+	for name := range priceModels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
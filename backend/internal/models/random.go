@@ -0,0 +1,52 @@
+package models
+
+import "sync"
+
+// RandomSource is a math/rand source whose complete state is a single number, so
+// the sequence of generated prices can be saved and continued later. It implements
+// SplitMix64 and is safe for concurrent use.
+type RandomSource struct {
+	mu    sync.Mutex
+	state uint64
+}
+
+// NewRandomSource creates a source starting from seed
+func NewRandomSource(seed int64) *RandomSource {
+	return &RandomSource{state: uint64(seed)}
+}
+
+// Seed restarts the source from seed
+func (s *RandomSource) Seed(seed int64) {
+	s.SetState(uint64(seed))
+}
+
+// Uint64 returns a pseudo-random 64-bit value
+func (s *RandomSource) Uint64() uint64 {
+	s.mu.Lock()
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	s.mu.Unlock()
+
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Int63 returns a non-negative pseudo-random 63-bit integer
+func (s *RandomSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// State returns the current state, restoring it with SetState repeats all following values
+func (s *RandomSource) State() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// SetState continues the source from a state returned by State
+func (s *RandomSource) SetState(state uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// CandleSchema is how candles are encoded in JSON
+type CandleSchema string
+
+// Candle schemas clients choose from with ?schema=
+const (
+	SchemaXY   CandleSchema = "xy"   // {"x":time,"y":[open,high,low,close],"volume":v}, as the frontend's charting library expects
+	SchemaOHLC CandleSchema = "ohlc" // {"time":t,"open":o,"high":h,"low":l,"close":c,"volume":v}
+)
+
+// ParseCandleSchema parses the name of a candle schema, SchemaXY if empty
+func ParseCandleSchema(value string) (CandleSchema, error) {
+	switch schema := CandleSchema(value); schema {
+	case "":
+		return SchemaXY, nil
+	case SchemaXY, SchemaOHLC:
+		return schema, nil
+	}
+	return "", fmt.Errorf("must be %q or %q, got %q", SchemaXY, SchemaOHLC, value)
+}
+
+// OHLCCandle is a candle with explicitly named fields, see SchemaOHLC
+type OHLCCandle struct {
+	Time       int64   `json:"time"` // Unix milliseconds the candle starts at
+	Open       float64 `json:"open"`
+	High       float64 `json:"high"`
+	Low        float64 `json:"low"`
+	Close      float64 `json:"close"`
+	Volume     float64 `json:"volume"`
+	IsComplete bool    `json:"isComplete,omitempty"`
+}
+
+// OHLC returns the candle with explicitly named fields
+func (c CandleData) OHLC() OHLCCandle {
+	return OHLCCandle{
+		Time:       c.Timestamp,
+		Open:       c.Values[0],
+		High:       c.Values[1],
+		Low:        c.Values[2],
+		Close:      c.Values[3],
+		Volume:     c.Volume,
+		IsComplete: c.IsComplete,
+	}
+}
+
+// OHLCUpdateMessage is an UpdateMessage in SchemaOHLC
+type OHLCUpdateMessage struct {
+	Type      string     `json:"type"`
+	Candle    OHLCCandle `json:"candle"`
+	TimeFrame TimeFrame  `json:"timeFrame,omitempty"`
+	Offset    int64      `json:"offset,omitempty"`
+}
+
+// OHLCTimeFrameData is a TimeFrameData in SchemaOHLC
+type OHLCTimeFrameData struct {
+	TimeFrame TimeFrame    `json:"timeFrame"`
+	Candles   []OHLCCandle `json:"candles"`
+}
+
+// WithSchema returns a message sent to clients with its candles in a schema, and whether
+// it has any. Messages in SchemaXY and those without candles are returned as they are.
+func WithSchema(message interface{}, schema CandleSchema) (interface{}, bool) {
+	if schema != SchemaOHLC {
+		return message, false
+	}
+	switch m := message.(type) {
+	case UpdateMessage:
+		return OHLCUpdateMessage{Type: m.Type, Candle: m.Candle.OHLC(), TimeFrame: m.TimeFrame, Offset: m.Offset}, true
+	case TimeFrameData:
+		data := OHLCTimeFrameData{TimeFrame: m.TimeFrame}
+		if m.Candles != nil {
+			data.Candles = make([]OHLCCandle, len(m.Candles))
+			for i, candle := range m.Candles {
+				data.Candles[i] = candle.OHLC()
+			}
+		}
+		return data, true
+	}
+	return message, false
+}
+
+// AppendJSON appends the JSON encoding of the candle to dst
+func (c OHLCCandle) AppendJSON(dst []byte) ([]byte, error) {
+	var err error
+
+	dst = append(dst, `{"time":`...)
+	dst = strconv.AppendInt(dst, c.Time, 10)
+	for _, field := range [...]struct {
+		name  string
+		value float64
+	}{{`,"open":`, c.Open}, {`,"high":`, c.High}, {`,"low":`, c.Low}, {`,"close":`, c.Close}, {`,"volume":`, c.Volume}} {
+		dst = append(dst, field.name...)
+		if dst, err = appendFloat(dst, field.value); err != nil {
+			return dst, err
+		}
+	}
+	if c.IsComplete {
+		dst = append(dst, `,"isComplete":true`...)
+	}
+	return append(dst, '}'), nil
+}
+
+// AppendCandlesSchema is AppendCandles in a candle schema
+func AppendCandlesSchema(dst []byte, candles []CandleData, schema CandleSchema) ([]byte, error) {
+	if schema != SchemaOHLC {
+		return AppendCandles(dst, candles)
+	}
+	var err error
+	for i, candle := range candles {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		if dst, err = candle.OHLC().AppendJSON(dst); err != nil {
+			return dst, err
+		}
+	}
+	return dst, nil
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// hoursPerDay is the number of multipliers of an intraday seasonality
+const hoursPerDay = 24
+
+// Seasonality is an intraday curve of activity: multipliers of the 24 hours of a day in UTC,
+// interpolated between the hours. Empty is flat, every hour trades alike.
+type Seasonality []float64
+
+// DefaultSeasonality is U-shaped like the trading day of an exchange: busy around the open and
+// close at midnight UTC, quiet around midday. It averages about 1, so it shifts activity
+// within a day without changing its total.
+var DefaultSeasonality = Seasonality{
+	1.70, 1.52, 1.35, 1.20, 1.07, 0.95, 0.85, 0.77, 0.70, 0.65, 0.62, 0.60,
+	0.60, 0.62, 0.65, 0.70, 0.77, 0.85, 0.95, 1.07, 1.20, 1.35, 1.52, 1.70,
+}
+
+// Validate reports why the curve is unusable, if it is
+func (s Seasonality) Validate() error {
+	if len(s) != 0 && len(s) != hoursPerDay {
+		return fmt.Errorf("seasonality must have a multiplier for each of the %d hours, got %d", hoursPerDay, len(s))
+	}
+	for hour, m := range s {
+		if !(m >= 0) || math.IsInf(m, 0) {
+			return fmt.Errorf("seasonality of hour %d must be a non-negative number, got %g", hour, m)
+		}
+	}
+	return nil
+}
+
+// At returns the multiplier at a time, interpolated between the hours
+func (s Seasonality) At(at time.Time) float64 {
+	if len(s) != hoursPerDay {
+		return 1
+	}
+	at = at.UTC()
+	hour := at.Hour()
+	frac := float64(at.Minute()*60+at.Second()) / 3600
+	return s[hour]*(1-frac) + s[(hour+1)%hoursPerDay]*frac
+}
@@ -0,0 +1,22 @@
+package models
+
+// Trade is a trade of the symbol: a price move of the simulation with the volume traded with
+// it, or a trade of the exchange feed
+type Trade struct {
+	ID           int64   `json:"id"` // Increasing from 1 since startup
+	Price        float64 `json:"price"`
+	Quantity     float64 `json:"qty"`
+	Time         int64   `json:"time"`         // Unix milliseconds
+	IsBuyerMaker bool    `json:"isBuyerMaker"` // Seller initiated, the price ticked down
+}
+
+// AggTrade is a run of consecutive trades at the same price and side, compressed into one
+type AggTrade struct {
+	ID           int64   `json:"id"` // ID of the first trade
+	Price        float64 `json:"price"`
+	Quantity     float64 `json:"qty"`     // Sum of the quantities
+	FirstID      int64   `json:"firstId"` // IDs of the first and last trade of the run
+	LastID       int64   `json:"lastId"`
+	Time         int64   `json:"time"` // Unix milliseconds of the first trade
+	IsBuyerMaker bool    `json:"isBuyerMaker"`
+}
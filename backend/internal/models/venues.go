@@ -0,0 +1,18 @@
+package models
+
+// VenueQuote is the price of a symbol on a simulated exchange
+type VenueQuote struct {
+	Venue   string  `json:"venue"`
+	Symbol  string  `json:"symbol"`
+	Path    string  `json:"path"`    // Prefix of the venue's routes
+	Latency int64   `json:"latency"` // Milliseconds the venue's prices lag behind
+	Price   float64 `json:"price"`   // Last price, 0 before the first one
+}
+
+// VenueMarket is a symbol quoted on several simulated exchanges
+type VenueMarket struct {
+	Underlying   string       `json:"underlying"`
+	Consolidated VenueQuote   `json:"consolidated"` // Average price of the venues
+	Venues       []VenueQuote `json:"venues"`
+	Spread       float64      `json:"spread"` // Highest minus lowest venue price, what buying on one and selling on another gains
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Periods of the average price moves the volume model compares each move with, in minutes
+const (
+	anchorPeriod      = 1  // Price level the trend of a move is measured from
+	recentMovePeriod  = 15 // Volatility regime
+	averageMovePeriod = 240
+	maxActivity       = 5 // Cap of the trend and regime factors, so a single jump doesn't dwarf a day of volume
+)
+
+// VolumeParams describes how traded volume follows the price
+type VolumeParams struct {
+	Base              float64     `json:"base"`                  // Average volume per minute
+	PriceSensitivity  float64     `json:"priceSensitivity"`      // From 0 to 1, how much volume grows with the size of a price move
+	RegimeSensitivity float64     `json:"regimeSensitivity"`     // From 0 to 1, how much volume grows in volatile periods
+	Intraday          Seasonality `json:"intraday,omitempty"`    // Curve of the simulation, shared with the volatility of prices
+	Seasonality       Seasonality `json:"seasonality,omitempty"` // Curve of the volume only, on top of Intraday
+}
+
+// DefaultVolumeParams trades about as much as the simulator did before volume followed the price
+var DefaultVolumeParams = VolumeParams{Base: 2, PriceSensitivity: 0.6, RegimeSensitivity: 0.5}
+
+// Validate reports why the volume parameters are unusable, if they are
+func (p VolumeParams) Validate() error {
+	if p.Base < 0 || math.IsInf(p.Base, 0) || math.IsNaN(p.Base) {
+		return fmt.Errorf("base volume must be a non-negative number, got %g", p.Base)
+	}
+	if !(p.PriceSensitivity >= 0 && p.PriceSensitivity <= 1) {
+		return fmt.Errorf("price sensitivity must be between 0 and 1, got %g", p.PriceSensitivity)
+	}
+	if !(p.RegimeSensitivity >= 0 && p.RegimeSensitivity <= 1) {
+		return fmt.Errorf("regime sensitivity must be between 0 and 1, got %g", p.RegimeSensitivity)
+	}
+	if err := p.Intraday.Validate(); err != nil {
+		return fmt.Errorf("intraday %w", err)
+	}
+	return p.Seasonality.Validate()
+}
+
+// Seasonal returns the multiplier of both seasonality curves at a time
+func (p VolumeParams) Seasonal(at time.Time) float64 {
+	return p.Intraday.At(at) * p.Seasonality.At(at)
+}
+
+// VolumeState is the state of a VolumeModel, part of snapshots
+type VolumeState struct {
+	Anchor       float64 `json:"anchor"`       // Average price of about the last minute
+	AverageTrend float64 `json:"averageTrend"` // Average distance of the price from the anchor
+	RecentMove   float64 `json:"recentMove"`   // Average absolute price change of about the last quarter hour
+	AverageMove  float64 `json:"averageMove"`  // Average absolute price change of about the last hours
+	Minutes      float64 `json:"minutes"`      // Trading the averages cover, until it reaches the longest period
+}
+
+// VolumeModel generates the volume traded with every price move. Volume grows with the
+// trend, how far the price moved from its average of the last minute compared with how far
+// it usually does, so candles with large bodies and ranges trade more. It also grows with
+// the volatility regime, the recent average move compared with the long-run one, and
+// follows the time of day. A VolumeModel must not be used concurrently.
+type VolumeModel struct {
+	state VolumeState
+}
+
+// State returns the averages the model compares moves with
+func (m *VolumeModel) State() VolumeState {
+	return m.state
+}
+
+// SetState continues the model from a saved state
+func (m *VolumeModel) SetState(state VolumeState) {
+	m.state = state
+}
+
+// Next returns the volume traded with a move of the price from prev at a time. The move stands
+// for share of a minute of trading, such as the broadcast interval. All randomness comes from rng.
+func (m *VolumeModel) Next(prev, price float64, at time.Time, share float64, params VolumeParams, rng *rand.Rand) float64 {
+	if m.state.Minutes == 0 {
+		m.state.Anchor = prev
+	}
+	m.state.Minutes = math.Min(m.state.Minutes+share, averageMovePeriod)
+
+	move := math.Abs(price - prev)
+	trend := math.Abs(price - m.state.Anchor)
+	m.state.Anchor += (price - m.state.Anchor) * m.smoothing(share, anchorPeriod)
+	m.state.AverageTrend += (trend - m.state.AverageTrend) * m.smoothing(share, averageMovePeriod)
+	m.state.RecentMove += (move - m.state.RecentMove) * m.smoothing(share, recentMovePeriod)
+	m.state.AverageMove += (move - m.state.AverageMove) * m.smoothing(share, averageMovePeriod)
+
+	relative, regime := 1.0, 1.0
+	if m.state.AverageTrend > 0 {
+		relative = math.Min(trend/m.state.AverageTrend, maxActivity)
+	}
+	if m.state.AverageMove > 0 {
+		regime = math.Min(m.state.RecentMove/m.state.AverageMove, maxActivity)
+	}
+	activity := math.Min((1-params.PriceSensitivity+params.PriceSensitivity*relative)*
+		(1-params.RegimeSensitivity+params.RegimeSensitivity*regime), maxActivity)
+
+	noise := 0.5 + rng.Float64() // Averages 1
+	return params.Base * share * activity * params.Seasonal(at) * noise
+}
+
+// smoothing returns the weight of a new value in an exponential moving average over period
+// minutes, for a value standing for share of a minute. Until the averages cover the period,
+// they are plain averages of all values, so the first values don't linger.
+func (m *VolumeModel) smoothing(share, period float64) float64 {
+	return math.Max(-math.Expm1(-share/period), share/m.state.Minutes)
+}
@@ -0,0 +1,42 @@
+package models
+
+// Watchlist is an ordered list of symbols a user follows
+type Watchlist struct {
+	ID        string           `json:"id"`
+	Name      string           `json:"name"`
+	Symbols   []WatchlistEntry `json:"symbols"`   // In display order
+	CreatedAt int64            `json:"createdAt"` // Unix milliseconds
+	UpdatedAt int64            `json:"updatedAt"` // Unix milliseconds
+}
+
+// WatchlistEntry is a symbol on a watchlist with the price alerts bound to it
+type WatchlistEntry struct {
+	Symbol  string         `json:"symbol"`
+	Alerts  []PriceAlert   `json:"alerts,omitempty"`
+	Summary *SymbolSummary `json:"summary,omitempty"` // Live data when listed, not stored
+}
+
+// PriceAlert fires when the price of a symbol reaches a level. It is delivered to the inbox
+// of the user and to the targets to notify.
+type PriceAlert struct {
+	Above  float64       `json:"above,omitempty"`  // Fires at this price or higher, 0 for none
+	Below  float64       `json:"below,omitempty"`  // Fires at this price or lower, 0 for none
+	Notify []AlertTarget `json:"notify,omitempty"` // Services the alert is also sent to
+}
+
+// AlertTarget is a destination on a service outside the app, such as a Telegram chat
+type AlertTarget struct {
+	Notifier string `json:"notifier"` // Name of the service, such as "telegram" or "discord"
+	Target   string `json:"target"`   // Destination on the service, such as a chat ID or webhook URL
+}
+
+// SymbolSummary is the live market data of a symbol over the last 24 hours
+type SymbolSummary struct {
+	Path   string  `json:"path"`   // Prefix of the symbol's routes, empty for the default simulation
+	Price  float64 `json:"price"`  // Last price
+	Change float64 `json:"change"` // Relative to the open 24 hours ago
+	High   float64 `json:"high"`
+	Low    float64 `json:"low"`
+	Volume float64 `json:"volume"`
+	Halted bool    `json:"halted"` // Trading is halted
+}
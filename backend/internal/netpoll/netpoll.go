@@ -0,0 +1,33 @@
+// Package netpoll watches many connections for incoming data with a single
+// event loop, so idle connections don't each need a goroutine blocked in Read.
+package netpoll
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// ErrUnsupported is returned by New on platforms without an event loop implementation
+var ErrUnsupported = errors.New("netpoll is not supported on this platform")
+
+// fileDescriptor returns the file descriptor of a connection. Connections that
+// aren't backed by a socket, like TLS connections, can't be polled.
+func fileDescriptor(conn net.Conn) (int, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, fmt.Errorf("connection of type %T has no file descriptor", conn)
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to access connection: %w", err)
+	}
+
+	fd := -1
+	if err := raw.Control(func(f uintptr) { fd = int(f) }); err != nil {
+		return 0, fmt.Errorf("failed to access connection: %w", err)
+	}
+	return fd, nil
+}
@@ -0,0 +1,160 @@
+//go:build linux
+
+package netpoll
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"server/internal/metrics"
+)
+
+const (
+	maxEvents   = 128 // Events returned by a single wait
+	waitTimeout = 500 // Milliseconds between checks whether the poller was closed
+)
+
+// Poller runs a handler whenever one of its connections becomes readable. The
+// handlers run on a fixed number of worker goroutines, and a connection is not
+// reported again until its handler returned, so handlers never run concurrently
+// for the same connection.
+type Poller struct {
+	epfd     int
+	lock     sync.Mutex
+	handlers map[int]func() // Keyed by file descriptor
+	ready    chan int
+	closed   atomic.Bool
+}
+
+// New creates a poller whose handlers run on the given number of workers
+func New(workers int) (*Poller, error) {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create epoll instance: %w", err)
+	}
+
+	p := &Poller{
+		epfd:     epfd,
+		handlers: make(map[int]func()),
+		ready:    make(chan int, maxEvents),
+	}
+
+	go p.wait()
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p, nil
+}
+
+// Add starts watching a connection. The handler should consume the available data
+// without blocking for long, it runs on one of the shared workers.
+func (p *Poller) Add(conn net.Conn, onReadable func()) error {
+	fd, err := fileDescriptor(conn)
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.handlers[fd] = onReadable
+	if err := syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_ADD, fd, readEvent(fd)); err != nil {
+		delete(p.handlers, fd)
+		return fmt.Errorf("failed to watch connection: %w", err)
+	}
+	return nil
+}
+
+// Remove stops watching a connection. It must be called before the connection is
+// closed, so a reused file descriptor isn't mistaken for the old connection.
+func (p *Poller) Remove(conn net.Conn) error {
+	fd, err := fileDescriptor(conn)
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if _, ok := p.handlers[fd]; !ok {
+		return nil
+	}
+	delete(p.handlers, fd)
+	if err := syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_DEL, fd, nil); err != nil {
+		return fmt.Errorf("failed to unwatch connection: %w", err)
+	}
+	return nil
+}
+
+// Close stops the event loop and its workers. Watched connections are left open.
+func (p *Poller) Close() error {
+	p.closed.Store(true) // The event loop closes the epoll instance once it notices
+	return nil
+}
+
+// readEvent returns the registration for a single readiness notification of fd
+func readEvent(fd int) *syscall.EpollEvent {
+	return &syscall.EpollEvent{
+		Events: syscall.EPOLLIN | syscall.EPOLLRDHUP | syscall.EPOLLONESHOT,
+		Fd:     int32(fd),
+	}
+}
+
+// wait is the event loop, it hands readable connections to the workers
+func (p *Poller) wait() {
+	defer close(p.ready)
+	defer syscall.Close(p.epfd)
+
+	events := make([]syscall.EpollEvent, maxEvents)
+	for !p.closed.Load() {
+		n, err := syscall.EpollWait(p.epfd, events, waitTimeout)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			log.Println("Error waiting for connection events:", err)
+			return
+		}
+		for i := 0; i < n; i++ {
+			p.ready <- int(events[i].Fd)
+		}
+	}
+}
+
+// work runs the handlers of readable connections and rearms their notification
+func (p *Poller) work() {
+	for fd := range p.ready {
+		p.lock.Lock()
+		handler, ok := p.handlers[fd]
+		p.lock.Unlock()
+		if !ok {
+			continue // Removed while the event was queued
+		}
+
+		p.run(handler)
+
+		p.lock.Lock()
+		if _, ok := p.handlers[fd]; ok {
+			if err := syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_MOD, fd, readEvent(fd)); err != nil {
+				log.Println("Error rearming connection:", err)
+			}
+		}
+		p.lock.Unlock()
+	}
+}
+
+// run calls a handler, recovering from panics so the worker survives
+func (p *Poller) run(handler func()) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			metrics.PanicsRecovered.Inc()
+			log.Printf("Panic in connection handler: %v\n%s", rec, debug.Stack())
+		}
+	}()
+	handler()
+}
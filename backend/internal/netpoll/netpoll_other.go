@@ -0,0 +1,28 @@
+//go:build !linux
+
+package netpoll
+
+import "net"
+
+// Poller is only implemented on Linux
+type Poller struct{}
+
+// New returns ErrUnsupported, callers fall back to a goroutine per connection
+func New(workers int) (*Poller, error) {
+	return nil, ErrUnsupported
+}
+
+// Add is not supported on this platform
+func (p *Poller) Add(conn net.Conn, onReadable func()) error {
+	return ErrUnsupported
+}
+
+// Remove is not supported on this platform
+func (p *Poller) Remove(conn net.Conn) error {
+	return ErrUnsupported
+}
+
+// Close is not supported on this platform
+func (p *Poller) Close() error {
+	return ErrUnsupported
+}
@@ -0,0 +1,76 @@
+package quota
+
+import (
+	"sync"
+	"time"
+
+	"server/internal/metrics"
+)
+
+// pruneInterval is how often counters of past windows are dropped
+const pruneInterval = time.Minute
+
+var exceeded = metrics.NewCounter("seedventure_quota_exceeded_total", "Number of requests and messages rejected by a quota")
+
+// counter counts the uses of a quota in one window
+type counter struct {
+	start  time.Time
+	window time.Duration
+	count  int
+}
+
+// Limiter counts what users do in fixed windows, e.g. requests per minute, and rejects
+// what exceeds a limit. Limits are passed with every call so reloaded limits apply
+// immediately.
+type Limiter struct {
+	lock      sync.Mutex
+	counters  map[string]*counter // By quota and user
+	lastPrune time.Time
+}
+
+// NewLimiter creates a limiter without any counts
+func NewLimiter() *Limiter {
+	return &Limiter{
+		counters:  make(map[string]*counter),
+		lastPrune: time.Now(),
+	}
+}
+
+// Allow counts a use of quota by user and reports whether it stays within limit uses per
+// window. If not, it returns how long until the window ends. Limits below 1 allow everything.
+func (l *Limiter) Allow(quota, user string, limit int, window time.Duration) (bool, time.Duration) {
+	if limit < 1 {
+		return true, 0
+	}
+	now := time.Now()
+	key := quota + "|" + user
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if now.Sub(l.lastPrune) >= pruneInterval {
+		l.pruneLocked(now)
+	}
+
+	c, ok := l.counters[key]
+	if !ok || now.Sub(c.start) >= window {
+		c = &counter{start: now, window: window}
+		l.counters[key] = c
+	}
+	if c.count >= limit {
+		exceeded.Inc()
+		return false, c.start.Add(window).Sub(now)
+	}
+	c.count++
+	return true, 0
+}
+
+// pruneLocked drops the counters of windows that ended. Requires l.lock.
+func (l *Limiter) pruneLocked(now time.Time) {
+	for key, c := range l.counters {
+		if now.Sub(c.start) >= c.window {
+			delete(l.counters, key)
+		}
+	}
+	l.lastPrune = now
+}
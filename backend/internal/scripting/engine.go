@@ -0,0 +1,470 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"server/internal/config"
+	"server/internal/metrics"
+	"server/internal/models"
+
+	"github.com/d5/tengo/v2"
+	"github.com/d5/tengo/v2/stdlib"
+)
+
+// Scripts are Tengo programs run after every tick of the current 1-minute candle and
+// every completed candle. They see these variables:
+//
+//	event   "tick" or "candle"
+//	candle  {time, open, high, low, close, volume}
+//	params  {model, basePrice, volatility, drift}, changes are applied to the simulation
+//	state   map kept between runs of the script
+//	log     array whose items are written to the server log after the run
+//
+// Only modules without access to the host are importable. Runs are limited in time
+// and allocations, a script failing maxConsecutiveErrors times in a row is disabled.
+
+// Script events
+const (
+	EventTick   = "tick"   // The current 1-minute candle moved
+	EventCandle = "candle" // A 1-minute candle was completed
+)
+
+const (
+	eventQueueSize        = 256 // Events waiting for the scripts, further ones are dropped
+	maxConsecutiveErrors  = 10
+	maxScriptStringLength = 1 << 20 // Longest string or byte slice a script can create
+)
+
+// allowedModules are the standard library modules scripts can import
+var allowedModules = []string{"math", "text", "json", "base64", "hex", "enum"}
+
+var (
+	// ErrScriptNotFound is returned for names without an installed script
+	ErrScriptNotFound = errors.New("script not found")
+	// ErrInvalidScriptName is returned for names that can't be used as file names
+	ErrInvalidScriptName = errors.New("script names must be 1-64 letters, digits, dashes or underscores")
+	// ErrTooManyScripts is returned when installing a script beyond scripting.maxScripts
+	ErrTooManyScripts = errors.New("the maximum number of scripts is installed")
+)
+
+// scriptName matches valid script names
+var scriptName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+var (
+	scriptRuns          = metrics.NewCounter("seedventure_script_runs_total", "Number of script runs")
+	scriptErrors        = metrics.NewCounter("seedventure_script_errors_total", "Number of script runs that failed or exceeded their limits")
+	scriptEventsDropped = metrics.NewCounter("seedventure_script_events_dropped_total", "Number of events dropped because scripts could not keep up")
+)
+
+// Simulation is the part of the price service scripts can read and change
+type Simulation interface {
+	GetSimulationParams() models.SimulationParams
+	UpdateSimulationParams(update models.SimulationUpdate) (models.SimulationParams, error)
+}
+
+// event is a candle change scripts are run for
+type event struct {
+	name   string
+	candle models.CandleData
+}
+
+// script is an installed script
+type script struct {
+	name     string
+	source   string
+	compiled *tengo.Compiled
+	state    map[string]interface{}
+
+	enabled           bool
+	runs              int64
+	errors            int64
+	consecutiveErrors int
+	lastError         string
+	runTime           time.Duration
+}
+
+// Engine runs the installed scripts on a goroutine of its own, so slow scripts
+// never hold up price generation
+type Engine struct {
+	dir         string // Directory the script sources are saved in
+	configStore *config.Store
+	simulation  Simulation
+	events      chan event
+
+	lock    sync.Mutex
+	scripts map[string]*script
+}
+
+// NewEngine creates an engine with the scripts saved in dir and starts running them
+func NewEngine(dir string, configStore *config.Store, simulation Simulation) (*Engine, error) {
+	tengo.MaxStringLen = maxScriptStringLength
+	tengo.MaxBytesLen = maxScriptStringLength
+
+	e := &Engine{
+		dir:         dir,
+		configStore: configStore,
+		simulation:  simulation,
+		events:      make(chan event, eventQueueSize),
+		scripts:     make(map[string]*script),
+	}
+	if err := e.load(); err != nil {
+		return nil, err
+	}
+
+	go e.run()
+	return e, nil
+}
+
+// load compiles the scripts saved in the script directory
+func (e *Engine) load() error {
+	if err := os.MkdirAll(e.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create script directory: %w", err)
+	}
+	entries, err := os.ReadDir(e.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list scripts: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".tengo")
+		if entry.IsDir() || name == entry.Name() || !scriptName.MatchString(name) {
+			continue
+		}
+		source, err := os.ReadFile(filepath.Join(e.dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read script %s: %w", name, err)
+		}
+		compiled, err := e.compile(string(source))
+		if err != nil {
+			log.Printf("Skipping script %s: %v", name, err)
+			continue
+		}
+		e.scripts[name] = &script{name: name, source: string(source), compiled: compiled, enabled: true}
+		log.Printf("Loaded script %s", name)
+	}
+	return nil
+}
+
+// compile checks and compiles a script with the current limits
+func (e *Engine) compile(source string) (*tengo.Compiled, error) {
+	limits := e.configStore.Get().Scripting
+	if len(source) > limits.MaxSourceBytes {
+		return nil, fmt.Errorf("script is %d bytes, the limit is %d", len(source), limits.MaxSourceBytes)
+	}
+
+	s := tengo.NewScript([]byte(source))
+	s.SetImports(stdlib.GetModuleMap(allowedModules...))
+	s.SetMaxAllocs(limits.MaxAllocs)
+	for _, name := range []string{"event", "candle", "params", "state", "log"} {
+		if err := s.Add(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	compiled, err := s.Compile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile script: %w", err)
+	}
+	return compiled, nil
+}
+
+// OnUpdate queues the scripts' runs for a candle update. It never blocks, events are
+// dropped if the scripts can't keep up.
+func (e *Engine) OnUpdate(message models.UpdateMessage) {
+	if message.TimeFrame != models.TimeFrame1Min {
+		return
+	}
+
+	ev := event{name: EventTick, candle: message.Candle}
+	if message.Candle.IsComplete {
+		ev.name = EventCandle
+	}
+
+	select {
+	case e.events <- ev:
+	default:
+		scriptEventsDropped.Inc()
+	}
+}
+
+// run runs the enabled scripts for every event, in the order of their names
+func (e *Engine) run() {
+	for ev := range e.events {
+		e.lock.Lock()
+		scripts := make([]*script, 0, len(e.scripts))
+		for _, s := range e.scripts {
+			if s.enabled {
+				scripts = append(scripts, s)
+			}
+		}
+		e.lock.Unlock()
+
+		sort.Slice(scripts, func(i, j int) bool {
+			return scripts[i].name < scripts[j].name
+		})
+		for _, s := range scripts {
+			e.runScript(s, ev)
+		}
+	}
+}
+
+// runScript runs a script for an event and applies the parameters it changed
+func (e *Engine) runScript(s *script, ev event) {
+	e.lock.Lock()
+	compiled := s.compiled
+	state := s.state
+	e.lock.Unlock()
+
+	if state == nil {
+		state = map[string]interface{}{}
+	}
+	params := e.simulation.GetSimulationParams()
+	paramsIn := map[string]interface{}{
+		"model":      params.Model,
+		"basePrice":  params.BasePrice,
+		"volatility": params.Volatility,
+		"drift":      params.Drift,
+	}
+
+	start := time.Now()
+	err := e.execute(compiled, ev, paramsIn, state)
+
+	var update models.SimulationUpdate
+	var logs []interface{}
+	if err == nil {
+		state = compiled.Get("state").Map()
+		logs = compiled.Get("log").Array()
+		update, err = paramsUpdate(params, compiled.Get("params").Map())
+	}
+	if err == nil && update != (models.SimulationUpdate{}) {
+		_, err = e.simulation.UpdateSimulationParams(update)
+	}
+	elapsed := time.Since(start)
+
+	for _, line := range logs {
+		log.Printf("Script %s: %v", s.name, line)
+	}
+
+	scriptRuns.Inc()
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	s.runs++
+	s.runTime += elapsed
+	if err != nil {
+		scriptErrors.Inc()
+		s.errors++
+		s.consecutiveErrors++
+		s.lastError = err.Error()
+		if s.consecutiveErrors >= maxConsecutiveErrors && s.enabled {
+			s.enabled = false
+			log.Printf("Disabled script %s after %d failed runs: %v", s.name, s.consecutiveErrors, err)
+		}
+		return
+	}
+	s.consecutiveErrors = 0
+	if state != nil {
+		s.state = state
+	}
+}
+
+// execute sets the variables of a run and runs the script within the time limit
+func (e *Engine) execute(compiled *tengo.Compiled, ev event, params, state map[string]interface{}) error {
+	c := ev.candle
+	variables := map[string]interface{}{
+		"event": ev.name,
+		"candle": map[string]interface{}{
+			"time":   c.Timestamp,
+			"open":   c.Values[0],
+			"high":   c.Values[1],
+			"low":    c.Values[2],
+			"close":  c.Values[3],
+			"volume": c.Volume,
+		},
+		"params": params,
+		"state":  state,
+		"log":    []interface{}{},
+	}
+	for name, value := range variables {
+		if err := compiled.Set(name, value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", name, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.configStore.Get().Scripting.Timeout)
+	defer cancel()
+	if err := compiled.RunContext(ctx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("script exceeded its time limit")
+		}
+		return err
+	}
+	return nil
+}
+
+// paramsUpdate returns the changes a script made to the simulation parameters
+func paramsUpdate(before models.SimulationParams, after map[string]interface{}) (models.SimulationUpdate, error) {
+	var update models.SimulationUpdate
+	if after == nil {
+		return update, nil
+	}
+
+	if v, ok := after["model"]; ok {
+		model, ok := v.(string)
+		if !ok {
+			return update, fmt.Errorf("params.model must be a string")
+		}
+		if model != before.Model {
+			update.Model = &model
+		}
+	}
+
+	floats := []struct {
+		name   string
+		before float64
+		target **float64
+	}{
+		{"basePrice", before.BasePrice, &update.BasePrice},
+		{"volatility", before.Volatility, &update.Volatility},
+		{"drift", before.Drift, &update.Drift},
+	}
+	for _, f := range floats {
+		v, ok := after[f.name]
+		if !ok {
+			continue
+		}
+		value, ok := toFloat(v)
+		if !ok {
+			return update, fmt.Errorf("params.%s must be a number", f.name)
+		}
+		if value != f.before {
+			*f.target = &value
+		}
+	}
+	return update, nil
+}
+
+// toFloat converts a number of a script to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// List returns all installed scripts, ordered by name
+func (e *Engine) List() []models.ScriptInfo {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	infos := make([]models.ScriptInfo, 0, len(e.scripts))
+	for _, s := range e.scripts {
+		infos = append(infos, s.info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// Get returns an installed script including its source
+func (e *Engine) Get(name string) (models.ScriptInfo, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	s, ok := e.scripts[name]
+	if !ok {
+		return models.ScriptInfo{}, ErrScriptNotFound
+	}
+	info := s.info()
+	info.Source = s.source
+	return info, nil
+}
+
+// Put installs a script or replaces the source of an installed one, which resets its
+// state. The script is saved in the script directory and enabled.
+func (e *Engine) Put(name, source string) (models.ScriptInfo, error) {
+	if !scriptName.MatchString(name) {
+		return models.ScriptInfo{}, ErrInvalidScriptName
+	}
+	compiled, err := e.compile(source)
+	if err != nil {
+		return models.ScriptInfo{}, err
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if _, ok := e.scripts[name]; !ok && len(e.scripts) >= e.configStore.Get().Scripting.MaxScripts {
+		return models.ScriptInfo{}, ErrTooManyScripts
+	}
+	if err := os.WriteFile(filepath.Join(e.dir, name+".tengo"), []byte(source), 0644); err != nil {
+		return models.ScriptInfo{}, fmt.Errorf("failed to save script: %w", err)
+	}
+
+	s := &script{name: name, source: source, compiled: compiled, enabled: true}
+	e.scripts[name] = s
+	log.Printf("Installed script %s", name)
+	return s.info(), nil
+}
+
+// Delete removes a script
+func (e *Engine) Delete(name string) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if _, ok := e.scripts[name]; !ok {
+		return ErrScriptNotFound
+	}
+	if err := os.Remove(filepath.Join(e.dir, name+".tengo")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete script: %w", err)
+	}
+	delete(e.scripts, name)
+	log.Printf("Deleted script %s", name)
+	return nil
+}
+
+// SetEnabled enables or disables a script until restart. Enabling resets its error count.
+func (e *Engine) SetEnabled(name string, enabled bool) (models.ScriptInfo, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	s, ok := e.scripts[name]
+	if !ok {
+		return models.ScriptInfo{}, ErrScriptNotFound
+	}
+	s.enabled = enabled
+	if enabled {
+		s.consecutiveErrors = 0
+	}
+	return s.info(), nil
+}
+
+// info describes the script without its source
+func (s *script) info() models.ScriptInfo {
+	info := models.ScriptInfo{
+		Name:      s.name,
+		Enabled:   s.enabled,
+		Runs:      s.runs,
+		Errors:    s.errors,
+		LastError: s.lastError,
+	}
+	if s.runs > 0 {
+		info.AvgRunTime = float64(s.runTime.Microseconds()) / float64(s.runs) / 1000
+	}
+	return info
+}
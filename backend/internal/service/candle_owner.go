@@ -0,0 +1,108 @@
+package service
+
+import (
+	"runtime/debug"
+
+	"server/internal/models"
+)
+
+// candleOp is an operation on the current candle
+type candleOp int
+
+const (
+	opStart     candleOp = iota // Start a new candle from the last close
+	opUpdate                    // Move the price of the current candle
+	opFinalize                  // Add the current candle to history
+	opDiscard                   // Drop the current candle without saving it
+	opSnapshot                  // Only read the current candle
+	opExclusive                 // Run a function that may read or replace the current candle
+)
+
+// candleCommand asks the owner goroutine to perform an operation. The owner
+// replies with a copy of the current candle afterwards, nil if there is none.
+type candleCommand struct {
+	op        candleOp
+	exclusive func(current *models.CandleData) *models.CandleData // Returns the new current candle for opExclusive
+	reply     chan candleReply
+}
+
+// candleReply is the current candle after a command, and the panic of the command if it failed
+type candleReply struct {
+	candle  *models.CandleData
+	failure *commandPanic
+}
+
+// ownCandle is the only goroutine that touches the current candle. Everyone
+// else sends it commands, which rules out data races on the candle by construction.
+func (ps *PriceService) ownCandle() {
+	var current *models.CandleData
+
+	for cmd := range ps.candleCommands {
+		var failure *commandPanic
+		current, failure = ps.perform(cmd, current)
+
+		var snapshot *models.CandleData
+		if current != nil {
+			candle := *current
+			snapshot = &candle
+		}
+		cmd.reply <- candleReply{candle: snapshot, failure: failure}
+	}
+}
+
+// perform runs a command on the current candle and returns the new one. A panic is
+// returned to be raised again by the sender, so a failing price model only breaks the loop
+// sending the command. The current candle is then kept as far as the command got.
+func (ps *PriceService) perform(cmd candleCommand, current *models.CandleData) (next *models.CandleData, failure *commandPanic) {
+	next = current
+	defer func() {
+		if rec := recover(); rec != nil {
+			failure = &commandPanic{value: rec, stack: debug.Stack()}
+		}
+	}()
+
+	switch cmd.op {
+	case opStart:
+		next = ps.startNewCandle()
+	case opUpdate:
+		if current == nil {
+			next = ps.startNewCandle()
+		} else {
+			ps.updateCandle(current)
+		}
+	case opFinalize:
+		if current != nil {
+			ps.finalizeCandle(current)
+			next = nil
+		}
+	case opDiscard:
+		next = nil
+	case opExclusive:
+		next = cmd.exclusive(current)
+	}
+	return next, nil
+}
+
+// waitReply waits for the reply to a command, raising the panic of the command again
+func waitReply(reply chan candleReply) *models.CandleData {
+	r := <-reply
+	if r.failure != nil {
+		panic(*r.failure)
+	}
+	return r.candle
+}
+
+// execute sends a command to the owner goroutine and waits until it is done
+func (ps *PriceService) execute(op candleOp) *models.CandleData {
+	reply := make(chan candleReply, 1)
+	ps.candleCommands <- candleCommand{op: op, reply: reply}
+	return waitReply(reply)
+}
+
+// executeExclusive runs fn on the owner goroutine, so the current candle can't change
+// while fn runs. fn gets the current candle, nil if there is none, and returns the new one.
+func (ps *PriceService) executeExclusive(fn func(current *models.CandleData) *models.CandleData) *models.CandleData {
+	reply := make(chan candleReply, 1)
+	ps.candleCommands <- candleCommand{op: opExclusive, exclusive: fn, reply: reply}
+	return waitReply(reply)
+}
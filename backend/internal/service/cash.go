@@ -0,0 +1,119 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"server/internal/models"
+)
+
+// cashFlowsFile is the file in the data directory holding the deposits and withdrawals
+const cashFlowsFile = "cashflows.json"
+
+// maxCashFlows caps the deposits and withdrawals kept, the oldest are discarded
+const maxCashFlows = 10000
+
+// ErrInvalidCashFlow is returned for a deposit or withdrawal of no amount
+var ErrInvalidCashFlow = errors.New("invalid cash flow")
+
+// loadCashFlows reads the deposits and withdrawals recorded before
+func (ps *PriceService) loadCashFlows() error {
+	ps.cashFlows = []models.CashFlow{}
+	data, err := os.ReadFile(filepath.Join(ps.dataDir, cashFlowsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read cash flows: %w", err)
+	}
+	if err := json.Unmarshal(data, &ps.cashFlows); err != nil {
+		return fmt.Errorf("failed to parse cash flows: %w", err)
+	}
+	return nil
+}
+
+// payCash pays the cash flows due at the close of a 1-minute candle: interest on idle cash
+// at every close, and the configured deposit at its multiples. Only called by finalizeCandle.
+func (ps *PriceService) payCash(close time.Time) {
+	ps.settingsLock.RLock()
+	cash := ps.cash
+	ps.settingsLock.RUnlock()
+
+	if cash.InterestRate != 0 {
+		ps.hub.PublishAll(models.CashMessage{Type: "cash", Flow: models.CashFlow{
+			Kind: models.CashInterest,
+			Rate: cash.InterestRate,
+			Time: close.UnixMilli(),
+		}})
+	}
+	if cash.Deposit != 0 && cash.DepositInterval > 0 && close.UnixMilli()%cash.DepositInterval.Milliseconds() == 0 {
+		if _, err := ps.PayCash(cash.Deposit, "scheduled", close); err != nil {
+			log.Printf("Error paying scheduled deposit: %v", err)
+		}
+	}
+}
+
+// PayCash deposits an amount into the cash of every player, or withdraws it if negative,
+// tells the clients and records it
+func (ps *PriceService) PayCash(amount float64, reason string, at time.Time) (models.CashFlow, error) {
+	if amount == 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return models.CashFlow{}, fmt.Errorf("%w: amount must be a number other than 0, got %g", ErrInvalidCashFlow, amount)
+	}
+
+	flow := models.CashFlow{Kind: models.CashDeposit, Amount: amount, Reason: reason, Time: at.UnixMilli()}
+	if amount < 0 {
+		flow.Kind, flow.Amount = models.CashWithdrawal, -amount
+	}
+	ps.hub.PublishAll(models.CashMessage{Type: "cash", Flow: flow})
+	log.Printf("Paid %s of %g (%s)", flow.Kind, flow.Amount, reason)
+
+	ps.cashLock.Lock()
+	defer ps.cashLock.Unlock()
+	ps.cashFlows = append(ps.cashFlows, flow)
+	if len(ps.cashFlows) > maxCashFlows {
+		ps.cashFlows = append([]models.CashFlow(nil), ps.cashFlows[len(ps.cashFlows)-maxCashFlows:]...)
+	}
+	if err := ps.saveCashFlows(); err != nil {
+		return flow, err
+	}
+	return flow, nil
+}
+
+// CashFlows returns the deposits and withdrawals in [from, to], oldest first
+func (ps *PriceService) CashFlows(from, to int64) []models.CashFlow {
+	ps.cashLock.Lock()
+	defer ps.cashLock.Unlock()
+
+	flows := []models.CashFlow{}
+	for _, flow := range ps.cashFlows {
+		if flow.Time >= from && flow.Time <= to {
+			flows = append(flows, flow)
+		}
+	}
+	return flows
+}
+
+// saveCashFlows writes the deposits and withdrawals. The caller holds cashLock.
+func (ps *PriceService) saveCashFlows() error {
+	data, err := json.MarshalIndent(ps.cashFlows, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cash flows: %w", err)
+	}
+
+	// Write a temporary file and rename it, so a crash never loses the whole ledger
+	path := filepath.Join(ps.dataDir, cashFlowsFile)
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cash flows: %w", err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		return fmt.Errorf("failed to write cash flows: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"log"
+	"math/rand"
+	"time"
+
+	"server/internal/config"
+	"server/internal/metrics"
+)
+
+var (
+	chaosDelays      = metrics.NewCounter("seedventure_chaos_delays_total", "Number of times chaos mode held back the frames of a client")
+	chaosDrops       = metrics.NewCounter("seedventure_chaos_drops_total", "Number of frames chaos mode didn't send")
+	chaosDisconnects = metrics.NewCounter("seedventure_chaos_disconnects_total", "Number of clients chaos mode disconnected")
+)
+
+// chaosFault is a fault chaos mode injects into a frame sent to a client
+type chaosFault int
+
+const (
+	faultNone       chaosFault = iota
+	faultDrop                  // The frame is not sent
+	faultDisconnect            // The client is disconnected instead
+)
+
+// SetChaos makes the hub inject the faults of chaos mode into the frames it sends, none if
+// chaos mode is disabled
+func (h *Hub) SetChaos(cfg config.ChaosConfig) {
+	if !cfg.Enabled {
+		h.chaos.Store(nil)
+		return
+	}
+	log.Printf("Chaos mode: delaying %g%% of frames up to %s, dropping %g%%, disconnecting %g%%",
+		cfg.DelayProbability*100, cfg.MaxDelay, cfg.DropProbability*100, cfg.DisconnectProbability*100)
+	h.chaos.Store(&cfg)
+}
+
+// chaosFault decides the fault injected into a broadcast frame
+func (h *Hub) chaosFault() chaosFault {
+	cfg := h.chaos.Load()
+	switch {
+	case cfg == nil:
+		return faultNone
+	case rand.Float64() < cfg.DisconnectProbability:
+		chaosDisconnects.Inc()
+		return faultDisconnect
+	case rand.Float64() < cfg.DropProbability:
+		chaosDrops.Inc()
+		return faultDrop
+	}
+	return faultNone
+}
+
+// delayWrite decides whether chaos mode holds back the next frame of a client. The client
+// stays scheduled, so no writer takes it, and is handed back to the writers after the
+// delay. Its frames keep their order and no writer waits for the delay.
+func (h *Hub) delayWrite(c *Client) bool {
+	cfg := h.chaos.Load()
+	if cfg == nil || cfg.DelayProbability == 0 || rand.Float64() >= cfg.DelayProbability {
+		return false
+	}
+	select {
+	case <-c.done:
+		return false // Let the writer see it closed
+	default:
+	}
+
+	chaosDelays.Inc()
+	delay := time.Duration(rand.Int63n(int64(cfg.MaxDelay))) + 1
+	time.AfterFunc(delay, func() { h.writes.push(c) })
+	return true
+}
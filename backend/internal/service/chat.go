@@ -0,0 +1,120 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"server/internal/models"
+)
+
+// chatFile is the file in the data directory holding the chat history
+const chatFile = "chat.json"
+
+// Errors of chat messages
+var (
+	ErrChatDisabled       = errors.New("chat is disabled")
+	ErrInvalidChatMessage = errors.New("invalid chat message")
+)
+
+// loadChat reads the chat history recorded before
+func (ps *PriceService) loadChat() error {
+	ps.chatHistory = []models.ChatEntry{}
+	data, err := os.ReadFile(filepath.Join(ps.dataDir, chatFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read chat history: %w", err)
+	}
+	if err := json.Unmarshal(data, &ps.chatHistory); err != nil {
+		return fmt.Errorf("failed to parse chat history: %w", err)
+	}
+	if n := len(ps.chatHistory); n > 0 {
+		ps.chatID = ps.chatHistory[n-1].ID
+	}
+	return nil
+}
+
+// PostChat passes a chat message through the configured chat filters, sends it to the
+// clients and records it. The message is returned even if recording it failed.
+func (ps *PriceService) PostChat(author string, guest bool, text string, at time.Time) (models.ChatEntry, error) {
+	ps.settingsLock.RLock()
+	chat := ps.chat
+	ps.settingsLock.RUnlock()
+
+	if !chat.Enabled {
+		return models.ChatEntry{}, ErrChatDisabled
+	}
+	text = strings.TrimSpace(text)
+	if text == "" || !utf8.ValidString(text) || strings.IndexFunc(text, unicode.IsControl) >= 0 {
+		return models.ChatEntry{}, fmt.Errorf("%w: text must be a single line that is not empty", ErrInvalidChatMessage)
+	}
+	if length := utf8.RuneCountInString(text); length > chat.MaxLength {
+		return models.ChatEntry{}, fmt.Errorf("%w: text must not exceed %d characters, got %d", ErrInvalidChatMessage, chat.MaxLength, length)
+	}
+	for _, name := range chat.Filters {
+		filter, ok := models.GetChatFilter(name)
+		if !ok {
+			continue
+		}
+		filtered, err := filter(text, chat.BlockedWords)
+		if err != nil {
+			return models.ChatEntry{}, fmt.Errorf("%w: %v", ErrInvalidChatMessage, err)
+		}
+		text = filtered
+	}
+
+	ps.chatLock.Lock()
+	defer ps.chatLock.Unlock()
+
+	ps.chatID++
+	entry := models.ChatEntry{ID: ps.chatID, Author: author, Guest: guest, Text: text, Time: at.UnixMilli()}
+	ps.hub.PublishAll(models.ChatMessage{Type: "chat", Message: entry})
+
+	ps.chatHistory = append(ps.chatHistory, entry)
+	if len(ps.chatHistory) > chat.History {
+		ps.chatHistory = append([]models.ChatEntry{}, ps.chatHistory[len(ps.chatHistory)-chat.History:]...)
+	}
+	if err := ps.saveChat(); err != nil {
+		return entry, err
+	}
+	return entry, nil
+}
+
+// ChatHistory returns the last limit chat messages, oldest first
+func (ps *PriceService) ChatHistory(limit int) []models.ChatEntry {
+	ps.chatLock.Lock()
+	defer ps.chatLock.Unlock()
+
+	start := len(ps.chatHistory) - limit
+	if start < 0 {
+		start = 0
+	}
+	return append([]models.ChatEntry{}, ps.chatHistory[start:]...)
+}
+
+// saveChat writes the chat history. The caller holds chatLock.
+func (ps *PriceService) saveChat() error {
+	data, err := json.MarshalIndent(ps.chatHistory, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode chat history: %w", err)
+	}
+
+	// Write a temporary file and rename it, so a crash never loses the whole history
+	path := filepath.Join(ps.dataDir, chatFile)
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write chat history: %w", err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		return fmt.Errorf("failed to write chat history: %w", err)
+	}
+	return nil
+}
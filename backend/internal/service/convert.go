@@ -0,0 +1,148 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"server/internal/models"
+)
+
+// rateLookback is how many periods before a candle the rates of a conversion are looked for
+const rateLookback = 60
+
+// ErrNoConversion is returned when no chain of markets converts between two currencies
+var ErrNoConversion = errors.New("no conversion between the currencies")
+
+// Market is a price service pricing its base asset in a quote currency
+type Market struct {
+	Symbol  string
+	Base    string
+	Quote   string
+	Service *PriceService
+}
+
+// ConversionLeg converts prices with the prices of a market, dividing by them if inverted
+type ConversionLeg struct {
+	Market   Market
+	Inverted bool
+}
+
+// FindConversion returns the shortest chain of markets converting prices in one currency
+// into another. Markets convert both ways, so cross rates are derived through any number
+// of intermediate currencies. The chain is empty if the currencies are the same.
+func FindConversion(markets []Market, from, to string) ([]ConversionLeg, error) {
+	// Visit markets in a fixed order, so the same chain is found every time
+	sorted := make([]Market, len(markets))
+	copy(sorted, markets)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Symbol < sorted[j].Symbol
+	})
+
+	previous := map[string]ConversionLeg{}
+	queue := []string{from}
+	for len(queue) > 0 && from != to {
+		currency := queue[0]
+		queue = queue[1:]
+		for _, market := range sorted {
+			var leg ConversionLeg
+			var next string
+			switch currency {
+			case market.Base:
+				leg, next = ConversionLeg{Market: market}, market.Quote
+			case market.Quote:
+				leg, next = ConversionLeg{Market: market, Inverted: true}, market.Base
+			default:
+				continue
+			}
+			if _, seen := previous[next]; seen || next == from {
+				continue
+			}
+			previous[next] = leg
+			if next == to {
+				queue = nil
+				break
+			}
+			queue = append(queue, next)
+		}
+	}
+
+	if _, ok := previous[to]; !ok && from != to {
+		return nil, fmt.Errorf("%w %s and %s", ErrNoConversion, from, to)
+	}
+	var legs []ConversionLeg
+	for currency := to; currency != from; {
+		leg := previous[currency]
+		legs = append([]ConversionLeg{leg}, legs...)
+		if leg.Inverted {
+			currency = leg.Market.Quote
+		} else {
+			currency = leg.Market.Base
+		}
+	}
+	return legs, nil
+}
+
+// ConvertCandles converts candles of a timeframe into another currency with the candles of
+// the markets of a conversion chain. A candle is converted with the rates of the candle of
+// each market of its period, or else the close of the market's last candle of the
+// rateLookback periods before. The open and close use the open and close of the rates, the
+// high and low the highest and lowest of them. Candles without a rate are left out,
+// volumes stay in the base asset.
+func ConvertCandles(candles []models.CandleData, tf models.TimeFrame, legs []ConversionLeg) []models.CandleData {
+	if len(candles) == 0 {
+		return []models.CandleData{}
+	}
+	from := candles[0].Timestamp - rateLookback*tf.GetDuration().Milliseconds()
+	to := candles[len(candles)-1].Timestamp
+
+	converted := make([]models.CandleData, len(candles))
+	copy(converted, candles)
+	keep := make([]bool, len(candles))
+	for i := range keep {
+		keep[i] = true
+	}
+
+	for _, leg := range legs {
+		rates := leg.Market.Service.GetHistoryRange(tf, from, to)
+		j := -1
+		for i := range converted {
+			for j+1 < len(rates) && rates[j+1].Timestamp <= converted[i].Timestamp {
+				j++
+			}
+			if j < 0 {
+				keep[i] = false
+				continue
+			}
+			open, closing := rates[j].Values[3], rates[j].Values[3]
+			if rates[j].Timestamp == converted[i].Timestamp {
+				open = rates[j].Values[0]
+			}
+			if leg.Inverted {
+				if open <= 0 || closing <= 0 {
+					keep[i] = false
+					continue
+				}
+				open, closing = 1/open, 1/closing
+			}
+			converted[i].Values[0] *= open
+			converted[i].Values[1] *= math.Max(open, closing)
+			converted[i].Values[2] *= math.Min(open, closing)
+			converted[i].Values[3] *= closing
+		}
+	}
+
+	result := make([]models.CandleData, 0, len(converted))
+	for i, candle := range converted {
+		if !keep[i] {
+			continue
+		}
+		for k, value := range candle.Values {
+			candle.Values[k] = models.ToFixed(value, models.MaxDecimals).Float(models.MaxDecimals)
+		}
+		candle.EnforceOHLC()
+		result = append(result, candle)
+	}
+	return result
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"log"
+
+	"server/internal/models"
+	"server/internal/store"
+)
+
+// follower applies the data of the primary. Its methods run on the goroutine of
+// follow.Primary.Run and hand the candles to the candle owner.
+type follower struct {
+	ps *PriceService
+}
+
+// runFollower mirrors the candles of the primary instead of generating prices. Finalized
+// 1-minute candles are aggregated locally, exactly like the primary does, and all storage
+// and broadcasting is shared with generated prices.
+func (ps *PriceService) runFollower() {
+	go ps.primary.Run(follower{ps: ps})
+	<-ps.stop
+}
+
+// IsFollower reports whether candles are mirrored from a primary. Followers are read-only,
+// changing their prices would only last until the next update of the primary.
+func (ps *PriceService) IsFollower() bool {
+	return ps.primary != nil
+}
+
+// Sync replaces the history of all timeframes with the primary's, the same way as a
+// data reload. The primary's current candle becomes the current candle.
+func (f follower) Sync(history map[models.TimeFrame][]models.CandleData) {
+	ps := f.ps
+
+	ps.reloadLock.Lock()
+	defer ps.reloadLock.Unlock()
+
+	var current *models.CandleData
+	minute := history[models.TimeFrame1Min]
+	if n := len(minute); n > 0 && !minute[n-1].IsComplete {
+		candle := minute[n-1]
+		current = &candle
+		history[models.TimeFrame1Min] = minute[:n-1]
+	}
+
+	maxCandles := ps.getMaxCandles()
+	shadow := make(map[models.TimeFrame]*store.Series, len(history))
+	for tf, candles := range history {
+		shadow[tf] = store.NewSeriesFrom(candles, maxCandles)
+	}
+
+	ps.executeExclusive(func(*models.CandleData) *models.CandleData {
+		ps.swapSeries(shadow)
+		return current
+	})
+	dataVersion := ps.publishReload()
+
+	log.Printf("Copied history from primary as version %d", dataVersion)
+}
+
+// Update applies a 1-minute candle update of the primary to the current candle
+func (f follower) Update(message models.UpdateMessage) {
+	f.ps.executeExclusive(func(current *models.CandleData) *models.CandleData {
+		return f.ps.applyFollowed(current, message.Candle)
+	})
+}
+
+// applyFollowed replaces the current candle with the primary's version of it. A candle
+// the primary completed is finalized, which aggregates it into the higher timeframes.
+// Updates of candles already in the history are skipped, they arrive when the history
+// was copied while the stream was connected already.
+func (ps *PriceService) applyFollowed(current *models.CandleData, candle models.CandleData) *models.CandleData {
+	if last, ok := ps.timeFrameData[models.TimeFrame1Min].last(); ok && candle.Timestamp <= last.Timestamp {
+		return current
+	}
+
+	if current != nil {
+		switch {
+		case candle.Timestamp < current.Timestamp:
+			return current
+		case candle.Timestamp > current.Timestamp:
+			// The end of the current candle was missed, keep it as last seen
+			ps.finalizeCandle(current)
+			current = nil
+		}
+	}
+
+	enforceOHLC(models.TimeFrame1Min, &candle, "the primary")
+	if candle.IsComplete {
+		candle.IsComplete = false
+		ps.finalizeCandle(&candle)
+		return nil
+	}
+
+	if current == nil {
+		ps.broadcastToClients(models.UpdateMessage{
+			Type:      "new",
+			Candle:    candle,
+			TimeFrame: models.TimeFrame1Min,
+		})
+		return &candle
+	}
+
+	prev := *current
+	*current = candle
+	ps.broadcastUpdate(prev, *current)
+	return current
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"log"
+	"math"
+
+	"server/internal/models"
+)
+
+// SetFuture makes the service a futures contract on a spot market: an index of the spot
+// price times the contract's basis, which converges to spot at expiry. Trading stops at
+// expiry, when the contract is settled. Must be called before the history is loaded.
+func (ps *PriceService) SetFuture(spot *PriceService, contract models.FuturesContract) {
+	ps.index = []IndexConstituent{{Name: contract.Underlying, Service: spot, Weight: 1}}
+	ps.future = &contract
+}
+
+// basis returns the factor of the index price at a time, 1 unless the service is a futures
+// or perpetual contract or a venue
+func (ps *PriceService) basis(at int64) float64 {
+	switch {
+	case ps.future != nil:
+		return ps.future.Basis(at)
+	case ps.premium != nil:
+		premium, _ := ps.Premium()
+		return 1 + premium
+	}
+	return 1
+}
+
+// expired reports whether the service is a futures contract at or past its expiry
+func (ps *PriceService) expired(at int64) bool {
+	return ps.future != nil && at >= ps.future.Expiry
+}
+
+// Settle closes the current candle of a futures contract at its settlement price and
+// stops the contract. Clients stay connected, the caller tells them about the settlement.
+func (ps *PriceService) Settle(price float64) error {
+	price = ps.precision.Price(price)
+	ps.executeExclusive(func(current *models.CandleData) *models.CandleData {
+		if current == nil {
+			return nil
+		}
+		prev := *current
+		current.Values[1] = math.Max(current.Values[1], price)
+		current.Values[2] = math.Min(current.Values[2], price)
+		current.Values[3] = price
+		ps.broadcastUpdate(prev, *current)
+		ps.finalizeCandle(current)
+		return nil
+	})
+	log.Printf("Settled %s at %g", ps.GetSimulationParams().Symbol, price)
+	return ps.Stop()
+}
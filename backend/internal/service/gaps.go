@@ -0,0 +1,72 @@
+package service
+
+import (
+	"server/internal/models"
+)
+
+// Gaps reports the periods of a timeframe in [from, to] without a stored candle, as left
+// by downtime or bugs. Only periods from the oldest stored candle on are checked, and
+// none from the period of the 1-minute candle in progress on, which isn't stored yet.
+func (ps *PriceService) Gaps(tf models.TimeFrame, from, to int64) models.GapReport {
+	report := models.GapReport{TimeFrame: tf, Gaps: []models.Gap{}}
+	period := tf.GetDuration().Milliseconds()
+	current := ps.GetCurrentCandle()
+
+	data := ps.timeFrameData[tf]
+	data.lock.RLock()
+	defer data.lock.RUnlock()
+
+	series := data.series
+	if series == nil || series.Len() == 0 {
+		return report
+	}
+
+	// The periods to check, end is exclusive
+	start := series.TimestampAt(0)
+	if from > start {
+		start = tf.NormalizeTimestamp(from)
+		if start < from {
+			start += period
+		}
+	}
+	end := series.TimestampAt(series.Len()-1) + period
+	if current != nil {
+		end = tf.NormalizeTimestamp(current.Timestamp)
+	}
+	if to < end-1 {
+		end = to + 1
+	}
+	if start >= end {
+		return report
+	}
+	report.From, report.To = start, start+(periods(start, end, period)-1)*period
+
+	expected := start
+	for i := series.Search(start); i < series.Len(); i++ {
+		timestamp := series.TimestampAt(i)
+		if timestamp >= end {
+			break
+		}
+		if timestamp > expected {
+			addGap(&report, expected, timestamp, period)
+		}
+		expected = timestamp + period
+		report.Candles++
+	}
+	if expected < end {
+		addGap(&report, expected, end, period)
+	}
+	return report
+}
+
+// addGap records the missing periods from the one starting at from to the one before next
+func addGap(report *models.GapReport, from, next, period int64) {
+	missing := periods(from, next, period)
+	report.Gaps = append(report.Gaps, models.Gap{From: from, To: from + (missing-1)*period, Missing: int(missing)})
+	report.Missing += int(missing)
+}
+
+// periods returns the number of periods starting in [from, end)
+func periods(from, end, period int64) int64 {
+	return (end - from + period - 1) / period
+}
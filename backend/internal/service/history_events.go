@@ -0,0 +1,125 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"server/internal/models"
+)
+
+// HistoryEvents turns a 1-minute history into the events of a recording, so a dataset can
+// be replayed like a recorded session. The first history candles are sent as the initial
+// history of every timeframe, the rest as the updates clients would have received if they
+// had been generated live: a new 1-minute candle at its start, and at its end its final
+// update followed by the updates of the higher timeframes.
+func HistoryEvents(minute []models.CandleData, history int, emit func(models.RecordedEvent) error) error {
+	if len(minute) == 0 {
+		return nil
+	}
+	if history > len(minute) {
+		history = len(minute)
+	}
+	e := historyEmitter{emit: emit, open: make(map[models.TimeFrame]*models.CandleData)}
+	minuteMs := models.TimeFrame1Min.GetDuration().Milliseconds()
+
+	// Replaying starts where the initial history ends
+	start := minute[0].Timestamp
+	if history > 0 {
+		start = minute[history-1].Timestamp + minuteMs
+	}
+	initial := minute[:history]
+	for _, tf := range models.AllTimeFrames() {
+		candles := initial
+		if tf != models.TimeFrame1Min {
+			candles = AggregateHistory(initial, tf)
+			if n := len(candles); n > 0 && candles[n-1].Timestamp+tf.GetDuration().Milliseconds() > start {
+				candles[n-1].IsComplete = false
+				open := candles[n-1]
+				e.open[tf] = &open
+			}
+		}
+		if candles == nil {
+			candles = []models.CandleData{}
+		}
+		if err := e.send(start, tf, models.TimeFrameData{TimeFrame: tf, Candles: candles}); err != nil {
+			return err
+		}
+	}
+
+	for _, candle := range minute[history:] {
+		started := models.CandleData{
+			Timestamp: candle.Timestamp,
+			Values:    [4]float64{candle.Values[0], candle.Values[0], candle.Values[0], candle.Values[0]},
+		}
+		if err := e.send(candle.Timestamp, models.TimeFrame1Min, models.UpdateMessage{Type: "new", Candle: started, TimeFrame: models.TimeFrame1Min}); err != nil {
+			return err
+		}
+
+		end := candle.Timestamp + minuteMs
+		candle.IsComplete = true
+		if err := e.send(end, models.TimeFrame1Min, models.UpdateMessage{Type: "update", Candle: candle, TimeFrame: models.TimeFrame1Min}); err != nil {
+			return err
+		}
+		for _, tf := range models.AllTimeFrames()[1:] {
+			if err := e.aggregate(end, tf, candle); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// historyEmitter tracks the open candles of the higher timeframes while emitting a history
+type historyEmitter struct {
+	emit func(models.RecordedEvent) error
+	open map[models.TimeFrame]*models.CandleData
+}
+
+// aggregate merges a finalized 1-minute candle into its higher timeframe candle and sends
+// the updates, completing the candle at the end of its period
+func (e *historyEmitter) aggregate(at int64, tf models.TimeFrame, candle models.CandleData) error {
+	timestamp := tf.NormalizeTimestamp(candle.Timestamp)
+	current := e.open[tf]
+	if current != nil && current.Timestamp != timestamp {
+		// A gap in the history skipped the end of the period
+		current.IsComplete = true
+		if err := e.send(at, tf, models.UpdateMessage{Type: "update", Candle: *current, TimeFrame: tf}); err != nil {
+			return err
+		}
+		current = nil
+	}
+
+	kind := "update"
+	if current == nil {
+		kind = "new"
+		current = &models.CandleData{Timestamp: timestamp, Values: candle.Values, Volume: candle.Volume}
+		e.open[tf] = current
+	} else {
+		if candle.Values[1] > current.Values[1] {
+			current.Values[1] = candle.Values[1]
+		}
+		if candle.Values[2] < current.Values[2] {
+			current.Values[2] = candle.Values[2]
+		}
+		current.Values[3] = candle.Values[3]
+		current.Volume = models.AddAmounts(current.Volume, candle.Volume)
+	}
+	current.IsComplete = at >= timestamp+tf.GetDuration().Milliseconds()
+
+	if err := e.send(at, tf, models.UpdateMessage{Type: kind, Candle: *current, TimeFrame: tf}); err != nil {
+		return err
+	}
+	if current.IsComplete {
+		delete(e.open, tf)
+	}
+	return nil
+}
+
+// send emits a message on the channel of a timeframe
+func (e *historyEmitter) send(at int64, tf models.TimeFrame, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	return e.emit(models.RecordedEvent{Time: at, Channel: tf, Message: data})
+}
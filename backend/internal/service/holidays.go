@@ -0,0 +1,42 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"server/internal/config"
+	"server/internal/models"
+)
+
+// holidayCalendar returns the calendar of the configured holidays, none if it can't be read
+func holidayCalendar(cfg *config.Config) *models.HolidayCalendar {
+	calendar, err := cfg.Simulation.Holidays.Calendar()
+	if err != nil {
+		log.Printf("Error loading holidays: %v", err)
+	}
+	return calendar
+}
+
+// closedAt reports whether the symbol doesn't trade at a time, as it's a holiday
+func (ps *PriceService) closedAt(at time.Time) bool {
+	ps.settingsLock.RLock()
+	defer ps.settingsLock.RUnlock()
+	return ps.holidays.Closed(at)
+}
+
+// MarketClosed reports whether the symbol doesn't trade today, as it's a holiday. No candles
+// are generated on holidays, so their daily history stays empty.
+func (ps *PriceService) MarketClosed() bool {
+	return ps.closedAt(ps.now())
+}
+
+// announceHoliday logs and tells the clients that the symbol closed for a holiday or opened
+// after one
+func (ps *PriceService) announceHoliday(closed bool) {
+	if closed {
+		log.Printf("Market closed for a holiday")
+	} else {
+		log.Printf("Market opened after a holiday")
+	}
+	ps.hub.PublishAll(ps.GetStatus())
+}
@@ -0,0 +1,583 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"server/internal/config"
+	"server/internal/metrics"
+	"server/internal/models"
+	"server/internal/netpoll"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait      = 10 * time.Second // Time allowed to write a single message
+	maxMessageSize = 4096             // Largest message read from clients, which only send small requests
+)
+
+var (
+	broadcastPayloads      = metrics.NewCounter("seedventure_broadcast_payloads_total", "Number of payloads serialized for broadcasting")
+	broadcastSerializeTime = metrics.NewCounter("seedventure_broadcast_serialize_nanoseconds_total", "Time spent serializing broadcast payloads")
+	broadcastDeliveries    = metrics.NewCounter("seedventure_broadcast_deliveries_total", "Number of payloads queued for delivery to clients")
+	broadcastSlowClients   = metrics.NewCounter("seedventure_broadcast_slow_clients_total", "Number of clients dropped because their queue was full")
+)
+
+// Client is a WebSocket connection registered with the hub. All writes to the
+// connection go through its queue and are performed by the hub's shared writers,
+// one writer at a time.
+type Client struct {
+	conn        clientConn
+	hub         *Hub
+	send        chan *payload
+	done        chan struct{}
+	closeOnce   sync.Once
+	connectedAt time.Time
+	scheduled   atomic.Bool // Waiting for or owned by a shared writer
+
+	spectator bool // Read-only connection counted against the spectator cap, guarded by the hub's clientsLock
+
+	sentOffset  atomic.Int64 // Offset of the last update written, if the update log is enabled
+	ackedOffset atomic.Int64 // Last offset the client acknowledged, see Ack
+
+	mu           sync.RWMutex
+	timeFrame    models.TimeFrame    // Channel the client is subscribed to
+	deltas       bool                // Client understands delta frames
+	schema       models.CandleSchema // Encoding of candles sent to the client
+	needsFull    bool                // Next update must be a full frame, the client has no base for a delta
+	laggingSince time.Time           // When the client fell behind the lag thresholds, zero if it didn't
+}
+
+// clientConn is the transport of a client
+type clientConn interface {
+	RemoteAddr() net.Addr
+	Close() error
+
+	// transport names the WebSocket implementation of the connection
+	transport() string
+	// writePayload writes a text message within writeWait
+	writePayload(p *payload) error
+	// writeInternalError tells the client the connection is closed because of a server error
+	writeInternalError()
+}
+
+// gorillaConn is a connection served by gorilla/websocket
+type gorillaConn struct {
+	*websocket.Conn
+}
+
+// payload is a serialized message shared between all clients it is sent to. The
+// WebSocket frame for each transport is built once, when it is first written.
+type payload struct {
+	data   []byte
+	offset int64 // Offset of the update in the update log, 0 for other messages
+
+	preparedOnce sync.Once
+	prepared     *websocket.PreparedMessage
+	preparedErr  error
+
+	frameOnce sync.Once
+	frame     []byte
+	frameErr  error
+}
+
+// Hub keeps track of connected clients and fans out broadcast payloads to them
+type Hub struct {
+	clients     map[*Client]struct{}
+	clientsLock sync.RWMutex
+	spectators  int // Connected and connecting spectators, guarded by clientsLock
+
+	writes *writeQueue // Clients waiting for one of the shared writers
+
+	// Event loop for connections registered with RegisterEventConn, nil unless started
+	poller *netpoll.Poller
+
+	recordLock sync.RWMutex
+	record     func(channel models.TimeFrame, data []byte) // Called with every broadcast, see SetRecorder
+
+	chaos atomic.Pointer[config.ChaosConfig] // Faults injected into frames, nil unless chaos mode is enabled
+
+	lag     atomic.Pointer[config.LagConfig] // Thresholds from which clients fall behind, nil until set
+	lagging int64                            // Clients falling behind at the last check, owned by watchLag
+	closed  chan struct{}                    // Closed by Close
+}
+
+// NewHub creates a new instance of Hub whose payloads are written by the given number of goroutines
+func NewHub(writers int) *Hub {
+	h := &Hub{
+		clients: make(map[*Client]struct{}),
+		writes:  newWriteQueue(),
+		closed:  make(chan struct{}),
+	}
+	for i := 0; i < writers; i++ {
+		go h.writeLoop()
+	}
+	go h.watchLag()
+	return h
+}
+
+// Register adds a connection subscribed to the given timeframe. A spectator takes over
+// the reservation of ReserveSpectator.
+func (h *Hub) Register(conn *websocket.Conn, timeFrame models.TimeFrame, spectator bool) *Client {
+	conn.SetReadLimit(maxMessageSize)
+	client := h.newClient(gorillaConn{conn}, timeFrame, spectator)
+	h.add(client)
+	return client
+}
+
+// newClient creates a client subscribed to the given timeframe
+func (h *Hub) newClient(conn clientConn, timeFrame models.TimeFrame, spectator bool) *Client {
+	return &Client{
+		conn:        conn,
+		hub:         h,
+		send:        make(chan *payload, config.ClientQueueSize),
+		done:        make(chan struct{}),
+		connectedAt: time.Now(),
+		timeFrame:   timeFrame,
+		schema:      models.SchemaXY,
+		needsFull:   true,
+		spectator:   spectator,
+	}
+}
+
+// add makes a client receive broadcasts
+func (h *Hub) add(client *Client) {
+	h.clientsLock.Lock()
+	h.clients[client] = struct{}{}
+	h.clientsLock.Unlock()
+}
+
+// Unregister removes a client and closes its connection
+func (h *Hub) Unregister(client *Client) {
+	h.clientsLock.Lock()
+	if _, ok := h.clients[client]; ok && client.spectator {
+		h.spectators--
+	}
+	delete(h.clients, client)
+	h.clientsLock.Unlock()
+
+	client.Close()
+}
+
+// ReserveSpectator counts a spectator about to connect, failing if max spectators are
+// connected already. The reservation is released when the spectator's client is
+// unregistered, see Register, or with ReleaseSpectator if it never connects.
+func (h *Hub) ReserveSpectator(max int) bool {
+	h.clientsLock.Lock()
+	defer h.clientsLock.Unlock()
+	if h.spectators >= max {
+		return false
+	}
+	h.spectators++
+	return true
+}
+
+// ReleaseSpectator releases the reservation of a spectator that didn't connect
+func (h *Hub) ReleaseSpectator() {
+	h.clientsLock.Lock()
+	h.spectators--
+	h.clientsLock.Unlock()
+}
+
+// Spectators returns the number of connected and connecting spectators
+func (h *Hub) Spectators() int {
+	h.clientsLock.RLock()
+	defer h.clientsLock.RUnlock()
+	return h.spectators
+}
+
+// Close disconnects every client and stops the shared writers and the event loop. The hub
+// must not be used afterwards.
+func (h *Hub) Close() {
+	h.clientsLock.Lock()
+	clients := h.clients
+	h.clients = make(map[*Client]struct{})
+	h.clientsLock.Unlock()
+
+	for client := range clients {
+		client.Close()
+	}
+	h.writes.close()
+	close(h.closed)
+	if h.poller != nil {
+		h.poller.Close()
+	}
+}
+
+// Count returns the number of connected clients
+func (h *Hub) Count() int {
+	h.clientsLock.RLock()
+	defer h.clientsLock.RUnlock()
+	return len(h.clients)
+}
+
+// Connections returns information about all connected clients
+func (h *Hub) Connections() []models.ConnectionInfo {
+	h.clientsLock.RLock()
+	defer h.clientsLock.RUnlock()
+
+	connections := make([]models.ConnectionInfo, 0, len(h.clients))
+	for client := range h.clients {
+		connections = append(connections, client.info())
+	}
+	return connections
+}
+
+// info describes the client. The caller holds the hub's clientsLock.
+func (c *Client) info() models.ConnectionInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	info := models.ConnectionInfo{
+		RemoteAddr:  c.conn.RemoteAddr().String(),
+		ConnectedAt: c.connectedAt.UnixMilli(),
+		TimeFrame:   c.timeFrame,
+		QueueDepth:  len(c.send),
+		Deltas:      c.deltas,
+		Transport:   c.conn.transport(),
+		Spectator:   c.spectator,
+		SentOffset:  c.sentOffset.Load(),
+		AckedOffset: c.ackedOffset.Load(),
+	}
+	if !c.laggingSince.IsZero() {
+		info.LaggingSince = c.laggingSince.UnixMilli()
+	}
+	return info
+}
+
+// ResetDeltas makes every client get a full frame before the next delta frame
+func (h *Hub) ResetDeltas() {
+	h.clientsLock.RLock()
+	defer h.clientsLock.RUnlock()
+
+	for client := range h.clients {
+		client.mu.Lock()
+		client.needsFull = true
+		client.mu.Unlock()
+	}
+}
+
+// SetRecorder makes fn receive every broadcast with the channel it was sent on, an empty
+// channel for broadcasts to all clients. Updates are passed as full frames. A nil fn stops recording.
+func (h *Hub) SetRecorder(fn func(channel models.TimeFrame, data []byte)) {
+	h.recordLock.Lock()
+	defer h.recordLock.Unlock()
+	h.record = fn
+}
+
+// recordBroadcast passes a broadcast to the recorder, if there is one
+func (h *Hub) recordBroadcast(channel models.TimeFrame, pm *payload) {
+	h.recordLock.RLock()
+	defer h.recordLock.RUnlock()
+	if h.record != nil {
+		h.record(channel, pm.data)
+	}
+}
+
+// Publish serializes a message once per candle schema and queues it for every client
+// subscribed to the timeframe
+func (h *Hub) Publish(timeFrame models.TimeFrame, message interface{}) {
+	pm, err := preparePayload(message)
+	if err != nil {
+		log.Println("Error marshalling data:", err)
+		return
+	}
+	h.recordBroadcast(timeFrame, pm)
+
+	payloads := schemaPayloads{message: message, xy: pm}
+	h.fanOut(func(client *Client) *payload {
+		if client.TimeFrame() != timeFrame {
+			return nil
+		}
+		return payloads.forClient(client)
+	})
+}
+
+// PublishUpdate queues an update of the current candle for every client subscribed to the
+// timeframe. Clients that opted into deltas get the delta frame instead, if there is one.
+func (h *Hub) PublishUpdate(timeFrame models.TimeFrame, full models.UpdateMessage, delta *models.DeltaMessage) {
+	fullPM, err := preparePayload(full)
+	if err != nil {
+		log.Println("Error marshalling data:", err)
+		return
+	}
+	fullPM.offset = full.Offset
+
+	var deltaPM *payload
+	if delta != nil {
+		if deltaPM, err = preparePayload(*delta); err != nil {
+			log.Println("Error marshalling data:", err)
+			return
+		}
+		deltaPM.offset = delta.Offset
+	}
+	h.recordBroadcast(timeFrame, fullPM)
+
+	payloads := schemaPayloads{message: full, xy: fullPM}
+	h.fanOut(func(client *Client) *payload {
+		if client.TimeFrame() != timeFrame {
+			return nil
+		}
+		if deltaPM != nil && client.takeDelta() {
+			return deltaPM
+		}
+		return payloads.forClient(client)
+	})
+}
+
+// schemaPayloads holds the encodings of a broadcast in the candle schemas. The SchemaOHLC
+// one is prepared when a client first needs it, so it costs nothing while none does.
+type schemaPayloads struct {
+	message interface{}
+	xy      *payload
+	ohlc    *payload
+}
+
+// forClient returns the encoding of the broadcast in the candle schema of a client
+func (p *schemaPayloads) forClient(client *Client) *payload {
+	if client.Schema() != models.SchemaOHLC {
+		return p.xy
+	}
+	if p.ohlc == nil {
+		p.ohlc = p.xy
+		if converted, ok := models.WithSchema(p.message, models.SchemaOHLC); ok {
+			pm, err := preparePayload(converted)
+			if err != nil {
+				log.Println("Error marshalling data:", err)
+				return p.xy
+			}
+			pm.offset = p.xy.offset
+			p.ohlc = pm
+		}
+	}
+	return p.ohlc
+}
+
+// PublishAll serializes a message once and queues it for every client
+func (h *Hub) PublishAll(message interface{}) {
+	pm, err := preparePayload(message)
+	if err != nil {
+		log.Println("Error marshalling data:", err)
+		return
+	}
+	h.recordBroadcast("", pm)
+
+	h.fanOut(func(*Client) *payload {
+		return pm
+	})
+}
+
+// publishRaw queues an already serialized message for every client subscribed to the
+// channel, or for every client if the channel is empty. It is not recorded.
+func (h *Hub) publishRaw(channel models.TimeFrame, data []byte) {
+	pm := &payload{data: data}
+
+	h.fanOut(func(client *Client) *payload {
+		if channel != "" && client.TimeFrame() != channel {
+			return nil
+		}
+		return pm
+	})
+}
+
+// fanOut queues the payload picked for each client, skipping clients it returns nil for
+// and dropping clients whose queue is full. In chaos mode payloads are dropped and clients
+// disconnected at random.
+func (h *Hub) fanOut(pick func(*Client) *payload) {
+	var slow, disconnected []*Client
+
+	h.clientsLock.RLock()
+	for client := range h.clients {
+		pm := pick(client)
+		if pm == nil {
+			continue
+		}
+		switch h.chaosFault() {
+		case faultDrop:
+			continue
+		case faultDisconnect:
+			disconnected = append(disconnected, client)
+			continue
+		}
+		if client.enqueue(pm) {
+			broadcastDeliveries.Inc()
+		} else {
+			slow = append(slow, client)
+		}
+	}
+	h.clientsLock.RUnlock()
+
+	for _, client := range slow {
+		log.Printf("Dropping slow client %s", client.conn.RemoteAddr())
+		broadcastSlowClients.Inc()
+		h.Unregister(client)
+	}
+	for _, client := range disconnected {
+		log.Printf("Chaos mode disconnecting client %s", client.conn.RemoteAddr())
+		h.Unregister(client)
+	}
+}
+
+// preparePayload serializes a broadcast message and records the serialization cost. The
+// payload builds its WebSocket frame once and shares it between all clients.
+func preparePayload(message interface{}) (*payload, error) {
+	start := time.Now()
+	pm, err := prepare(message)
+	broadcastSerializeTime.Add(int64(time.Since(start)))
+	broadcastPayloads.Inc()
+	return pm, err
+}
+
+// prepare serializes a message into a payload
+func prepare(message interface{}) (*payload, error) {
+	data, err := encode(message)
+	if err != nil {
+		return nil, err
+	}
+	return &payload{data: data}, nil
+}
+
+// preparedMessage returns the payload as a gorilla/websocket text message
+func (p *payload) preparedMessage() (*websocket.PreparedMessage, error) {
+	p.preparedOnce.Do(func() {
+		p.prepared, p.preparedErr = websocket.NewPreparedMessage(websocket.TextMessage, p.data)
+	})
+	return p.prepared, p.preparedErr
+}
+
+// encode serializes a message, using the allocation-free encoder for message types that support it
+func encode(message interface{}) ([]byte, error) {
+	if appender, ok := message.(models.JSONAppender); ok {
+		return models.Marshal(appender)
+	}
+	return json.Marshal(message)
+}
+
+// TimeFrame returns the timeframe the client is subscribed to
+func (c *Client) TimeFrame() models.TimeFrame {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.timeFrame
+}
+
+// Subscribe switches the client to another timeframe
+func (c *Client) Subscribe(timeFrame models.TimeFrame) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timeFrame = timeFrame
+	c.needsFull = true
+}
+
+// EnableDeltas lets the client receive delta frames for intra-candle updates
+func (c *Client) EnableDeltas() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deltas = true
+}
+
+// SetSchema sets the encoding of the candles sent to the client. Clients with SchemaOHLC
+// get full updates instead of delta frames.
+func (c *Client) SetSchema(schema models.CandleSchema) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.schema = schema
+	c.needsFull = true
+}
+
+// Schema returns the encoding of the candles sent to the client
+func (c *Client) Schema() models.CandleSchema {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.schema
+}
+
+// wantsDeltas reports whether the client opted into delta frames
+func (c *Client) wantsDeltas() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.deltas
+}
+
+// takeDelta reports whether the client can be sent a delta frame now. Otherwise it
+// gets a full frame, after which deltas can be applied to it.
+func (c *Client) takeDelta() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.deltas || c.schema == models.SchemaOHLC {
+		return false
+	}
+	if c.needsFull {
+		c.needsFull = false
+		return false
+	}
+	return true
+}
+
+// IsSpectator reports whether the client is a read-only spectator
+func (c *Client) IsSpectator() bool {
+	c.hub.clientsLock.RLock()
+	defer c.hub.clientsLock.RUnlock()
+	return c.spectator
+}
+
+// Send queues a message for this client only, with its candles in the client's schema
+func (c *Client) Send(message interface{}) error {
+	message, _ = models.WithSchema(message, c.Schema())
+	pm, err := prepare(message)
+	if err != nil {
+		return err
+	}
+	if !c.enqueue(pm) {
+		return fmt.Errorf("send queue full")
+	}
+	return nil
+}
+
+// Close discards queued payloads and closes the connection. It is safe to call more than once.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// enqueue adds a payload to the send queue without blocking
+func (c *Client) enqueue(pm *payload) bool {
+	select {
+	case <-c.done:
+		return true // Closed clients silently discard payloads
+	default:
+	}
+
+	select {
+	case c.send <- pm:
+		c.hub.scheduleWrite(c)
+		return true
+	default:
+		return false
+	}
+}
+
+func (c gorillaConn) transport() string { return "gorilla" }
+
+func (c gorillaConn) writePayload(p *payload) error {
+	pm, err := p.preparedMessage()
+	if err != nil {
+		return err
+	}
+	c.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.WritePreparedMessage(pm)
+}
+
+func (c gorillaConn) writeInternalError() {
+	c.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "internal error"),
+		time.Now().Add(time.Second))
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"server/internal/models"
+	"server/internal/netpoll"
+
+	"github.com/gobwas/ws"
+)
+
+// eventConn is a connection upgraded with gobwas/ws and served by the hub's event
+// loop: reads are triggered by the poller instead of a goroutine blocked in Read, so
+// an idle connection doesn't hold any goroutines or buffers.
+type eventConn struct {
+	net.Conn
+	poller    *netpoll.Poller
+	buffered  *bufio.Reader // Data the client sent right after the handshake, nil if there was none
+	writeLock sync.Mutex
+}
+
+// StartEventLoop lets the hub serve connections registered with RegisterEventConn, using
+// the given number of workers for reading. It fails on platforms without an event loop
+// implementation.
+func (h *Hub) StartEventLoop(workers int) error {
+	poller, err := netpoll.New(workers)
+	if err != nil {
+		return err
+	}
+
+	h.poller = poller
+	return nil
+}
+
+// UsesEventLoop reports whether the event loop was started
+func (h *Hub) UsesEventLoop() bool {
+	return h.poller != nil
+}
+
+// RegisterEventConn adds a connection upgraded with gobwas/ws, subscribed to the given
+// timeframe. buffered holds data read past the handshake. onMessage is called with every
+// text message the client sends, on one of the event loop's workers. A spectator takes
+// over the reservation of ReserveSpectator once registered.
+func (h *Hub) RegisterEventConn(conn net.Conn, buffered *bufio.Reader, timeFrame models.TimeFrame, spectator bool, onMessage func(*Client, []byte)) (*Client, error) {
+	if h.poller == nil {
+		return nil, fmt.Errorf("event loop not started")
+	}
+
+	ec := &eventConn{Conn: conn, poller: h.poller}
+	if buffered != nil && buffered.Buffered() > 0 {
+		ec.buffered = buffered
+	}
+
+	client := h.newClient(ec, timeFrame, spectator)
+
+	// The poller only reports new data, so messages that arrived with the handshake are handled first
+	if ec.buffered != nil {
+		if err := ec.readMessages(client, onMessage); err != nil {
+			return nil, err
+		}
+	}
+
+	onReadable := func() {
+		if err := ec.readMessages(client, onMessage); err != nil {
+			h.Unregister(client)
+		}
+	}
+	if err := h.poller.Add(conn, onReadable); err != nil {
+		return nil, err
+	}
+	h.add(client)
+	return client, nil
+}
+
+func (c *eventConn) transport() string { return "epoll" }
+
+// Close stops watching the connection and closes it
+func (c *eventConn) Close() error {
+	if err := c.poller.Remove(c.Conn); err != nil {
+		log.Println("Error removing connection from event loop:", err)
+	}
+	return c.Conn.Close()
+}
+
+// writePayload writes a text message, the frame is built once per payload
+func (c *eventConn) writePayload(p *payload) error {
+	p.frameOnce.Do(func() {
+		p.frame, p.frameErr = ws.CompileFrame(ws.NewTextFrame(p.data))
+	})
+	if p.frameErr != nil {
+		return p.frameErr
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.SetWriteDeadline(time.Now().Add(writeWait))
+	_, err := c.Write(p.frame)
+	return err
+}
+
+// writeFrame writes a control frame
+func (c *eventConn) writeFrame(f ws.Frame) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.SetWriteDeadline(time.Now().Add(writeWait))
+	return ws.WriteFrame(c.Conn, f)
+}
+
+func (c *eventConn) writeInternalError() {
+	c.writeFrame(ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusInternalServerError, "internal error")))
+}
+
+// readMessages reads the frames available on the connection, answering control frames
+// and passing text messages to onMessage. An error means the connection is done.
+func (c *eventConn) readMessages(client *Client, onMessage func(*Client, []byte)) error {
+	// Data is ready, the deadline only guards against clients stalling mid-frame
+	c.SetReadDeadline(time.Now().Add(writeWait))
+
+	for {
+		var r io.Reader = c.Conn
+		if c.buffered != nil {
+			r = c.buffered
+		}
+
+		message, err := c.readFrame(r)
+		if err != nil {
+			return err
+		}
+		if message != nil {
+			onMessage(client, message)
+		}
+
+		// Frames are read exactly from the connection, only the handshake buffer can hold another one
+		if c.buffered == nil {
+			return nil
+		}
+		if c.buffered.Buffered() == 0 {
+			c.buffered = nil
+			return nil
+		}
+	}
+}
+
+// readFrame reads a single frame and returns its payload if it is a text message
+func (c *eventConn) readFrame(r io.Reader) ([]byte, error) {
+	header, err := ws.ReadHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if header.Length > maxMessageSize || !header.Fin {
+		c.writeFrame(ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusMessageTooBig, "")))
+		return nil, fmt.Errorf("unsupported frame of %d bytes", header.Length)
+	}
+
+	data := make([]byte, header.Length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	if header.Masked {
+		ws.Cipher(data, header.Mask, 0)
+	}
+
+	switch header.OpCode {
+	case ws.OpText:
+		return data, nil
+	case ws.OpPing:
+		return nil, c.writeFrame(ws.NewPongFrame(data))
+	case ws.OpClose:
+		c.writeFrame(ws.NewCloseFrame(nil))
+		return nil, io.EOF
+	default:
+		return nil, nil // Binary messages and unsolicited pongs are ignored
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"server/internal/config"
+	"server/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+var benchClients = flag.Int("bench.clients", 100, "WebSocket clients receiving broadcasts in the benchmarks")
+
+// updateMessage is a typical broadcast payload
+var updateMessage = models.UpdateMessage{
+	Type: "update",
+	Candle: models.CandleData{
+		Timestamp: 1700000000000,
+		Values:    [4]float64{101.25, 103.5, 99.75, 102.13},
+		Volume:    1234.56,
+	},
+	TimeFrame: models.TimeFrame1Min,
+}
+
+// BenchmarkEncodeUpdate measures serializing a broadcast with the allocation-free encoder
+func BenchmarkEncodeUpdate(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := models.Marshal(updateMessage); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEncodeUpdateReflection measures serializing a broadcast with encoding/json, for comparison
+func BenchmarkEncodeUpdateReflection(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(updateMessage); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkBroadcast measures fanning out a tick to connected WebSocket clients over loopback
+func BenchmarkBroadcast(b *testing.B) {
+	hub := NewHub(config.Default().Server.WebSocket.Writers)
+	defer hub.Close()
+	upgrader := websocket.Upgrader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		hub.Register(conn, models.TimeFrame1Min, false)
+	}))
+	defer server.Close()
+
+	// Every client acknowledges the payloads it received, so the benchmark
+	// waits until all of them arrived and doesn't just measure queueing
+	clients := *benchClients
+	var received sync.WaitGroup
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	for i := 0; i < clients; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer conn.Close()
+
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+				received.Done()
+			}
+		}()
+	}
+	for hub.Count() < clients {
+		time.Sleep(time.Millisecond)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		received.Add(clients)
+		hub.Publish(models.TimeFrame1Min, updateMessage)
+		received.Wait()
+	}
+}
+
+// TestClientQueueSize checks that clients queue as many payloads as the lag thresholds
+// are validated against
+func TestClientQueueSize(t *testing.T) {
+	hub := NewHub(1)
+	defer hub.Close()
+	if client := hub.newClient(nil, models.TimeFrame1Min, false); cap(client.send) != config.ClientQueueSize {
+		t.Fatalf("client queue holds %d payloads, want %d", cap(client.send), config.ClientQueueSize)
+	}
+}
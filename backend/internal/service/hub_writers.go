@@ -0,0 +1,151 @@
+package service
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+
+	"server/internal/metrics"
+	"server/internal/models"
+)
+
+// writeBatch is the number of payloads written to a client before the writer moves on to another one
+const writeBatch = 8
+
+var broadcastWriteTurns = metrics.NewCounter("seedventure_broadcast_write_turns_total", "Number of times a shared writer took a client's turn")
+
+// writeQueue holds clients waiting for a shared writer. Clients are grouped by the
+// channel they are subscribed to, and the writers take turns between the channels,
+// so a burst on one busy channel doesn't delay delivery on the others.
+type writeQueue struct {
+	lock     sync.Mutex
+	ready    sync.Cond
+	channels map[models.TimeFrame][]*Client
+	turns    []models.TimeFrame // Channels with waiting clients, next turn first
+	closed   bool               // Set by close, the writers stop once no client waits anymore
+}
+
+// newWriteQueue creates an empty write queue
+func newWriteQueue() *writeQueue {
+	q := &writeQueue{channels: make(map[models.TimeFrame][]*Client)}
+	q.ready.L = &q.lock
+	return q
+}
+
+// push adds a client to the end of its channel's line
+func (q *writeQueue) push(c *Client) {
+	tf := c.TimeFrame()
+
+	q.lock.Lock()
+	if len(q.channels[tf]) == 0 {
+		q.turns = append(q.turns, tf)
+	}
+	q.channels[tf] = append(q.channels[tf], c)
+	q.lock.Unlock()
+
+	q.ready.Signal()
+}
+
+// pop waits for a client and returns the first one of the channel whose turn it is, or
+// nil once the queue is closed and empty
+func (q *writeQueue) pop() *Client {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for len(q.turns) == 0 {
+		if q.closed {
+			return nil
+		}
+		q.ready.Wait()
+	}
+
+	tf := q.turns[0]
+	q.turns = q.turns[1:]
+
+	line := q.channels[tf]
+	c := line[0]
+	line[0] = nil
+	if line = line[1:]; len(line) > 0 {
+		q.channels[tf] = line
+		q.turns = append(q.turns, tf) // Back of the line of channels
+	} else {
+		delete(q.channels, tf)
+	}
+	return c
+}
+
+// close makes the writers stop once they wrote to the waiting clients
+func (q *writeQueue) close() {
+	q.lock.Lock()
+	q.closed = true
+	q.lock.Unlock()
+
+	q.ready.Broadcast()
+}
+
+// len returns the number of waiting clients
+func (q *writeQueue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	n := 0
+	for _, line := range q.channels {
+		n += len(line)
+	}
+	return n
+}
+
+// scheduleWrite hands a client with queued payloads to the shared writers, unless it already waits for one
+func (h *Hub) scheduleWrite(c *Client) {
+	if c.scheduled.CompareAndSwap(false, true) {
+		h.writes.push(c)
+	}
+}
+
+// writeLoop is a shared writer, it writes the queued payloads of scheduled clients until
+// the hub is closed
+func (h *Hub) writeLoop() {
+	for c := h.writes.pop(); c != nil; c = h.writes.pop() {
+		h.flush(c)
+	}
+}
+
+// flush writes up to writeBatch queued payloads of a client. A client with more
+// payloads goes to the back of the line, so one client can't hold on to a writer.
+func (h *Hub) flush(c *Client) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			metrics.PanicsRecovered.Inc()
+			log.Printf("Panic while writing to WebSocket client: %v\n%s", rec, debug.Stack())
+			c.conn.writeInternalError()
+			go h.Unregister(c)
+		}
+	}()
+	broadcastWriteTurns.Inc()
+
+	// Only the writer owning the client receives from its queue, so this never blocks
+	for i := 0; i < writeBatch && len(c.send) > 0; i++ {
+		if h.delayWrite(c) {
+			return // Stays scheduled until the delay is over
+		}
+		select {
+		case <-c.done:
+			return // Stays scheduled, so it is never picked up again
+		case pm := <-c.send:
+			if err := c.conn.writePayload(pm); err != nil {
+				log.Println("Error sending message:", err)
+				go h.Unregister(c)
+				return
+			}
+			if pm.offset != 0 {
+				c.sentOffset.Store(pm.offset)
+			}
+		}
+	}
+
+	// Payloads queued while the flag is cleared schedule the client themselves
+	c.scheduled.Store(false)
+	if len(c.send) > 0 {
+		h.scheduleWrite(c)
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"server/internal/ingest"
+	"server/internal/models"
+	"server/internal/store"
+)
+
+// IndexConstituent is a symbol of an index with its weight
+type IndexConstituent struct {
+	Name    string
+	Service *PriceService
+	Weight  float64
+}
+
+// SetIndex makes the service an index of a weighted basket of other symbols: its price is
+// the weighted sum of their prices, recomputed every broadcast interval, instead of being
+// generated. Indexes don't trade, their candles have no volume. Must be called before the
+// history is loaded, with constituents whose history is loaded first.
+func (ps *PriceService) SetIndex(constituents []IndexConstituent) {
+	ps.index = constituents
+}
+
+// IsIndex reports whether prices are computed from constituents
+func (ps *PriceService) IsIndex() bool {
+	return ps.index != nil
+}
+
+// runIndex builds candles from the prices of the constituents instead of generating
+// them. Every broadcast interval the index price moves the current candle like a trade
+// of the exchange feed would, all storage, aggregation and broadcasting is shared.
+func (ps *PriceService) runIndex() {
+	ps.settingsLock.RLock()
+	interval := ps.broadcastInterval
+	ps.settingsLock.RUnlock()
+
+	updateTicker := time.NewTicker(interval)
+	defer updateTicker.Stop()
+
+	var state ingestState
+	for {
+		select {
+		case <-updateTicker.C:
+			now := ps.now()
+			if !ps.isGenerating() || ps.expired(now.UnixMilli()) {
+				continue
+			}
+			ps.stepPremium()
+			price, ok := ps.indexPrice(now)
+			if ok && ps.delay != nil {
+				price, ok = ps.delay.delayed(now, price)
+			}
+			if !ok {
+				continue
+			}
+			ps.executeExclusive(func(current *models.CandleData) *models.CandleData {
+				current = ps.applyTrade(current, ingest.Trade{Price: price, Time: now.UnixMilli()}, &state)
+				return ps.flushIngested(current, now, &state)
+			})
+		case interval := <-ps.intervalChanges:
+			updateTicker.Reset(interval)
+		case <-ps.stop:
+			return
+		}
+	}
+}
+
+// indexPrice returns the weighted sum of the current prices of the constituents, the last
+// close for those without a current candle, times the basis of a futures or perpetual
+// contract or venue. It fails while a constituent has no price yet.
+func (ps *PriceService) indexPrice(now time.Time) (float64, bool) {
+	var price float64
+	for _, c := range ps.index {
+		last, ok := c.Service.LastPrice()
+		if !ok {
+			return 0, false
+		}
+		price += c.Weight * last
+	}
+	return ps.precision.Price(price * ps.basis(now.UnixMilli())), true
+}
+
+// initializeIndex replaces the history with the weighted sums of the 1-minute candles of
+// the constituents, for the minutes all of them have a candle, and before the expiry of a
+// futures contract. The high and low of a sum are the sums of the highs and lows, the
+// widest range the index can have moved in.
+func (ps *PriceService) initializeIndex() {
+	type minute struct {
+		values [4]float64
+		count  int
+	}
+	minutes := make(map[int64]*minute)
+	for _, c := range ps.index {
+		candles, _ := c.Service.timeFrameData[models.TimeFrame1Min].candles()
+		for _, candle := range candles {
+			m := minutes[candle.Timestamp]
+			if m == nil {
+				m = &minute{}
+				minutes[candle.Timestamp] = m
+			}
+			for i, value := range candle.Values {
+				m.values[i] += c.Weight * value
+			}
+			m.count++
+		}
+	}
+
+	candles := make([]models.CandleData, 0, len(minutes))
+	for timestamp, m := range minutes {
+		if m.count != len(ps.index) || ps.expired(timestamp) {
+			continue
+		}
+		candle := models.CandleData{Timestamp: timestamp, IsComplete: true}
+		basis := ps.basis(timestamp)
+		for i, value := range m.values {
+			candle.Values[i] = ps.precision.Price(value * basis)
+		}
+		enforceOHLC(models.TimeFrame1Min, &candle, "an index candle")
+		candles = append(candles, candle)
+	}
+
+	maxCandles := ps.getMaxCandles()
+	minuteSeries := store.NewSeriesFrom(candles, maxCandles)
+	ps.timeFrameData[models.TimeFrame1Min].replace(minuteSeries)
+	for _, tf := range models.AllTimeFrames()[1:] {
+		ps.timeFrameData[tf].replace(store.NewSeriesFrom(AggregateHistory(candles, tf), maxCandles))
+	}
+	log.Printf("Computed %d index candles from %d constituents", minuteSeries.Len(), len(ps.index))
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"time"
+
+	"server/internal/ingest"
+	"server/internal/metrics"
+	"server/internal/models"
+)
+
+const (
+	ingestQueueSize = 4096            // Trades buffered between the feed and the candle owner
+	ingestGrace     = 2 * time.Second // Wait for late trades before closing a minute without a newer trade
+)
+
+var ingestDropped = metrics.NewCounter("seedventure_ingest_dropped_trades_total", "Number of trades dropped because candles could not keep up with the feed")
+
+// ingestState tracks what was sent to clients for the current candle. It belongs to
+// runIngest and is only touched by functions it runs on the candle owner.
+type ingestState struct {
+	traded  bool              // The current candle has seen a trade
+	pending bool              // The current candle changed since it was last sent
+	sent    models.CandleData // The current candle as last sent, base of the next delta
+}
+
+// runIngest builds candles from the trades of the exchange feed instead of generating
+// prices. Trades move the current candle as they arrive, clients get it every broadcast
+// interval. All storage, aggregation and broadcasting is shared with generated prices.
+func (ps *PriceService) runIngest() {
+	trades := make(chan ingest.Trade, ingestQueueSize)
+	go ps.feed.Run(func(trade ingest.Trade) {
+		select {
+		case trades <- trade:
+		default:
+			ingestDropped.Inc()
+		}
+	})
+	ps.supervise(func() { ps.applyTrades(trades) })
+}
+
+// applyTrades moves the current candle by the trades of the feed and sends it to clients
+// every broadcast interval
+func (ps *PriceService) applyTrades(trades <-chan ingest.Trade) {
+	ps.settingsLock.RLock()
+	interval := ps.broadcastInterval
+	ps.settingsLock.RUnlock()
+
+	updateTicker := time.NewTicker(interval)
+	defer updateTicker.Stop()
+
+	var state ingestState
+	for {
+		select {
+		case trade := <-trades:
+			if ps.isGenerating() {
+				ps.executeExclusive(func(current *models.CandleData) *models.CandleData {
+					return ps.applyTrade(current, trade, &state)
+				})
+			}
+		case <-updateTicker.C:
+			if ps.isGenerating() {
+				ps.executeExclusive(func(current *models.CandleData) *models.CandleData {
+					return ps.flushIngested(current, time.Now(), &state)
+				})
+			}
+		case interval := <-ps.intervalChanges:
+			updateTicker.Reset(interval)
+		case <-ps.stop:
+			return
+		}
+	}
+}
+
+// applyTrade merges a trade into the current candle, rolling over to a new candle when
+// the trade belongs to a later minute. Trades of finalized minutes are late and still
+// carry the latest price, so they go into the current candle as well.
+func (ps *PriceService) applyTrade(current *models.CandleData, trade ingest.Trade, state *ingestState) *models.CandleData {
+	timestamp := models.TimeFrame1Min.NormalizeTimestamp(trade.Time)
+
+	if current != nil && timestamp > current.Timestamp {
+		ps.finalizeCandle(current)
+		current = nil
+	}
+	if current == nil {
+		current = ps.openIngested(timestamp, trade.Price, state)
+	}
+
+	// The first trade sets the open, which is only an estimate until then
+	if !state.traded {
+		current.Values = [4]float64{trade.Price, trade.Price, trade.Price, trade.Price}
+		current.Volume = 0
+		state.traded = true
+	}
+
+	if trade.Price > current.Values[1] {
+		current.Values[1] = trade.Price
+	}
+	if trade.Price < current.Values[2] {
+		current.Values[2] = trade.Price
+	}
+	current.Values[3] = trade.Price
+	current.Volume = models.AddAmounts(current.Volume, trade.Quantity)
+	state.pending = true
+	if ps.feed != nil {
+		ps.trades.record(trade.Price, trade.Quantity, trade.Time)
+	}
+
+	return current
+}
+
+// flushIngested sends the current candle to clients if it changed, and closes it once
+// its minute is over even if no newer trade arrived, continuing with a flat candle.
+func (ps *PriceService) flushIngested(current *models.CandleData, now time.Time, state *ingestState) *models.CandleData {
+	if current == nil {
+		return nil
+	}
+
+	if state.pending {
+		ps.broadcastUpdate(state.sent, *current)
+		state.sent = *current
+		state.pending = false
+	}
+
+	end := current.Timestamp + time.Minute.Milliseconds()
+	if now.Add(-ingestGrace).UnixMilli() < end {
+		return current
+	}
+
+	lastClose := current.Values[3]
+	ps.finalizeCandle(current)
+	return ps.openIngested(models.TimeFrame1Min.NormalizeTimestamp(now.UnixMilli()), lastClose, state)
+}
+
+// openIngested starts a candle at the given price and tells clients about it. Unlike
+// generated candles, its open is final: a minute without trades stays flat at the previous close.
+func (ps *PriceService) openIngested(timestamp int64, price float64, state *ingestState) *models.CandleData {
+	candle := &models.CandleData{
+		Timestamp: timestamp,
+		Values:    [4]float64{price, price, price, price},
+	}
+	ps.broadcastToClients(models.UpdateMessage{
+		Type:      "new",
+		Candle:    *candle,
+		TimeFrame: models.TimeFrame1Min,
+	})
+
+	*state = ingestState{traded: true, sent: *candle}
+	return candle
+}
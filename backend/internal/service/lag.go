@@ -0,0 +1,137 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"server/internal/config"
+	"server/internal/metrics"
+	"server/internal/models"
+)
+
+// lagCheckInterval is how often the clients are checked against the lag thresholds
+const lagCheckInterval = time.Second
+
+var (
+	lagAlerts      = metrics.NewCounter("seedventure_ws_lag_alerts_total", "Number of times a client fell behind the lag thresholds")
+	lagEvictions   = metrics.NewCounter("seedventure_ws_lag_evictions_total", "Number of clients disconnected for falling behind too long")
+	laggingClients atomic.Int64 // Clients of all hubs falling behind at the last check
+
+	_ = metrics.NewGaugeFunc("seedventure_ws_lagging_clients", "Number of clients falling behind the lag thresholds", func() float64 {
+		return float64(laggingClients.Load())
+	})
+)
+
+// SetLagThresholds sets the thresholds from which a client falls behind
+func (h *Hub) SetLagThresholds(cfg config.LagConfig) {
+	h.lag.Store(&cfg)
+}
+
+// Ack records the offset of the update log up to which the client processed updates
+func (c *Client) Ack(offset int64) {
+	c.ackedOffset.Store(offset)
+}
+
+// lagReason returns why the client falls behind the thresholds, empty if it doesn't
+func (c *Client) lagReason(cfg *config.LagConfig) string {
+	if depth := len(c.send); cfg.QueueDepth > 0 && depth >= cfg.QueueDepth {
+		return fmt.Sprintf("%d payloads queued", depth)
+	}
+	if acked := c.ackedOffset.Load(); cfg.AckLag > 0 && acked > 0 {
+		if lag := c.sentOffset.Load() - acked; lag >= cfg.AckLag {
+			return fmt.Sprintf("acknowledgements %d offsets behind", lag)
+		}
+	}
+	return ""
+}
+
+// watchLag checks the clients against the lag thresholds until the hub is closed
+func (h *Hub) watchLag() {
+	ticker := time.NewTicker(lagCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.closed:
+			laggingClients.Add(-h.lagging)
+			return
+		case now := <-ticker.C:
+			h.checkLag(now)
+		}
+	}
+}
+
+// checkLag alerts about clients that fell behind the thresholds and disconnects those that
+// stayed behind longer than allowed
+func (h *Hub) checkLag(now time.Time) {
+	cfg := h.lag.Load()
+	if cfg == nil {
+		return
+	}
+
+	var lagging int64
+	var evict []*Client
+
+	h.clientsLock.RLock()
+	for client := range h.clients {
+		reason := client.lagReason(cfg)
+
+		client.mu.Lock()
+		switch {
+		case reason != "" && client.laggingSince.IsZero():
+			client.laggingSince = now
+			lagAlerts.Inc()
+			log.Printf("Alert: client %s is falling behind, %s", client.conn.RemoteAddr(), reason)
+		case reason == "" && !client.laggingSince.IsZero():
+			log.Printf("Client %s caught up after %s", client.conn.RemoteAddr(), now.Sub(client.laggingSince).Round(time.Second))
+			client.laggingSince = time.Time{}
+		}
+		since := client.laggingSince
+		client.mu.Unlock()
+
+		if reason != "" {
+			lagging++
+			if cfg.EvictAfter > 0 && now.Sub(since) >= cfg.EvictAfter {
+				evict = append(evict, client)
+			}
+		}
+	}
+	h.clientsLock.RUnlock()
+
+	laggingClients.Add(lagging - h.lagging)
+	h.lagging = lagging
+
+	for _, client := range evict {
+		log.Printf("Dropping client %s, behind for more than %s", client.conn.RemoteAddr(), cfg.EvictAfter)
+		lagEvictions.Inc()
+		h.Unregister(client)
+	}
+}
+
+// LagReport lists the clients falling behind the lag thresholds as of the last check
+func (h *Hub) LagReport() models.LagReport {
+	var report models.LagReport
+	if cfg := h.lag.Load(); cfg != nil {
+		report.QueueDepth = cfg.QueueDepth
+		report.AckLag = cfg.AckLag
+		report.EvictAfter = cfg.EvictAfter.Milliseconds()
+	}
+
+	h.clientsLock.RLock()
+	report.Connections = len(h.clients)
+	report.Lagging = []models.ConnectionInfo{}
+	for client := range h.clients {
+		if info := client.info(); info.LaggingSince != 0 {
+			report.Lagging = append(report.Lagging, info)
+		}
+	}
+	h.clientsLock.RUnlock()
+
+	sort.Slice(report.Lagging, func(i, j int) bool {
+		return report.Lagging[i].LaggingSince < report.Lagging[j].LaggingSince
+	})
+	return report
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"server/internal/models"
+)
+
+// SetMaintenance enables or disables maintenance mode. While enabled, no new
+// prices are generated and clients are told why; history stays readable.
+func (ps *PriceService) SetMaintenance(enabled bool, message string) {
+	ps.maintenanceLock.Lock()
+	ps.maintenanceMsg = message
+	if !enabled {
+		ps.maintenanceMsg = ""
+	}
+	ps.maintenance.Store(enabled)
+	ps.maintenanceLock.Unlock()
+
+	if enabled {
+		log.Printf("Maintenance mode enabled: %s", message)
+	} else {
+		log.Println("Maintenance mode disabled")
+	}
+
+	ps.hub.PublishAll(ps.GetStatus())
+}
+
+// InMaintenance reports whether maintenance mode is enabled
+func (ps *PriceService) InMaintenance() bool {
+	return ps.maintenance.Load()
+}
+
+// GetStatus returns the status message describing the current server status
+func (ps *PriceService) GetStatus() models.StatusMessage {
+	ps.maintenanceLock.RLock()
+	defer ps.maintenanceLock.RUnlock()
+
+	if ps.maintenance.Load() {
+		return models.StatusMessage{
+			Type:    "status",
+			Status:  models.StatusMaintenance,
+			Message: ps.maintenanceMsg,
+		}
+	}
+
+	if ps.MarketClosed() {
+		return models.StatusMessage{
+			Type:    "status",
+			Status:  models.StatusClosed,
+			Message: "closed for a holiday",
+		}
+	}
+
+	if ps.halt.Halted {
+		return models.StatusMessage{
+			Type:       "status",
+			Status:     models.StatusTradingHalted,
+			Message:    ps.halt.Reason,
+			CancelOpen: ps.halt.CancelOpen,
+		}
+	}
+
+	return models.StatusMessage{
+		Type:   "status",
+		Status: models.StatusRunning,
+	}
+}
+
+// SetTradingHalt halts or resumes trading of the symbol. Unlike in maintenance, prices keep
+// moving; clients are told to stop accepting orders, and to close open positions at the
+// current price if cancelOpen is set. Halting a halted symbol updates the reason.
+func (ps *PriceService) SetTradingHalt(halted bool, reason string, cancelOpen bool) {
+	ps.maintenanceLock.Lock()
+	switch {
+	case !halted:
+		ps.halt = models.TradingHalt{}
+	case !ps.halt.Halted:
+		ps.halt = models.TradingHalt{Halted: true, Since: time.Now().UnixMilli()}
+		fallthrough
+	default:
+		ps.halt.Reason = reason
+		ps.halt.CancelOpen = ps.halt.CancelOpen || cancelOpen
+	}
+	ps.maintenanceLock.Unlock()
+
+	symbol := ps.GetSimulationParams().Symbol
+	if halted {
+		log.Printf("Trading of %s halted: %s", symbol, reason)
+	} else {
+		log.Printf("Trading of %s resumed", symbol)
+	}
+
+	ps.hub.PublishAll(ps.GetStatus())
+}
+
+// TradingHalt returns the trading status of the symbol
+func (ps *PriceService) TradingHalt() models.TradingHalt {
+	ps.maintenanceLock.RLock()
+	defer ps.maintenanceLock.RUnlock()
+	halt := ps.halt
+	halt.Symbol = ps.GetSimulationParams().Symbol
+	return halt
+}
+
+// TradingHalted reports whether trading of the symbol is halted
+func (ps *PriceService) TradingHalted() bool {
+	ps.maintenanceLock.RLock()
+	defer ps.maintenanceLock.RUnlock()
+	return ps.halt.Halted
+}
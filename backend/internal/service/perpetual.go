@@ -0,0 +1,87 @@
+package service
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// premiumReversion is the share of the premium of a perpetual contract or venue that decays
+// every broadcast interval, pulling it back towards spot
+const premiumReversion = 0.05
+
+// premium is the simulated premium of a perpetual contract or venue over spot, a
+// mean-reverting random walk around 0, and its average since the last funding
+type premium struct {
+	lock       sync.Mutex
+	rng        *rand.Rand
+	volatility float64 // Standard deviation of a step
+	value      float64
+	sum        float64 // Sum of the premiums since the last funding
+	samples    int
+}
+
+// SetPerpetual makes the service a perpetual contract on a spot market: an index of the spot
+// price times 1 plus a premium moving randomly by volatility every broadcast interval and
+// reverting to 0. The premium averaged between fundings is the funding rate, see
+// TakeFunding. Must be called before the history is loaded, which starts at spot.
+func (ps *PriceService) SetPerpetual(spot *PriceService, underlying string, volatility float64) {
+	ps.index = []IndexConstituent{{Name: underlying, Service: spot, Weight: 1}}
+	ps.premium = ps.newPremium(volatility)
+}
+
+// newPremium returns a premium moving by volatility, with a generator of its own seeded by
+// the service's
+func (ps *PriceService) newPremium(volatility float64) *premium {
+	return &premium{
+		rng:        rand.New(rand.NewSource(ps.rng.Int63())),
+		volatility: volatility,
+	}
+}
+
+// stepPremium moves the premium of a perpetual contract or venue by one broadcast interval
+func (ps *PriceService) stepPremium() {
+	p := ps.premium
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.value += -premiumReversion*p.value + p.volatility*p.rng.NormFloat64()
+	p.sum += p.value
+	p.samples++
+}
+
+// Premium returns the current premium of a perpetual contract or venue over spot and its
+// average since the last funding, 0 unless the service is either
+func (ps *PriceService) Premium() (current, average float64) {
+	p := ps.premium
+	if p == nil {
+		return 0, 0
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.value, p.average()
+}
+
+// TakeFunding returns the average premium of a perpetual contract since the last funding
+// and starts averaging anew
+func (ps *PriceService) TakeFunding() float64 {
+	p := ps.premium
+	if p == nil {
+		return 0
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	average := p.average()
+	p.sum, p.samples = 0, 0
+	return average
+}
+
+// average returns the average premium since the last funding, the current one if there
+// was no step since. The caller holds lock.
+func (p *premium) average() float64 {
+	if p.samples == 0 {
+		return p.value
+	}
+	return p.sum / float64(p.samples)
+}
@@ -1,213 +1,648 @@
 package service
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"math/rand"
+	"net"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"server/internal/config"
+	"server/internal/follow"
+	"server/internal/ingest"
+	"server/internal/metrics"
 	"server/internal/models"
+	"server/internal/store"
+	"server/internal/version"
 
 	"github.com/gorilla/websocket"
 )
 
+// historyChunkSize is the number of candles encoded at a time when streaming history
+const historyChunkSize = 1024
+
+// historyCacheMaxCandles is the largest history kept serialized in memory, larger ones are streamed
+const historyCacheMaxCandles = 10000
+
+// saveWorkers bounds the number of timeframes written to disk concurrently
+const saveWorkers = 4
+
+// ErrNotAggregate is returned when rebuilding the 1-minute timeframe, which isn't
+// aggregated from another one
+var ErrNotAggregate = errors.New("1m is the source of the aggregates and can't be rebuilt")
+
+// ohlcRepairs counts candles that had to be widened to keep their open and close within
+// their high and low
+var ohlcRepairs = metrics.NewCounter("seedventure_ohlc_repairs_total", "Number of candles whose high or low had to be widened to their open and close")
+
+const (
+	minutesPerDay     = 24 * 60
+	maxGeneratedTicks = 600 // Most price moves per generated candle, as with a broadcast interval of 100ms
+)
+
+// snapshotInterval is the number of frames after which delta clients get a full update
+const snapshotInterval = 10
+
 // PriceService manages price data for multiple timeframes
 type PriceService struct {
-	// Map of timeframe to candle data
-	timeFrameData     map[models.TimeFrame][]models.CandleData
-	timeFrameDataLock sync.RWMutex
-
-	currentCandle *models.CandleData
-	clients       map[*websocket.Conn]bool
-	clientsLock   sync.RWMutex
-	dataDir       string // Directory to store data files
-	maxCandles    int    // Maximum number of candles to keep per timeframe
+	// Map of timeframe to candle data, each timeframe has its own lock
+	timeFrameData map[models.TimeFrame]*timeFrameStore
+
+	candleCommands chan candleCommand      // Requests to the goroutine owning the current candle
+	deltaFrames    int                     // Delta frames since the last full update, owned by ownCandle
+	hub            *Hub                    // Connected WebSocket clients
+	dataDir        string                  // Directory to store data files
+	feed           *ingest.Feed            // Exchange feed replacing generated prices, nil when generating
+	primary        *follow.Primary         // Server whose candles are mirrored instead of generating prices, nil when generating
+	index          []IndexConstituent      // Symbols whose prices are summed instead of generating prices, nil when generating
+	future         *models.FuturesContract // Contract whose basis the index price is multiplied with, nil unless a futures contract
+	premium        *premium                // Premium the index price is multiplied with, nil unless a perpetual contract or venue
+	delay          *delay                  // Latency of the index price, nil unless a venue
+	clock          atomic.Value            // Clock of candle timestamps, a func() time.Time, see SetClock
+	precision      models.Precision        // Rounding of generated prices and volumes
+
+	// Settings that can be changed while running
+	settingsLock      sync.RWMutex
+	maxCandles        int                     // Maximum number of candles to keep per timeframe
+	params            models.SimulationParams // Price generation parameters
+	priceModel        models.PriceModel       // Model selected by params.Model
+	volumeParams      models.VolumeParams     // How volume follows the price
+	random            *models.RandomSource    // Source of all randomness, its state is part of snapshots
+	rng               *rand.Rand              // Generator reading from random
+	volumeModel       models.VolumeModel      // Used along with rng, its state is part of snapshots
+	broadcastInterval time.Duration           // How often the current candle is updated
+	saveInterval      time.Duration           // How often changed timeframes are saved
+	cash              config.CashConfig       // Cash flows paid at candle closes, see payCash
+	chat              config.ChatConfig       // How chat messages are checked and kept, see PostChat
+	holidays          *models.HolidayCalendar // Days without candles, see MarketClosed
+	intervalChanges   chan time.Duration
+
+	stop     chan struct{} // Closed by Stop to end Run
+	stopOnce sync.Once
+
+	paused atomic.Bool // When set, the run loop stops generating prices
+	ready  atomic.Bool // Set once history is loaded and the first candle has started
+
+	maintenance     atomic.Bool // When set, generation stops and clients are told about maintenance
+	maintenanceLock sync.RWMutex
+	maintenanceMsg  string
+	halt            models.TradingHalt // Guarded by maintenanceLock, see SetTradingHalt
+
+	dataVersion atomic.Uint64 // Incremented whenever a new dataset replaces the history
+	reloadLock  sync.Mutex    // Serializes data reloads
+
+	recordingLock sync.Mutex       // Guards recorder and replay
+	recorder      *sessionRecorder // Recording in progress, nil if none
+	replay        *sessionReplay   // Replay in progress, nil if none
+	replaying     atomic.Bool      // When set, generation stops while a recording is re-emitted
+
+	listenersLock   sync.RWMutex
+	updateListeners []func(models.UpdateMessage) // Called with every candle update, see OnUpdate
+
+	trades  tradeLog   // Recent trades, see RecentTrades
+	updates *updateLog // Every update sent, nil unless data.updateLog is enabled, see LoggedUpdates
+
+	cashLock  sync.Mutex
+	cashFlows []models.CashFlow // Deposits and withdrawals, see PayCash
+
+	chatLock    sync.Mutex
+	chatHistory []models.ChatEntry // Last chat messages, see PostChat
+	chatID      int64              // ID of the last chat message
+
+	healthLock sync.Mutex
+	loopHealth models.LoopHealth // Health of the simulation loop, see supervise
 }
 
 // NewPriceService creates a new instance of PriceService
-func NewPriceService() *PriceService {
+func NewPriceService(cfg *config.Config) *PriceService {
 	// Create data directory if it doesn't exist
-	dataDir := "data"
+	dataDir := cfg.Data.Dir
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		log.Printf("Error creating data directory: %v", err)
 	}
 
-	return &PriceService{
-		timeFrameData: make(map[models.TimeFrame][]models.CandleData),
-		clients:       make(map[*websocket.Conn]bool),
-		dataDir:       dataDir,
-		maxCandles:    100, // Store maximum of 100 candles per timeframe
+	priceModel, _ := models.GetPriceModel(cfg.Simulation.Model)
+
+	seed := cfg.Simulation.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	random := models.NewRandomSource(seed)
+
+	ps := &PriceService{
+		timeFrameData:  newTimeFrameStores(),
+		candleCommands: make(chan candleCommand),
+		hub:            NewHub(cfg.Server.WebSocket.Writers),
+		dataDir:        dataDir,
+		precision:      cfg.Simulation.Precision(),
+
+		maxCandles:        cfg.Data.MaxCandles,
+		params:            simulationParams(cfg),
+		priceModel:        priceModel,
+		volumeParams:      cfg.Simulation.VolumeParams(),
+		random:            random,
+		rng:               rand.New(random),
+		broadcastInterval: cfg.Simulation.BroadcastInterval,
+		saveInterval:      cfg.Data.SaveInterval,
+		cash:              cfg.Cash,
+		chat:              cfg.Chat,
+		holidays:          holidayCalendar(cfg),
+		intervalChanges:   make(chan time.Duration, 1),
+		stop:              make(chan struct{}),
+	}
+	ps.SetClock(time.Now)
+	if err := ps.loadCashFlows(); err != nil {
+		log.Printf("Error loading cash flows: %v", err)
+	}
+	if err := ps.loadChat(); err != nil {
+		log.Printf("Error loading chat history: %v", err)
+	}
+	if cfg.Data.UpdateLog.Enabled {
+		updates, err := openUpdateLog(dataDir, cfg.Data.UpdateLog)
+		if err != nil {
+			log.Printf("Error opening update log, updates aren't logged: %v", err)
+		} else {
+			ps.updates = updates
+			go updates.flushLoop(ps.stop)
+		}
+	}
+	ps.hub.SetChaos(cfg.Chaos)
+	ps.hub.SetLagThresholds(cfg.Server.WebSocket.Lag)
+	go ps.ownCandle()
+	if cfg.NamespaceName() == config.DefaultNamespace {
+		registerStoreMetrics(ps.timeFrameData)
 	}
-}
 
-// Initialize generates historical data directly for each timeframe
-func (ps *PriceService) Initialize(days int) {
-	basePrice := 1.0
-	volatility := 10.0
-	now := time.Now()
+	if cfg.Ingest.Enabled() {
+		ps.feed = ingest.NewFeed(cfg.Ingest.URL, cfg.Ingest.ReconnectDelay)
+	}
+	if cfg.Follow.Enabled() {
+		ps.primary = follow.NewPrimary(cfg.Follow.Primary, cfg.Follow.APIKey, cfg.Follow.ReconnectDelay)
+	}
 
-	tf := models.TimeFrame1Min
+	if cfg.Server.WebSocket.Transport == config.TransportEpoll {
+		if err := ps.hub.StartEventLoop(cfg.Server.WebSocket.Workers); err != nil {
+			log.Printf("Cannot use the epoll WebSocket transport, falling back to gorilla: %v", err)
+		}
+	}
 
-	log.Printf("Generating data for timeframe %s...", tf)
+	return ps
+}
 
-	// We'll create 100 candles for the last 100 minutes
-	numCandles := ps.maxCandles
-	candles := make([]models.CandleData, 0, numCandles)
+// SetClock replaces the clock candles are timestamped with, which is the system clock
+// by default. Tests set it before generating the first candle, though it may be replaced
+// while the generator runs.
+func (ps *PriceService) SetClock(now func() time.Time) {
+	ps.clock.Store(now)
+}
 
-	// Initialize price variables for this timeframe
-	currentPrice := basePrice
-	lastClose := basePrice
+// now returns the time of the clock candles are timestamped with
+func (ps *PriceService) now() time.Time {
+	return ps.clock.Load().(func() time.Time)()
+}
 
-	// Generate candles for the past 100 minutes
-	for i := 0; i < numCandles; i++ {
-		// Calculate timestamp for each candle, starting from (now - 99 minutes) to now
-		// For the most recent 100 minutes, we go from (now - 99*minute) to now
-		minutesAgo := int64(numCandles - 1 - i)
-		candleTime := now.Add(-time.Duration(minutesAgo) * time.Minute)
+// simulationParams extracts the price generation parameters from the configuration
+func simulationParams(cfg *config.Config) models.SimulationParams {
+	return models.SimulationParams{
+		Symbol:     cfg.Simulation.Symbol,
+		Model:      cfg.Simulation.Model,
+		BasePrice:  cfg.Simulation.BasePrice,
+		Volatility: cfg.Simulation.Volatility,
+		Drift:      cfg.Simulation.Drift,
 
-		// Normalize timestamp to the beginning of the period
-		timestamp := tf.NormalizeTimestamp(candleTime.Unix() * 1000)
+		Seasonality: cfg.Simulation.Seasonality,
+	}
+}
 
-		// Generate realistic price movement
-		change := (rand.Float64() - 0.5) * volatility
-		currentPrice = lastClose + change
+// ApplyConfig updates the settings that are safe to change while running
+func (ps *PriceService) ApplyConfig(cfg *config.Config) {
+	ps.settingsLock.Lock()
+	intervalChanged := ps.broadcastInterval != cfg.Simulation.BroadcastInterval
+	ps.maxCandles = cfg.Data.MaxCandles
+	if cfg.Simulation.Model != ps.params.Model {
+		ps.priceModel, _ = models.GetPriceModel(cfg.Simulation.Model) // A new instance, so only when the model changes
+	}
+	ps.params = simulationParams(cfg)
+	ps.volumeParams = cfg.Simulation.VolumeParams()
+	ps.broadcastInterval = cfg.Simulation.BroadcastInterval
+	ps.saveInterval = cfg.Data.SaveInterval
+	ps.cash = cfg.Cash
+	ps.chat = cfg.Chat
+	ps.holidays = holidayCalendar(cfg)
+	ps.settingsLock.Unlock()
+	ps.hub.SetChaos(cfg.Chaos)
+	ps.hub.SetLagThresholds(cfg.Server.WebSocket.Lag)
+
+	// Enforce the new retention on the data we already hold
+	for _, data := range ps.timeFrameData {
+		data.resize(cfg.Data.MaxCandles)
+	}
 
-		if currentPrice < 0 {
-			currentPrice = 0 // Prevent negative prices
+	// Let the run loop pick up the new interval, replacing any pending change
+	if intervalChanged {
+		select {
+		case <-ps.intervalChanges:
+		default:
 		}
+		ps.intervalChanges <- cfg.Simulation.BroadcastInterval
+	}
 
-		// Open should be close to the last close
-		open := lastClose + (rand.Float64()-0.5)*(volatility*0.1)
+	log.Printf("Applied settings: volatility %.2f, max candles %d, broadcast interval %s",
+		cfg.Simulation.Volatility, cfg.Data.MaxCandles, cfg.Simulation.BroadcastInterval)
+}
 
-		// Generate high and low with more realistic ranges for timeframe
-		highLowRange := volatility * 0.5
+// getMaxCandles returns the current retention limit per timeframe
+func (ps *PriceService) getMaxCandles() int {
+	ps.settingsLock.RLock()
+	defer ps.settingsLock.RUnlock()
+	return ps.maxCandles
+}
 
-		high := math.Max(open, currentPrice) + rand.Float64()*highLowRange
-		low := math.Min(open, currentPrice) - rand.Float64()*highLowRange
+// GetSimulationParams returns the current price generation parameters
+func (ps *PriceService) GetSimulationParams() models.SimulationParams {
+	ps.settingsLock.RLock()
+	defer ps.settingsLock.RUnlock()
+	return ps.params
+}
+
+// UpdateSimulationParams applies a partial update of the price generation parameters
+func (ps *PriceService) UpdateSimulationParams(update models.SimulationUpdate) (models.SimulationParams, error) {
+	ps.settingsLock.Lock()
+	defer ps.settingsLock.Unlock()
+
+	if update.Symbol != "" && update.Symbol != ps.params.Symbol {
+		return ps.params, fmt.Errorf("unknown symbol %s", update.Symbol)
+	}
+
+	params := ps.params
+	priceModel := ps.priceModel
 
-		// Ensure low is not greater than high
-		if low > high {
-			low = high - (rand.Float64() * highLowRange * 0.1)
+	if update.Model != nil {
+		model, ok := models.GetPriceModel(*update.Model)
+		if !ok {
+			return ps.params, fmt.Errorf("unknown price model %q, available models: %v", *update.Model, models.PriceModelNames())
 		}
+		params.Model = *update.Model
+		priceModel = model
+	}
+	if update.BasePrice != nil {
+		if *update.BasePrice <= 0 {
+			return ps.params, fmt.Errorf("basePrice must be positive, got %g", *update.BasePrice)
+		}
+		params.BasePrice = *update.BasePrice
+	}
+	if update.Volatility != nil {
+		if *update.Volatility < 0 {
+			return ps.params, fmt.Errorf("volatility must not be negative, got %g", *update.Volatility)
+		}
+		params.Volatility = *update.Volatility
+	}
+	if update.Drift != nil {
+		params.Drift = *update.Drift
+	}
 
-		open = math.Round(open*100) / 100
-		high = math.Round(high*100) / 100
-		low = math.Round(low*100) / 100
-		close := math.Round(currentPrice*100) / 100
+	ps.params = params
+	ps.priceModel = priceModel
 
-		lastClose = close
+	log.Printf("Simulation parameters for %s updated: model %s, base price %.2f, volatility %.2f, drift %.4f",
+		params.Symbol, params.Model, params.BasePrice, params.Volatility, params.Drift)
+	return params, nil
+}
 
-		// Generate volume appropriate for the timeframe
-		volumeBase := 1000.0
-		volumeMultiplier := 1.0
+// Run updates the current candle every broadcast interval and creates a new one every minute.
+// With an exchange feed, candles are built from its trades instead, followers mirror
+// the candles of their primary and indexes follow their constituents. Changed timeframes are saved in the background.
+// The loop is restarted after a panic, see supervise.
+func (ps *PriceService) Run() {
+	go ps.runSaver()
+
+	switch {
+	case ps.feed != nil:
+		ps.runIngest()
+	case ps.primary != nil:
+		ps.runFollower()
+	case ps.index != nil:
+		ps.supervise(ps.runIndex)
+	default:
+		ps.supervise(ps.runGenerator)
+	}
+}
 
-		volume := math.Round((rand.Float64()*volumeBase*volumeMultiplier)*100) / 100
+// runGenerator generates prices, updating the current candle every broadcast interval and
+// starting a new one every minute
+func (ps *PriceService) runGenerator() {
+	ps.settingsLock.RLock()
+	interval := ps.broadcastInterval
+	ps.settingsLock.RUnlock()
+
+	// Candles complete exactly at the end of their minute, so the first one after startup
+	// only covers the rest of its minute
+	boundary := nextCandleBoundary(ps.now())
+	updateTicker := time.NewTicker(interval)
+	candleTimer := time.NewTimer(boundary.Sub(ps.now()))
+	defer updateTicker.Stop()
+	defer candleTimer.Stop()
+
+	// Holidays have no candles, not even the one started before Run
+	closed := ps.MarketClosed()
+	if closed {
+		ps.execute(opDiscard)
+		ps.announceHoliday(closed)
+	}
 
-		// Create candle
-		candle := models.CandleData{
-			Timestamp:  timestamp,
-			Values:     [4]float64{open, high, low, close},
-			IsComplete: true,
-			Volume:     volume,
+	for {
+		select {
+		case <-updateTicker.C:
+			if ps.isGenerating() && !closed {
+				ps.UpdateCurrentCandle()
+			}
+		case <-candleTimer.C:
+			if holiday := ps.closedAt(boundary); holiday != closed {
+				closed = holiday
+				ps.announceHoliday(closed)
+			}
+			if ps.isGenerating() {
+				ps.FinalizeCurrentCandle()
+				if !closed {
+					ps.StartNewCandle()
+				}
+			}
+			// Skip boundaries missed while the process was suspended or the clock jumped
+			now := ps.now()
+			if boundary = boundary.Add(time.Minute); !boundary.After(now) {
+				boundary = nextCandleBoundary(now)
+			}
+			candleTimer.Reset(boundary.Sub(now))
+		case interval := <-ps.intervalChanges:
+			updateTicker.Reset(interval)
+		case <-ps.stop:
+			return
 		}
-
-		candles = append(candles, candle)
 	}
+}
+
+// nextCandleBoundary returns the start of the minute after now, when the current 1-minute
+// candle completes
+func nextCandleBoundary(now time.Time) time.Time {
+	return now.Truncate(time.Minute).Add(time.Minute)
+}
+
+// Stop ends Run and saves all timeframes. Clients stay connected but get no more updates.
+func (ps *PriceService) Stop() error {
+	ps.stopOnce.Do(func() {
+		close(ps.stop)
+		if ps.feed != nil {
+			ps.feed.Close()
+		}
+		if ps.primary != nil {
+			ps.primary.Close()
+		}
+		if ps.updates != nil {
+			if err := ps.updates.close(); err != nil {
+				log.Printf("Error closing update log: %v", err)
+			}
+		}
+	})
+	return ps.SaveAllTimeFrames()
+}
 
-	log.Printf("Generated %d candles for timeframe %s", len(candles), tf)
+// LoadOrInitialize loads the history from the data directory, or generates the given
+// number of days of history and saves it if there is none
+func (ps *PriceService) LoadOrInitialize(days int) {
+	if err := ps.LoadAllTimeFrames(); err != nil {
+		log.Println("Generating new historical data:", err)
 
-	// Store candles for this timeframe
-	ps.timeFrameDataLock.Lock()
-	ps.timeFrameData[tf] = candles
-	ps.timeFrameDataLock.Unlock()
+		ps.Initialize(days)
 
-	// Save timeframe data immediately
-	if err := ps.SaveTimeFrame(tf); err != nil {
-		log.Printf("Error saving data for %s: %v", tf, err)
+		if err := ps.SaveAllTimeFrames(); err != nil {
+			log.Printf("Error saving data: %v", err)
+		}
 	}
+}
 
-	// Initialize higher timeframes based on 1-minute data
-	ps.initializeHigherTimeframes()
+// Hub returns the hub broadcasting to the connected clients
+func (ps *PriceService) Hub() *Hub {
+	return ps.hub
 }
 
-// initializeHigherTimeframes creates initial data for higher timeframes from 1-minute data
-func (ps *PriceService) initializeHigherTimeframes() {
-	timeframes := []models.TimeFrame{
-		models.TimeFrame5Min,
-		models.TimeFrame15Min,
-		models.TimeFrame1Hour,
-		models.TimeFrame4Hour,
-		models.TimeFrame1Day,
+// Initialize replaces the history with days of generated 1-minute candles ending with the
+// last complete minute, moving the price with the selected model as live generation does.
+// The candles are generated a day at a time and aggregated into the higher timeframes as
+// they go, so only the retained data.maxCandles of every timeframe are kept in memory.
+// Indexes compute their history from the constituents instead.
+func (ps *PriceService) Initialize(days int) {
+	if ps.index != nil {
+		ps.initializeIndex()
+		return
+	}
+	if days < 1 {
+		days = 1
 	}
+	// The price and volume models are shared with live candles, so they are only used by
+	// the candle owner, which leaves the current candle as it is
+	ps.executeExclusive(func(current *models.CandleData) *models.CandleData {
+		ps.generateHistory(days)
+		return current
+	})
+}
 
-	ps.timeFrameDataLock.RLock()
-	minuteCandles := ps.timeFrameData[models.TimeFrame1Min]
-	ps.timeFrameDataLock.RUnlock()
+// generateHistory replaces the history with days of generated candles, see Initialize.
+// Only called by ownCandle.
+func (ps *PriceService) generateHistory(days int) {
+	params := ps.GetSimulationParams()
+	maxCandles := ps.getMaxCandles()
+
+	ps.settingsLock.RLock()
+	priceModel := ps.priceModel
+	volumeParams := ps.volumeParams
+	ticks := int(time.Minute / ps.broadcastInterval)
+	ps.settingsLock.RUnlock()
+	if ticks < 1 {
+		ticks = 1
+	} else if ticks > maxGeneratedTicks {
+		ticks = maxGeneratedTicks
+	}
 
-	// Process each timeframe
-	for _, tf := range timeframes {
-		// Map to group candles by normalized timestamp
-		groupedCandles := make(map[int64]models.CandleData)
-
-		// Group minute candles into higher timeframe buckets
-		for _, candle := range minuteCandles {
-			normalizedTimestamp := tf.NormalizeTimestamp(candle.Timestamp)
-
-			// If this is a new timestamp, initialize the candle
-			if existingCandle, exists := groupedCandles[normalizedTimestamp]; !exists {
-				groupedCandles[normalizedTimestamp] = models.CandleData{
-					Timestamp:  normalizedTimestamp,
-					Values:     [4]float64{candle.Values[0], candle.Values[1], candle.Values[2], candle.Values[3]},
-					IsComplete: true,
-					Volume:     candle.Volume,
-				}
-			} else {
-				// Update the existing candle
-				updatedCandle := existingCandle
+	total := days * minutesPerDay
+	end := models.TimeFrame1Min.NormalizeTimestamp(ps.now().UnixMilli()) // Start of the current minute
+	start := end - int64(total)*time.Minute.Milliseconds()
+	log.Printf("Generating %d days of 1-minute candles with the %s model...", days, params.Model)
 
-				// Keep the original open
-				// Update high/low if needed
-				if candle.Values[1] > updatedCandle.Values[1] {
-					updatedCandle.Values[1] = candle.Values[1]
+	series := make(map[models.TimeFrame]*store.Series)
+	pending := make(map[models.TimeFrame]*models.CandleData) // Incomplete candles of higher timeframes
+	for _, tf := range models.AllTimeFrames() {
+		series[tf] = store.NewSeries(maxCandles)
+	}
+
+	lastClose := params.BasePrice
+	chunk := make([]models.CandleData, 0, minutesPerDay)
+	for minute := 0; minute < total; {
+		chunk = chunk[:0]
+		for ; minute < total && len(chunk) < minutesPerDay; minute++ {
+			timestamp := start + int64(minute)*time.Minute.Milliseconds()
+			if ps.closedAt(time.UnixMilli(timestamp)) {
+				continue
+			}
+			candle := ps.generateCandle(timestamp, lastClose, params, priceModel, volumeParams, ticks)
+			lastClose = candle.Values[3]
+			chunk = append(chunk, candle)
+		}
+
+		for _, candle := range chunk {
+			series[models.TimeFrame1Min].Append(candle)
+			for _, tf := range models.AllTimeFrames()[1:] {
+				timestamp := tf.NormalizeTimestamp(candle.Timestamp)
+				current := pending[tf]
+				if current != nil && current.Timestamp != timestamp {
+					series[tf].Append(*current)
+					current = nil
 				}
-				if candle.Values[2] < updatedCandle.Values[2] {
-					updatedCandle.Values[2] = candle.Values[2]
+				if current == nil {
+					current = &models.CandleData{Timestamp: timestamp, Values: candle.Values, IsComplete: true}
+					pending[tf] = current
 				}
+				current.Values[1] = math.Max(current.Values[1], candle.Values[1])
+				current.Values[2] = math.Min(current.Values[2], candle.Values[2])
+				current.Values[3] = candle.Values[3]
+				current.Volume = models.AddAmounts(current.Volume, candle.Volume)
+			}
+		}
+		if days > 1 {
+			log.Printf("Generated %d of %d days", minute/minutesPerDay, days)
+		}
+	}
+	for tf, current := range pending {
+		series[tf].Append(*current)
+	}
 
-				// Set close to the newest candle
-				updatedCandle.Values[3] = candle.Values[3]
+	for _, tf := range models.AllTimeFrames() {
+		ps.timeFrameData[tf].replace(series[tf])
+		log.Printf("Generated %d candles for timeframe %s", series[tf].Len(), tf)
+	}
+}
 
-				// Accumulate volume
-				updatedCandle.Volume += candle.Volume
+// generateCandle generates a complete 1-minute candle opening near lastClose, moving the
+// price ticks times with the price model as live candles are updated
+func (ps *PriceService) generateCandle(timestamp int64, lastClose float64, params models.SimulationParams, priceModel models.PriceModel, volumeParams models.VolumeParams, ticks int) models.CandleData {
+	share := 1 / float64(ticks)
+	at := time.UnixMilli(timestamp)
+
+	open := ps.precision.Price(lastClose + (ps.rng.Float64()-0.5)*(params.At(at).Volatility*0.1))
+	high, low, price := open, open, open
+	volume := ps.precision.Volume(ps.volumeModel.Next(lastClose, open, at, share, volumeParams, ps.rng))
+
+	for i := 0; i < ticks; i++ {
+		next := ps.precision.Price(priceModel.Next(price, params.At(at), ps.rng))
+		at = time.UnixMilli(timestamp + int64(i+1)*time.Minute.Milliseconds()/int64(ticks))
+		volume = ps.precision.AddVolume(volume, ps.volumeModel.Next(price, next, at, share, volumeParams, ps.rng))
+		price = next
+		high = math.Max(high, price)
+		low = math.Min(low, price)
+	}
 
-				groupedCandles[normalizedTimestamp] = updatedCandle
-			}
-		}
+	candle := models.CandleData{
+		Timestamp:  timestamp,
+		Values:     [4]float64{open, high, low, price},
+		IsComplete: true,
+		Volume:     volume,
+	}
+	enforceOHLC(models.TimeFrame1Min, &candle, "history generation")
+	return candle
+}
 
-		// Convert map to slice and ensure we have at most maxCandles
-		timeframeCandles := make([]models.CandleData, 0, len(groupedCandles))
-		for _, candle := range groupedCandles {
-			timeframeCandles = append(timeframeCandles, candle)
-		}
+// MarkReady signals that history is loaded and live candles are being generated
+func (ps *PriceService) MarkReady() {
+	ps.ready.Store(true)
+}
 
-		// Sort by timestamp (oldest first)
-		// Note: In a real implementation, you might want to use a proper sorting function
-		// For this example, we assume the data is already sorted by timestamp
+// IsReady reports whether the service can serve price data
+func (ps *PriceService) IsReady() bool {
+	return ps.ready.Load()
+}
 
-		// Trim to maxCandles
-		if len(timeframeCandles) > ps.maxCandles {
-			timeframeCandles = timeframeCandles[len(timeframeCandles)-ps.maxCandles:]
+// Pause stops price generation until Resume is called
+func (ps *PriceService) Pause() {
+	ps.paused.Store(true)
+	log.Println("Simulation paused")
+}
+
+// Resume continues price generation after Pause
+func (ps *PriceService) Resume() {
+	ps.paused.Store(false)
+	log.Println("Simulation resumed")
+}
+
+// IsPaused reports whether price generation is paused
+func (ps *PriceService) IsPaused() bool {
+	return ps.paused.Load()
+}
+
+// isGenerating reports whether the run loop should produce new prices
+func (ps *PriceService) isGenerating() bool {
+	return !ps.paused.Load() && !ps.maintenance.Load() && !ps.replaying.Load()
+}
+
+// Reset discards all price history, generates fresh data and starts a new candle
+func (ps *PriceService) Reset() {
+	for _, data := range ps.timeFrameData {
+		data.replace(nil)
+	}
+	ps.execute(opDiscard)
+
+	ps.Initialize(1)
+	if err := ps.SaveAllTimeFrames(); err != nil {
+		log.Printf("Error saving data: %v", err)
+	}
+	ps.StartNewCandle()
+
+	log.Println("Price data reset")
+}
+
+// RebuildAggregates regenerates higher timeframes from the 1-minute history and saves
+// them, all of them without any timeframes given
+func (ps *PriceService) RebuildAggregates(timeframes ...models.TimeFrame) error {
+	if len(timeframes) == 0 {
+		timeframes = models.AllTimeFrames()[1:]
+	}
+	for _, tf := range timeframes {
+		if !tf.IsValid() {
+			return fmt.Errorf("unknown timeframe %q", tf)
+		}
+		if tf == models.TimeFrame1Min {
+			return ErrNotAggregate
 		}
+	}
+
+	ps.rebuildTimeframes(timeframes)
+	log.Printf("Rebuilt %v from 1-minute data", timeframes)
+	return nil
+}
 
-		// Store in timeFrameData
-		ps.timeFrameDataLock.Lock()
-		ps.timeFrameData[tf] = timeframeCandles
-		ps.timeFrameDataLock.Unlock()
+// rebuildTimeframes replaces the history of higher timeframes with the aggregated
+// 1-minute history and saves them
+func (ps *PriceService) rebuildTimeframes(timeframes []models.TimeFrame) {
+	minuteCandles, _ := ps.timeFrameData[models.TimeFrame1Min].candles()
+
+	maxCandles := ps.getMaxCandles()
+
+	// Process each timeframe
+	for _, tf := range timeframes {
+		timeframeCandles := AggregateHistory(minuteCandles, tf)
+
+		// Store in timeFrameData, keeping at most maxCandles
+		ps.timeFrameData[tf].replace(store.NewSeriesFrom(timeframeCandles, maxCandles))
 
 		// Save the timeframe data
 		if err := ps.SaveTimeFrame(tf); err != nil {
@@ -216,35 +651,110 @@ func (ps *PriceService) initializeHigherTimeframes() {
 	}
 }
 
+// AggregateHistory groups 1-minute candles into the candles of a higher timeframe, oldest first
+func AggregateHistory(minuteCandles []models.CandleData, tf models.TimeFrame) []models.CandleData {
+	// Map to group candles by normalized timestamp
+	groupedCandles := make(map[int64]models.CandleData)
+
+	// Group minute candles into higher timeframe buckets
+	for _, candle := range minuteCandles {
+		normalizedTimestamp := tf.NormalizeTimestamp(candle.Timestamp)
+
+		// If this is a new timestamp, initialize the candle
+		if existingCandle, exists := groupedCandles[normalizedTimestamp]; !exists {
+			groupedCandles[normalizedTimestamp] = models.CandleData{
+				Timestamp:  normalizedTimestamp,
+				Values:     [4]float64{candle.Values[0], candle.Values[1], candle.Values[2], candle.Values[3]},
+				IsComplete: true,
+				Volume:     candle.Volume,
+			}
+		} else {
+			// Update the existing candle
+			updatedCandle := existingCandle
+
+			// Keep the original open
+			// Update high/low if needed
+			if candle.Values[1] > updatedCandle.Values[1] {
+				updatedCandle.Values[1] = candle.Values[1]
+			}
+			if candle.Values[2] < updatedCandle.Values[2] {
+				updatedCandle.Values[2] = candle.Values[2]
+			}
+
+			// Set close to the newest candle
+			updatedCandle.Values[3] = candle.Values[3]
+
+			// Accumulate volume
+			updatedCandle.Volume = models.AddAmounts(updatedCandle.Volume, candle.Volume)
+
+			groupedCandles[normalizedTimestamp] = updatedCandle
+		}
+	}
+
+	// Convert map to slice
+	timeframeCandles := make([]models.CandleData, 0, len(groupedCandles))
+	for _, candle := range groupedCandles {
+		timeframeCandles = append(timeframeCandles, candle)
+	}
+
+	// Sort by timestamp (oldest first)
+	sort.Slice(timeframeCandles, func(i, j int) bool {
+		return timeframeCandles[i].Timestamp < timeframeCandles[j].Timestamp
+	})
+
+	return timeframeCandles
+}
+
 // StartNewCandle creates a new current candle based on the last price
 func (ps *PriceService) StartNewCandle() {
-	ps.timeFrameDataLock.RLock()
-	minuteCandles, ok := ps.timeFrameData[models.TimeFrame1Min]
+	ps.execute(opStart)
+}
+
+// UpdateCurrentCandle updates the current candle with a new price
+func (ps *PriceService) UpdateCurrentCandle() {
+	ps.execute(opUpdate)
+}
+
+// FinalizeCurrentCandle completes the current candle and adds it to history
+func (ps *PriceService) FinalizeCurrentCandle() {
+	ps.execute(opFinalize)
+}
+
+// GetCurrentCandle returns a copy of the current candle if it exists
+func (ps *PriceService) GetCurrentCandle() *models.CandleData {
+	return ps.execute(opSnapshot)
+}
+
+// LastPrice returns the close of the current candle, or of the last stored one while there
+// is no current candle. It fails if there are no candles yet.
+func (ps *PriceService) LastPrice() (float64, bool) {
+	if current := ps.GetCurrentCandle(); current != nil {
+		return current.Values[3], true
+	}
+	last, ok := ps.timeFrameData[models.TimeFrame1Min].last()
+	return last.Values[3], ok
+}
+
+// startNewCandle creates and broadcasts a candle opening near the last close. Only called by ownCandle.
+func (ps *PriceService) startNewCandle() *models.CandleData {
+	lastCandle, ok := ps.timeFrameData[models.TimeFrame1Min].last()
 	var lastClose float64
 	var lastTimestamp int64
 
-	if ok && len(minuteCandles) > 0 {
-		lastCandle := minuteCandles[len(minuteCandles)-1]
+	if ok {
 		lastClose = lastCandle.Values[3]
 		lastTimestamp = lastCandle.Timestamp
 	} else {
-		lastClose = 200.0 // Default starting price
-		lastTimestamp = time.Now().Add(-time.Minute).Unix() * 1000
+		lastClose = ps.GetSimulationParams().BasePrice // Default starting price
+		lastTimestamp = ps.now().Add(-time.Minute).Unix() * 1000
 	}
-	ps.timeFrameDataLock.RUnlock()
-
-	// Small random change for the open price
-	change := (rand.Float64() - 0.5) * 1.0
-	open := lastClose + change
-	open = math.Round(open*100) / 100
 
-	// Minimum price to avoid zero
-	if open < 0.01 {
-		open = 0.01
-	}
+	// Small random change for the open price, at least one tick to avoid zero
+	change := (ps.rng.Float64() - 0.5) * (ps.GetSimulationParams().Volatility * 0.1)
+	open := ps.precision.Price(lastClose + change)
 
 	// Create new candle with only open price initially
-	now := time.Now()
+	now := ps.now()
 	timestamp := models.TimeFrame1Min.NormalizeTimestamp(now.Unix() * 1000)
 
 	// Ensure the new timestamp is greater than the last one
@@ -252,8 +762,8 @@ func (ps *PriceService) StartNewCandle() {
 		timestamp = lastTimestamp + 60000 // One minute later
 	}
 
-	// Generate random volume
-	volume := math.Round(rand.Float64()*100) / 100
+	// The opening move trades like any other
+	volume := ps.precision.Volume(ps.nextVolume(lastClose, open, now))
 
 	newCandle := models.CandleData{
 		Timestamp:  timestamp,
@@ -261,8 +771,7 @@ func (ps *PriceService) StartNewCandle() {
 		IsComplete: false,
 		Volume:     volume,
 	}
-
-	ps.currentCandle = &newCandle
+	enforceOHLC(models.TimeFrame1Min, &newCandle, "a new candle")
 
 	// Broadcast the new candle to all clients
 	ps.broadcastToClients(models.UpdateMessage{
@@ -272,31 +781,27 @@ func (ps *PriceService) StartNewCandle() {
 	})
 
 	log.Printf("Started new 1-minute candle: Open: %.2f", open)
+	return &newCandle
 }
 
-// UpdateCurrentCandle updates the current candle with a new price
-func (ps *PriceService) UpdateCurrentCandle() {
-	if ps.currentCandle == nil {
-		ps.StartNewCandle()
-		return
-	}
+// updateCandle moves the price of the current candle and broadcasts it. Only called by ownCandle.
+func (ps *PriceService) updateCandle(current *models.CandleData) {
+	prev := *current
 
 	// Get current values
-	open := ps.currentCandle.Values[0]
-	high := ps.currentCandle.Values[1]
-	low := ps.currentCandle.Values[2]
+	open := current.Values[0]
+	high := current.Values[1]
+	low := current.Values[2]
 
-	// Generate a new random price movement
-	volatility := rand.Float64() * 10
-	lastClose := ps.currentCandle.Values[3]
-	change := (rand.Float64() - 0.5) * volatility
-	close := lastClose + change
-	close = math.Round(close*100) / 100
+	// Generate a new price movement with the selected model
+	ps.settingsLock.RLock()
+	params := ps.params
+	priceModel := ps.priceModel
+	ps.settingsLock.RUnlock()
 
-	// Minimum price to avoid zero
-	if close < 0.01 {
-		close = 0.01
-	}
+	// Rounded to the tick size, at least one tick to avoid zero
+	lastClose := current.Values[3]
+	close := ps.precision.Price(priceModel.Next(lastClose, params.At(ps.now()), ps.rng))
 
 	// Update high and low if needed
 	if close > high {
@@ -307,43 +812,92 @@ func (ps *PriceService) UpdateCurrentCandle() {
 	}
 
 	// Update the current candle
-	ps.currentCandle.Values = [4]float64{open, high, low, close}
+	current.Values = [4]float64{open, high, low, close}
+	enforceOHLC(models.TimeFrame1Min, current, "a price update")
 
-	// Increase volume slightly
-	ps.currentCandle.Volume += math.Round(rand.Float64()*5) / 100
+	// Trade the volume of the move
+	current.Volume = ps.precision.AddVolume(current.Volume, ps.nextVolume(lastClose, close, ps.now()))
 
 	// Broadcast the update to all clients
-	ps.broadcastToClients(models.UpdateMessage{
-		Type:      "update",
-		Candle:    *ps.currentCandle,
-		TimeFrame: models.TimeFrame1Min,
-	})
+	ps.broadcastUpdate(prev, *current)
 }
 
-// FinalizeCurrentCandle completes the current candle and adds it to history
-func (ps *PriceService) FinalizeCurrentCandle() {
-	if ps.currentCandle == nil {
+// enforceOHLC keeps the open and close of a candle within its high and low before it is
+// stored or sent. Only a bug or a broken feed produces such candles, so they are logged.
+func enforceOHLC(tf models.TimeFrame, candle *models.CandleData, source string) {
+	err := candle.CheckOHLC()
+	if err == nil || !candle.EnforceOHLC() {
 		return
 	}
+	ohlcRepairs.Inc()
+	log.Printf("Widened %s candle at %s from %s: %v", tf,
+		time.UnixMilli(candle.Timestamp).UTC().Format(time.RFC3339), source, err)
+}
 
-	// Mark the candle as complete
-	ps.currentCandle.IsComplete = true
-	finalCandle := *ps.currentCandle
+// nextVolume returns the volume traded with a live move of the price from prev, which stands
+// for a broadcast interval of trading. Only called by ownCandle.
+func (ps *PriceService) nextVolume(prev, price float64, at time.Time) float64 {
+	ps.settingsLock.RLock()
+	params := ps.volumeParams
+	share := float64(ps.broadcastInterval) / float64(time.Minute)
+	ps.settingsLock.RUnlock()
+
+	return ps.volumeModel.Next(prev, price, at, share, params, ps.rng)
+}
+
+// broadcastUpdate sends an intra-candle update, as a delta to the previous frame for clients
+// that support it. Every snapshotInterval frames all clients get a full update instead, so
+// clients that missed a frame recover. Moves of generated prices are recorded as trades.
+func (ps *PriceService) broadcastUpdate(prev, next models.CandleData) {
+	// Without an exchange feed, whose trades are recorded as they come, every move is a trade
+	if ps.feed == nil {
+		quantity := next.Volume
+		if prev.Timestamp == next.Timestamp {
+			quantity = ps.precision.Volume(next.Volume - prev.Volume)
+		}
+		if quantity > 0 || next.Values[3] != prev.Values[3] {
+			ps.trades.record(next.Values[3], quantity, ps.now().UnixMilli())
+		}
+	}
 
-	// Add to history for 1-minute timeframe
-	ps.timeFrameDataLock.Lock()
+	full := ps.logUpdate(models.UpdateMessage{
+		Type:      "update",
+		Candle:    next,
+		TimeFrame: models.TimeFrame1Min,
+	})
 
-	// Ensure the 1-minute slice exists
-	if _, ok := ps.timeFrameData[models.TimeFrame1Min]; !ok {
-		ps.timeFrameData[models.TimeFrame1Min] = make([]models.CandleData, 0)
+	var delta *models.DeltaMessage
+	ps.deltaFrames++
+	if ps.deltaFrames < snapshotInterval {
+		d := models.NewDeltaMessage(models.TimeFrame1Min, prev, next)
+		d.Offset = full.Offset
+		delta = &d
+	} else {
+		ps.deltaFrames = 0
 	}
 
-	// Add the new candle and maintain maximum size
-	ps.timeFrameData[models.TimeFrame1Min] = append(ps.timeFrameData[models.TimeFrame1Min], finalCandle)
-	if len(ps.timeFrameData[models.TimeFrame1Min]) > ps.maxCandles {
-		ps.timeFrameData[models.TimeFrame1Min] = ps.timeFrameData[models.TimeFrame1Min][1:]
+	ps.hub.PublishUpdate(models.TimeFrame1Min, full, delta)
+	ps.notifyUpdate(full)
+}
+
+// finalizeCandle completes the current candle and adds it to history. Only called by ownCandle.
+func (ps *PriceService) finalizeCandle(current *models.CandleData) {
+	// Mark the candle as complete
+	current.IsComplete = true
+	enforceOHLC(models.TimeFrame1Min, current, "a completed candle")
+	finalCandle := *current
+
+	maxCandles := ps.getMaxCandles()
+
+	// Add to history for 1-minute timeframe, the series drops the oldest candle when full
+	minuteData := ps.timeFrameData[models.TimeFrame1Min]
+	minuteData.lock.Lock()
+	result := minuteData.modifyLocked(maxCandles).Append(finalCandle)
+	minuteData.lock.Unlock()
+	if result == store.Replaced || result == store.Unchanged {
+		log.Printf("Completed 1-minute candle at %s repeats the timestamp of a stored candle",
+			time.UnixMilli(finalCandle.Timestamp).UTC().Format(time.RFC3339))
 	}
-	ps.timeFrameDataLock.Unlock()
 
 	// Broadcast the final update with isComplete flag
 	ps.broadcastToClients(models.UpdateMessage{
@@ -358,15 +912,7 @@ func (ps *PriceService) FinalizeCurrentCandle() {
 	// Update higher timeframes if needed
 	ps.updateHigherTimeframes(finalCandle)
 
-	// Save 1-minute data periodically (every 15 minutes)
-	if time.Now().Minute()%15 == 0 {
-		if err := ps.SaveTimeFrame(models.TimeFrame1Min); err != nil {
-			log.Printf("Error saving 1-minute data: %v", err)
-		}
-	}
-
-	// Reset current candle
-	ps.currentCandle = nil
+	ps.payCash(time.UnixMilli(finalCandle.Timestamp).Add(time.Minute))
 }
 
 // updateHigherTimeframes updates aggregated timeframes when a new 1-minute candle is finalized
@@ -379,268 +925,554 @@ func (ps *PriceService) updateHigherTimeframes(newCandle models.CandleData) {
 		models.TimeFrame1Day,
 	}
 
-	ps.timeFrameDataLock.Lock()
-	defer ps.timeFrameDataLock.Unlock()
+	maxCandles := ps.getMaxCandles()
 
 	for _, tf := range timeframes {
-		// Get normalized timestamp for this timeframe
-		normalizedTimestamp := tf.NormalizeTimestamp(newCandle.Timestamp)
+		ps.updateTimeFrame(tf, newCandle, maxCandles)
+	}
+}
 
-		// Check if we have candles for this timeframe
-		if _, ok := ps.timeFrameData[tf]; !ok {
-			ps.timeFrameData[tf] = make([]models.CandleData, 0)
-		}
+// updateTimeFrame merges a finalized 1-minute candle into the candles of an aggregated timeframe
+func (ps *PriceService) updateTimeFrame(tf models.TimeFrame, newCandle models.CandleData, maxCandles int) {
+	messages := ps.aggregate(tf, newCandle, maxCandles)
 
-		// Find or create a candle for this timestamp
-		candleIndex := -1
-		for i, c := range ps.timeFrameData[tf] {
-			if c.Timestamp == normalizedTimestamp {
-				candleIndex = i
-				break
-			}
-		}
+	// Broadcast after releasing the lock of the timeframe
+	for _, message := range messages {
+		ps.broadcastToClients(message)
+	}
+}
 
-		// Check if this is a new period - we need to finalize the previous candle first
-		// and potentially save data for this timeframe
-		prevCandleFinalized := false
-		if candleIndex == -1 {
-			// Check if the most recent candle needs to be finalized
-			if len(ps.timeFrameData[tf]) > 0 {
-				lastCandle := &ps.timeFrameData[tf][len(ps.timeFrameData[tf])-1]
-				if !lastCandle.IsComplete {
-					lastCandle.IsComplete = true
-					prevCandleFinalized = true
-
-					// Broadcast the finalized candle
-					ps.broadcastToClients(models.UpdateMessage{
-						Type:      "update",
-						Candle:    *lastCandle,
-						TimeFrame: tf,
-					})
-				}
-			}
+// aggregate applies a finalized 1-minute candle to the candles of a timeframe and returns the updates to broadcast
+func (ps *PriceService) aggregate(tf models.TimeFrame, newCandle models.CandleData, maxCandles int) []models.UpdateMessage {
+	data := ps.timeFrameData[tf]
+	data.lock.Lock()
+	defer data.lock.Unlock()
 
-			// This is a new candle for this timeframe
-			newTimeframeCandle := models.CandleData{
-				Timestamp:  normalizedTimestamp,
-				Values:     [4]float64{newCandle.Values[0], newCandle.Values[1], newCandle.Values[2], newCandle.Values[3]},
-				IsComplete: false,
-				Volume:     newCandle.Volume,
-			}
+	var messages []models.UpdateMessage
 
-			ps.timeFrameData[tf] = append(ps.timeFrameData[tf], newTimeframeCandle)
+	// Get normalized timestamp for this timeframe
+	normalizedTimestamp := tf.NormalizeTimestamp(newCandle.Timestamp)
 
-			// Trim to maxCandles if needed
-			if len(ps.timeFrameData[tf]) > ps.maxCandles {
-				ps.timeFrameData[tf] = ps.timeFrameData[tf][1:]
-			}
+	// Get or create the candles for this timeframe
+	series := data.modifyLocked(maxCandles)
+
+	// The open candle is always the most recent one, so the common case needs no search
+	candleIndex := -1
+	if lastCandle, ok := series.Last(); ok {
+		if lastCandle.Timestamp == normalizedTimestamp {
+			candleIndex = series.Len() - 1
+		} else if lastCandle.Timestamp > normalizedTimestamp {
+			// A late candle for an older period
+			candleIndex = series.IndexOf(normalizedTimestamp)
+		}
+	}
 
-			// Broadcast the new candle to clients
-			ps.broadcastToClients(models.UpdateMessage{
-				Type:      "new",
-				Candle:    newTimeframeCandle,
+	// Check if this is a new period - we need to finalize the previous candle first
+	if candleIndex == -1 {
+		// Check if the most recent candle needs to be finalized
+		if lastCandle, ok := series.Last(); ok && !lastCandle.IsComplete {
+			lastCandle.IsComplete = true
+			series.Set(series.Len()-1, lastCandle)
+
+			// Broadcast the finalized candle
+			messages = append(messages, models.UpdateMessage{
+				Type:      "update",
+				Candle:    lastCandle,
 				TimeFrame: tf,
 			})
+		}
 
-			// Save the timeframe data if we finalized a candle
-			if prevCandleFinalized {
-				// We're inside a lock, so we need to save in a goroutine
-				go func(timeFrame models.TimeFrame) {
-					if err := ps.SaveTimeFrame(timeFrame); err != nil {
-						log.Printf("Error saving data for %s: %v", timeFrame, err)
-					}
-				}(tf)
-			}
-
-			continue
+		// This is a new candle for this timeframe
+		newTimeframeCandle := models.CandleData{
+			Timestamp:  normalizedTimestamp,
+			Values:     [4]float64{newCandle.Values[0], newCandle.Values[1], newCandle.Values[2], newCandle.Values[3]},
+			IsComplete: false,
+			Volume:     newCandle.Volume,
 		}
+		enforceOHLC(tf, &newTimeframeCandle, "aggregation")
 
-		// Update existing candle
-		candle := &ps.timeFrameData[tf][candleIndex]
+		// The series drops the oldest candle when full
+		series.Append(newTimeframeCandle)
 
-		// We only update high/low if needed
-		if newCandle.Values[1] > candle.Values[1] {
-			candle.Values[1] = newCandle.Values[1] // Update high
-		}
-		if newCandle.Values[2] < candle.Values[2] {
-			candle.Values[2] = newCandle.Values[2] // Update low
+		// Broadcast the new candle to clients
+		messages = append(messages, models.UpdateMessage{
+			Type:      "new",
+			Candle:    newTimeframeCandle,
+			TimeFrame: tf,
+		})
+		return messages
+	}
+
+	// Update existing candle
+	candle := series.At(candleIndex)
+
+	// We only update high/low if needed
+	if newCandle.Values[1] > candle.Values[1] {
+		candle.Values[1] = newCandle.Values[1] // Update high
+	}
+	if newCandle.Values[2] < candle.Values[2] {
+		candle.Values[2] = newCandle.Values[2] // Update low
+	}
+
+	// Always update close
+	candle.Values[3] = newCandle.Values[3]
+
+	// Add volume
+	candle.Volume = models.AddAmounts(candle.Volume, newCandle.Volume)
+	enforceOHLC(tf, &candle, "aggregation")
+
+	// The candle is complete with the last 1-minute candle of its period, or once the
+	// period is over for candles arriving late
+	candleEndTime := time.UnixMilli(normalizedTimestamp).Add(tf.GetDuration())
+	minuteEndTime := time.UnixMilli(newCandle.Timestamp).Add(models.TimeFrame1Min.GetDuration())
+	if (!minuteEndTime.Before(candleEndTime) || ps.now().After(candleEndTime)) && !candle.IsComplete {
+		candle.IsComplete = true
+	}
+
+	series.Set(candleIndex, candle)
+
+	// Broadcast the update
+	messages = append(messages, models.UpdateMessage{
+		Type:      "update",
+		Candle:    candle,
+		TimeFrame: tf,
+	})
+	return messages
+}
+
+// GetHistoryForTimeFrame returns historical candles for a specific timeframe
+func (ps *PriceService) GetHistoryForTimeFrame(timeFrame models.TimeFrame) []models.CandleData {
+	return ps.GetHistoryRange(timeFrame, math.MinInt64, math.MaxInt64)
+}
+
+// WriteHistory writes the JSON response with the candles of a timeframe in [from, to], in a
+// candle schema. Complete histories of moderate size in SchemaXY are served from the
+// serialized cache, everything else is streamed.
+func (ps *PriceService) WriteHistory(w io.Writer, timeFrame models.TimeFrame, from, to int64, schema models.CandleSchema, flush func()) error {
+	if from == math.MinInt64 && to == math.MaxInt64 && schema == models.SchemaXY {
+		if data, ok := ps.timeFrameData[timeFrame]; ok && data.len() <= historyCacheMaxCandles {
+			return ps.writeCachedHistory(w, timeFrame)
 		}
+	}
+	return ps.StreamHistory(w, timeFrame, from, to, schema, flush)
+}
 
-		// Always update close
-		candle.Values[3] = newCandle.Values[3]
+// writeCachedHistory writes the JSON response with the complete history of a timeframe. The stored
+// candles are serialized once per change, only the current candle is encoded per request.
+func (ps *PriceService) writeCachedHistory(w io.Writer, timeFrame models.TimeFrame) error {
+	data, ok := ps.timeFrameData[timeFrame]
+	if !ok {
+		return models.WriteHistoryJSON(w, timeFrame, nil)
+	}
 
-		// Add volume
-		candle.Volume += newCandle.Volume
+	encoded, ok, err := data.encodedCandles()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return models.WriteHistoryJSON(w, timeFrame, nil)
+	}
 
-		// Broadcast the update
-		ps.broadcastToClients(models.UpdateMessage{
-			Type:      "update",
-			Candle:    *candle,
-			TimeFrame: tf,
-		})
+	// Add the candle in progress, in place of the stored one of its period
+	var last *models.CandleData
+	if !encoded.empty {
+		last = &encoded.last
+	}
+	if live, replace, ok := ps.liveCandle(timeFrame, last); ok {
+		if replace {
+			return models.WriteHistoryJSON(w, timeFrame, encoded.withoutLast, live)
+		}
+		return models.WriteHistoryJSON(w, timeFrame, encoded.candles, live)
+	}
+	return models.WriteHistoryJSON(w, timeFrame, encoded.candles)
+}
 
-		// Check if this candle is now complete based on the timeframe duration
-		now := time.Now()
-		candleEndTime := time.Unix(normalizedTimestamp/1000, 0).Add(tf.GetDuration())
+// StreamHistory writes the JSON response with the candles of a timeframe in [from, to], in a
+// candle schema. The candles are copied and encoded in chunks and flush is called after every
+// chunk, so memory use stays flat however much history is retained.
+func (ps *PriceService) StreamHistory(w io.Writer, timeFrame models.TimeFrame, from, to int64, schema models.CandleSchema, flush func()) error {
+	buf := models.AppendHistoryPrefix(make([]byte, 0, historyChunkSize*96), timeFrame)
+	empty := true
+
+	if data, ok := ps.timeFrameData[timeFrame]; ok {
+		cursor := from
+		var held []models.CandleData // Last candle read, written with the next chunk as the candle in progress may replace it
+		for {
+			page, exists := data.page(cursor, to, historyChunkSize)
+			if !exists {
+				break
+			}
+			candles := append(held, page...)
 
-		if now.After(candleEndTime) && !candle.IsComplete {
-			candle.IsComplete = true
+			// Add the candle in progress after the last chunk
+			done := len(page) < historyChunkSize
+			if done {
+				candles = ps.withLiveCandle(timeFrame, candles, from, to)
+			} else {
+				held = []models.CandleData{candles[len(candles)-1]}
+				candles = candles[:len(candles)-1]
+			}
 
-			// Save data when we complete a candle
-			go func(timeFrame models.TimeFrame) {
-				if err := ps.SaveTimeFrame(timeFrame); err != nil {
-					log.Printf("Error saving data for %s: %v", timeFrame, err)
+			if len(candles) > 0 {
+				if !empty {
+					buf = append(buf, ',')
 				}
-			}(tf)
+				var err error
+				if buf, err = models.AppendCandlesSchema(buf, candles, schema); err != nil {
+					return err
+				}
+				empty = false
+			}
 
-			// Broadcast the finalized candle
-			ps.broadcastToClients(models.UpdateMessage{
-				Type:      "update",
-				Candle:    *candle,
-				TimeFrame: tf,
-			})
+			if done {
+				break
+			}
+
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			flush()
+			buf = buf[:0]
+
+			last := held[0].Timestamp
+			if last == math.MaxInt64 {
+				break
+			}
+			cursor = last + 1
 		}
 	}
+
+	_, err := w.Write(models.AppendHistorySuffix(buf))
+	return err
 }
 
-// GetCurrentCandle returns the current candle if it exists
-func (ps *PriceService) GetCurrentCandle() *models.CandleData {
-	if ps.currentCandle == nil {
-		return nil
+// GetHistoryRange returns the candles of a timeframe with timestamps in [from, to]
+func (ps *PriceService) GetHistoryRange(timeFrame models.TimeFrame, from, to int64) []models.CandleData {
+	data, ok := ps.timeFrameData[timeFrame]
+	if !ok {
+		return []models.CandleData{}
+	}
+
+	// Create a copy of the candles
+	filteredCandles, ok := data.between(from, to)
+	if !ok {
+		return []models.CandleData{}
 	}
 
-	// Return a copy to avoid race conditions
-	candle := *ps.currentCandle
-	return &candle
+	return ps.withLiveCandle(timeFrame, filteredCandles, from, to)
 }
 
-// GetHistoryForTimeFrame returns historical candles for a specific timeframe
-func (ps *PriceService) GetHistoryForTimeFrame(timeFrame models.TimeFrame) []models.CandleData {
-	ps.timeFrameDataLock.RLock()
-	defer ps.timeFrameDataLock.RUnlock()
+// GetHistoryTail returns at most limit of the newest candles of a timeframe with timestamps
+// up to to, including the candle in progress
+func (ps *PriceService) GetHistoryTail(timeFrame models.TimeFrame, to int64, limit int) []models.CandleData {
+	data, ok := ps.timeFrameData[timeFrame]
+	if !ok {
+		return []models.CandleData{}
+	}
 
-	candles, ok := ps.timeFrameData[timeFrame]
+	candles, ok := data.tail(to, limit)
 	if !ok {
 		return []models.CandleData{}
 	}
+	candles = ps.withLiveCandle(timeFrame, candles, math.MinInt64, to)
+	if len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+	return candles
+}
 
-	// Create a copy of the candles
-	filteredCandles := make([]models.CandleData, len(candles))
-	copy(filteredCandles, candles)
+// withLiveCandle adds the candle in progress of a timeframe to candles, the stored ones
+// read up to to, if it is in [from, to]. It replaces the last candle if that is of its period.
+func (ps *PriceService) withLiveCandle(timeFrame models.TimeFrame, candles []models.CandleData, from, to int64) []models.CandleData {
+	var last *models.CandleData
+	if len(candles) > 0 {
+		last = &candles[len(candles)-1]
+	}
+	live, replace, ok := ps.liveCandle(timeFrame, last)
+	if !ok || live.Timestamp < from || live.Timestamp > to {
+		return candles
+	}
+	if replace {
+		candles[len(candles)-1] = live
+		return candles
+	}
+	return append(candles, live)
+}
 
-	// If we have a current candle and this is the 1-minute timeframe, add it
-	if timeFrame == models.TimeFrame1Min && ps.currentCandle != nil {
-		filteredCandles = append(filteredCandles, *ps.currentCandle)
+// liveCandle returns the candle in progress of a timeframe: the current 1-minute candle,
+// merged into last, the last stored candle, if that is of the same period. replace reports
+// whether it takes the place of last rather than following it. The stored candles must be
+// read first, so a current candle finalized in between is missed rather than counted twice.
+func (ps *PriceService) liveCandle(timeFrame models.TimeFrame, last *models.CandleData) (live models.CandleData, replace, ok bool) {
+	current := ps.GetCurrentCandle()
+	if current == nil {
+		return models.CandleData{}, false, false
+	}
+	if timeFrame == models.TimeFrame1Min {
+		return *current, false, true
 	}
 
-	return filteredCandles
+	period := timeFrame.NormalizeTimestamp(current.Timestamp)
+	switch {
+	case last == nil || last.Timestamp < period:
+		live = *current
+		live.Timestamp = period
+		return live, false, true
+	case last.Timestamp == period:
+		live = *last
+		live.Values[1] = math.Max(live.Values[1], current.Values[1])
+		live.Values[2] = math.Min(live.Values[2], current.Values[2])
+		live.Values[3] = current.Values[3]
+		live.Volume = models.AddAmounts(live.Volume, current.Volume)
+		live.IsComplete = false
+		return live, true, true
+	}
+	return models.CandleData{}, false, false
 }
 
-// RegisterClient adds a new WebSocket client
-func (ps *PriceService) RegisterClient(conn *websocket.Conn) {
-	ps.clientsLock.Lock()
-	defer ps.clientsLock.Unlock()
-	ps.clients[conn] = true
+// RegisterClient adds a new WebSocket client subscribed to the given timeframe, see Hub.Register
+func (ps *PriceService) RegisterClient(conn *websocket.Conn, timeFrame models.TimeFrame, spectator bool) *Client {
+	return ps.hub.Register(conn, timeFrame, spectator)
 }
 
-// UnregisterClient removes a WebSocket client
-func (ps *PriceService) UnregisterClient(conn *websocket.Conn) {
-	ps.clientsLock.Lock()
-	defer ps.clientsLock.Unlock()
-	delete(ps.clients, conn)
+// RegisterEventClient adds a connection upgraded with gobwas/ws to the event loop,
+// see Hub.RegisterEventConn
+func (ps *PriceService) RegisterEventClient(conn net.Conn, buffered *bufio.Reader, timeFrame models.TimeFrame, spectator bool, onMessage func(*Client, []byte)) (*Client, error) {
+	return ps.hub.RegisterEventConn(conn, buffered, timeFrame, spectator, onMessage)
 }
 
-// broadcastToClients sends a message to all connected clients
-func (ps *PriceService) broadcastToClients(message models.UpdateMessage) {
-	ps.clientsLock.RLock()
-	defer ps.clientsLock.RUnlock()
+// UsesEventLoop reports whether WebSocket connections should be registered with RegisterEventClient
+func (ps *PriceService) UsesEventLoop() bool {
+	return ps.hub.UsesEventLoop()
+}
 
-	data, err := json.Marshal(message)
-	if err != nil {
-		log.Println("Error marshalling data:", err)
-		return
-	}
+// UnregisterClient removes a WebSocket client and closes its connection
+func (ps *PriceService) UnregisterClient(client *Client) {
+	ps.hub.Unregister(client)
+}
+
+// GetConnections returns information about all connected WebSocket clients
+func (ps *PriceService) GetConnections() []models.ConnectionInfo {
+	return ps.hub.Connections()
+}
+
+// GetLagReport returns the WebSocket clients falling behind the lag thresholds
+func (ps *PriceService) GetLagReport() models.LagReport {
+	return ps.hub.LagReport()
+}
 
-	for client := range ps.clients {
-		if err := client.WriteMessage(websocket.TextMessage, data); err != nil {
-			log.Println("Error sending message:", err)
-			client.Close()
-			ps.clientsLock.Lock()
-			delete(ps.clients, client)
-			ps.clientsLock.Unlock()
+// GetStats returns runtime statistics of the service
+func (ps *PriceService) GetStats() models.Stats {
+	clients := ps.hub.Count()
+
+	candles := make(map[models.TimeFrame]int, len(ps.timeFrameData))
+	lastSaved := make(map[models.TimeFrame]int64, len(ps.timeFrameData))
+	usage := make(map[models.TimeFrame]models.StoreStats, len(ps.timeFrameData))
+	for tf, data := range ps.timeFrameData {
+		usage[tf] = data.usage()
+		candles[tf] = usage[tf].Candles
+		if saved := data.lastSaved(); !saved.IsZero() {
+			lastSaved[tf] = saved.UnixMilli()
 		}
 	}
+
+	return models.Stats{
+		Version:       version.Get(),
+		UptimeSeconds: int64(version.Uptime().Seconds()),
+		Ready:         ps.IsReady(),
+		Paused:        ps.IsPaused(),
+		Maintenance:   ps.maintenance.Load(),
+		Clients:       clients,
+		Candles:       candles,
+		LastSaved:     lastSaved,
+		DataVersion:   ps.dataVersion.Load(),
+		Store:         usage,
+		Memory:        memoryStats(),
+		Simulation:    ps.LoopHealth(),
+	}
+}
+
+// memoryStats returns the memory use and garbage collection statistics of the process
+func memoryStats() models.MemoryStats {
+	mem := metrics.ReadMemStats()
+
+	var lastGC int64
+	if mem.LastGC > 0 {
+		lastGC = int64(mem.LastGC / uint64(time.Millisecond))
+	}
+
+	return models.MemoryStats{
+		HeapAlloc:     mem.HeapAlloc,
+		HeapInuse:     mem.HeapInuse,
+		HeapObjects:   mem.HeapObjects,
+		Sys:           mem.Sys,
+		NumGC:         mem.NumGC,
+		PauseTotalNs:  mem.PauseTotalNs,
+		LastGC:        lastGC,
+		GCCPUFraction: mem.GCCPUFraction,
+		Goroutines:    runtime.NumGoroutine(),
+	}
+}
+
+// broadcastToClients sends a message to all clients subscribed to its timeframe
+func (ps *PriceService) broadcastToClients(message models.UpdateMessage) {
+	message = ps.logUpdate(message)
+	ps.hub.Publish(message.TimeFrame, message)
+	ps.notifyUpdate(message)
+}
+
+// OnUpdate registers fn to be called with every candle update sent to clients, in the
+// order they are sent. fn runs on the goroutine generating prices and must not block.
+func (ps *PriceService) OnUpdate(fn func(models.UpdateMessage)) {
+	ps.listenersLock.Lock()
+	defer ps.listenersLock.Unlock()
+	ps.updateListeners = append(ps.updateListeners, fn)
+}
+
+// notifyUpdate calls the update listeners
+func (ps *PriceService) notifyUpdate(message models.UpdateMessage) {
+	ps.listenersLock.RLock()
+	defer ps.listenersLock.RUnlock()
+
+	for _, fn := range ps.updateListeners {
+		fn(message)
+	}
 }
 
 // SaveTimeFrame saves data for a specific timeframe to a file
 func (ps *PriceService) SaveTimeFrame(timeFrame models.TimeFrame) error {
-	// Create a temporary lock to read the data
-	ps.timeFrameDataLock.RLock()
-	candles, ok := ps.timeFrameData[timeFrame]
-	ps.timeFrameDataLock.RUnlock()
+	data, ok := ps.timeFrameData[timeFrame]
+	if !ok {
+		return fmt.Errorf("unknown timeframe %s", timeFrame)
+	}
+
+	// Only one save per timeframe at a time, so an older snapshot never overwrites a newer one
+	data.saveLock.Lock()
+	defer data.saveLock.Unlock()
 
+	// Create a copy of the data to avoid potential race conditions,
+	// the series never holds more than maxCandles
+	candlesCopy, version, ok := data.snapshot()
 	if !ok {
 		return fmt.Errorf("no data for timeframe %s", timeFrame)
 	}
 
-	// Create a copy of the data to avoid potential race conditions
-	// and ensure we only save at most maxCandles
-	var candlesCopy []models.CandleData
-	if len(candles) <= ps.maxCandles {
-		candlesCopy = make([]models.CandleData, len(candles))
-		copy(candlesCopy, candles)
-	} else {
-		// Only save the most recent maxCandles
-		startIdx := len(candles) - ps.maxCandles
-		candlesCopy = make([]models.CandleData, ps.maxCandles)
-		copy(candlesCopy, candles[startIdx:])
+	if err := WriteHistoryFile(ps.dataDir, timeFrame, candlesCopy); err != nil {
+		return err
 	}
 
-	// Create a directory for the data file if it doesn't exist
-	if err := os.MkdirAll(ps.dataDir, 0755); err != nil {
-		return fmt.Errorf("failed to create data directory: %w", err)
+	data.markSaved(version)
+	log.Printf("Saved %d candles for timeframe %s", len(candlesCopy), timeFrame)
+	return nil
+}
+
+// runSaver periodically saves the timeframes that changed since their last save, so
+// bursts of changes are coalesced into a single write per timeframe and interval
+func (ps *PriceService) runSaver() {
+	for {
+		ps.settingsLock.RLock()
+		interval := ps.saveInterval
+		ps.settingsLock.RUnlock()
+
+		select {
+		case <-time.After(interval):
+		case <-ps.stop:
+			return
+		}
+		ps.saveDirtyTimeFrames()
 	}
+}
 
-	filename := filepath.Join(ps.dataDir, fmt.Sprintf("price_history_%s.json", timeFrame))
+// saveDirtyTimeFrames saves all timeframes that changed since their last save
+func (ps *PriceService) saveDirtyTimeFrames() {
+	var dirty []models.TimeFrame
+	for _, tf := range models.AllTimeFrames() {
+		if ps.timeFrameData[tf].dirty() {
+			dirty = append(dirty, tf)
+		}
+	}
 
-	// Create a temporary file
-	tempFile := filename + ".tmp"
+	if err := ps.saveTimeFrames(dirty); err != nil {
+		log.Printf("Error saving data: %v", err)
+	}
+}
 
-	data, err := json.Marshal(candlesCopy)
-	if err != nil {
-		return fmt.Errorf("failed to marshal data: %w", err)
+// SaveAllTimeFrames saves data for all timeframes
+func (ps *PriceService) SaveAllTimeFrames() error {
+	return ps.saveTimeFrames(models.AllTimeFrames())
+}
+
+// saveTimeFrames saves timeframes concurrently on at most saveWorkers goroutines and
+// reports all failures in a single error
+func (ps *PriceService) saveTimeFrames(timeframes []models.TimeFrame) error {
+	workers := saveWorkers
+	if len(timeframes) < workers {
+		workers = len(timeframes)
 	}
 
-	// Write to the temporary file
-	if err := os.WriteFile(tempFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write to temporary file: %w", err)
+	jobs := make(chan models.TimeFrame)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures []string
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tf := range jobs {
+				if err := ps.SaveTimeFrame(tf); err != nil {
+					mu.Lock()
+					failures = append(failures, fmt.Sprintf("%s: %v", tf, err))
+					mu.Unlock()
+				}
+			}
+		}()
 	}
 
-	// Rename the temporary file to the actual file (atomic operation)
-	if err := os.Rename(tempFile, filename); err != nil {
-		return fmt.Errorf("failed to rename temporary file: %w", err)
+	for _, tf := range timeframes {
+		jobs <- tf
 	}
+	close(jobs)
+	wg.Wait()
 
-	log.Printf("Saved %d candles for timeframe %s", len(candlesCopy), timeFrame)
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return fmt.Errorf("failed to save %d of %d timeframes: %s", len(failures), len(timeframes), strings.Join(failures, "; "))
+	}
 	return nil
 }
 
-// SaveAllTimeFrames saves data for all timeframes
-func (ps *PriceService) SaveAllTimeFrames() {
-	timeframes := []models.TimeFrame{
-		models.TimeFrame1Min,
-		models.TimeFrame5Min,
-		models.TimeFrame15Min,
-		models.TimeFrame1Hour,
-		models.TimeFrame4Hour,
-		models.TimeFrame1Day,
+// writeFileAtomic replaces a file with data. The data is written to a temporary file in the same
+// directory, synced and renamed over the target, so readers never see a partially written file.
+func writeFileAtomic(filename string, data []byte) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
 	}
+	defer os.Remove(tempFile.Name()) // No-op once renamed
 
-	for _, tf := range timeframes {
-		if err := ps.SaveTimeFrame(tf); err != nil {
-			log.Printf("Error saving data for %s: %v", tf, err)
-		}
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("failed to write to temporary file: %w", err)
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if err := os.Chmod(tempFile.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to set permissions of temporary file: %w", err)
+	}
+
+	// Rename the temporary file to the actual file (atomic operation)
+	if err := os.Rename(tempFile.Name(), filename); err != nil {
+		return fmt.Errorf("failed to rename temporary file: %w", err)
 	}
+	return nil
 }
 
 // LoadAllTimeFrames loads data for all timeframes
@@ -674,30 +1506,56 @@ func (ps *PriceService) LoadAllTimeFrames() error {
 	return loadErr
 }
 
-// LoadTimeFrame loads data for a specific timeframe from a file
-func (ps *PriceService) LoadTimeFrame(timeFrame models.TimeFrame) error {
-	filename := filepath.Join(ps.dataDir, fmt.Sprintf("price_history_%s.json", timeFrame))
+// HistoryFile returns the path of the data file of a timeframe in dir
+func HistoryFile(dir string, timeFrame models.TimeFrame) string {
+	return filepath.Join(dir, fmt.Sprintf("price_history_%s.json", timeFrame))
+}
+
+// WriteHistoryFile replaces the data file of a timeframe in dir with candles
+func WriteHistoryFile(dir string, timeFrame models.TimeFrame, candles []models.CandleData) error {
+	// Create a directory for the data file if it doesn't exist
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
 
-	data, err := os.ReadFile(filename)
+	encoded, err := json.Marshal(candles)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to marshal data: %w", err)
+	}
+	return writeFileAtomic(HistoryFile(dir, timeFrame), encoded)
+}
+
+// ReadHistoryFile reads the candles of a timeframe from its data file in dir
+func ReadHistoryFile(dir string, timeFrame models.TimeFrame) ([]models.CandleData, error) {
+	data, err := os.ReadFile(HistoryFile(dir, timeFrame))
+	if err != nil {
+		return nil, err
 	}
 
 	var candles []models.CandleData
 	if err := json.Unmarshal(data, &candles); err != nil {
+		return nil, err
+	}
+	return candles, nil
+}
+
+// LoadTimeFrame loads data for a specific timeframe from a file
+func (ps *PriceService) LoadTimeFrame(timeFrame models.TimeFrame) error {
+	tfData, ok := ps.timeFrameData[timeFrame]
+	if !ok {
+		return fmt.Errorf("unknown timeframe %s", timeFrame)
+	}
+
+	candles, err := ReadHistoryFile(ps.dataDir, timeFrame)
+	if err != nil {
 		return err
 	}
 
 	// Enforce maxCandles limit when loading
-	if len(candles) > ps.maxCandles {
-		startIdx := len(candles) - ps.maxCandles
-		candles = candles[startIdx:]
-	}
+	series := store.NewSeriesFrom(candles, ps.getMaxCandles())
 
-	ps.timeFrameDataLock.Lock()
-	ps.timeFrameData[timeFrame] = candles
-	ps.timeFrameDataLock.Unlock()
+	tfData.replace(series)
 
-	log.Printf("Loaded %d candles for timeframe %s", len(candles), timeFrame)
+	log.Printf("Loaded %d candles for timeframe %s", series.Len(), timeFrame)
 	return nil
 }
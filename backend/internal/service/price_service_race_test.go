@@ -0,0 +1,176 @@
+package service
+
+import (
+	"io"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"server/internal/config"
+	"server/internal/models"
+)
+
+// testClock is a clock for candle timestamps that tests move by hand
+type testClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestService creates a price service with a day of generated history, keeping its data
+// in a temporary directory, and its candles timestamped by a test clock
+func newTestService(tb testing.TB) (*PriceService, *testClock) {
+	tb.Helper()
+	cfg := config.Default()
+	cfg.Data.Dir = tb.TempDir()
+	cfg.Simulation.Seed = 1
+	if err := cfg.Validate(); err != nil {
+		tb.Fatal(err)
+	}
+
+	clock := &testClock{now: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)}
+	ps := NewPriceService(cfg)
+	ps.SetClock(clock.Now)
+	ps.Initialize(1)
+	ps.StartNewCandle()
+	ps.MarkReady()
+	tb.Cleanup(func() {
+		if err := ps.Stop(); err != nil {
+			tb.Errorf("stopping the price service: %v", err)
+		}
+	})
+	return ps, clock
+}
+
+// TestConcurrentAccess reads the history and stats of every timeframe while candles are
+// updated, completed and trimmed. Run it with go test -race.
+func TestConcurrentAccess(t *testing.T) {
+	ps, clock := newTestService(t)
+	cfg := config.Default()
+	cfg.Data.Dir = ps.dataDir
+
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	read := func(read func()) {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					read()
+				}
+			}
+		}()
+	}
+
+	for _, tf := range models.AllTimeFrames() {
+		tf := tf
+		read(func() {
+			history := ps.GetHistoryForTimeFrame(tf)
+			if len(history) == 0 {
+				t.Errorf("no %s history", tf)
+			}
+		})
+		read(func() {
+			now := clock.Now().UnixMilli()
+			ps.GetHistoryRange(tf, now-time.Hour.Milliseconds(), now)
+			ps.GetHistoryTail(tf, math.MaxInt64, 10)
+		})
+		read(func() {
+			if err := ps.WriteHistory(io.Discard, tf, math.MinInt64, math.MaxInt64, models.SchemaXY, func() {}); err != nil {
+				t.Errorf("writing %s history: %v", tf, err)
+			}
+		})
+	}
+	read(func() { ps.GetStats() })
+	read(func() { ps.GetCurrentCandle() })
+	read(func() { ps.LastPrice() })
+
+	volatility := 0.5
+	for minute := 0; minute < 30; minute++ {
+		for tick := 0; tick < 10; tick++ {
+			clock.Advance(time.Minute / 10)
+			ps.UpdateCurrentCandle()
+		}
+		ps.FinalizeCurrentCandle()
+		ps.StartNewCandle()
+
+		switch minute % 10 {
+		case 3:
+			if _, err := ps.UpdateSimulationParams(models.SimulationUpdate{Volatility: &volatility}); err != nil {
+				t.Fatal(err)
+			}
+		case 7:
+			cfg.Data.MaxCandles = 500 + minute
+			ps.ApplyConfig(cfg)
+		}
+	}
+
+	close(stop)
+	readers.Wait()
+
+	for _, tf := range models.AllTimeFrames() {
+		for _, candle := range ps.GetHistoryForTimeFrame(tf) {
+			if err := candle.CheckOHLC(); err != nil {
+				t.Fatalf("%s candle at %d: %v", tf, candle.Timestamp, err)
+			}
+		}
+	}
+}
+
+// TestSetClockWhileUpdating replaces the clock while candles are updated. Run it with
+// go test -race.
+func TestSetClockWhileUpdating(t *testing.T) {
+	ps, clock := newTestService(t)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			other := &testClock{now: clock.Now()}
+			ps.SetClock(other.Now)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		ps.UpdateCurrentCandle()
+	}
+	<-done
+}
+
+// TestResetWhileUpdating regenerates the history while candles are updated, both of which
+// use the price and volume models. Run it with go test -race.
+func TestResetWhileUpdating(t *testing.T) {
+	ps, clock := newTestService(t)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			clock.Advance(time.Second)
+			ps.UpdateCurrentCandle()
+		}
+	}()
+	ps.Reset()
+	<-done
+
+	for _, tf := range models.AllTimeFrames() {
+		if len(ps.GetHistoryForTimeFrame(tf)) == 0 {
+			t.Fatalf("no %s history after the reset", tf)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"server/internal/config"
+	"server/internal/models"
+)
+
+var benchCandles = flag.Int("bench.candles", 100000, "candles kept per timeframe by the benchmarks")
+
+// bench holds the price service with generated history shared by the benchmarks, created
+// by the first one needing it and removed once all tests ran
+var bench struct {
+	once    sync.Once
+	service *PriceService
+	dataDir string
+	err     error
+}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	code := m.Run()
+	if bench.service != nil {
+		bench.service.Stop()
+	}
+	if bench.dataDir != "" {
+		os.RemoveAll(bench.dataDir)
+	}
+	os.Exit(code)
+}
+
+// benchService returns the shared price service of the benchmarks. The service logs every
+// candle it generates and saves, so the log is discarded from then on.
+func benchService(b *testing.B) *PriceService {
+	bench.once.Do(func() {
+		bench.dataDir, bench.err = os.MkdirTemp("", "seedventure-bench-")
+		if bench.err != nil {
+			return
+		}
+		log.SetOutput(io.Discard)
+
+		cfg := config.Default()
+		cfg.Data.Dir = bench.dataDir
+		cfg.Data.MaxCandles = *benchCandles
+
+		bench.service = NewPriceService(cfg)
+		bench.service.Initialize(1)
+		bench.service.StartNewCandle()
+	})
+	if bench.err != nil {
+		b.Fatal(bench.err)
+	}
+	return bench.service
+}
+
+// BenchmarkUpdateCurrentCandle measures a single price tick of the current candle
+func BenchmarkUpdateCurrentCandle(b *testing.B) {
+	ps := benchService(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ps.UpdateCurrentCandle()
+	}
+}
+
+// BenchmarkFinalizeCandle measures a candle rollover, which also updates all aggregated timeframes
+func BenchmarkFinalizeCandle(b *testing.B) {
+	ps := benchService(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ps.FinalizeCurrentCandle()
+		ps.StartNewCandle()
+	}
+}
+
+// BenchmarkHistoryFull measures copying the complete 1-minute history
+func BenchmarkHistoryFull(b *testing.B) {
+	ps := benchService(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ps.GetHistoryForTimeFrame(models.TimeFrame1Min)
+	}
+}
+
+// BenchmarkHistoryRange measures filtering an hour out of the 1-minute history
+func BenchmarkHistoryRange(b *testing.B) {
+	ps := benchService(b)
+	history := ps.GetHistoryForTimeFrame(models.TimeFrame1Min)
+	from := history[len(history)/2].Timestamp
+	to := from + time.Hour.Milliseconds()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ps.GetHistoryRange(models.TimeFrame1Min, from, to)
+	}
+}
+
+// BenchmarkEncodeHistory measures serializing the complete 1-minute history
+func BenchmarkEncodeHistory(b *testing.B) {
+	data := models.TimeFrameData{
+		TimeFrame: models.TimeFrame1Min,
+		Candles:   benchService(b).GetHistoryForTimeFrame(models.TimeFrame1Min),
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := models.Marshal(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSaveTimeFrame measures persisting the 1-minute history
+func BenchmarkSaveTimeFrame(b *testing.B) {
+	ps := benchService(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := ps.SaveTimeFrame(models.TimeFrame1Min); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLoadTimeFrame measures loading the 1-minute history from disk
+func BenchmarkLoadTimeFrame(b *testing.B) {
+	ps := benchService(b)
+	if err := ps.SaveTimeFrame(models.TimeFrame1Min); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := ps.LoadTimeFrame(models.TimeFrame1Min); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"server/internal/models"
+)
+
+const (
+	recordingFlushInterval = time.Second // How often recorded events are written to disk
+	maxReplaySpeed         = 1000        // Highest time compression of a replay
+	maxRecordedEventSize   = 64 << 20    // Longest line of a recording, which holds the complete history of a timeframe
+)
+
+var (
+	// ErrRecordingNotFound is returned when a named recording doesn't exist
+	ErrRecordingNotFound = errors.New("recording not found")
+	// ErrRecordingActive is returned when starting a recording while one is written
+	ErrRecordingActive = errors.New("a recording is already in progress")
+	// ErrNotRecording is returned when stopping a recording while none is written
+	ErrNotRecording = errors.New("no recording in progress")
+	// ErrReplayActive is returned when starting a replay while one is running
+	ErrReplayActive = errors.New("a replay is already running")
+	// ErrNotReplaying is returned when stopping a replay while none is running
+	ErrNotReplaying = errors.New("no replay running")
+)
+
+// recordingName matches the names of recording files, which must not contain path separators
+var recordingName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*\.jsonl$`)
+
+// sessionRecorder appends broadcasts to a recording file
+type sessionRecorder struct {
+	name string
+	file *os.File
+
+	lock   sync.Mutex
+	w      *bufio.Writer
+	events int64
+	err    error // First write error, recording stops writing after it
+
+	done chan struct{}
+}
+
+// sessionReplay is a recording being re-emitted to clients
+type sessionReplay struct {
+	name  string
+	speed float64
+	loop  bool
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// recordingDir returns the directory recordings are saved in
+func (ps *PriceService) recordingDir() string {
+	return filepath.Join(ps.dataDir, "recordings")
+}
+
+// StartRecording starts writing all broadcasts to a new recording. It begins with the
+// history of every timeframe, so a replay starts from the same charts clients had.
+func (ps *PriceService) StartRecording() (models.RecordingInfo, error) {
+	ps.recordingLock.Lock()
+	defer ps.recordingLock.Unlock()
+
+	if ps.recorder != nil {
+		return models.RecordingInfo{}, ErrRecordingActive
+	}
+	if err := os.MkdirAll(ps.recordingDir(), 0755); err != nil {
+		return models.RecordingInfo{}, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("recording-%s.jsonl", now.UTC().Format("20060102-150405.000"))
+	file, err := os.OpenFile(filepath.Join(ps.recordingDir(), name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return models.RecordingInfo{}, fmt.Errorf("failed to create recording: %w", err)
+	}
+
+	rec := &sessionRecorder{
+		name: name,
+		file: file,
+		w:    bufio.NewWriter(file),
+		done: make(chan struct{}),
+	}
+
+	// Nothing is broadcast while the history is written and the recorder attached
+	ps.executeExclusive(func(current *models.CandleData) *models.CandleData {
+		for _, tf := range models.AllTimeFrames() {
+			candles, _ := ps.timeFrameData[tf].candles()
+			if tf == models.TimeFrame1Min && current != nil {
+				candles = append(candles, *current)
+			}
+			if candles == nil {
+				candles = []models.CandleData{}
+			}
+			data, err := encode(models.TimeFrameData{TimeFrame: tf, Candles: candles})
+			if err != nil {
+				log.Printf("Error encoding history for recording: %v", err)
+				continue
+			}
+			rec.write(tf, data)
+		}
+		ps.hub.SetRecorder(rec.write)
+		return current
+	})
+	go rec.flushLoop()
+	ps.recorder = rec
+
+	log.Printf("Started recording %s", name)
+	return models.RecordingInfo{Name: name, CreatedAt: now.UnixMilli()}, nil
+}
+
+// StopRecording stops the recording in progress and closes its file
+func (ps *PriceService) StopRecording() (models.RecordingInfo, error) {
+	ps.recordingLock.Lock()
+	defer ps.recordingLock.Unlock()
+
+	rec := ps.recorder
+	if rec == nil {
+		return models.RecordingInfo{}, ErrNotRecording
+	}
+	ps.hub.SetRecorder(nil)
+	ps.recorder = nil
+	close(rec.done)
+
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	if err := rec.w.Flush(); err != nil && rec.err == nil {
+		rec.err = err
+	}
+	if err := rec.file.Close(); err != nil && rec.err == nil {
+		rec.err = err
+	}
+	if rec.err != nil {
+		return models.RecordingInfo{}, fmt.Errorf("failed to write recording %s: %w", rec.name, rec.err)
+	}
+
+	log.Printf("Stopped recording %s after %d events", rec.name, rec.events)
+	return recordingInfo(filepath.Join(ps.recordingDir(), rec.name))
+}
+
+// write appends a broadcast to the recording
+func (rec *sessionRecorder) write(channel models.TimeFrame, data []byte) {
+	line, err := json.Marshal(models.RecordedEvent{
+		Time:    time.Now().UnixMilli(),
+		Channel: channel,
+		Message: data,
+	})
+	if err != nil {
+		log.Printf("Error encoding recorded event: %v", err)
+		return
+	}
+
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	if rec.err != nil {
+		return
+	}
+	if _, err := rec.w.Write(append(line, '\n')); err != nil {
+		rec.err = err
+		log.Printf("Error writing recording %s, recording stopped: %v", rec.name, err)
+		return
+	}
+	rec.events++
+}
+
+// flushLoop writes buffered events to disk until the recording stops
+func (rec *sessionRecorder) flushLoop() {
+	ticker := time.NewTicker(recordingFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rec.done:
+			return
+		case <-ticker.C:
+			rec.lock.Lock()
+			if err := rec.w.Flush(); err != nil && rec.err == nil {
+				rec.err = err
+				log.Printf("Error writing recording %s, recording stopped: %v", rec.name, err)
+			}
+			rec.lock.Unlock()
+		}
+	}
+}
+
+// RecordingStatus returns the recording and replay in progress
+func (ps *PriceService) RecordingStatus() models.RecordingStatus {
+	ps.recordingLock.Lock()
+	defer ps.recordingLock.Unlock()
+
+	var status models.RecordingStatus
+	if rec := ps.recorder; rec != nil {
+		rec.lock.Lock()
+		status.Recording = rec.name
+		status.Events = rec.events
+		rec.lock.Unlock()
+	}
+	if replay := ps.replay; replay != nil {
+		status.Replaying = replay.name
+		status.Speed = replay.speed
+		status.Loop = replay.loop
+	}
+	return status
+}
+
+// ListRecordings returns the saved recordings, newest first
+func (ps *PriceService) ListRecordings() ([]models.RecordingInfo, error) {
+	entries, err := os.ReadDir(ps.recordingDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return []models.RecordingInfo{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+
+	recordings := []models.RecordingInfo{}
+	for _, entry := range entries {
+		if entry.IsDir() || !recordingName.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := recordingInfo(filepath.Join(ps.recordingDir(), entry.Name()))
+		if err != nil {
+			continue
+		}
+		recordings = append(recordings, info)
+	}
+
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].CreatedAt > recordings[j].CreatedAt
+	})
+	return recordings, nil
+}
+
+// recordingInfo describes a recording file
+func recordingInfo(path string) (models.RecordingInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return models.RecordingInfo{}, err
+	}
+	return models.RecordingInfo{
+		Name:      filepath.Base(path),
+		CreatedAt: info.ModTime().UnixMilli(),
+		Size:      info.Size(),
+	}, nil
+}
+
+// StartReplay re-emits a recording to clients, speed times faster than it was recorded.
+// Price generation pauses during the replay. Afterwards clients get the live history
+// again, the same way as after a data reload.
+func (ps *PriceService) StartReplay(name string, speed float64, loop bool) error {
+	if !recordingName.MatchString(name) {
+		return ErrRecordingNotFound
+	}
+	return ps.ReplayFile(filepath.Join(ps.recordingDir(), name), speed, loop)
+}
+
+// ReplayFile replays a recording outside of the data directory like StartReplay
+func (ps *PriceService) ReplayFile(path string, speed float64, loop bool) error {
+	if speed <= 0 || speed > maxReplaySpeed {
+		return fmt.Errorf("speed must be above 0 and at most %d, got %g", maxReplaySpeed, speed)
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return ErrRecordingNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to read recording: %w", err)
+	}
+	name := filepath.Base(path)
+
+	ps.recordingLock.Lock()
+	defer ps.recordingLock.Unlock()
+
+	if ps.replay != nil {
+		return ErrReplayActive
+	}
+	replay := &sessionReplay{
+		name:  name,
+		speed: speed,
+		loop:  loop,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	ps.replay = replay
+	ps.replaying.Store(true)
+
+	go ps.runReplay(replay, path)
+
+	log.Printf("Started replay of %s at %gx", name, speed)
+	return nil
+}
+
+// StopReplay stops the running replay and waits until clients are back on live prices
+func (ps *PriceService) StopReplay() error {
+	ps.recordingLock.Lock()
+	replay := ps.replay
+	ps.recordingLock.Unlock()
+
+	if replay == nil {
+		return ErrNotReplaying
+	}
+	select {
+	case <-replay.stop:
+	default:
+		close(replay.stop)
+	}
+	<-replay.done
+	return nil
+}
+
+// runReplay emits the events of a recording until it ends or the replay is stopped
+func (ps *PriceService) runReplay(replay *sessionReplay, path string) {
+	defer func() {
+		ps.recordingLock.Lock()
+		ps.replay = nil
+		ps.replaying.Store(false)
+		ps.recordingLock.Unlock()
+
+		// Bring clients back to the live history
+		ps.publishReload()
+		close(replay.done)
+		log.Printf("Finished replay of %s", replay.name)
+	}()
+
+	for {
+		if err := ps.replayFile(replay, path); err != nil {
+			log.Printf("Error replaying %s: %v", replay.name, err)
+			return
+		}
+		if !replay.loop {
+			return
+		}
+		select {
+		case <-replay.stop:
+			return
+		default:
+		}
+	}
+}
+
+// replayFile emits the events of a recording once, keeping their original spacing divided by the speed
+func (ps *PriceService) replayFile(replay *sessionReplay, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordedEventSize)
+
+	var previous int64
+	for scanner.Scan() {
+		var event models.RecordedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("invalid event: %w", err)
+		}
+
+		if previous != 0 && event.Time > previous {
+			wait := time.Duration(float64(time.Duration(event.Time-previous)*time.Millisecond) / replay.speed)
+			select {
+			case <-replay.stop:
+				return nil
+			case <-time.After(wait):
+			}
+		}
+		previous = event.Time
+
+		select {
+		case <-replay.stop:
+			return nil
+		default:
+		}
+
+		ps.hub.publishRaw(event.Channel, event.Message)
+	}
+	return scanner.Err()
+}
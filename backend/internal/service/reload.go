@@ -0,0 +1,102 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+
+	"server/internal/models"
+	"server/internal/store"
+)
+
+// ReloadData replaces the history of all timeframes with the dataset in dir, or the
+// data directory if dir is empty, without interrupting clients. The dataset is loaded
+// into new series first and swapped in for all timeframes at once, so a dataset that
+// fails to load leaves the running data untouched. Timeframes without a data file are
+// aggregated from the 1-minute candles, which are required.
+//
+// Clients get a reload message followed by the new history of their timeframe. The new
+// data is written to the data directory by the next save.
+func (ps *PriceService) ReloadData(dir string) (models.DataReload, error) {
+	if dir == "" {
+		dir = ps.dataDir
+	}
+
+	ps.reloadLock.Lock()
+	defer ps.reloadLock.Unlock()
+
+	reload := models.DataReload{
+		Dir:        dir,
+		Candles:    make(map[models.TimeFrame]int),
+		Aggregated: []models.TimeFrame{},
+	}
+
+	minuteCandles, err := ReadHistoryFile(dir, models.TimeFrame1Min)
+	if err != nil {
+		return reload, fmt.Errorf("failed to load %s data: %w", models.TimeFrame1Min, err)
+	}
+	if len(minuteCandles) == 0 {
+		return reload, fmt.Errorf("no %s candles in %s", models.TimeFrame1Min, dir)
+	}
+
+	maxCandles := ps.getMaxCandles()
+	shadow := make(map[models.TimeFrame]*store.Series, len(ps.timeFrameData))
+	for _, tf := range models.AllTimeFrames() {
+		candles := minuteCandles
+		if tf != models.TimeFrame1Min {
+			candles, err = ReadHistoryFile(dir, tf)
+			if errors.Is(err, fs.ErrNotExist) {
+				candles = AggregateHistory(minuteCandles, tf)
+				reload.Aggregated = append(reload.Aggregated, tf)
+			} else if err != nil {
+				return reload, fmt.Errorf("failed to load %s data: %w", tf, err)
+			}
+		}
+
+		shadow[tf] = store.NewSeriesFrom(candles, maxCandles)
+		reload.Candles[tf] = shadow[tf].Len()
+	}
+
+	// No candle may be finalized into the old history after the swap, so the
+	// current candle is dropped and a new one starts from the new history
+	ps.executeExclusive(func(*models.CandleData) *models.CandleData {
+		ps.swapSeries(shadow)
+		return ps.startNewCandle()
+	})
+	reload.DataVersion = ps.publishReload()
+
+	log.Printf("Reloaded data from %s as version %d", dir, reload.DataVersion)
+	return reload, nil
+}
+
+// swapSeries replaces the series of the given timeframes while holding the locks of
+// all timeframes, so readers see either the old or the new dataset but never a mix
+func (ps *PriceService) swapSeries(shadow map[models.TimeFrame]*store.Series) {
+	for _, tf := range models.AllTimeFrames() {
+		ps.timeFrameData[tf].lock.Lock()
+	}
+	for tf, series := range shadow {
+		ps.timeFrameData[tf].series = series
+		ps.timeFrameData[tf].version++
+	}
+	for _, tf := range models.AllTimeFrames() {
+		ps.timeFrameData[tf].lock.Unlock()
+	}
+}
+
+// publishReload bumps the data version and sends every client the reload message and
+// the new history of its timeframe. It returns the new data version.
+func (ps *PriceService) publishReload() uint64 {
+	dataVersion := ps.dataVersion.Add(1)
+
+	ps.hub.ResetDeltas()
+	ps.hub.PublishAll(models.ReloadMessage{Type: "reload", DataVersion: dataVersion})
+	for _, tf := range models.AllTimeFrames() {
+		ps.hub.Publish(tf, models.TimeFrameData{
+			TimeFrame: tf,
+			Candles:   ps.GetHistoryForTimeFrame(tf),
+		})
+	}
+	return dataVersion
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"server/internal/models"
+	"server/internal/store"
+)
+
+// snapshotFormat is the version of the snapshot layout written by this server
+const snapshotFormat = 1
+
+// ErrSnapshotNotFound is returned when a named snapshot doesn't exist
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// snapshotName matches the names of snapshot files, which must not contain path separators
+var snapshotName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*\.json$`)
+
+// snapshotDir returns the directory snapshots are saved in
+func (ps *PriceService) snapshotDir() string {
+	return filepath.Join(ps.dataDir, "snapshots")
+}
+
+// Snapshot captures the complete simulation state. Candle generation waits while
+// the state is copied, so the snapshot is consistent across all timeframes.
+func (ps *PriceService) Snapshot() models.SimulationSnapshot {
+	snapshot := models.SimulationSnapshot{
+		Format:  snapshotFormat,
+		Candles: make(map[models.TimeFrame][]models.CandleData, len(ps.timeFrameData)),
+	}
+
+	ps.executeExclusive(func(current *models.CandleData) *models.CandleData {
+		snapshot.CreatedAt = time.Now().UnixMilli()
+		snapshot.Params = ps.GetSimulationParams()
+		snapshot.RandomState = ps.random.State()
+		snapshot.VolumeState = ps.volumeModel.State()
+		if current != nil {
+			candle := *current
+			snapshot.CurrentCandle = &candle
+		}
+		for tf, data := range ps.timeFrameData {
+			candles, _ := data.candles()
+			if candles == nil {
+				candles = []models.CandleData{}
+			}
+			snapshot.Candles[tf] = candles
+		}
+		return current
+	})
+
+	return snapshot
+}
+
+// Restore replaces the complete simulation state with a snapshot. Clients get the
+// restored history the same way as after a data reload.
+func (ps *PriceService) Restore(snapshot models.SimulationSnapshot) error {
+	if snapshot.Format != snapshotFormat {
+		return fmt.Errorf("unsupported snapshot format %d, expected %d", snapshot.Format, snapshotFormat)
+	}
+
+	params := snapshot.Params
+	priceModel, ok := models.GetPriceModel(params.Model)
+	if !ok {
+		return fmt.Errorf("unknown price model %q in snapshot", params.Model)
+	}
+	if symbol := ps.GetSimulationParams().Symbol; params.Symbol != symbol {
+		return fmt.Errorf("snapshot is for symbol %s, the server simulates %s", params.Symbol, symbol)
+	}
+
+	// Timeframes missing from the snapshot are aggregated from the 1-minute candles
+	maxCandles := ps.getMaxCandles()
+	minuteCandles := snapshot.Candles[models.TimeFrame1Min]
+	shadow := make(map[models.TimeFrame]*store.Series, len(ps.timeFrameData))
+	for _, tf := range models.AllTimeFrames() {
+		candles, ok := snapshot.Candles[tf]
+		if !ok {
+			candles = AggregateHistory(minuteCandles, tf)
+		}
+		shadow[tf] = store.NewSeriesFrom(candles, maxCandles)
+	}
+
+	ps.reloadLock.Lock()
+	defer ps.reloadLock.Unlock()
+
+	ps.executeExclusive(func(*models.CandleData) *models.CandleData {
+		ps.settingsLock.Lock()
+		ps.params = params
+		ps.priceModel = priceModel
+		ps.settingsLock.Unlock()
+
+		ps.random.SetState(snapshot.RandomState)
+		ps.volumeModel.SetState(snapshot.VolumeState)
+		ps.swapSeries(shadow)
+
+		if snapshot.CurrentCandle == nil {
+			return nil
+		}
+		candle := *snapshot.CurrentCandle
+		return &candle
+	})
+	dataVersion := ps.publishReload()
+
+	log.Printf("Restored snapshot taken at %s as data version %d",
+		time.UnixMilli(snapshot.CreatedAt).Format(time.RFC3339), dataVersion)
+	return nil
+}
+
+// SaveSnapshot writes a snapshot of the current state to the snapshot directory
+func (ps *PriceService) SaveSnapshot() (models.SnapshotInfo, error) {
+	snapshot := ps.Snapshot()
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return models.SnapshotInfo{}, fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+
+	if err := os.MkdirAll(ps.snapshotDir(), 0755); err != nil {
+		return models.SnapshotInfo{}, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	name := fmt.Sprintf("snapshot-%s.json", time.UnixMilli(snapshot.CreatedAt).UTC().Format("20060102-150405.000"))
+	if err := writeFileAtomic(filepath.Join(ps.snapshotDir(), name), data); err != nil {
+		return models.SnapshotInfo{}, err
+	}
+
+	log.Printf("Saved snapshot %s", name)
+	return models.SnapshotInfo{
+		Name:      name,
+		CreatedAt: snapshot.CreatedAt,
+		Size:      int64(len(data)),
+	}, nil
+}
+
+// ListSnapshots returns the saved snapshots, newest first
+func (ps *PriceService) ListSnapshots() ([]models.SnapshotInfo, error) {
+	entries, err := os.ReadDir(ps.snapshotDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return []models.SnapshotInfo{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	snapshots := []models.SnapshotInfo{}
+	for _, entry := range entries {
+		if entry.IsDir() || !snapshotName.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, models.SnapshotInfo{
+			Name:      entry.Name(),
+			CreatedAt: info.ModTime().UnixMilli(),
+			Size:      info.Size(),
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt > snapshots[j].CreatedAt
+	})
+	return snapshots, nil
+}
+
+// RestoreSnapshot restores a snapshot saved in the snapshot directory
+func (ps *PriceService) RestoreSnapshot(name string) error {
+	if !snapshotName.MatchString(name) {
+		return ErrSnapshotNotFound
+	}
+
+	data, err := os.ReadFile(filepath.Join(ps.snapshotDir(), name))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrSnapshotNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var snapshot models.SimulationSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to parse snapshot %s: %w", name, err)
+	}
+	return ps.Restore(snapshot)
+}
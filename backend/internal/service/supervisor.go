@@ -0,0 +1,110 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"server/internal/metrics"
+	"server/internal/models"
+)
+
+const (
+	minRestartBackoff = time.Second // Wait before restarting a simulation loop after its first panic
+	maxRestartBackoff = time.Minute // Longest wait, the backoff doubles with every panic up to it
+	healthyRunTime    = time.Minute // Run time without a panic after which the backoff starts over
+)
+
+var simulationRestarts = metrics.NewCounter("seedventure_simulation_restarts_total", "Number of simulation loops restarted after a panic")
+
+// commandPanic is a panic of a command on the candle owner, raised again by its sender with
+// the stack it happened on
+type commandPanic struct {
+	value interface{}
+	stack []byte
+}
+
+func (p commandPanic) String() string {
+	return fmt.Sprint(p.value)
+}
+
+// supervise runs the simulation loop of the symbol until the service is stopped. A panic
+// only stops this symbol: the loop is restarted after a backoff, doubling with every panic
+// until it ran healthyRunTime, and GetStats reports it.
+func (ps *PriceService) supervise(loop func()) {
+	backoff := minRestartBackoff
+	for {
+		started := time.Now()
+		ps.setLoopHealth(func(health *models.LoopHealth) {
+			health.State = models.LoopRunning
+			health.RestartAt = 0
+		})
+
+		rec, stack := ps.runProtected(loop)
+		if rec == nil {
+			ps.setLoopHealth(func(health *models.LoopHealth) { health.State = models.LoopStopped })
+			return
+		}
+
+		if time.Since(started) >= healthyRunTime {
+			backoff = minRestartBackoff
+		}
+		now := time.Now()
+		ps.setLoopHealth(func(health *models.LoopHealth) {
+			health.State = models.LoopRestarting
+			health.LastPanic = fmt.Sprint(rec)
+			health.LastPanicAt = now.UnixMilli()
+			health.RestartAt = now.Add(backoff).UnixMilli()
+		})
+		log.Printf("Panic in simulation loop of %s, restarting in %s: %v\n%s", ps.GetSimulationParams().Symbol, backoff, rec, stack)
+
+		select {
+		case <-ps.stop:
+			ps.setLoopHealth(func(health *models.LoopHealth) {
+				health.State = models.LoopStopped
+				health.RestartAt = 0
+			})
+			return
+		case <-time.After(backoff):
+		}
+		simulationRestarts.Inc()
+		ps.setLoopHealth(func(health *models.LoopHealth) { health.Restarts++ })
+		if backoff *= 2; backoff > maxRestartBackoff {
+			backoff = maxRestartBackoff
+		}
+	}
+}
+
+// runProtected runs the loop, returning what it panicked with and where, nil if it returned
+func (ps *PriceService) runProtected(loop func()) (rec interface{}, stack []byte) {
+	defer func() {
+		if rec = recover(); rec != nil {
+			metrics.PanicsRecovered.Inc()
+			stack = debug.Stack()
+			if p, ok := rec.(commandPanic); ok {
+				stack = p.stack
+			}
+		}
+	}()
+	loop()
+	return nil, nil
+}
+
+// setLoopHealth changes the health of the simulation loop
+func (ps *PriceService) setLoopHealth(change func(health *models.LoopHealth)) {
+	ps.healthLock.Lock()
+	defer ps.healthLock.Unlock()
+	change(&ps.loopHealth)
+}
+
+// LoopHealth returns the health of the simulation loop, nil if none was started
+func (ps *PriceService) LoopHealth() *models.LoopHealth {
+	ps.healthLock.Lock()
+	defer ps.healthLock.Unlock()
+	if ps.loopHealth.State == "" {
+		return nil
+	}
+	health := ps.loopHealth
+	return &health
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"server/internal/metrics"
+	"server/internal/models"
+	"server/internal/store"
+)
+
+var (
+	historyCacheHits   = metrics.NewCounter("seedventure_history_cache_hits_total", "Number of history responses served from the serialized cache")
+	historyCacheMisses = metrics.NewCounter("seedventure_history_cache_misses_total", "Number of history responses that had to be serialized")
+)
+
+// timeFrameStore holds the candles of one timeframe behind its own lock, so
+// reading the history of one timeframe doesn't contend with updates to another
+type timeFrameStore struct {
+	lock    sync.RWMutex
+	series  *store.Series // nil until data was generated or loaded
+	version uint64        // Incremented on every change of the series
+
+	// Version and time of the last save, the timeframe is dirty while savedVersion lags behind version
+	savedVersion uint64
+	lastSave     time.Time
+	saveLock     sync.Mutex // Serializes writes of the data file
+
+	// Serialized JSON of the stored candles, valid while encodedVersion matches version
+	encodedLock    sync.Mutex
+	encoded        *encodedSeries
+	encodedVersion uint64
+}
+
+// encodedSeries is the JSON encoding of the stored candles of a timeframe, see
+// models.AppendCandles
+type encodedSeries struct {
+	candles     []byte            // Every stored candle
+	withoutLast []byte            // Every stored candle but the last, which a live candle may replace
+	last        models.CandleData // The last stored candle
+	empty       bool              // Whether there are no candles, so last is not set
+}
+
+// registerStoreMetrics exports the usage of the stores per timeframe, computed on every collection.
+// A later call replaces the metrics, so they always describe the most recently created service.
+func registerStoreMetrics(stores map[models.TimeFrame]*timeFrameStore) {
+	usage := func(value func(models.StoreStats) float64) func() map[string]float64 {
+		return func() map[string]float64 {
+			values := make(map[string]float64, len(stores))
+			for tf, s := range stores {
+				values[string(tf)] = value(s.usage())
+			}
+			return values
+		}
+	}
+
+	metrics.NewLabeledGaugeFunc("seedventure_store_candles", "Number of stored candles", "timeframe",
+		usage(func(u models.StoreStats) float64 { return float64(u.Candles) }))
+	metrics.NewLabeledGaugeFunc("seedventure_store_capacity", "Maximum number of stored candles", "timeframe",
+		usage(func(u models.StoreStats) float64 { return float64(u.Capacity) }))
+	metrics.NewLabeledGaugeFunc("seedventure_store_bytes", "Memory retained by the candle buffer", "timeframe",
+		usage(func(u models.StoreStats) float64 { return float64(u.Bytes) }))
+	metrics.NewLabeledGaugeFunc("seedventure_store_utilization", "Stored candles relative to capacity", "timeframe",
+		usage(func(u models.StoreStats) float64 { return u.Utilization }))
+	metrics.NewLabeledGaugeFunc("seedventure_history_cache_bytes", "Memory retained by the serialized history cache", "timeframe",
+		usage(func(u models.StoreStats) float64 { return float64(u.CacheBytes) }))
+}
+
+// newTimeFrameStores creates an empty store for every supported timeframe. The
+// returned map is never modified afterwards and can be read without locking.
+func newTimeFrameStores() map[models.TimeFrame]*timeFrameStore {
+	stores := make(map[models.TimeFrame]*timeFrameStore)
+	for _, tf := range models.AllTimeFrames() {
+		stores[tf] = &timeFrameStore{}
+	}
+	return stores
+}
+
+// candles returns a copy of the stored candles, oldest first, and whether any data exists
+func (s *timeFrameStore) candles() ([]models.CandleData, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.series == nil {
+		return nil, false
+	}
+	return s.series.Candles(), true
+}
+
+// snapshot returns a copy of the stored candles together with the version they belong to
+func (s *timeFrameStore) snapshot() ([]models.CandleData, uint64, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.series == nil {
+		return nil, s.version, false
+	}
+	return s.series.Candles(), s.version, true
+}
+
+// markSaved records that the given version was written to disk
+func (s *timeFrameStore) markSaved(version uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if version > s.savedVersion {
+		s.savedVersion = version
+	}
+	s.lastSave = time.Now()
+}
+
+// dirty reports whether the candles changed since they were last saved
+func (s *timeFrameStore) dirty() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.series != nil && s.version != s.savedVersion
+}
+
+// lastSaved returns when the candles were last written to disk, zero if never
+func (s *timeFrameStore) lastSaved() time.Time {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.lastSave
+}
+
+// between returns a copy of the candles with timestamps in [from, to]
+func (s *timeFrameStore) between(from, to int64) ([]models.CandleData, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.series == nil {
+		return nil, false
+	}
+	return s.series.Between(from, to), true
+}
+
+// page returns at most limit candles with timestamps in [from, to]
+func (s *timeFrameStore) page(from, to int64, limit int) ([]models.CandleData, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.series == nil {
+		return nil, false
+	}
+	return s.series.Page(from, to, limit), true
+}
+
+// tail returns at most limit of the newest candles with timestamps up to to
+func (s *timeFrameStore) tail(to int64, limit int) ([]models.CandleData, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.series == nil {
+		return nil, false
+	}
+	return s.series.Tail(to, limit), true
+}
+
+// last returns the most recent stored candle
+func (s *timeFrameStore) last() (models.CandleData, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.series == nil {
+		return models.CandleData{}, false
+	}
+	return s.series.Last()
+}
+
+// len returns the number of stored candles
+func (s *timeFrameStore) len() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.series == nil {
+		return 0
+	}
+	return s.series.Len()
+}
+
+// usage returns the size and memory of the stored candles
+func (s *timeFrameStore) usage() models.StoreStats {
+	s.lock.RLock()
+	var usage models.StoreStats
+	if s.series != nil {
+		usage.Candles = s.series.Len()
+		usage.Capacity = s.series.Cap()
+		usage.Bytes = s.series.Bytes()
+		usage.Utilization = float64(usage.Candles) / float64(usage.Capacity)
+	}
+	s.lock.RUnlock()
+
+	s.encodedLock.Lock()
+	if s.encoded != nil {
+		usage.CacheBytes = cap(s.encoded.candles)
+	}
+	s.encodedLock.Unlock()
+	return usage
+}
+
+// encodedCandles returns the encoding of the stored candles. The encoding is cached until
+// the candles change.
+func (s *timeFrameStore) encodedCandles() (*encodedSeries, bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.series == nil {
+		return nil, false, nil
+	}
+
+	s.encodedLock.Lock()
+	defer s.encodedLock.Unlock()
+
+	if s.encoded != nil && s.encodedVersion == s.version {
+		historyCacheHits.Inc()
+		return s.encoded, true, nil
+	}
+
+	historyCacheMisses.Inc()
+	candles := s.series.Candles()
+	if len(candles) == 0 {
+		s.encoded = &encodedSeries{empty: true}
+		s.encodedVersion = s.version
+		return s.encoded, true, nil
+	}
+
+	// The candles before the last are encoded first, so their encoding is a prefix of the whole
+	head := candles[:len(candles)-1]
+	encoded, err := models.AppendCandles(make([]byte, 0, len(candles)*96), head)
+	if err != nil {
+		return nil, true, err
+	}
+	withoutLast := encoded[:len(encoded):len(encoded)]
+	if len(head) > 0 {
+		encoded = append(encoded, ',')
+	}
+	if encoded, err = models.AppendCandles(encoded, candles[len(candles)-1:]); err != nil {
+		return nil, true, err
+	}
+
+	s.encoded = &encodedSeries{candles: encoded, withoutLast: withoutLast, last: candles[len(candles)-1]}
+	s.encodedVersion = s.version
+	return s.encoded, true, nil
+}
+
+// replace swaps in a new series, nil discards all data
+func (s *timeFrameStore) replace(series *store.Series) {
+	s.lock.Lock()
+	s.series = series
+	s.version++
+	s.lock.Unlock()
+}
+
+// resize changes the retention of the stored data, keeping the most recent candles
+func (s *timeFrameStore) resize(maxCandles int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.series != nil && s.series.Cap() != maxCandles {
+		s.series = s.series.Resize(maxCandles)
+		s.version++
+	}
+}
+
+// modifyLocked returns the series for modification, creating an empty one if needed, and
+// invalidates the cached encoding. The caller must hold the write lock.
+func (s *timeFrameStore) modifyLocked(maxCandles int) *store.Series {
+	if s.series == nil {
+		s.series = store.NewSeries(maxCandles)
+	}
+	s.version++
+	return s.series
+}
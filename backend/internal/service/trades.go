@@ -0,0 +1,90 @@
+package service
+
+import (
+	"sync"
+
+	"server/internal/models"
+)
+
+// MaxTrades is the number of recent trades kept in memory
+const MaxTrades = 1000
+
+// tradeLog holds the most recent trades in a ring
+type tradeLog struct {
+	lock   sync.RWMutex
+	trades [MaxTrades]models.Trade
+	count  int64 // Trades recorded since startup, the ID of the newest
+}
+
+// record adds a trade at a price, seller initiated if the price is lower than the one of
+// the previous trade, a repeated price keeps the side
+func (l *tradeLog) record(price, quantity float64, at int64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	trade := models.Trade{Price: price, Quantity: quantity, Time: at}
+	if l.count > 0 {
+		last := l.trades[(l.count-1)%MaxTrades]
+		trade.IsBuyerMaker = price < last.Price || (price == last.Price && last.IsBuyerMaker)
+	}
+	l.count++
+	trade.ID = l.count
+	l.trades[(l.count-1)%MaxTrades] = trade
+}
+
+// recent returns the newest trades, up to limit, oldest first
+func (l *tradeLog) recent(limit int) []models.Trade {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	n := l.count
+	if n > MaxTrades {
+		n = MaxTrades
+	}
+	if int64(limit) < n {
+		n = int64(limit)
+	}
+	trades := make([]models.Trade, n)
+	for i := range trades {
+		trades[i] = l.trades[(l.count-n+int64(i))%MaxTrades]
+	}
+	return trades
+}
+
+// RecentTrades returns the newest trades, up to limit and MaxTrades, oldest first. Generated
+// prices trade once every broadcast interval the price or the volume moves.
+func (ps *PriceService) RecentTrades(limit int) []models.Trade {
+	return ps.trades.recent(limit)
+}
+
+// AggregatedTrades returns the newest of the recent trades with consecutive trades at the
+// same price and side compressed into one, up to limit, oldest first
+func (ps *PriceService) AggregatedTrades(limit int) []models.AggTrade {
+	var aggregated []models.AggTrade
+	for _, trade := range ps.trades.recent(MaxTrades) {
+		if n := len(aggregated); n > 0 {
+			last := &aggregated[n-1]
+			if last.Price == trade.Price && last.IsBuyerMaker == trade.IsBuyerMaker {
+				last.Quantity = ps.precision.AddVolume(last.Quantity, trade.Quantity)
+				last.LastID = trade.ID
+				continue
+			}
+		}
+		aggregated = append(aggregated, models.AggTrade{
+			ID:           trade.ID,
+			Price:        trade.Price,
+			Quantity:     trade.Quantity,
+			FirstID:      trade.ID,
+			LastID:       trade.ID,
+			Time:         trade.Time,
+			IsBuyerMaker: trade.IsBuyerMaker,
+		})
+	}
+	if len(aggregated) > limit {
+		aggregated = aggregated[len(aggregated)-limit:]
+	}
+	if aggregated == nil {
+		aggregated = []models.AggTrade{}
+	}
+	return aggregated
+}
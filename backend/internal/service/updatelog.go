@@ -0,0 +1,365 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"server/internal/config"
+	"server/internal/models"
+)
+
+const (
+	updateLogDir           = "updates"   // Directory in the data directory holding the segments of the update log
+	updateLogFlushInterval = time.Second // How often logged updates are written to disk
+	maxResumedUpdates      = 200         // Most updates a reconnecting client is sent, fitting its send queue
+)
+
+var (
+	// ErrUpdateLogDisabled is returned when reading the update log while it is disabled
+	ErrUpdateLogDisabled = errors.New("update log is disabled")
+	// ErrOffsetDiscarded is returned when reading updates the log already discarded, or
+	// more than a client can be sent at once
+	ErrOffsetDiscarded = errors.New("offset no longer available")
+)
+
+// segmentName matches the names of segment files, holding the offset of their first update
+var segmentName = regexp.MustCompile(`^updates-(\d{20})\.jsonl$`)
+
+// updateLog is an append-only log of every candle update sent to clients, each numbered
+// with an offset increasing by 1. It is split into segment files, which are replayable
+// recordings, and keeps the newest segments. Reconnecting clients resume from it.
+type updateLog struct {
+	dir         string
+	maxSegment  int64 // Bytes after which a new segment is started
+	maxSegments int
+
+	lock     sync.Mutex
+	segments []int64 // First offsets of the segments, oldest first
+	file     *os.File
+	w        *bufio.Writer
+	size     int64 // Bytes of the newest segment
+	next     int64 // Offset of the next update
+	err      error // First write error, logging stops after it
+}
+
+// openUpdateLog opens the update log in a data directory, continuing after its last update.
+// An update cut off by a crash is dropped.
+func openUpdateLog(dataDir string, cfg config.UpdateLogConfig) (*updateLog, error) {
+	l := &updateLog{
+		dir:         filepath.Join(dataDir, updateLogDir),
+		maxSegment:  cfg.SegmentSize,
+		maxSegments: cfg.Segments,
+		next:        1,
+	}
+	if err := os.MkdirAll(l.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create update log directory: %w", err)
+	}
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list update log segments: %w", err)
+	}
+	for _, entry := range entries {
+		if match := segmentName.FindStringSubmatch(entry.Name()); match != nil {
+			first, _ := strconv.ParseInt(match[1], 10, 64)
+			l.segments = append(l.segments, first)
+		}
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i] < l.segments[j] })
+
+	if len(l.segments) == 0 {
+		return l, l.roll()
+	}
+	last := l.segments[len(l.segments)-1]
+	if err := l.recover(last); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(l.segmentPath(last), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open update log segment: %w", err)
+	}
+	l.file, l.w = file, bufio.NewWriter(file)
+	return l, nil
+}
+
+// segmentPath returns the path of the segment starting at an offset
+func (l *updateLog) segmentPath(first int64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("updates-%020d.jsonl", first))
+}
+
+// recover finds the next offset after the updates of the newest segment and truncates it
+// after the last complete one
+func (l *updateLog) recover(first int64) error {
+	path := l.segmentPath(first)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read update log segment: %w", err)
+	}
+
+	l.next, l.size = first, 0
+	for len(data[l.size:]) > 0 {
+		end := bytes.IndexByte(data[l.size:], '\n')
+		if end < 0 {
+			break
+		}
+		var event models.RecordedEvent
+		if err := json.Unmarshal(data[l.size:l.size+int64(end)], &event); err != nil {
+			break
+		}
+		l.next = event.Offset + 1
+		l.size += int64(end) + 1
+	}
+	if l.size < int64(len(data)) {
+		log.Printf("Dropping %d bytes of an incomplete update at the end of %s", int64(len(data))-l.size, path)
+		if err := os.Truncate(path, l.size); err != nil {
+			return fmt.Errorf("failed to truncate update log segment: %w", err)
+		}
+	}
+	return nil
+}
+
+// roll closes the newest segment, starts a new one at the next offset and deletes the
+// oldest segments beyond the configured number. The caller holds lock, unless opening.
+func (l *updateLog) roll() error {
+	if l.file != nil {
+		if err := l.w.Flush(); err != nil {
+			return err
+		}
+		if err := l.file.Close(); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(l.segmentPath(l.next), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create update log segment: %w", err)
+	}
+	l.file, l.w, l.size = file, bufio.NewWriter(file), 0
+	l.segments = append(l.segments, l.next)
+
+	for len(l.segments) > l.maxSegments {
+		if err := os.Remove(l.segmentPath(l.segments[0])); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Error deleting update log segment: %v", err)
+		}
+		l.segments = l.segments[1:]
+	}
+	return nil
+}
+
+// append logs an update sent on its timeframe and returns its offset, 0 if it couldn't be logged
+func (l *updateLog) append(message models.UpdateMessage) int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.err != nil {
+		return 0
+	}
+
+	message.Offset = l.next
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Error encoding logged update: %v", err)
+		return 0
+	}
+	line, err := json.Marshal(models.RecordedEvent{Offset: l.next, Time: time.Now().UnixMilli(), Channel: message.TimeFrame, Message: data})
+	if err != nil {
+		log.Printf("Error encoding logged update: %v", err)
+		return 0
+	}
+
+	if l.size > 0 && l.size+int64(len(line)) >= l.maxSegment {
+		if err := l.roll(); err != nil {
+			l.err = err
+			log.Printf("Error starting update log segment, logging stopped: %v", err)
+			return 0
+		}
+	}
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		l.err = err
+		log.Printf("Error writing update log, logging stopped: %v", err)
+		return 0
+	}
+	l.size += int64(len(line)) + 1
+	l.next++
+	return message.Offset
+}
+
+// read returns the updates from an offset on, oldest first, only those sent on a channel if
+// not empty and at most limit. It also returns the offset of the next update to be logged.
+func (l *updateLog) read(from int64, channel models.TimeFrame, limit int) ([]models.RecordedEvent, int64, error) {
+	l.lock.Lock()
+	if err := l.w.Flush(); err != nil && l.err == nil {
+		l.err = err
+	}
+	segments := append([]int64(nil), l.segments...)
+	next := l.next
+	l.lock.Unlock()
+
+	if from < segments[0] {
+		return nil, next, fmt.Errorf("%w: the log starts at offset %d", ErrOffsetDiscarded, segments[0])
+	}
+
+	events := []models.RecordedEvent{}
+	start := sort.Search(len(segments), func(i int) bool { return segments[i] > from }) - 1
+	for _, first := range segments[start:] {
+		done, err := l.readSegment(first, from, next, channel, limit, &events)
+		if err != nil {
+			return nil, next, err
+		}
+		if done {
+			break
+		}
+	}
+	return events, next, nil
+}
+
+// readSegment appends the updates of a segment from an offset on to events until it holds
+// limit, which it reports. Updates at or after next were logged after the read began.
+func (l *updateLog) readSegment(first, from, next int64, channel models.TimeFrame, limit int, events *[]models.RecordedEvent) (bool, error) {
+	file, err := os.Open(l.segmentPath(first))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, ErrOffsetDiscarded // Deleted by a roll since the read began
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read update log: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return false, nil // An incomplete line is still being written
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to read update log: %w", err)
+		}
+		var event models.RecordedEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return false, fmt.Errorf("invalid update in log: %w", err)
+		}
+		if event.Offset >= next {
+			return true, nil
+		}
+		if event.Offset < from || (channel != "" && event.Channel != channel) {
+			continue
+		}
+		if len(*events) == limit {
+			return true, nil
+		}
+		*events = append(*events, event)
+	}
+}
+
+// flushLoop writes buffered updates to disk until stop is closed
+func (l *updateLog) flushLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(updateLogFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			l.flush()
+		}
+	}
+}
+
+// flush writes buffered updates to disk
+func (l *updateLog) flush() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if err := l.w.Flush(); err != nil {
+		if l.err == nil {
+			l.err = err
+			log.Printf("Error writing update log, logging stopped: %v", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// close writes buffered updates to disk and closes the newest segment
+func (l *updateLog) close() error {
+	err := l.flush()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// logUpdate logs an update about to be sent, if the update log is enabled, and returns it
+// numbered with its offset
+func (ps *PriceService) logUpdate(message models.UpdateMessage) models.UpdateMessage {
+	if ps.updates != nil {
+		message.Offset = ps.updates.append(message)
+	}
+	return message
+}
+
+// LoggedUpdates returns up to limit updates from an offset on, oldest first, only those sent
+// on a timeframe if not empty, and the offset of the next update. It fails with
+// ErrOffsetDiscarded if the log no longer holds the offset.
+func (ps *PriceService) LoggedUpdates(from int64, timeFrame models.TimeFrame, limit int) ([]models.RecordedEvent, int64, error) {
+	if ps.updates == nil {
+		return nil, 0, ErrUpdateLogDisabled
+	}
+	return ps.updates.read(from, timeFrame, limit)
+}
+
+// LoggedOffsets returns the offset of the oldest update the log holds and of the next one
+func (ps *PriceService) LoggedOffsets() (first, next int64, err error) {
+	if ps.updates == nil {
+		return 0, 0, ErrUpdateLogDisabled
+	}
+	ps.updates.lock.Lock()
+	defer ps.updates.lock.Unlock()
+	return ps.updates.segments[0], ps.updates.next, nil
+}
+
+// ResumeUpdates sends a reconnecting client the updates of its timeframe it missed since an
+// offset, before any newer update. It fails with ErrOffsetDiscarded if the log no longer
+// holds all of them or there are too many, and the client should load the history instead.
+func (ps *PriceService) ResumeUpdates(client *Client, from int64) error {
+	if ps.updates == nil {
+		return ErrUpdateLogDisabled
+	}
+
+	var err error
+	ps.executeExclusive(func(current *models.CandleData) *models.CandleData {
+		var events []models.RecordedEvent
+		var next int64
+		events, next, err = ps.updates.read(from, client.TimeFrame(), maxResumedUpdates+1)
+		if err != nil {
+			return current
+		}
+		if len(events) > maxResumedUpdates {
+			err = fmt.Errorf("%w: more than %d updates since offset %d, the log is at %d", ErrOffsetDiscarded, maxResumedUpdates, from, next)
+			return current
+		}
+		ohlc := client.Schema() == models.SchemaOHLC
+		for _, event := range events {
+			var update models.UpdateMessage
+			if ohlc && json.Unmarshal(event.Message, &update) == nil {
+				client.Send(update)
+				continue
+			}
+			client.Send(event.Message)
+		}
+		return current
+	})
+	return err
+}
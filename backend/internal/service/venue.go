@@ -0,0 +1,46 @@
+package service
+
+import "time"
+
+// delay holds back the index prices of a venue by its latency
+type delay struct {
+	latency time.Duration
+	prices  []timedPrice // Prices of the last latency, oldest first
+}
+
+// timedPrice is an index price and when it was computed
+type timedPrice struct {
+	at    time.Time
+	price float64
+}
+
+// SetVenue makes the service a simulated exchange quoting a spot market: an index of the spot
+// price times 1 plus a premium moving randomly by divergence every broadcast interval and
+// reverting to 0, which reaches the venue latency late. Must be called before the history is
+// loaded, which starts at spot.
+func (ps *PriceService) SetVenue(spot *PriceService, underlying string, divergence float64, latency time.Duration) {
+	ps.index = []IndexConstituent{{Name: underlying, Service: spot, Weight: 1}}
+	ps.premium = ps.newPremium(divergence)
+	if latency > 0 {
+		ps.delay = &delay{latency: latency}
+	}
+}
+
+// delayed records the index price at a time and returns the newest price that is at least
+// latency old, failing until there is one. Older prices are dropped. Only called by runIndex.
+func (d *delay) delayed(now time.Time, price float64) (float64, bool) {
+	d.prices = append(d.prices, timedPrice{at: now, price: price})
+
+	due := -1
+	for i, p := range d.prices {
+		if now.Sub(p.at) < d.latency {
+			break
+		}
+		due = i
+	}
+	if due < 0 {
+		return 0, false
+	}
+	d.prices = d.prices[due:]
+	return d.prices[0].price, true
+}
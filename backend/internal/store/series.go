@@ -0,0 +1,287 @@
+package store
+
+import (
+	"math"
+	"sort"
+
+	"server/internal/metrics"
+	"server/internal/models"
+)
+
+var (
+	timestampConflicts = metrics.NewCounter("seedventure_store_timestamp_conflicts_total", "Number of candles appended with the timestamp of a different stored candle")
+	conflictsRejected  = metrics.NewCounter("seedventure_store_conflicts_rejected_total", "Number of conflicting candles rejected because they were an incomplete version of a complete candle")
+)
+
+// AppendResult tells what Append did with a candle
+type AppendResult int
+
+const (
+	Appended  AppendResult = iota // Newer than every stored candle, added as the most recent one
+	Inserted                      // Older than the most recent candle, inserted at its sorted position
+	Replaced                      // Same timestamp as a stored candle, which it replaced
+	Unchanged                     // Same timestamp as a stored candle, which it equals or must not replace
+	Dropped                       // Older than every candle a full series retains
+)
+
+// Series stores the candles of one timeframe in columnar form: one slice per
+// field instead of a slice of structs. The slices form a ring buffer of fixed
+// capacity, so appending to a full series overwrites the oldest candle without
+// reallocating, and scans over a single field stay cache-friendly.
+//
+// Candles are kept sorted by timestamp with unique timestamps, which allows
+// lookups and range queries by binary search. Append enforces this, callers of
+// Set must keep the timestamp of the candle they replace.
+//
+// Series is not safe for concurrent use; callers guard it with their own lock.
+type Series struct {
+	timestamps []int64
+	opens      []float64
+	highs      []float64
+	lows       []float64
+	closes     []float64
+	volumes    []float64
+	complete   []bool
+
+	start  int // Physical index of the oldest candle
+	length int // Number of stored candles
+}
+
+// NewSeries creates an empty series holding at most capacity candles
+func NewSeries(capacity int) *Series {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &Series{
+		timestamps: make([]int64, capacity),
+		opens:      make([]float64, capacity),
+		highs:      make([]float64, capacity),
+		lows:       make([]float64, capacity),
+		closes:     make([]float64, capacity),
+		volumes:    make([]float64, capacity),
+		complete:   make([]bool, capacity),
+	}
+}
+
+// NewSeriesFrom creates a series from candles, keeping the most recent capacity candles
+func NewSeriesFrom(candles []models.CandleData, capacity int) *Series {
+	s := NewSeries(capacity)
+	if !sort.SliceIsSorted(candles, func(i, j int) bool { return candles[i].Timestamp < candles[j].Timestamp }) {
+		sorted := make([]models.CandleData, len(candles))
+		copy(sorted, candles)
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+		candles = sorted
+	}
+	if len(candles) > s.Cap() {
+		candles = candles[len(candles)-s.Cap():]
+	}
+	for _, candle := range candles {
+		s.Append(candle)
+	}
+	return s
+}
+
+// Len returns the number of stored candles
+func (s *Series) Len() int {
+	return s.length
+}
+
+// Cap returns the maximum number of candles the series can hold
+func (s *Series) Cap() int {
+	return len(s.timestamps)
+}
+
+// candleBytes is the memory one candle occupies across the column slices
+const candleBytes = 6*8 + 1
+
+// Bytes returns the memory retained by the column slices, which is fixed by the capacity
+func (s *Series) Bytes() int {
+	return s.Cap() * candleBytes
+}
+
+// physical maps a logical index (0 = oldest) to an index into the column slices
+func (s *Series) physical(i int) int {
+	return (s.start + i) % len(s.timestamps)
+}
+
+// At returns the candle at logical index i, where 0 is the oldest candle
+func (s *Series) At(i int) models.CandleData {
+	p := s.physical(i)
+	return models.CandleData{
+		Timestamp:  s.timestamps[p],
+		Values:     [4]float64{s.opens[p], s.highs[p], s.lows[p], s.closes[p]},
+		IsComplete: s.complete[p],
+		Volume:     s.volumes[p],
+	}
+}
+
+// TimestampAt returns the timestamp of the candle at logical index i
+func (s *Series) TimestampAt(i int) int64 {
+	return s.timestamps[s.physical(i)]
+}
+
+// Set replaces the candle at logical index i, which must keep its timestamp
+func (s *Series) Set(i int, candle models.CandleData) {
+	p := s.physical(i)
+	s.timestamps[p] = candle.Timestamp
+	s.opens[p] = candle.Values[0]
+	s.highs[p] = candle.Values[1]
+	s.lows[p] = candle.Values[2]
+	s.closes[p] = candle.Values[3]
+	s.volumes[p] = candle.Volume
+	s.complete[p] = candle.IsComplete
+}
+
+// Last returns the most recent candle
+func (s *Series) Last() (models.CandleData, bool) {
+	if s.length == 0 {
+		return models.CandleData{}, false
+	}
+	return s.At(s.length - 1), true
+}
+
+// Append adds a candle as the most recent one, dropping the oldest candle when full.
+// A candle that is not newer than the last one is inserted at its sorted position instead,
+// so timestamps stay strictly increasing. A candle with the timestamp of a stored one is a
+// later version of it and replaces it, unless it is an incomplete version of a complete
+// candle, which would reopen a finished period and is rejected.
+func (s *Series) Append(candle models.CandleData) AppendResult {
+	if s.length > 0 && candle.Timestamp <= s.TimestampAt(s.length-1) {
+		return s.insert(candle)
+	}
+
+	if s.length < len(s.timestamps) {
+		s.length++
+	} else {
+		s.start = (s.start + 1) % len(s.timestamps)
+	}
+	s.Set(s.length-1, candle)
+	return Appended
+}
+
+// insert places a candle at its sorted position, shifting newer candles back
+func (s *Series) insert(candle models.CandleData) AppendResult {
+	i := s.Search(candle.Timestamp)
+	if i < s.length && s.TimestampAt(i) == candle.Timestamp {
+		return s.merge(i, candle)
+	}
+
+	if s.length == len(s.timestamps) {
+		if i == 0 {
+			return Dropped // Older than everything we retain
+		}
+		// Drop the oldest candle to make room
+		s.start = (s.start + 1) % len(s.timestamps)
+		s.length--
+		i--
+	}
+
+	s.length++
+	for j := s.length - 1; j > i; j-- {
+		s.Set(j, s.At(j-1))
+	}
+	s.Set(i, candle)
+	return Inserted
+}
+
+// merge resolves a candle with the timestamp of the one at logical index i
+func (s *Series) merge(i int, candle models.CandleData) AppendResult {
+	stored := s.At(i)
+	if stored == candle {
+		return Unchanged
+	}
+	timestampConflicts.Inc()
+	if stored.IsComplete && !candle.IsComplete {
+		conflictsRejected.Inc()
+		return Unchanged
+	}
+	s.Set(i, candle)
+	return Replaced
+}
+
+// Search returns the logical index of the first candle with a timestamp at or after the given one
+func (s *Series) Search(timestamp int64) int {
+	return sort.Search(s.length, func(i int) bool {
+		return s.TimestampAt(i) >= timestamp
+	})
+}
+
+// IndexOf returns the logical index of the candle with the given timestamp, or -1
+func (s *Series) IndexOf(timestamp int64) int {
+	if i := s.Search(timestamp); i < s.length && s.TimestampAt(i) == timestamp {
+		return i
+	}
+	return -1
+}
+
+// Candles returns a copy of all candles, oldest first
+func (s *Series) Candles() []models.CandleData {
+	return s.Range(0, s.length)
+}
+
+// Range returns a copy of the candles with logical indexes in [from, to)
+func (s *Series) Range(from, to int) []models.CandleData {
+	if from < 0 {
+		from = 0
+	}
+	if to > s.length {
+		to = s.length
+	}
+	if from >= to {
+		return []models.CandleData{}
+	}
+
+	candles := make([]models.CandleData, 0, to-from)
+	for i := from; i < to; i++ {
+		candles = append(candles, s.At(i))
+	}
+	return candles
+}
+
+// Between returns a copy of the candles with timestamps in [from, to]
+func (s *Series) Between(from, to int64) []models.CandleData {
+	if from > to {
+		return []models.CandleData{}
+	}
+	end := s.length
+	if to < math.MaxInt64 {
+		end = s.Search(to + 1)
+	}
+	return s.Range(s.Search(from), end)
+}
+
+// Page returns a copy of at most limit candles with timestamps in [from, to], oldest first.
+// Paging by timestamp stays consistent while candles are appended between calls.
+func (s *Series) Page(from, to int64, limit int) []models.CandleData {
+	if from > to || limit <= 0 {
+		return []models.CandleData{}
+	}
+	start := s.Search(from)
+	end := s.length
+	if to < math.MaxInt64 {
+		end = s.Search(to + 1)
+	}
+	if end-start > limit {
+		end = start + limit
+	}
+	return s.Range(start, end)
+}
+
+// Tail returns a copy of at most limit of the newest candles with timestamps up to to,
+// oldest first
+func (s *Series) Tail(to int64, limit int) []models.CandleData {
+	if limit <= 0 {
+		return []models.CandleData{}
+	}
+	end := s.length
+	if to < math.MaxInt64 {
+		end = s.Search(to + 1)
+	}
+	return s.Range(end-limit, end)
+}
+
+// Resize changes the capacity of the series, keeping the most recent candles
+func (s *Series) Resize(capacity int) *Series {
+	return NewSeriesFrom(s.Candles(), capacity)
+}
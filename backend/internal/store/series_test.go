@@ -0,0 +1,73 @@
+package store
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"server/internal/models"
+)
+
+var benchCandles = flag.Int("bench.candles", 100000, "candles in the series scanned by the benchmarks")
+
+// fullSeries returns a series holding n consecutive 1-minute candles
+func fullSeries(n int) *Series {
+	s := NewSeries(n)
+	for i := 0; i < n; i++ {
+		s.Append(benchCandle(int64(i) * time.Minute.Milliseconds()))
+	}
+	return s
+}
+
+func benchCandle(timestamp int64) models.CandleData {
+	return models.CandleData{Timestamp: timestamp, Values: [4]float64{100, 101, 99, 100.5}, Volume: 12.5, IsComplete: true}
+}
+
+// BenchmarkAppend measures appending to a full series, which drops its oldest candle
+func BenchmarkAppend(b *testing.B) {
+	s := fullSeries(*benchCandles)
+	next := int64(*benchCandles) * time.Minute.Milliseconds()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.Append(benchCandle(next))
+		next += time.Minute.Milliseconds()
+	}
+}
+
+// BenchmarkCandles measures copying the complete series
+func BenchmarkCandles(b *testing.B) {
+	s := fullSeries(*benchCandles)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.Candles()
+	}
+}
+
+// BenchmarkBetween measures copying an hour out of the middle of the series
+func BenchmarkBetween(b *testing.B) {
+	s := fullSeries(*benchCandles)
+	from := s.TimestampAt(*benchCandles / 2)
+	to := from + time.Hour.Milliseconds()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.Between(from, to)
+	}
+}
+
+// BenchmarkTail measures copying the newest candles, as the charts request them
+func BenchmarkTail(b *testing.B) {
+	s := fullSeries(*benchCandles)
+	to := s.TimestampAt(*benchCandles - 1)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.Tail(to, 300)
+	}
+}
@@ -0,0 +1,46 @@
+package version
+
+import (
+	"runtime"
+	"time"
+)
+
+// Build information, set at build time with
+//
+//	go build -ldflags "-X server/internal/version.Version=v1.2.3 -X server/internal/version.Commit=abc1234 -X server/internal/version.BuildTime=2024-01-01T00:00:00Z"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+// startTime is when the process started
+var startTime = time.Now()
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build information of the running binary
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// String returns a single line description of the build, used in logs
+func (i Info) String() string {
+	return i.Version + " (commit " + i.Commit + ", built " + i.BuildTime + ", " + i.GoVersion + ")"
+}
+
+// Uptime returns how long the process has been running
+func Uptime() time.Duration {
+	return time.Since(startTime)
+}
@@ -0,0 +1,115 @@
+// Package webui serves the production build of the frontend embedded in the binary, so
+// small deployments need only one process. Binaries built without running make frontend
+// first embed no build and don't serve the frontend.
+package webui
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// dist holds the frontend build, copied here by make frontend
+//
+//go:embed all:dist
+var dist embed.FS
+
+// indexFile is the page of the frontend, answering every route of its router
+const indexFile = "index.html"
+
+// Cache lifetimes. Vite puts a hash of their content into the names of the files in
+// assets, so they never change, while index.html must be revalidated to pick up a new build.
+const (
+	immutableCache = "public, max-age=31536000, immutable"
+	staticCache    = "public, max-age=3600"
+	revalidate     = "no-cache"
+)
+
+// ErrNotBuilt is returned if the binary was built without the frontend
+var ErrNotBuilt = errors.New("frontend not embedded, build it with make frontend first")
+
+// file is an embedded file with the entity tag derived from its content
+type file struct {
+	data []byte
+	etag string
+}
+
+// Handler serves the embedded frontend
+type Handler struct {
+	files map[string]file
+}
+
+// NewHandler loads the embedded frontend build
+func NewHandler() (*Handler, error) {
+	root, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil, err
+	}
+	h := &Handler{files: make(map[string]file)}
+	err = fs.WalkDir(root, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || name == ".gitkeep" {
+			return err
+		}
+		data, err := fs.ReadFile(root, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		h.files[name] = file{data: data, etag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := h.files[indexFile]; !ok {
+		return nil, ErrNotBuilt
+	}
+	return h, nil
+}
+
+// ServeHTTP serves the file at the request path. Pages the frontend's router handles in
+// the browser don't exist as files, so requests for HTML without a file extension get
+// index.html instead of 404, and the frontend shows the page of the path.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = indexFile
+	}
+	f, ok := h.files[name]
+	if !ok {
+		if path.Ext(name) != "" || !acceptsHTML(r) {
+			http.NotFound(w, r)
+			return
+		}
+		name, f = indexFile, h.files[indexFile]
+	}
+
+	w.Header().Set("Cache-Control", cacheControl(name))
+	w.Header().Set("ETag", f.etag)
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(f.data))
+}
+
+// cacheControl returns how long browsers may cache a file
+func cacheControl(name string) string {
+	switch {
+	case name == indexFile:
+		return revalidate
+	case strings.HasPrefix(name, "assets/"):
+		return immutableCache
+	default:
+		return staticCache
+	}
+}
+
+// acceptsHTML reports whether a request comes from a browser navigating to a page, rather
+// than a script requesting data from a route that doesn't exist
+func acceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
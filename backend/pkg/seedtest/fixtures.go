@@ -0,0 +1,190 @@
+package seedtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"server/internal/config"
+	"server/internal/models"
+	"server/internal/service"
+	"server/pkg/seedventure"
+)
+
+// UpdateGoldenEnv is the environment variable that makes AssertGolden rewrite the golden
+// files instead of comparing with them, after an intended change of the serialization
+const UpdateGoldenEnv = "SEEDTEST_UPDATE_GOLDEN"
+
+// fixtureCandles is the number of candles kept per timeframe in fixtures
+const fixtureCandles = 100
+
+// Fixtures are candles and messages generated from a fixed seed, the same on every run
+type Fixtures struct {
+	Candles map[seedventure.TimeFrame][]seedventure.CandleData // The last candles of a day of history
+	Updates []seedventure.UpdateMessage                        // Every update of two live candles after the history, as sent to clients
+	Deltas  []models.DeltaMessage                              // Delta frames between the 1-minute updates of the first live candle
+}
+
+// NewFixtures generates a day of history from seed at Start, keeping the last 100
+// candles of every timeframe, followed by two live candles
+func NewFixtures(seed int64) (*Fixtures, error) {
+	dir, err := os.MkdirTemp("", "seedtest-fixtures-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.Default()
+	cfg.Data.Dir = dir
+	cfg.Data.MaxCandles = fixtureCandles
+	cfg.Simulation.Seed = seed
+
+	clock := NewClock(Start)
+	ps := service.NewPriceService(cfg)
+	ps.SetClock(clock.Now)
+
+	var lock sync.Mutex
+	var updates []models.UpdateMessage
+	ps.OnUpdate(func(message models.UpdateMessage) {
+		lock.Lock()
+		updates = append(updates, message)
+		lock.Unlock()
+	})
+
+	f := &Fixtures{Candles: make(map[models.TimeFrame][]models.CandleData)}
+	ps.Initialize(1)
+	for _, tf := range models.AllTimeFrames() {
+		f.Candles[tf] = ps.GetHistoryForTimeFrame(tf)
+	}
+
+	ps.StartNewCandle()
+	for candle := 0; candle < 2; candle++ {
+		for tick := 0; tick < 5; tick++ {
+			clock.Advance(10 * time.Second)
+			ps.UpdateCurrentCandle()
+		}
+		clock.Set(clock.Now().Truncate(time.Minute).Add(time.Minute))
+		ps.FinalizeCurrentCandle()
+		ps.StartNewCandle()
+	}
+	if err := ps.Stop(); err != nil {
+		return nil, err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	f.Updates = updates
+	var prev *models.UpdateMessage
+	for i, message := range updates {
+		if message.TimeFrame != models.TimeFrame1Min {
+			continue
+		}
+		if prev != nil && message.Type == "update" && prev.Candle.Timestamp == message.Candle.Timestamp && !message.Candle.IsComplete {
+			f.Deltas = append(f.Deltas, models.NewDeltaMessage(models.TimeFrame1Min, prev.Candle, message.Candle))
+		}
+		prev = &updates[i]
+	}
+
+	// Golden files of inconsistent candles would make clients expect them
+	for tf, candles := range f.Candles {
+		for _, candle := range candles {
+			if err := candle.CheckOHLC(); err != nil {
+				return nil, fmt.Errorf("%s candle at %d: %w", tf, candle.Timestamp, err)
+			}
+		}
+	}
+	for _, message := range f.Updates {
+		if err := message.Candle.CheckOHLC(); err != nil {
+			return nil, fmt.Errorf("%s update at %d: %w", message.TimeFrame, message.Candle.Timestamp, err)
+		}
+	}
+	return f, nil
+}
+
+// Files returns the fixtures as golden files by name: candles-<timeframe>.json for
+// every timeframe, updates.json and deltas.json
+func (f *Fixtures) Files() (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	add := func(name string, v interface{}) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		files[name] = append(data, '\n')
+		return nil
+	}
+
+	for tf, candles := range f.Candles {
+		if err := add("candles-"+string(tf)+".json", candles); err != nil {
+			return nil, err
+		}
+	}
+	if err := add("updates.json", f.Updates); err != nil {
+		return nil, err
+	}
+	if err := add("deltas.json", f.Deltas); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// WriteGolden writes the golden files of the fixtures to dir
+func (f *Fixtures) WriteGolden(dir string) error {
+	files, err := f.Files()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AssertGolden fails the test for every golden file in dir that differs from the fixtures
+// generated from seed, so changes of the serialization of candles and messages don't go
+// unnoticed. With UpdateGoldenEnv set it rewrites the files instead.
+func AssertGolden(tb testing.TB, dir string, seed int64) {
+	tb.Helper()
+	f, err := NewFixtures(seed)
+	if err != nil {
+		tb.Fatalf("seedtest: generating fixtures: %v", err)
+	}
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := f.WriteGolden(dir); err != nil {
+			tb.Fatalf("seedtest: writing golden files: %v", err)
+		}
+		return
+	}
+
+	files, err := f.Files()
+	if err != nil {
+		tb.Fatalf("seedtest: %v", err)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		want, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			tb.Errorf("seedtest: reading golden file: %v (set %s=1 to create it)", err, UpdateGoldenEnv)
+			continue
+		}
+		if !bytes.Equal(files[name], want) {
+			tb.Errorf("seedtest: %s differs from the golden file in %s (set %s=1 to update it)", name, dir, UpdateGoldenEnv)
+		}
+	}
+}
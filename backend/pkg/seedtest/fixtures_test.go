@@ -0,0 +1,13 @@
+package seedtest_test
+
+import (
+	"testing"
+
+	"server/pkg/seedtest"
+)
+
+// TestFixtures compares the fixtures of the default seed with the golden files. Set
+// SEEDTEST_UPDATE_GOLDEN=1 to rewrite them after an intended change to generation.
+func TestFixtures(t *testing.T) {
+	seedtest.AssertGolden(t, "testdata/golden", seedtest.DefaultSeed)
+}
@@ -0,0 +1,42 @@
+package seedtest_test
+
+import (
+	"testing"
+	"time"
+
+	"server/pkg/seedtest"
+	"server/pkg/seedventure"
+)
+
+// TestOHLCOverLongRuns generates weeks of history and then days of live candles with every
+// price model, crossing day boundaries, and checks that every candle of every timeframe
+// keeps its open and close between its low and high
+func TestOHLCOverLongRuns(t *testing.T) {
+	historyDays, liveDays := 30, 2
+	if testing.Short() {
+		historyDays, liveDays = 3, 1
+	}
+
+	for _, model := range seedventure.PriceModelNames() {
+		model := model
+		t.Run(model, func(t *testing.T) {
+			t.Parallel()
+			cfg := seedventure.DefaultConfig()
+			cfg.Simulation.Model = model
+			cfg.Simulation.BroadcastInterval = 10 * time.Second
+			h := seedtest.New(t, cfg)
+
+			// Start the live candles shortly before midnight, so they complete days
+			h.Clock.Set(seedtest.Start.Add(-10 * time.Minute))
+			h.Generate(historyDays)
+			h.AssertOHLC()
+			h.Candles(liveDays * 24 * 60)
+			h.AssertOHLC()
+
+			days := h.History(seedventure.TimeFrame1Day)
+			if len(days) < historyDays+liveDays {
+				t.Errorf("%d daily candles after %d days of history and %d live, want at least %d", len(days), historyDays, liveDays, historyDays+liveDays)
+			}
+		})
+	}
+}
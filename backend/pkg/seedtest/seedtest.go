@@ -0,0 +1,218 @@
+// Package seedtest runs the Seedventure simulator under the control of tests.
+//
+// A Harness wraps a simulator whose candles are timestamped by a fake clock and whose
+// prices come from a seeded generator. Nothing runs in the background: prices only move
+// when the test calls Tick, and candles only complete when it calls NextCandle, so tests
+// neither sleep nor depend on timing. The same seed and the same calls produce the same
+// candles on every run.
+package seedtest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"server/internal/config"
+	"server/internal/models"
+	"server/internal/service"
+	"server/pkg/seedventure"
+)
+
+// Start is the time of the fake clock of a new harness
+var Start = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// DefaultSeed seeds the price generator of harnesses configured without a seed
+const DefaultSeed = 1
+
+// Clock is a fake clock that only moves when told to. It is safe for concurrent use.
+type Clock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+// NewClock creates a clock standing at now
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the time of the clock
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *Clock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to now
+func (c *Clock) Set(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = now
+}
+
+// Harness is a simulator driven step by step by a test
+type Harness struct {
+	Clock *Clock
+
+	tb      testing.TB
+	service *service.PriceService
+	ticks   int // Ticks per candle, from the broadcast interval
+
+	lock    sync.Mutex
+	updates []seedventure.UpdateMessage
+}
+
+// New creates a harness from a configuration, nil for the defaults, keeping its data in
+// a temporary directory removed with the test. A configuration without a seed uses
+// DefaultSeed. The harness starts without history and with a new candle at Start.
+func New(tb testing.TB, cfg *seedventure.Config) *Harness {
+	tb.Helper()
+	if cfg == nil {
+		cfg = config.Default()
+	} else {
+		copied := *cfg
+		cfg = &copied
+	}
+	cfg.Data.Dir = tb.TempDir()
+	if cfg.Simulation.Seed == 0 {
+		cfg.Simulation.Seed = DefaultSeed
+	}
+	if err := cfg.Validate(); err != nil {
+		tb.Fatalf("seedtest: invalid configuration: %v", err)
+	}
+
+	h := &Harness{
+		Clock:   NewClock(Start),
+		tb:      tb,
+		service: service.NewPriceService(cfg),
+		ticks:   int(time.Minute / cfg.Simulation.BroadcastInterval),
+	}
+	if h.ticks < 1 {
+		h.ticks = 1
+	}
+	h.service.SetClock(h.Clock.Now)
+	h.service.OnUpdate(func(message models.UpdateMessage) {
+		h.lock.Lock()
+		h.updates = append(h.updates, message)
+		h.lock.Unlock()
+	})
+	h.service.StartNewCandle()
+	h.service.MarkReady()
+
+	tb.Cleanup(func() {
+		// Stopping saves every timeframe, which fails for those without candles yet
+		if err := h.service.Stop(); err != nil && h.hasCandles() {
+			tb.Errorf("seedtest: stopping the simulator: %v", err)
+		}
+	})
+	return h
+}
+
+// hasCandles reports whether every timeframe has candles
+func (h *Harness) hasCandles() bool {
+	for _, tf := range seedventure.AllTimeFrames() {
+		if len(h.History(tf)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Generate replaces the history with days of generated candles ending before the clock's
+// current minute, and starts a new candle at it
+func (h *Harness) Generate(days int) {
+	h.service.Initialize(days)
+	h.service.StartNewCandle()
+}
+
+// Tick moves the price of the current candle once, as the server does every broadcast
+// interval, and advances the clock by it
+func (h *Harness) Tick() {
+	h.Clock.Advance(time.Minute / time.Duration(h.ticks))
+	h.service.UpdateCurrentCandle()
+}
+
+// NextCandle completes the current candle and starts the next one at the following
+// minute, moving the clock there
+func (h *Harness) NextCandle() {
+	now := h.Clock.Now()
+	h.Clock.Set(now.Truncate(time.Minute).Add(time.Minute))
+	h.service.FinalizeCurrentCandle()
+	h.service.StartNewCandle()
+}
+
+// Candles generates n complete candles, each with the ticks of one minute
+func (h *Harness) Candles(n int) {
+	for i := 0; i < n; i++ {
+		for t := 0; t < h.ticks-1; t++ {
+			h.Tick()
+		}
+		h.NextCandle()
+	}
+}
+
+// Current returns a copy of the candle in progress
+func (h *Harness) Current() seedventure.CandleData {
+	h.tb.Helper()
+	candle := h.service.GetCurrentCandle()
+	if candle == nil {
+		h.tb.Fatal("seedtest: no current candle")
+	}
+	return *candle
+}
+
+// History returns a copy of the candles of a timeframe, including the current 1-minute candle
+func (h *Harness) History(timeFrame seedventure.TimeFrame) []seedventure.CandleData {
+	return h.service.GetHistoryForTimeFrame(timeFrame)
+}
+
+// Updates returns the candle updates sent since the harness was created or the last
+// call of Updates, oldest first
+func (h *Harness) Updates() []seedventure.UpdateMessage {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	updates := h.updates
+	h.updates = nil
+	return updates
+}
+
+// UpdateParams changes price generation parameters, failing the test if they are invalid
+func (h *Harness) UpdateParams(update seedventure.SimulationUpdate) seedventure.SimulationParams {
+	h.tb.Helper()
+	params, err := h.service.UpdateSimulationParams(update)
+	if err != nil {
+		h.tb.Fatalf("seedtest: updating parameters: %v", err)
+	}
+	return params
+}
+
+// Hub returns the hub broadcasting the updates, to connect WebSocket clients to
+func (h *Harness) Hub() *seedventure.Hub {
+	return h.service.Hub()
+}
+
+// AssertOHLC fails the test for every candle whose open or close lies outside of its low
+// and high
+func AssertOHLC(tb testing.TB, candles []seedventure.CandleData) {
+	tb.Helper()
+	for i, candle := range candles {
+		if err := candle.CheckOHLC(); err != nil {
+			tb.Errorf("seedtest: candle %d at %s: %v", i, time.UnixMilli(candle.Timestamp).UTC().Format(time.RFC3339), err)
+		}
+	}
+}
+
+// AssertOHLC fails the test for every candle of any timeframe, including the one in
+// progress, whose open or close lies outside of its low and high
+func (h *Harness) AssertOHLC() {
+	h.tb.Helper()
+	for _, tf := range seedventure.AllTimeFrames() {
+		AssertOHLC(h.tb, h.History(tf))
+	}
+}
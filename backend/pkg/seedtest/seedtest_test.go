@@ -0,0 +1,123 @@
+package seedtest_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"server/pkg/seedtest"
+	"server/pkg/seedventure"
+)
+
+func TestClock(t *testing.T) {
+	clock := seedtest.NewClock(seedtest.Start)
+	if now := clock.Now(); !now.Equal(seedtest.Start) {
+		t.Fatalf("new clock at %s, want %s", now, seedtest.Start)
+	}
+	clock.Advance(90 * time.Second)
+	if now, want := clock.Now(), seedtest.Start.Add(90*time.Second); !now.Equal(want) {
+		t.Fatalf("advanced clock at %s, want %s", now, want)
+	}
+	clock.Set(seedtest.Start)
+	if now := clock.Now(); !now.Equal(seedtest.Start) {
+		t.Fatalf("set clock at %s, want %s", now, seedtest.Start)
+	}
+}
+
+func TestTickAndNextCandle(t *testing.T) {
+	h := seedtest.New(t, nil)
+	if current := h.Current(); current.Timestamp != seedtest.Start.UnixMilli() || current.IsComplete {
+		t.Fatalf("first candle %+v, want one in progress at %s", current, seedtest.Start)
+	}
+
+	h.Tick()
+	h.Tick()
+	if now := h.Clock.Now(); !now.After(seedtest.Start) || now.Sub(seedtest.Start) >= time.Minute {
+		t.Fatalf("clock at %s after two ticks, want within the first minute", now)
+	}
+	updates := h.Updates()
+	if len(updates) == 0 {
+		t.Fatal("no updates after two ticks")
+	}
+	if last := updates[len(updates)-1]; last.Candle.Timestamp != seedtest.Start.UnixMilli() {
+		t.Fatalf("last update of candle %d, want %d", last.Candle.Timestamp, seedtest.Start.UnixMilli())
+	}
+	if updates := h.Updates(); len(updates) != 0 {
+		t.Fatalf("got %d updates again, want them cleared", len(updates))
+	}
+
+	h.NextCandle()
+	next := seedtest.Start.Add(time.Minute)
+	if now := h.Clock.Now(); !now.Equal(next) {
+		t.Fatalf("clock at %s after the next candle, want %s", now, next)
+	}
+	if current := h.Current(); current.Timestamp != next.UnixMilli() {
+		t.Fatalf("current candle at %d, want %d", current.Timestamp, next.UnixMilli())
+	}
+	history := h.History(seedventure.TimeFrame1Min)
+	if len(history) < 2 || !history[len(history)-2].IsComplete {
+		t.Fatalf("got 1m history %+v, want the first candle completed", history)
+	}
+	h.AssertOHLC()
+}
+
+// run generates a day of history and a few live candles with a harness of seed
+func run(t *testing.T, seed int64) ([]seedventure.CandleData, []seedventure.UpdateMessage) {
+	cfg := seedventure.DefaultConfig()
+	cfg.Simulation.Seed = seed
+	h := seedtest.New(t, cfg)
+	h.Clock.Set(seedtest.Start.Add(-5 * time.Minute))
+	h.Generate(1)
+	h.Candles(5)
+	return h.History(seedventure.TimeFrame1Min), h.Updates()
+}
+
+func TestHarnessIsDeterministic(t *testing.T) {
+	candles, updates := run(t, seedtest.DefaultSeed)
+	again, againUpdates := run(t, seedtest.DefaultSeed)
+	if !reflect.DeepEqual(candles, again) {
+		t.Error("the same seed generated different candles")
+	}
+	if !reflect.DeepEqual(updates, againUpdates) {
+		t.Error("the same seed sent different updates")
+	}
+
+	other, _ := run(t, seedtest.DefaultSeed+1)
+	if reflect.DeepEqual(candles, other) {
+		t.Error("different seeds generated the same candles")
+	}
+}
+
+func TestUpdateParams(t *testing.T) {
+	h := seedtest.New(t, nil)
+	volatility := 0.25
+	if params := h.UpdateParams(seedventure.SimulationUpdate{Volatility: &volatility}); params.Volatility != volatility {
+		t.Fatalf("volatility %v after the update, want %v", params.Volatility, volatility)
+	}
+}
+
+// recorder is a testing.TB that records errors instead of failing
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertOHLC(t *testing.T) {
+	candles := []seedventure.CandleData{
+		{Timestamp: seedtest.Start.UnixMilli(), Values: [4]float64{10, 12, 9, 11}},
+		{Timestamp: seedtest.Start.Add(time.Minute).UnixMilli(), Values: [4]float64{11, 12, 10, 13}},
+		{Timestamp: seedtest.Start.Add(2 * time.Minute).UnixMilli(), Values: [4]float64{8, 12, 9, 11}},
+	}
+	r := &recorder{TB: t}
+	seedtest.AssertOHLC(r, candles)
+	if len(r.errors) != 2 {
+		t.Fatalf("got errors %q, want one for each of the last two candles", r.errors)
+	}
+}
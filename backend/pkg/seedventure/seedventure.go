@@ -0,0 +1,163 @@
+// Package seedventure embeds the Seedventure market simulator in other Go programs.
+//
+// The simulator generates candles for every timeframe, stores them in the data
+// directory and broadcasts updates to WebSocket clients, exactly like the server,
+// but without listening for HTTP requests. The types below are the stable API of
+// the simulator; the packages under internal/ may change between releases.
+package seedventure
+
+import (
+	"server/internal/config"
+	"server/internal/models"
+	"server/internal/service"
+)
+
+// Configuration and data types shared with the server
+type (
+	Config           = config.Config
+	TimeFrame        = models.TimeFrame
+	CandleData       = models.CandleData
+	UpdateMessage    = models.UpdateMessage
+	SimulationParams = models.SimulationParams
+	SimulationUpdate = models.SimulationUpdate
+	Stats            = models.Stats
+)
+
+// Price models
+type (
+	PriceModel        = models.PriceModel
+	PriceModelFunc    = models.PriceModelFunc
+	PriceModelFactory = models.PriceModelFactory
+)
+
+// Broadcast hub, for serving the simulator's updates over WebSocket connections
+type (
+	Hub    = service.Hub
+	Client = service.Client
+)
+
+// Available timeframes
+const (
+	TimeFrame1Min  = models.TimeFrame1Min
+	TimeFrame5Min  = models.TimeFrame5Min
+	TimeFrame15Min = models.TimeFrame15Min
+	TimeFrame1Hour = models.TimeFrame1Hour
+	TimeFrame4Hour = models.TimeFrame4Hour
+	TimeFrame1Day  = models.TimeFrame1Day
+)
+
+// Built-in price models
+const (
+	PriceModelRandomWalk    = models.PriceModelRandomWalk
+	PriceModelMeanReverting = models.PriceModelMeanReverting
+)
+
+// DefaultConfig returns the configuration the server uses when nothing else is specified
+func DefaultConfig() *Config {
+	return config.Default()
+}
+
+// AllTimeFrames returns every supported timeframe, shortest first
+func AllTimeFrames() []TimeFrame {
+	return models.AllTimeFrames()
+}
+
+// PriceModelNames returns the names of all available price models
+func PriceModelNames() []string {
+	return models.PriceModelNames()
+}
+
+// RegisterPriceModel makes a price model available under name, to be selected with
+// simulation.model. It panics if the name is empty or already taken.
+func RegisterPriceModel(name string, factory PriceModelFactory) {
+	models.RegisterPriceModel(name, factory)
+}
+
+// NewHub creates a hub whose broadcasts are written by the given number of goroutines
+func NewHub(writers int) *Hub {
+	return service.NewHub(writers)
+}
+
+// Simulator is an embedded market simulator
+type Simulator struct {
+	service *service.PriceService
+}
+
+// New creates a simulator from a configuration, nil for the defaults. History is loaded
+// from the data directory, or generated for historyDays days and saved if there is none.
+func New(cfg *Config, historyDays int) (*Simulator, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	ps := service.NewPriceService(cfg)
+	ps.LoadOrInitialize(historyDays)
+	ps.StartNewCandle()
+
+	return &Simulator{service: ps}, nil
+}
+
+// Start generates prices in the background until Stop is called
+func (s *Simulator) Start() {
+	go s.service.Run()
+	s.service.MarkReady()
+}
+
+// Stop ends price generation and saves all timeframes
+func (s *Simulator) Stop() error {
+	return s.service.Stop()
+}
+
+// OnUpdate registers fn to be called with every candle update, in the order they
+// happen. fn runs on the goroutine generating prices and must not block.
+func (s *Simulator) OnUpdate(fn func(UpdateMessage)) {
+	s.service.OnUpdate(fn)
+}
+
+// History returns a copy of the candles of a timeframe, including the current 1-minute candle
+func (s *Simulator) History(timeFrame TimeFrame) []CandleData {
+	return s.service.GetHistoryForTimeFrame(timeFrame)
+}
+
+// HistoryRange returns the candles of a timeframe with timestamps in [from, to], in Unix milliseconds
+func (s *Simulator) HistoryRange(timeFrame TimeFrame, from, to int64) []CandleData {
+	return s.service.GetHistoryRange(timeFrame, from, to)
+}
+
+// CurrentCandle returns a copy of the candle in progress, nil if there is none
+func (s *Simulator) CurrentCandle() *CandleData {
+	return s.service.GetCurrentCandle()
+}
+
+// Params returns the current price generation parameters
+func (s *Simulator) Params() SimulationParams {
+	return s.service.GetSimulationParams()
+}
+
+// UpdateParams changes price generation parameters while running
+func (s *Simulator) UpdateParams(update SimulationUpdate) (SimulationParams, error) {
+	return s.service.UpdateSimulationParams(update)
+}
+
+// Pause stops price generation until Resume is called
+func (s *Simulator) Pause() {
+	s.service.Pause()
+}
+
+// Resume continues price generation after Pause
+func (s *Simulator) Resume() {
+	s.service.Resume()
+}
+
+// Stats returns statistics about connections, storage and memory
+func (s *Simulator) Stats() Stats {
+	return s.service.GetStats()
+}
+
+// Hub returns the hub broadcasting the simulator's updates, to register WebSocket connections with
+func (s *Simulator) Hub() *Hub {
+	return s.service.Hub()
+}
@@ -5,11 +5,16 @@ import { useWebSocket } from "./useWebSocket.js";
  * @returns {Object} Price WebSocket utilities
  */
 export function usePriceWebSocket() {
-  // Base WebSocket URL
-  const WS_BASE_URL = "ws://localhost:8080/api/prices/live";
-
-  // Create base WebSocket composable
-  const websocket = useWebSocket(WS_BASE_URL);
+  // Base WebSocket URL, on the backend serving the production build
+  const WS_ORIGIN = import.meta.env.DEV
+    ? "ws://localhost:8080"
+    : `${window.location.protocol === "https:" ? "wss:" : "ws:"}//${window.location.host}`;
+  const NAMESPACE_PREFIX =
+    window.location.pathname.match(/^\/ns\/[^/]+/)?.[0] ?? "";
+  const WS_BASE_URL = `${WS_ORIGIN}${NAMESPACE_PREFIX}/api/prices/live`;
+
+  // Create base WebSocket composable, receiving delta frames for intra-candle updates
+  const websocket = useWebSocket(WS_BASE_URL, "?deltas=true");
 
   /**
    * Connect to the price WebSocket
@@ -3,9 +3,10 @@ import { ref, onUnmounted } from "vue";
 /**
  * A composable for managing WebSocket connections
  * @param {string} baseUrl - The base WebSocket URL
+ * @param {string} query - Query string appended to every connection URL
  * @returns {Object} WebSocket utilities
  */
-export function useWebSocket(baseUrl) {
+export function useWebSocket(baseUrl, query = "") {
   const connectionStatus = ref("disconnected");
   const error = ref(null);
   let socket = null;
@@ -30,7 +31,7 @@ export function useWebSocket(baseUrl) {
 
     try {
       // Construct WebSocket URL
-      const url = path ? `${baseUrl}/${path}` : baseUrl;
+      const url = (path ? `${baseUrl}/${path}` : baseUrl) + query;
 
       // Create WebSocket
       socket = new WebSocket(url);
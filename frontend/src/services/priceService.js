@@ -2,8 +2,14 @@
  * API service for price data
  */
 
-// API URL constants
-const API_BASE_URL = "http://localhost:8080/api";
+// API URL constants. The production build is served by the backend itself, while the
+// dev server talks to a backend running next to it.
+const API_ORIGIN = import.meta.env.DEV
+  ? "http://localhost:8080"
+  : window.location.origin;
+// Simulations other than the default one are served under /ns/<name>
+const NAMESPACE_PREFIX = window.location.pathname.match(/^\/ns\/[^/]+/)?.[0] ?? "";
+const API_BASE_URL = `${API_ORIGIN}${NAMESPACE_PREFIX}/api`;
 const PRICES_ENDPOINT = `${API_BASE_URL}/prices`;
 
 /**
@@ -27,6 +27,10 @@ const state = reactive({
   isPositiveChange: false,
   isLoading: true,
   error: null,
+  tradingHalted: false,
+  haltReason: "",
+  openCancelled: null,
+  cashFlow: null,
 });
 
 // Debounce timer
@@ -71,15 +75,52 @@ function debounceUIUpdate(isTimeframeData = false, timeFrame = null) {
   }, DEBOUNCE_TIME);
 }
 
+// Apply a delta frame, which only carries the fields that changed, to its candle
+function applyDelta(delta) {
+  const index = candles.value.findIndex((item) => item.x === delta.x);
+  if (index < 0) return;
+
+  const [open, high, low] = candles.value[index].y;
+  const updatedCandles = [...candles.value];
+  updatedCandles[index] = {
+    x: delta.x,
+    y: [open, delta.h ?? high, delta.l ?? low, delta.c],
+  };
+  candles.value = updatedCandles;
+}
+
 // Process WebSocket messages
 function processWebSocketMessage(message) {
+  // Handle server status changes, such as trading halts and holidays
+  if (message.type === "status") {
+    state.tradingHalted =
+      message.status === "trading_halted" || message.status === "closed";
+    state.haltReason = state.tradingHalted ? message.message || "" : "";
+    // A new object for every halt that cancels open positions, even while still halted
+    if (state.tradingHalted && message.cancelOpen) {
+      state.openCancelled = { reason: state.haltReason };
+    }
+  }
+  // Handle deposits, withdrawals and interest, applied to the player's cash
+  else if (message.type === "cash") {
+    state.cashFlow = message.flow;
+  }
+  // Handle delta frames for the current candle
+  else if (
+    message.type === "delta" &&
+    message.timeFrame === state.selectedTimeframe
+  ) {
+    applyDelta(message);
+    debounceUIUpdate();
+  }
   // Handle candle updates
-  if (message.type && message.timeFrame === state.selectedTimeframe) {
+  else if (message.type && message.timeFrame === state.selectedTimeframe) {
     const { type, candle } = message;
     const formattedCandle = { x: candle.x, y: candle.y };
 
-    // Update or add candle
-    if (type === "update") {
+    // Update or add candle. History includes the candle in progress, so a new candle
+    // of a longer timeframe may already be shown.
+    if (type === "update" || type === "new") {
       const index = candles.value.findIndex((item) => item.x === candle.x);
 
       if (index >= 0) {
@@ -91,8 +132,6 @@ function processWebSocketMessage(message) {
         // Add as new candle
         addCandle(formattedCandle);
       }
-    } else if (type === "new") {
-      addCandle(formattedCandle);
     }
 
     // Debounce UI updates